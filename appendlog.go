@@ -0,0 +1,944 @@
+package jellyzset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Append-only log layout, version 1:
+//
+//	magic "JZAOF" | version byte
+//	for each record: payload length as an unsigned varint | payload | CRC-32 (Castagnoli) of the payload, as 4 big-endian bytes
+//
+// A payload is an operation byte and a key, followed by the arguments of the operation encoded as in a
+// snapshot. Mutations are recorded by their effect rather than as they were called, so that replaying
+// them gives the same result even when a member was handed to a caller blocked in BZPopMin or BZPopMax.
+// The mutations of a transaction are nested in a single aofMulti record, so that they are replayed together.
+const (
+	appendLogMagic   = "JZAOF"
+	appendLogVersion = 1
+)
+
+// Operations recorded in the append-only log.
+const (
+	aofAdd             = iota + 1 // Set the score and value of members, adding them if needed
+	aofRem                        // Remove members
+	aofRemRangeByRank             // Remove the members between two ranks
+	aofRemRangeByScore            // Remove the members between two score bounds
+	aofRemRangeByLex              // Remove the members between two lexicographic bounds
+	aofDel                        // Remove a key
+	aofStore                      // Replace a key with a sorted set holding the given members
+	aofFlush                      // Remove every key
+	aofExpire                     // Set the deadline of a key
+	aofPersist                    // Remove the deadline of a key
+	aofExpireMember               // Set the deadline of a member
+	aofPersistMember              // Remove the deadline of a member
+	aofMulti                      // Apply the records of a transaction
+)
+
+var (
+	// ErrInvalidAppendLog is returned by OpenAppendLog when the log is not an append-only log or a record
+	// other than the last one is damaged.
+	ErrInvalidAppendLog = errors.New("invalid or corrupted append-only log")
+
+	// ErrAppendLogOpen is returned by OpenAppendLog when an append-only log is already open.
+	ErrAppendLogOpen = errors.New("append-only log already open")
+
+	// ErrAppendLogNotOpen is returned when an append-only log operation is used while no log is open.
+	ErrAppendLogNotOpen = errors.New("append-only log not open")
+
+	// ErrRewriteInProgress is returned by RewriteAppendLog when a rewrite is already running.
+	ErrRewriteInProgress = errors.New("append-only log rewrite already in progress")
+)
+
+// FsyncPolicy selects how often the append-only log is flushed to stable storage, mirroring the Redis
+// appendfsync setting. Records are always written to the file as soon as they are made, so only an
+// operating system crash or power loss can lose the writes since the last fsync.
+type FsyncPolicy int
+
+const (
+	FsyncEverySec FsyncPolicy = iota // Fsync once per second, losing at most one second of writes
+	FsyncAlways                      // Fsync after every record, the safest and slowest policy
+	FsyncNo                          // Never fsync, leaving it to the operating system
+)
+
+// AppendLogOptions specifies the behaviour of the append-only log opened by OpenAppendLog.
+type AppendLogOptions struct {
+	Fsync FsyncPolicy // How often the log is flushed to stable storage, FsyncEverySec by default
+
+	// RewritePercentage starts a background RewriteAppendLog once the log has grown by this percentage
+	// since it was opened or last rewritten, as the Redis auto-aof-rewrite-percentage setting. 0 disables it.
+	RewritePercentage int
+
+	// RewriteMinSize is the size in bytes below which the log is never rewritten automatically.
+	RewriteMinSize int64
+}
+
+// appendLog is an open append-only log file, shared by the mutators that record into it.
+type appendLog struct {
+	mu             sync.Mutex
+	path           string
+	file           *os.File
+	opts           AppendLogOptions
+	size           int64         // Size of the file
+	baseSize       int64         // Size of the file when it was opened or last rewritten
+	dirty          bool          // Whether records were written since the last fsync
+	err            error         // First error met while recording; records are no longer written to the file once set
+	rewriting      bool          // Whether a rewrite is running
+	rewritePending bool          // Whether an automatic rewrite was started but has not begun yet
+	rewriteBuf     bytes.Buffer  // Records made while a rewrite is running, appended to the rewritten log
+	rewriteErr     error         // First error met while recording during the running rewrite
+	closed         bool          // Whether the log was closed
+	done           chan struct{} // Closed to stop the goroutine that fsyncs every second
+}
+
+// logRecord is a mutation recorded in the append-only log.
+type logRecord[V any] struct {
+	op             byte
+	key            string
+	entries        []Entry[V]     // Members set by aofAdd or stored by aofStore
+	members        []string       // Members removed by aofRem, or the member of aofExpireMember and aofPersistMember
+	start, stop    int            // Ranks of aofRemRangeByRank
+	min, max       ScoreBound     // Bounds of aofRemRangeByScore
+	minLex, maxLex LexBound       // Bounds of aofRemRangeByLex
+	deadline       time.Time      // Deadline set by aofExpire or aofExpireMember
+	batch          []logRecord[V] // Records applied together by aofMulti
+}
+
+// keyEntries holds the members of a sorted set apart from the ZSet, as copied to rewrite the append-only log or read from an RDB file.
+type keyEntries[V any] struct {
+	key      string
+	entries  []Entry[V]
+	deadline time.Time        // When the key expires, zero if it never does
+	expiries []memberDeadline // Deadlines of the members that expire
+}
+
+// OpenAppendLog opens the append-only log at the given path and records every later mutation of the ZSet
+// into it, so that the ZSet can be restored after a restart by opening the same log again.
+//
+// If the log holds records, they are replayed and their result replaces the contents of the ZSet; callers
+// blocked in BZPopMin or BZPopMax are then served from the restored keys. A final record cut short by a
+// crash is discarded and truncated away, while damage anywhere else is reported as ErrInvalidAppendLog and
+// leaves the ZSet unchanged. If the log does not exist or is empty, it is created holding the current
+// contents of the ZSet. Values are encoded with the codec set by SetValueCodec.
+//
+// A mutation that cannot be recorded, because its value cannot be encoded or the file cannot be written,
+// stops the recording of later mutations until the log is rewritten; the error is reported by
+// SyncAppendLog, RewriteAppendLog and CloseAppendLog.
+//
+// Parameters:
+//   - path: The path of the log file.
+//   - opts: The fsync policy and the automatic rewrite settings.
+//
+// Returns:
+//   - ErrAppendLogOpen if a log is already open, ErrInvalidAppendLog if the log is damaged, or an error
+//     from the codec or the file system.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	err := zset.OpenAppendLog("zset.aof", jellyzset.AppendLogOptions{Fsync: jellyzset.FsyncEverySec})
+//	zset.ZAdd("leaderboard", 3.5, "member1", "value1")
+//	err = zset.CloseAppendLog()
+//
+// In this example, the ZAdd is recorded in "zset.aof", and opening the log again after a restart restores "leaderboard".
+func (z *TypedZSet[V]) OpenAppendLog(path string, opts AppendLogOptions) error {
+	z.mu.RLock()
+	open, codec := z.aof != nil, z.codec
+	z.mu.RUnlock()
+
+	if open {
+		return ErrAppendLogOpen
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+
+	log, replayed, err := openAppendLog(file, path, opts, codec)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if z.aof != nil {
+		file.Close()
+		return ErrAppendLogOpen
+	}
+
+	if replayed == nil {
+		// A new log starts from the current contents, so that replaying it gives the ZSet as it is now
+		if err := initLog(log, z.dump(), codec); err != nil {
+			file.Close()
+			return err
+		}
+	} else {
+		z.setRecords(replayed.records)
+		z.volatile, z.expiring = replayed.volatile, replayed.expiring
+		z.startSweeper()
+	}
+
+	log.start()
+	z.aof = log
+
+	for key, set := range z.records {
+		set.mu.Lock()
+		z.serveWaiters(key, set)
+		set.mu.Unlock()
+	}
+
+	return nil
+}
+
+// RewriteAppendLog replaces the append-only log with a minimal log holding one record per key, built from
+// the current contents of the ZSet, like the Redis BGREWRITEAOF command.
+//
+// The contents are copied while the keyspace is briefly locked, and the new log is written to a temporary
+// file while the ZSet keeps serving reads and writes. Mutations made in the meantime are recorded in both
+// the current log and a buffer, which is appended to the new log before it atomically replaces the current
+// one. It is started automatically in the background when AppendLogOptions.RewritePercentage is set.
+//
+// Returns:
+//   - ErrAppendLogNotOpen if no log is open or it is closed before the rewrite completes,
+//     ErrRewriteInProgress if a rewrite is already running, or an error from the codec or the file system.
+//     On error the current log is kept.
+//
+// Example:
+//
+//	for i := 0; i < 1000; i++ {
+//		zset.ZIncrBy("counters", 1, "visits")
+//	}
+//	err := zset.RewriteAppendLog()
+//
+// In this example, the thousand records of the increments are replaced by a single record holding "visits" with a score of 1000.
+func (z *TypedZSet[V]) RewriteAppendLog() error {
+	z.mu.Lock()
+	log := z.aof
+	if log == nil {
+		z.mu.Unlock()
+		return ErrAppendLogNotOpen
+	}
+
+	if err := log.beginRewrite(); err != nil {
+		z.mu.Unlock()
+		return err
+	}
+
+	codec, contents := z.codec, z.dump()
+	z.mu.Unlock()
+
+	return rewriteLog(log, contents, codec)
+}
+
+// SyncAppendLog flushes the append-only log to stable storage, whatever its fsync policy.
+//
+// Returns:
+//   - ErrAppendLogNotOpen if no log is open, or the first error met while recording mutations.
+func (z *TypedZSet[V]) SyncAppendLog() error {
+	z.mu.RLock()
+	log := z.aof
+	z.mu.RUnlock()
+
+	if log == nil {
+		return ErrAppendLogNotOpen
+	}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	log.sync()
+	return log.err
+}
+
+// CloseAppendLog flushes and closes the append-only log. Later mutations are no longer recorded.
+//
+// Returns:
+//   - ErrAppendLogNotOpen if no log is open, or the first error met while recording mutations or closing the file.
+func (z *TypedZSet[V]) CloseAppendLog() error {
+	z.mu.Lock()
+	log := z.aof
+	z.aof = nil
+	z.mu.Unlock()
+
+	if log == nil {
+		return ErrAppendLogNotOpen
+	}
+
+	return log.close()
+}
+
+// log records a mutation: it gives the key a new version, and appends the mutation to the append-only log if
+// one is open, or to the records of the running transaction. The caller must hold the keyspace lock or the
+// write lock of the mutated set, so that the records of each key are in the order of the mutations.
+func (z *TypedZSet[V]) log(rec logRecord[V]) {
+	z.changed(rec.key)
+	if z.aof == nil {
+		return
+	}
+
+	if z.txn != nil {
+		z.txn.records = append(z.txn.records, rec)
+		return
+	}
+	z.appendLog(rec)
+}
+
+// appendLog appends a record to the append-only log, which must be open, and starts an automatic rewrite if
+// the log has grown enough.
+func (z *TypedZSet[V]) appendLog(rec logRecord[V]) {
+	frame, err := encodeLogRecord(rec, z.codec)
+	if err != nil {
+		z.aof.fail(err)
+		return
+	}
+
+	if z.aof.write(frame) {
+		go z.RewriteAppendLog()
+	}
+}
+
+// logRemoved records the removal of the members of entries, if there are any.
+func (z *TypedZSet[V]) logRemoved(key string, entries []Entry[V]) {
+	if z.aof == nil || len(entries) == 0 {
+		return
+	}
+
+	members := make([]string, len(entries))
+	for i, e := range entries {
+		members[i] = e.Member
+	}
+	z.log(logRecord[V]{op: aofRem, key: key, members: members})
+}
+
+// dump copies the members and deadlines of every sorted set, in key order, leaving out the keys and members
+// past their deadline. The caller must hold the keyspace lock exclusively.
+func (z *TypedZSet[V]) dump() []keyEntries[V] {
+	now := z.clock.Now()
+	contents := make([]keyEntries[V], 0, len(z.records))
+	for key, set := range z.records {
+		if !set.expiredAt(now) && z.purgeKey(key, set) {
+			contents = append(contents, keyEntries[V]{
+				key:      key,
+				entries:  set.entries(),
+				deadline: set.deadline,
+				expiries: append([]memberDeadline(nil), set.expiries.deadlines...),
+			})
+		}
+	}
+
+	sort.Slice(contents, func(i, j int) bool { return contents[i].key < contents[j].key })
+	return contents
+}
+
+// replace replaces the sorted set at the given key with one holding members, which must be sorted by
+// score and member. Unlike store, the key is kept even when there are no members.
+func (z *TypedZSet[V]) replace(key string, members []Entry[V]) {
+	z.deleteKey(key)
+
+	set := z.getOrCreate(key)
+	for _, node := range set.zsl.build(members) {
+		set.remember(node)
+	}
+}
+
+// apply performs a replayed mutation.
+func (z *TypedZSet[V]) apply(rec logRecord[V]) {
+	switch rec.op {
+	case aofAdd:
+		z.ZAddMany(rec.key, rec.entries...)
+	case aofRem:
+		for _, member := range rec.members {
+			z.ZRem(rec.key, member)
+		}
+	case aofRemRangeByRank:
+		z.ZRemRangeByRank(rec.key, rec.start, rec.stop)
+	case aofRemRangeByScore:
+		z.ZRemRangeByScoreBounds(rec.key, rec.min, rec.max)
+	case aofRemRangeByLex:
+		z.ZRemRangeByLexBounds(rec.key, rec.minLex, rec.maxLex)
+	case aofDel:
+		z.ZClear(rec.key)
+	case aofStore:
+		z.replace(rec.key, rec.entries)
+	case aofFlush:
+		z.setRecords(make(map[string]*zset[V]))
+		z.volatile = make(map[string]*zset[V])
+		z.expiring = make(map[string]*zset[V])
+	case aofExpire, aofPersist:
+		// Deadlines that have passed are kept, so the key is removed as expired once the ZSet uses the log
+		if set, exists := z.records[rec.key]; exists {
+			z.setDeadline(rec.key, set, rec.deadline)
+		}
+	case aofExpireMember:
+		// Likewise, a member whose deadline has passed is removed once the ZSet uses the log
+		if set, exists := z.records[rec.key]; exists && set.records[rec.members[0]] != nil {
+			set.expiries.set(rec.members[0], rec.deadline)
+			z.expiring[rec.key] = set
+		}
+	case aofPersistMember:
+		if set, exists := z.records[rec.key]; exists {
+			set.expiries.remove(rec.members[0])
+		}
+	case aofMulti:
+		for _, nested := range rec.batch {
+			z.apply(nested)
+		}
+	}
+}
+
+// openAppendLog replays the log in file and positions it for appending. The returned TypedZSet holds the
+// replayed contents, or is nil when the log is new and still has to be given its header.
+func openAppendLog[V any](file *os.File, path string, opts AppendLogOptions, codec ValueCodec[V]) (*appendLog, *TypedZSet[V], error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	replayed, valid, err := replayAppendLog(bufio.NewReader(file), info.Size(), codec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Drop a final record cut short by a crash, or a partial header, so new records follow the last complete one
+	if valid < info.Size() {
+		if err := file.Truncate(valid); err != nil {
+			return nil, nil, err
+		}
+	}
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+
+	log := &appendLog{path: path, file: file, opts: opts, size: valid, baseSize: valid}
+	return log, replayed, nil
+}
+
+// replayAppendLog replays the records of a log of the given size into a new TypedZSet. It returns the
+// length of the log up to the end of its last complete record, and a nil TypedZSet if the log does not
+// even hold a complete header.
+func replayAppendLog[V any](r *bufio.Reader, size int64, codec ValueCodec[V]) (*TypedZSet[V], int64, error) {
+	header := make([]byte, len(appendLogMagic)+1)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, 0, err
+	}
+	if !bytes.HasPrefix([]byte(appendLogMagic), header[:min(n, len(appendLogMagic))]) {
+		return nil, 0, ErrInvalidAppendLog
+	}
+	if n < len(header) {
+		return nil, 0, nil
+	}
+	if header[len(appendLogMagic)] != appendLogVersion {
+		return nil, 0, ErrInvalidAppendLog
+	}
+
+	replayed := NewTyped[V]()
+	replayed.codec, replayed.clock = codec, replayClock{}
+
+	valid := int64(len(header))
+	for {
+		payload, length, err := readLogFrame(r, size-valid)
+		if err == io.EOF {
+			return replayed, valid, nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			// The final record was cut short, which is what a crash in the middle of a write leaves behind
+			return replayed, valid, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		rec, err := decodeLogRecord(payload, codec)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		replayed.apply(rec)
+		valid += length
+	}
+}
+
+// replayClock stops the time while a log is replayed, so that no key expires halfway through the records
+// that built it. The deadlines take effect once the replayed keys are in use.
+type replayClock struct{}
+
+func (replayClock) Now() time.Time { return time.Time{} }
+
+// readLogFrame reads the payload of the next record, checking it against its checksum, and returns it with
+// the length of the whole record. It returns io.EOF at the end of the log and io.ErrUnexpectedEOF if the
+// log ends, or would end according to the length prefix, inside the record.
+func readLogFrame(r *bufio.Reader, remaining int64) ([]byte, int64, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, 0, err
+		}
+		return nil, 0, ErrInvalidAppendLog
+	}
+
+	prefix := int64(len(binary.AppendUvarint(nil, length)))
+	if available := remaining - prefix - 4; available < 0 || length > uint64(available) {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	frame := make([]byte, length+4)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+
+	payload := frame[:length]
+	if crc32.Checksum(payload, snapshotTable) != binary.BigEndian.Uint32(frame[length:]) {
+		return nil, 0, ErrInvalidAppendLog
+	}
+
+	return payload, prefix + int64(len(frame)), nil
+}
+
+// encodeLogRecord encodes a record, framed with its length and checksum.
+func encodeLogRecord[V any](rec logRecord[V], codec ValueCodec[V]) ([]byte, error) {
+	var payload bytes.Buffer
+	sw := &snapshotWriter{w: &payload, crc: crc32.New(snapshotTable)}
+
+	if err := writeLogRecord(sw, rec, codec); err != nil {
+		return nil, err
+	}
+
+	frame := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+payload.Len()+4), uint64(payload.Len()))
+	frame = append(frame, payload.Bytes()...)
+	return binary.BigEndian.AppendUint32(frame, sw.crc.Sum32()), nil
+}
+
+// writeLogRecord writes the payload of a record: its operation, its key and its arguments, which for
+// aofMulti are the records of the transaction.
+func writeLogRecord[V any](sw *snapshotWriter, rec logRecord[V], codec ValueCodec[V]) error {
+	sw.write([]byte{rec.op})
+	sw.string(rec.key)
+
+	switch rec.op {
+	case aofAdd, aofStore:
+		sw.uvarint(uint64(len(rec.entries)))
+		for _, e := range rec.entries {
+			if err := snapshotEntry(sw, codec, e.Member, e.Score, e.Value); err != nil {
+				return err
+			}
+		}
+	case aofRem:
+		sw.uvarint(uint64(len(rec.members)))
+		for _, member := range rec.members {
+			sw.string(member)
+		}
+	case aofRemRangeByRank:
+		sw.varint(int64(rec.start))
+		sw.varint(int64(rec.stop))
+	case aofRemRangeByScore:
+		for _, b := range []ScoreBound{rec.min, rec.max} {
+			sw.float(b.Value)
+			sw.write([]byte{boolByte(b.Exclusive)})
+		}
+	case aofRemRangeByLex:
+		for _, b := range []LexBound{rec.minLex, rec.maxLex} {
+			sw.string(b.Value)
+			sw.write([]byte{boolByte(b.Exclusive)})
+			sw.varint(int64(b.Inf))
+		}
+	case aofExpire:
+		sw.varint(rec.deadline.UnixNano())
+	case aofExpireMember:
+		sw.string(rec.members[0])
+		sw.varint(rec.deadline.UnixNano())
+	case aofPersistMember:
+		sw.string(rec.members[0])
+	case aofMulti:
+		sw.uvarint(uint64(len(rec.batch)))
+		for _, nested := range rec.batch {
+			if err := writeLogRecord(sw, nested, codec); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// decodeLogRecord decodes the payload of a record.
+func decodeLogRecord[V any](payload []byte, codec ValueCodec[V]) (logRecord[V], error) {
+	sr := &snapshotReader{r: bufio.NewReader(bytes.NewReader(payload)), crc: crc32.New(snapshotTable)}
+
+	rec, err := readLogRecord(sr, codec)
+	if err == ErrInvalidSnapshot {
+		err = ErrInvalidAppendLog
+	}
+	return rec, err
+}
+
+func readLogRecord[V any](sr *snapshotReader, codec ValueCodec[V]) (logRecord[V], error) {
+	var rec logRecord[V]
+
+	op, err := sr.ReadByte()
+	if err != nil {
+		return rec, err
+	}
+	rec.op = op
+
+	if rec.key, err = sr.string(); err != nil {
+		return rec, err
+	}
+
+	switch rec.op {
+	case aofAdd, aofStore:
+		rec.entries, err = readSnapshotMembers(sr, codec, rec.op == aofStore)
+	case aofRem:
+		var count uint64
+		if count, err = sr.uvarint(); err != nil {
+			return rec, err
+		}
+		for i := uint64(0); i < count && err == nil; i++ {
+			var member string
+			member, err = sr.string()
+			rec.members = append(rec.members, member)
+		}
+	case aofRemRangeByRank:
+		var start, stop int64
+		if start, err = sr.varint(); err == nil {
+			stop, err = sr.varint()
+		}
+		rec.start, rec.stop = int(start), int(stop)
+	case aofRemRangeByScore:
+		if rec.min, err = readScoreBound(sr); err == nil {
+			rec.max, err = readScoreBound(sr)
+		}
+	case aofRemRangeByLex:
+		if rec.minLex, err = readLexBound(sr); err == nil {
+			rec.maxLex, err = readLexBound(sr)
+		}
+	case aofExpire:
+		var deadline int64
+		deadline, err = sr.varint()
+		rec.deadline = time.Unix(0, deadline)
+	case aofExpireMember, aofPersistMember:
+		var member string
+		if member, err = sr.string(); err != nil {
+			return rec, err
+		}
+		rec.members = []string{member}
+		if rec.op == aofExpireMember {
+			var deadline int64
+			deadline, err = sr.varint()
+			rec.deadline = time.Unix(0, deadline)
+		}
+	case aofMulti:
+		var count uint64
+		if count, err = sr.uvarint(); err != nil {
+			return rec, err
+		}
+		for i := uint64(0); i < count && err == nil; i++ {
+			var nested logRecord[V]
+			if nested, err = readLogRecord(sr, codec); err == nil && nested.op == aofMulti {
+				// Transactions are never nested, and reading them recursively could exhaust the stack
+				err = ErrInvalidAppendLog
+			}
+			rec.batch = append(rec.batch, nested)
+		}
+	case aofDel, aofFlush, aofPersist:
+	default:
+		return rec, ErrInvalidAppendLog
+	}
+
+	return rec, err
+}
+
+func readScoreBound(sr *snapshotReader) (ScoreBound, error) {
+	value, err := sr.float()
+	if err != nil {
+		return ScoreBound{}, err
+	}
+
+	exclusive, err := sr.ReadByte()
+	return ScoreBound{Value: value, Exclusive: exclusive != 0}, err
+}
+
+func readLexBound(sr *snapshotReader) (LexBound, error) {
+	value, err := sr.string()
+	if err != nil {
+		return LexBound{}, err
+	}
+
+	exclusive, err := sr.ReadByte()
+	if err != nil {
+		return LexBound{}, err
+	}
+
+	inf, err := sr.varint()
+	return LexBound{Value: value, Exclusive: exclusive != 0, Inf: int(inf)}, err
+}
+
+func boolByte(b bool) byte {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writeLogBase writes the header of a log and one record per key of contents, followed by a record of its
+// deadline for a key that has one and a record per member with a deadline, and returns the number of bytes
+// written.
+func writeLogBase[V any](w io.Writer, contents []keyEntries[V], codec ValueCodec[V]) (int64, error) {
+	buffered := bufio.NewWriter(w)
+	size := int64(len(appendLogMagic) + 1)
+
+	buffered.WriteString(appendLogMagic)
+	buffered.WriteByte(appendLogVersion)
+
+	for _, c := range contents {
+		frame, err := encodeLogRecord(logRecord[V]{op: aofStore, key: c.key, entries: c.entries}, codec)
+		if err != nil {
+			return 0, err
+		}
+
+		buffered.Write(frame)
+		size += int64(len(frame))
+
+		if !c.deadline.IsZero() {
+			frame, _ := encodeLogRecord(logRecord[V]{op: aofExpire, key: c.key, deadline: c.deadline}, codec)
+			buffered.Write(frame)
+			size += int64(len(frame))
+		}
+		for _, e := range c.expiries {
+			frame, _ := encodeLogRecord(logRecord[V]{op: aofExpireMember, key: c.key, members: []string{e.member}, deadline: e.deadline}, codec)
+			buffered.Write(frame)
+			size += int64(len(frame))
+		}
+	}
+
+	return size, buffered.Flush()
+}
+
+// initLog gives a new log its header and the current contents, and flushes it to stable storage.
+func initLog[V any](l *appendLog, contents []keyEntries[V], codec ValueCodec[V]) error {
+	size, err := writeLogBase(l.file, contents, codec)
+	if err != nil {
+		return err
+	}
+
+	l.size, l.baseSize = size, size
+	return l.file.Sync()
+}
+
+// start starts the goroutine that fsyncs the log every second, when that is the policy.
+func (l *appendLog) start() {
+	if l.opts.Fsync != FsyncEverySec {
+		return
+	}
+
+	l.done = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-l.done:
+				return
+			case <-ticker.C:
+				l.mu.Lock()
+				if !l.closed {
+					l.sync()
+				}
+				l.mu.Unlock()
+			}
+		}
+	}()
+}
+
+// write appends an encoded record to the log, and to the rewrite buffer while a rewrite is running.
+// It reports whether an automatic rewrite should be started.
+func (l *appendLog) write(frame []byte) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.closed {
+		return false
+	}
+
+	if l.rewriting {
+		l.rewriteBuf.Write(frame)
+	}
+
+	if l.err == nil {
+		n, err := l.file.Write(frame)
+		l.size += int64(n)
+		if err != nil {
+			l.err = err
+		} else {
+			l.dirty = true
+			if l.opts.Fsync == FsyncAlways {
+				l.sync()
+			}
+		}
+	}
+
+	pct := int64(l.opts.RewritePercentage)
+	if pct <= 0 || l.rewriting || l.rewritePending || l.size < l.opts.RewriteMinSize || l.size < l.baseSize*(100+pct)/100 {
+		return false
+	}
+
+	l.rewritePending = true
+	return true
+}
+
+// fail records an error that prevented a mutation from being recorded.
+func (l *appendLog) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.err == nil {
+		l.err = err
+	}
+	if l.rewriting && l.rewriteErr == nil {
+		l.rewriteErr = err
+	}
+}
+
+// sync flushes the log to stable storage if records were written since the last fsync. The caller must hold l.mu.
+func (l *appendLog) sync() {
+	if !l.dirty {
+		return
+	}
+
+	l.dirty = false
+	if err := l.file.Sync(); err != nil && l.err == nil {
+		l.err = err
+	}
+}
+
+// beginRewrite marks a rewrite as running, so that records are also kept for the rewritten log.
+func (l *appendLog) beginRewrite() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rewritePending = false
+	if l.closed {
+		return ErrAppendLogNotOpen
+	}
+	if l.rewriting {
+		return ErrRewriteInProgress
+	}
+
+	l.rewriting = true
+	l.rewriteErr = nil
+	l.rewriteBuf.Reset()
+	return nil
+}
+
+// rewriteLog writes contents and the records buffered since they were copied to a temporary file, which
+// then replaces the log.
+func rewriteLog[V any](l *appendLog, contents []keyEntries[V], codec ValueCodec[V]) error {
+	file, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".rewrite-*")
+	if err != nil {
+		l.mu.Lock()
+		l.abortRewrite()
+		l.mu.Unlock()
+		return err
+	}
+
+	// The contents are written without holding the log lock, so mutations are recorded meanwhile
+	size, err := writeLogBase(file, contents, codec)
+	if err == nil {
+		err = file.Sync()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err == nil && l.closed {
+		err = ErrAppendLogNotOpen
+	}
+	if err == nil {
+		err = l.install(file, size)
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		l.abortRewrite()
+	}
+
+	return err
+}
+
+// install appends the buffered records to a rewritten log of the given size and moves it over the log.
+// The caller must hold l.mu.
+func (l *appendLog) install(file *os.File, size int64) error {
+	n, err := file.Write(l.rewriteBuf.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	if info, err := l.file.Stat(); err == nil {
+		file.Chmod(info.Mode())
+	}
+	if err := os.Rename(file.Name(), l.path); err != nil {
+		return err
+	}
+
+	// Make the rename itself durable; not every platform supports syncing a directory
+	if dir, err := os.Open(filepath.Dir(l.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	l.file.Close()
+	l.file = file
+	l.size = size + int64(n)
+	l.baseSize = l.size
+	l.dirty = false
+
+	// The rewritten log holds every record the old one missed, except those that could not be encoded
+	l.err = l.rewriteErr
+	l.rewriting, l.rewriteErr, l.rewriteBuf = false, nil, bytes.Buffer{}
+	return nil
+}
+
+// abortRewrite marks the running rewrite as failed. The log must grow again before it is rewritten
+// automatically, so a failing rewrite is not retried on every record. The caller must hold l.mu.
+func (l *appendLog) abortRewrite() {
+	l.rewriting, l.rewriteErr, l.rewriteBuf = false, nil, bytes.Buffer{}
+	l.baseSize = l.size
+}
+
+// close flushes and closes the log file.
+func (l *appendLog) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.closed = true
+	if l.done != nil {
+		close(l.done)
+	}
+
+	l.sync()
+	if err := l.file.Close(); err != nil && l.err == nil {
+		l.err = err
+	}
+
+	return l.err
+}
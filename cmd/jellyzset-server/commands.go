@@ -0,0 +1,952 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/davidandw190/jellyzset"
+)
+
+// Error replies shared by several commands, worded as in Redis.
+const (
+	errSyntax        = "syntax error"
+	errNotInteger    = "value is not an integer or out of range"
+	errWrongType     = "Operation against a key holding the wrong kind of value" // Sent with the WRONGTYPE code
+	errInvalidCursor = "invalid cursor"
+)
+
+// command is an entry of the command table.
+type command struct {
+	arity int // Number of arguments including the command name, or -N for at least N, as in the Redis command table
+	run   func(c *conn, args []string)
+}
+
+// commands maps the lowercase names of the supported commands to their entries.
+var commands = map[string]command{
+	"ping":    {-1, ping},
+	"echo":    {2, func(c *conn, args []string) { c.w.bulk(args[1]) }},
+	"hello":   {-1, hello},
+	"select":  {2, selectDB},
+	"command": {-1, func(c *conn, args []string) { c.w.array(0) }},
+	"client":  {-2, client},
+	"quit":    {-1, func(c *conn, args []string) { c.quit = true; c.w.ok() }},
+	"info":    {-1, info},
+
+	"dbsize":   {1, func(c *conn, args []string) { c.w.integer(int64(len(c.keys("")))) }},
+	"flushdb":  {-1, flush},
+	"flushall": {-1, flush},
+	"del":      {-2, del},
+	"unlink":   {-2, del},
+	"exists":   {-2, exists},
+	"keys":     {2, keys},
+	"type":     {2, keyType},
+	"scan":     {-2, scan},
+
+	"expire":    {3, func(c *conn, args []string) { expire(c, args, time.Second, false) }},
+	"pexpire":   {3, func(c *conn, args []string) { expire(c, args, time.Millisecond, false) }},
+	"expireat":  {3, func(c *conn, args []string) { expire(c, args, time.Second, true) }},
+	"pexpireat": {3, func(c *conn, args []string) { expire(c, args, time.Millisecond, true) }},
+	"ttl":       {2, func(c *conn, args []string) { ttl(c, args, time.Second) }},
+	"pttl":      {2, func(c *conn, args []string) { ttl(c, args, time.Millisecond) }},
+	"persist":   {2, persist},
+
+	"zadd":      {-4, zadd},
+	"zincrby":   {4, zincrby},
+	"zscore":    {3, zscore},
+	"zmscore":   {-3, zmscore},
+	"zcard":     {2, func(c *conn, args []string) { c.w.integer(int64(c.srv.db.ZCard(args[1]))) }},
+	"zrank":     {-3, func(c *conn, args []string) { zrank(c, args, false) }},
+	"zrevrank":  {-3, func(c *conn, args []string) { zrank(c, args, true) }},
+	"zrem":      {-3, zrem},
+	"zcount":    {4, zcount},
+	"zlexcount": {4, zlexcount},
+	"zrange": {-4, func(c *conn, args []string) {
+		zrange(c, args, rangeRequest{}, "BYSCORE", "BYLEX", "REV", "LIMIT", "WITHSCORES")
+	}},
+	"zrevrange":     {-4, func(c *conn, args []string) { zrange(c, args, rangeRequest{rev: true}, "WITHSCORES") }},
+	"zrangebyscore": {-4, func(c *conn, args []string) { zrange(c, args, rangeRequest{byScore: true}, "LIMIT", "WITHSCORES") }},
+	"zrevrangebyscore": {-4, func(c *conn, args []string) {
+		zrange(c, args, rangeRequest{byScore: true, rev: true}, "LIMIT", "WITHSCORES")
+	}},
+	"zrangebylex":      {-4, func(c *conn, args []string) { zrange(c, args, rangeRequest{byLex: true}, "LIMIT") }},
+	"zrevrangebylex":   {-4, func(c *conn, args []string) { zrange(c, args, rangeRequest{byLex: true, rev: true}, "LIMIT") }},
+	"zremrangebyrank":  {4, zremrangebyrank},
+	"zremrangebyscore": {4, zremrangebyscore},
+	"zremrangebylex":   {4, zremrangebylex},
+	"zpopmin":          {-2, func(c *conn, args []string) { zpop(c, args, false) }},
+	"zpopmax":          {-2, func(c *conn, args []string) { zpop(c, args, true) }},
+	"bzpopmin":         {-3, func(c *conn, args []string) { bzpop(c, args, false) }},
+	"bzpopmax":         {-3, func(c *conn, args []string) { bzpop(c, args, true) }},
+	"zunion":           {-3, func(c *conn, args []string) { zsetOp(c, args, "union", false) }},
+	"zinter":           {-3, func(c *conn, args []string) { zsetOp(c, args, "inter", false) }},
+	"zdiff":            {-3, func(c *conn, args []string) { zsetOp(c, args, "diff", false) }},
+	"zunionstore":      {-4, func(c *conn, args []string) { zsetOp(c, args, "union", true) }},
+	"zinterstore":      {-4, func(c *conn, args []string) { zsetOp(c, args, "inter", true) }},
+	"zdiffstore":       {-4, func(c *conn, args []string) { zsetOp(c, args, "diff", true) }},
+	"zintercard":       {-3, zintercard},
+	"zscan":            {-3, zscan},
+
+	// Every key holds a sorted set, so commands of the other types only tell existing keys apart from missing ones.
+	"get":      {2, otherType(func(c *conn) { c.w.null() })},
+	"strlen":   {2, otherType(func(c *conn) { c.w.integer(0) })},
+	"llen":     {2, otherType(func(c *conn) { c.w.integer(0) })},
+	"lrange":   {4, otherType(func(c *conn) { c.w.array(0) })},
+	"scard":    {2, otherType(func(c *conn) { c.w.integer(0) })},
+	"smembers": {2, otherType(func(c *conn) { c.w.array(0) })},
+	"hlen":     {2, otherType(func(c *conn) { c.w.integer(0) })},
+	"hget":     {3, otherType(func(c *conn) { c.w.null() })},
+	"hgetall":  {2, otherType(func(c *conn) { c.w.mapHeader(0) })},
+}
+
+func ping(c *conn, args []string) {
+	switch len(args) {
+	case 1:
+		c.w.simple("PONG")
+	case 2:
+		c.w.bulk(args[1])
+	default:
+		c.w.error("wrong number of arguments for 'ping' command")
+	}
+}
+
+// hello switches the protocol version and replies with the server properties, as a map in RESP3.
+func hello(c *conn, args []string) {
+	proto := c.w.proto
+	if len(args) > 1 {
+		v, err := strconv.Atoi(args[1])
+		if err != nil {
+			c.w.error("Protocol version is not an integer or out of range")
+			return
+		}
+		if v != 2 && v != 3 {
+			c.w.errorCode("NOPROTO", "unsupported protocol version")
+			return
+		}
+		proto = v
+
+		// Authentication is not supported, so credentials are accepted and ignored, as by a Redis server without a password.
+		for i := 2; i < len(args); i++ {
+			switch {
+			case strings.EqualFold(args[i], "AUTH") && i+2 < len(args):
+				i += 2
+			case strings.EqualFold(args[i], "SETNAME") && i+1 < len(args):
+				i++
+			default:
+				c.w.error("syntax error in HELLO option '" + truncate(args[i]) + "'")
+				return
+			}
+		}
+	}
+
+	c.w.proto = proto
+	c.w.mapHeader(7)
+	c.w.bulk("server")
+	c.w.bulk("redis")
+	c.w.bulk("version")
+	c.w.bulk(redisVersion)
+	c.w.bulk("proto")
+	c.w.integer(int64(proto))
+	c.w.bulk("id")
+	c.w.integer(c.id)
+	c.w.bulk("mode")
+	c.w.bulk("standalone")
+	c.w.bulk("role")
+	c.w.bulk("master")
+	c.w.bulk("modules")
+	c.w.array(0)
+}
+
+func selectDB(c *conn, args []string) {
+	db, err := strconv.Atoi(args[1])
+	if err != nil {
+		c.w.error(errNotInteger)
+		return
+	}
+	if db != 0 {
+		c.w.error("DB index is out of range")
+		return
+	}
+	c.w.ok()
+}
+
+// client supports the subcommands sent by client libraries when they connect.
+func client(c *conn, args []string) {
+	switch strings.ToUpper(args[1]) {
+	case "ID":
+		c.w.integer(c.id)
+	case "GETNAME":
+		c.w.null()
+	case "SETNAME", "SETINFO":
+		c.w.ok()
+	default:
+		c.w.error("unknown subcommand '" + truncate(args[1]) + "'. Try CLIENT HELP.")
+	}
+}
+
+func info(c *conn, args []string) {
+	var b strings.Builder
+	b.WriteString("# Server\r\n")
+	b.WriteString("redis_version:" + redisVersion + "\r\n")
+	b.WriteString("redis_mode:standalone\r\n")
+	b.WriteString("\r\n# Memory\r\n")
+	b.WriteString("used_memory:" + strconv.FormatInt(c.srv.db.UsedMemory(), 10) + "\r\n")
+	b.WriteString("maxmemory:" + strconv.FormatInt(c.srv.maxMemory, 10) + "\r\n")
+	b.WriteString("maxmemory_policy:" + c.srv.policy + "\r\n")
+	b.WriteString("\r\n# Stats\r\n")
+	b.WriteString("evicted_keys:" + strconv.FormatInt(c.srv.evicted.Load(), 10) + "\r\n")
+	b.WriteString("\r\n# Keyspace\r\n")
+	if keys := c.keys(""); len(keys) > 0 {
+		expires := 0
+		for _, key := range keys {
+			if c.srv.db.TTL(key) >= 0 {
+				expires++
+			}
+		}
+		b.WriteString("db0:keys=" + strconv.Itoa(len(keys)) + ",expires=" + strconv.Itoa(expires) + ",avg_ttl=0\r\n")
+	}
+	c.w.bulk(b.String())
+}
+
+func flush(c *conn, args []string) {
+	if len(args) > 2 || len(args) == 2 && !strings.EqualFold(args[1], "SYNC") && !strings.EqualFold(args[1], "ASYNC") {
+		c.w.error(errSyntax)
+		return
+	}
+
+	for _, key := range c.srv.db.ZKeys() {
+		c.srv.db.ZClear(key)
+	}
+	c.w.ok()
+}
+
+func del(c *conn, args []string) {
+	var n int64
+	for _, key := range args[1:] {
+		if c.exists(key) {
+			c.srv.db.ZClear(key)
+			n++
+		}
+	}
+	c.w.integer(n)
+}
+
+func exists(c *conn, args []string) {
+	var n int64
+	for _, key := range args[1:] {
+		if c.exists(key) {
+			n++
+		}
+	}
+	c.w.integer(n)
+}
+
+func keys(c *conn, args []string) {
+	c.w.strings(c.keys(args[1]))
+}
+
+func keyType(c *conn, args []string) {
+	if c.exists(args[1]) {
+		c.w.simple("zset")
+	} else {
+		c.w.simple("none")
+	}
+}
+
+func scan(c *conn, args []string) {
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		c.w.error(errInvalidCursor)
+		return
+	}
+
+	match, count, typ, ok := scanOptions(c, args[2:], true)
+	if !ok {
+		return
+	}
+
+	next, names, err := c.srv.db.Scan(cursor, match, count)
+	if err != nil {
+		c.w.error(err.Error())
+		return
+	}
+	names = slices.DeleteFunc(names, func(key string) bool {
+		return typ != "" && !strings.EqualFold(typ, "zset") || !c.exists(key)
+	})
+
+	c.w.array(2)
+	c.w.bulk(strconv.FormatUint(next, 10))
+	c.w.strings(names)
+}
+
+// scanOptions parses the MATCH, COUNT and, for SCAN, TYPE options of the scan commands.
+func scanOptions(c *conn, args []string, withType bool) (match string, count int, typ string, ok bool) {
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			c.w.error(errSyntax)
+			return "", 0, "", false
+		}
+
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "MATCH":
+			match = args[i+1]
+		case opt == "COUNT":
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				c.w.error(errNotInteger)
+				return "", 0, "", false
+			}
+			if n < 1 {
+				c.w.error(errSyntax)
+				return "", 0, "", false
+			}
+			count = n
+		case opt == "TYPE" && withType:
+			typ = args[i+1]
+		default:
+			c.w.error(errSyntax)
+			return "", 0, "", false
+		}
+	}
+
+	if match == "*" {
+		match = ""
+	}
+	return match, count, typ, true
+}
+
+// expire sets the deadline of a key from a time in the given unit, either relative to now or, when absolute
+// is true, since the Unix epoch.
+func expire(c *conn, args []string, unit time.Duration, absolute bool) {
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		c.w.error(errNotInteger)
+		return
+	}
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		c.w.error("invalid expire time in '" + strings.ToLower(args[0]) + "' command")
+		return
+	}
+
+	var ok bool
+	if absolute {
+		ok = c.srv.db.ExpireAt(args[1], time.Unix(0, 0).Add(time.Duration(n)*unit))
+	} else {
+		ok = c.srv.db.Expire(args[1], time.Duration(n)*unit)
+	}
+	c.w.integer(boolInt(ok))
+}
+
+// ttl replies with the time left to live of a key in the given unit, rounded to the nearest, or with -1 for a
+// key without a deadline and -2 for a missing key.
+func ttl(c *conn, args []string, unit time.Duration) {
+	switch d := c.srv.db.TTL(args[1]); d {
+	case jellyzset.TTLNotFound:
+		c.w.integer(-2)
+	case jellyzset.TTLNoExpiry:
+		c.w.integer(-1)
+	default:
+		c.w.integer(int64((d + unit/2) / unit))
+	}
+}
+
+func persist(c *conn, args []string) {
+	c.w.integer(boolInt(c.srv.db.Persist(args[1])))
+}
+
+// zadd supports the NX, XX, GT, LT, CH and INCR flags, which come before the score and member pairs.
+func zadd(c *conn, args []string) {
+	var opts jellyzset.ZAddOptions
+	i := 2
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			opts.NX = true
+		case "XX":
+			opts.XX = true
+		case "GT":
+			opts.GT = true
+		case "LT":
+			opts.LT = true
+		case "CH":
+			opts.CH = true
+		case "INCR":
+			opts.INCR = true
+		default:
+			break flags
+		}
+	}
+
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		c.w.error(errSyntax)
+		return
+	}
+
+	members := make([]jellyzset.ZMember, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, err := parseScore(pairs[j])
+		if err != nil {
+			c.w.error(err.Error())
+			return
+		}
+		members = append(members, jellyzset.ZMember{Score: score, Member: pairs[j+1]})
+	}
+
+	if opts.INCR && len(members) == 1 {
+		score, ok, err := c.srv.db.ZAddIncr(args[1], opts, members[0].Score, members[0].Member, nil)
+		switch {
+		case err != nil:
+			c.writeError(err)
+		case !ok:
+			c.w.null()
+		default:
+			c.w.double(score)
+		}
+		return
+	}
+
+	n, err := c.srv.db.ZAddWithOptions(args[1], opts, members...)
+	if err != nil {
+		c.writeError(err)
+		return
+	}
+	c.w.integer(int64(n))
+}
+
+func zincrby(c *conn, args []string) {
+	increment, err := parseScore(args[2])
+	if err != nil {
+		c.w.error(err.Error())
+		return
+	}
+
+	score, err := c.srv.db.ZIncrBy(args[1], increment, args[3])
+	if err != nil {
+		c.writeError(err)
+		return
+	}
+	c.w.double(score)
+}
+
+func zscore(c *conn, args []string) {
+	ok, score := c.srv.db.ZScore(args[1], args[2])
+	if !ok {
+		c.w.null()
+		return
+	}
+	c.w.double(score)
+}
+
+func zmscore(c *conn, args []string) {
+	c.w.array(len(args) - 2)
+	for _, member := range args[2:] {
+		zscore(c, []string{args[0], args[1], member})
+	}
+}
+
+func zrank(c *conn, args []string, rev bool) {
+	if len(args) > 4 || len(args) == 4 && !strings.EqualFold(args[3], "WITHSCORE") {
+		c.w.error(errSyntax)
+		return
+	}
+	withScore := len(args) == 4
+
+	rank, score := c.srv.db.ZRankWithScore(args[1], args[2])
+	if rev {
+		rank, score = c.srv.db.ZRevRankWithScore(args[1], args[2])
+	}
+
+	switch {
+	case rank < 0:
+		if withScore {
+			c.w.nullArray()
+		} else {
+			c.w.null()
+		}
+	case withScore:
+		c.w.array(2)
+		c.w.integer(rank)
+		c.w.double(score)
+	default:
+		c.w.integer(rank)
+	}
+}
+
+func zrem(c *conn, args []string) {
+	c.w.integer(int64(c.srv.db.ZRemMany(args[1], args[2:]...)))
+}
+
+func zcount(c *conn, args []string) {
+	min, err1 := jellyzset.ParseScoreBound(args[2])
+	max, err2 := jellyzset.ParseScoreBound(args[3])
+	if err1 != nil || err2 != nil {
+		c.w.error(jellyzset.ErrInvalidScoreRange.Error())
+		return
+	}
+	c.w.integer(int64(c.srv.db.ZCountBounds(args[1], min, max)))
+}
+
+func zlexcount(c *conn, args []string) {
+	n, err := c.srv.db.ZLexCount(args[1], args[2], args[3])
+	if err != nil {
+		c.w.error(err.Error())
+		return
+	}
+	c.w.integer(int64(n))
+}
+
+// rangeRequest holds the options of the ZRANGE family, either implied by the command or given as arguments.
+type rangeRequest struct {
+	byScore    bool
+	byLex      bool
+	rev        bool
+	withScores bool
+	limit      bool
+	offset     int
+	count      int
+}
+
+// zrange runs a command of the ZRANGE family. The arguments after the key and the two bounds are options,
+// which must be among the ones the command accepts.
+func zrange(c *conn, args []string, req rangeRequest, accepted ...string) {
+	for i := 4; i < len(args); i++ {
+		opt := strings.ToUpper(args[i])
+		if !slices.Contains(accepted, opt) {
+			c.w.error(errSyntax)
+			return
+		}
+
+		switch opt {
+		case "BYSCORE":
+			req.byScore = true
+		case "BYLEX":
+			req.byLex = true
+		case "REV":
+			req.rev = true
+		case "WITHSCORES":
+			req.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				c.w.error(errSyntax)
+				return
+			}
+			offset, err1 := strconv.Atoi(args[i+1])
+			count, err2 := strconv.Atoi(args[i+2])
+			if err1 != nil || err2 != nil {
+				c.w.error(errNotInteger)
+				return
+			}
+			req.limit, req.offset, req.count = true, offset, count
+			i += 2
+		}
+	}
+
+	switch {
+	case req.byScore && req.byLex:
+		c.w.error(errSyntax)
+		return
+	case req.limit && !req.byScore && !req.byLex:
+		c.w.error("syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+		return
+	case req.withScores && req.byLex:
+		c.w.error("syntax error, WITHSCORES not supported in combination with BYLEX")
+		return
+	}
+
+	var query jellyzset.RangeQuery
+	switch {
+	case req.byScore:
+		start, err1 := jellyzset.ParseScoreBound(args[2])
+		stop, err2 := jellyzset.ParseScoreBound(args[3])
+		if err1 != nil || err2 != nil {
+			c.w.error(jellyzset.ErrInvalidScoreRange.Error())
+			return
+		}
+		query = jellyzset.RangeByScoreBounds(start, stop)
+	case req.byLex:
+		start, err1 := jellyzset.ParseLexBound(args[2])
+		stop, err2 := jellyzset.ParseLexBound(args[3])
+		if err1 != nil || err2 != nil {
+			c.w.error(jellyzset.ErrInvalidLexRange.Error())
+			return
+		}
+		query = jellyzset.RangeByLexBounds(start, stop)
+	default:
+		start, err1 := strconv.Atoi(args[2])
+		stop, err2 := strconv.Atoi(args[3])
+		if err1 != nil || err2 != nil {
+			c.w.error(errNotInteger)
+			return
+		}
+		query = jellyzset.RangeByRank(start, stop)
+	}
+
+	if req.rev {
+		query = query.Rev()
+	}
+	if req.limit {
+		query = query.Limit(req.offset, max(req.count, -1))
+	}
+
+	entries, err := c.srv.db.TypedZSet.ZRangeQuery(args[1], query)
+	if err != nil {
+		c.w.error(err.Error())
+		return
+	}
+	c.entries(entries, req.withScores)
+}
+
+func zremrangebyrank(c *conn, args []string) {
+	start, err1 := strconv.Atoi(args[2])
+	stop, err2 := strconv.Atoi(args[3])
+	if err1 != nil || err2 != nil {
+		c.w.error(errNotInteger)
+		return
+	}
+	c.w.integer(int64(c.srv.db.ZRemRangeByRank(args[1], start, stop)))
+}
+
+func zremrangebyscore(c *conn, args []string) {
+	min, err1 := jellyzset.ParseScoreBound(args[2])
+	max, err2 := jellyzset.ParseScoreBound(args[3])
+	if err1 != nil || err2 != nil {
+		c.w.error(jellyzset.ErrInvalidScoreRange.Error())
+		return
+	}
+	c.w.integer(int64(c.srv.db.ZRemRangeByScoreBounds(args[1], min, max)))
+}
+
+func zremrangebylex(c *conn, args []string) {
+	n, err := c.srv.db.ZRemRangeByLex(args[1], args[2], args[3])
+	if err != nil {
+		c.w.error(err.Error())
+		return
+	}
+	c.w.integer(int64(n))
+}
+
+// zpop replies with a flat member and score pair without a count, and with a list of pairs with one.
+func zpop(c *conn, args []string, max bool) {
+	if len(args) > 3 {
+		c.w.error(errSyntax)
+		return
+	}
+
+	db := c.srv.db.TypedZSet
+	if len(args) == 2 {
+		pop := db.ZPopMin
+		if max {
+			pop = db.ZPopMax
+		}
+
+		entry, err := pop(args[1])
+		if err != nil {
+			c.w.array(0)
+			return
+		}
+		c.w.array(2)
+		c.w.bulk(entry.Member)
+		c.w.double(entry.Score)
+		return
+	}
+
+	count, err := strconv.Atoi(args[2])
+	if err != nil {
+		c.w.error(errNotInteger)
+		return
+	}
+
+	pop := db.ZPopMinCount
+	if max {
+		pop = db.ZPopMaxCount
+	}
+	entries, err := pop(args[1], count)
+	if err != nil {
+		c.w.error(err.Error())
+		return
+	}
+	c.entries(entries, true)
+}
+
+// bzpop blocks until a member can be popped from one of the keys, the timeout in seconds expires or the server
+// is closed. A timeout of 0 blocks indefinitely.
+func bzpop(c *conn, args []string, max bool) {
+	timeout, err := strconv.ParseFloat(args[len(args)-1], 64)
+	if err != nil || math.IsNaN(timeout) || math.IsInf(timeout, 0) {
+		c.w.error("timeout is not a float or out of range")
+		return
+	}
+	if timeout < 0 {
+		c.w.error("timeout is negative")
+		return
+	}
+
+	ctx, cancel := c.srv.ctx, context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout*float64(time.Second)))
+	}
+	defer cancel()
+
+	pop := c.srv.db.BZPopMin
+	if max {
+		pop = c.srv.db.BZPopMax
+	}
+
+	// Replies are only flushed between commands, so the ones to pipelined commands sent before are flushed first.
+	c.w.flush()
+	key, entry, err := pop(ctx, args[1:len(args)-1]...)
+	if err != nil {
+		c.w.nullArray()
+		return
+	}
+
+	c.w.array(3)
+	c.w.bulk(key)
+	c.w.bulk(entry.Member)
+	c.w.double(entry.Score)
+}
+
+// zsetOp runs ZUNION, ZINTER, ZDIFF or their STORE variants. The destination key of the STORE variants comes
+// before the number of keys, and they reply with the size of the stored set instead of its members.
+func zsetOp(c *conn, args []string, op string, store bool) {
+	name := strings.ToLower(args[0])
+	rest := args[1:]
+	var dst string
+	if store {
+		dst, rest = rest[0], rest[1:]
+	}
+
+	numKeys, err := strconv.Atoi(rest[0])
+	if err != nil {
+		c.w.error(errNotInteger)
+		return
+	}
+	if numKeys < 1 {
+		c.w.error("at least 1 input key is needed for '" + name + "' command")
+		return
+	}
+	if numKeys > len(rest)-1 {
+		c.w.error(errSyntax)
+		return
+	}
+
+	keys := rest[1 : 1+numKeys]
+	opts := &jellyzset.ZStoreOptions{}
+	withScores := false
+	for i := 1 + numKeys; i < len(rest); i++ {
+		switch opt := strings.ToUpper(rest[i]); {
+		case opt == "WEIGHTS" && op != "diff" && i+numKeys < len(rest):
+			opts.Weights = make([]float64, numKeys)
+			for j := range opts.Weights {
+				w, err := strconv.ParseFloat(rest[i+1+j], 64)
+				if err != nil || math.IsNaN(w) {
+					c.w.error("weight value is not a float")
+					return
+				}
+				opts.Weights[j] = w
+			}
+			i += numKeys
+		case opt == "AGGREGATE" && op != "diff" && i+1 < len(rest):
+			switch strings.ToUpper(rest[i+1]) {
+			case "SUM":
+				opts.Aggregate = jellyzset.AggregateSum
+			case "MIN":
+				opts.Aggregate = jellyzset.AggregateMin
+			case "MAX":
+				opts.Aggregate = jellyzset.AggregateMax
+			default:
+				c.w.error(errSyntax)
+				return
+			}
+			i++
+		case opt == "WITHSCORES" && !store:
+			withScores = true
+		default:
+			c.w.error(errSyntax)
+			return
+		}
+	}
+
+	db := c.srv.db.TypedZSet
+	if store {
+		var n int
+		switch op {
+		case "union":
+			n, err = db.ZUnionStore(dst, keys, opts)
+		case "inter":
+			n, err = db.ZInterStore(dst, keys, opts)
+		default:
+			n, err = db.ZDiffStore(dst, keys)
+		}
+		if err != nil {
+			c.writeError(err)
+			return
+		}
+		c.w.integer(int64(n))
+		return
+	}
+
+	var entries []jellyzset.Entry[interface{}]
+	switch op {
+	case "union":
+		entries, err = db.ZUnion(keys, opts)
+	case "inter":
+		entries, err = db.ZInter(keys, opts)
+	default:
+		entries, err = db.ZDiff(keys)
+	}
+	if err != nil {
+		c.w.error(err.Error())
+		return
+	}
+	c.entries(entries, withScores)
+}
+
+func zintercard(c *conn, args []string) {
+	numKeys, err := strconv.Atoi(args[1])
+	if err != nil {
+		c.w.error(errNotInteger)
+		return
+	}
+	if numKeys < 1 {
+		c.w.error("numkeys should be greater than 0")
+		return
+	}
+	if numKeys > len(args)-2 {
+		c.w.error("Number of keys can't be greater than number of args")
+		return
+	}
+
+	limit := 0
+	switch rest := args[2+numKeys:]; {
+	case len(rest) == 0:
+	case len(rest) == 2 && strings.EqualFold(rest[0], "LIMIT"):
+		if limit, err = strconv.Atoi(rest[1]); err != nil {
+			c.w.error(errNotInteger)
+			return
+		}
+	default:
+		c.w.error(errSyntax)
+		return
+	}
+
+	n, err := c.srv.db.ZInterCard(args[2:2+numKeys], limit)
+	if err != nil {
+		c.w.error(err.Error())
+		return
+	}
+	c.w.integer(int64(n))
+}
+
+// zscan replies with the next cursor and a flat list of members and scores, in RESP3 as well.
+func zscan(c *conn, args []string) {
+	cursor, err := strconv.ParseUint(args[2], 10, 64)
+	if err != nil {
+		c.w.error(errInvalidCursor)
+		return
+	}
+
+	match, count, _, ok := scanOptions(c, args[3:], false)
+	if !ok {
+		return
+	}
+
+	next, entries, err := c.srv.db.ZScan(args[1], cursor, match, count)
+	if err != nil {
+		c.w.error(err.Error())
+		return
+	}
+
+	c.w.array(2)
+	c.w.bulk(strconv.FormatUint(next, 10))
+	c.w.array(2 * len(entries))
+	for _, e := range entries {
+		c.w.bulk(e.Member)
+		c.w.bulk(formatScore(e.Score))
+	}
+}
+
+// otherType returns the handler of a read command of another data type, which replies as Redis does for a
+// missing key, or with WRONGTYPE if the key exists since it then holds a sorted set.
+func otherType(missing func(c *conn)) func(c *conn, args []string) {
+	return func(c *conn, args []string) {
+		if c.exists(args[1]) {
+			c.w.errorCode("WRONGTYPE", errWrongType)
+			return
+		}
+		missing(c)
+	}
+}
+
+// writeError replies with an error returned by the ZSet, with the OOM code for ErrOOM as in Redis.
+func (c *conn) writeError(err error) {
+	if errors.Is(err, jellyzset.ErrOOM) {
+		c.w.errorCode("OOM", err.Error()+".")
+		return
+	}
+	c.w.error(err.Error())
+}
+
+// entries replies with the members of a range, and with their scores if requested: alternating with the
+// members in RESP2, and as member and score pairs in RESP3.
+func (c *conn) entries(entries []jellyzset.Entry[interface{}], withScores bool) {
+	if !withScores {
+		c.w.array(len(entries))
+		for _, e := range entries {
+			c.w.bulk(e.Member)
+		}
+		return
+	}
+
+	if c.w.proto == 3 {
+		c.w.array(len(entries))
+		for _, e := range entries {
+			c.w.array(2)
+			c.w.bulk(e.Member)
+			c.w.double(e.Score)
+		}
+		return
+	}
+
+	c.w.array(2 * len(entries))
+	for _, e := range entries {
+		c.w.bulk(e.Member)
+		c.w.double(e.Score)
+	}
+}
+
+// exists reports whether a key exists as Redis sees it. ZRem and the pops leave emptied sorted sets behind,
+// while Redis deletes a key along with its last member, so empty sets are treated as missing keys.
+func (c *conn) exists(key string) bool {
+	return c.srv.db.ZCard(key) > 0
+}
+
+// keys returns the existing keys matching a glob pattern, or every existing key for an empty pattern.
+func (c *conn) keys(pattern string) []string {
+	matched := []string{}
+	var cursor uint64
+	for {
+		next, names, _ := c.srv.db.Scan(cursor, pattern, 1000)
+		for _, key := range names {
+			if c.exists(key) {
+				matched = append(matched, key)
+			}
+		}
+		if cursor = next; cursor == 0 {
+			return matched
+		}
+	}
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
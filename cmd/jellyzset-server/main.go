@@ -0,0 +1,171 @@
+// Command jellyzset-server serves a jellyzset ZSet over the Redis protocol, so that redis-cli and Redis client
+// libraries can use it.
+//
+// It speaks RESP2, and RESP3 once a client sends HELLO 3, on a TCP address, a Unix socket or both. Every key
+// holds a sorted set: the sorted set commands behave as in Redis, and the read commands of the other data types
+// reply WRONGTYPE for existing keys. Only database 0 exists.
+//
+// Usage:
+//
+//	jellyzset-server [-addr 127.0.0.1:6379] [-unixsocket path] [-appendonly path] [-appendfsync everysec|always|no]
+//		[-maxmemory bytes] [-maxmemory-policy noeviction|allkeys-lru|allkeys-lfu|volatile-ttl]
+//
+// With -appendonly, every change is recorded in an append-only log, which is replayed on the next start.
+// With -maxmemory, keys are evicted according to -maxmemory-policy once the sorted sets use more memory than
+// allowed, or writes fail with an OOM error under the noeviction policy.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/davidandw190/jellyzset"
+)
+
+// redisVersion is the Redis version reported by HELLO and INFO, which client libraries check for features.
+const redisVersion = "7.2.0"
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:6379", "TCP address to listen on, or an empty string to not listen on TCP")
+	unixSocket := flag.String("unixsocket", "", "path of a Unix socket to listen on")
+	appendOnly := flag.String("appendonly", "", "path of an append-only log to replay and record changes in")
+	appendFsync := flag.String("appendfsync", "everysec", "when the append-only log is synced to disk: everysec, always or no")
+	maxMemory := flag.String("maxmemory", "0", "memory limit of the sorted sets, in bytes or with a unit such as 100mb, or 0 for none")
+	maxMemoryPolicy := flag.String("maxmemory-policy", "noeviction", "keys evicted at the memory limit: noeviction, allkeys-lru, allkeys-lfu or volatile-ttl")
+	flag.Parse()
+
+	if err := run(*addr, *unixSocket, *appendOnly, *appendFsync, *maxMemory, *maxMemoryPolicy); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(addr, unixSocket, appendOnly, appendFsync, maxMemory, maxMemoryPolicy string) error {
+	if addr == "" && unixSocket == "" {
+		return errors.New("nothing to listen on: -addr and -unixsocket are both empty")
+	}
+
+	fsync, err := parseFsync(appendFsync)
+	if err != nil {
+		return err
+	}
+	limit, err := parseMemory(maxMemory)
+	if err != nil {
+		return err
+	}
+	policy, err := parsePolicy(maxMemoryPolicy)
+	if err != nil {
+		return err
+	}
+
+	db := jellyzset.New()
+	defer db.Close()
+	db.SetMaxMemory(limit, policy)
+	if appendOnly != "" {
+		if err := db.OpenAppendLog(appendOnly, jellyzset.AppendLogOptions{Fsync: fsync}); err != nil {
+			return err
+		}
+		defer db.CloseAppendLog()
+	}
+
+	var listeners []net.Listener
+	if addr != "" {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+	if unixSocket != "" {
+		// A socket left behind by a previous run that was killed would make Listen fail.
+		os.Remove(unixSocket)
+		l, err := net.Listen("unix", unixSocket)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+
+	srv := newServer(db)
+	srv.maxMemory, srv.policy = limit, maxMemoryPolicy
+	errc := make(chan error, len(listeners))
+	for _, l := range listeners {
+		log.Printf("listening on %s %s", l.Addr().Network(), l.Addr())
+		go func(l net.Listener) { errc <- srv.serve(l) }(l)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case sig := <-signals:
+		log.Printf("received %s, shutting down", sig)
+	case err = <-errc:
+	}
+
+	srv.close()
+	return err
+}
+
+func parseFsync(policy string) (jellyzset.FsyncPolicy, error) {
+	switch policy {
+	case "everysec":
+		return jellyzset.FsyncEverySec, nil
+	case "always":
+		return jellyzset.FsyncAlways, nil
+	case "no":
+		return jellyzset.FsyncNo, nil
+	}
+	return 0, fmt.Errorf("invalid -appendfsync %q: must be everysec, always or no", policy)
+}
+
+// parseMemory parses a memory size as Redis does in its configuration: a number of bytes, optionally
+// followed by k, m or g for powers of 1000, or kb, mb or gb for powers of 1024.
+func parseMemory(size string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000}, {"b", 1},
+	}
+
+	number, multiplier := strings.ToLower(size), int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(number, u.suffix) {
+			number, multiplier = strings.TrimSuffix(number, u.suffix), u.multiplier
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("invalid -maxmemory %q: must be a number of bytes, optionally with a unit such as 100mb", size)
+	}
+	return n * multiplier, nil
+}
+
+func parsePolicy(policy string) (jellyzset.EvictionPolicy, error) {
+	switch policy {
+	case "noeviction":
+		return jellyzset.NoEviction, nil
+	case "allkeys-lru":
+		return jellyzset.AllKeysLRU, nil
+	case "allkeys-lfu":
+		return jellyzset.AllKeysLFU, nil
+	case "volatile-ttl":
+		return jellyzset.VolatileTTL, nil
+	}
+	return 0, fmt.Errorf("invalid -maxmemory-policy %q: must be noeviction, allkeys-lru, allkeys-lfu or volatile-ttl", policy)
+}
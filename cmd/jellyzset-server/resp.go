@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxMultibulkLength = 1024 * 1024 // Largest number of arguments in a command, as in Redis
+	maxBulkLength      = 512 << 20   // Largest argument, as the Redis proto-max-bulk-len default
+	maxInlineLength    = 64 << 10    // Largest inline command, as PROTO_INLINE_MAX_SIZE in Redis
+)
+
+// protocolError is a malformed request. It is reported to the client, after which the connection is closed.
+type protocolError string
+
+func (e protocolError) Error() string { return "Protocol error: " + string(e) }
+
+// respReader reads commands sent as RESP arrays of bulk strings, or as inline commands typed in a terminal.
+type respReader struct {
+	r *bufio.Reader
+}
+
+func newRESPReader(r io.Reader) *respReader {
+	return &respReader{r: bufio.NewReaderSize(r, 16<<10)}
+}
+
+// readCommand reads the next command. It returns an empty slice for an empty inline command.
+func (rr *respReader) readCommand() ([]string, error) {
+	line, err := rr.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 || line[0] != '*' {
+		if len(line) > maxInlineLength {
+			return nil, protocolError("too big inline request")
+		}
+		return strings.Fields(line), nil
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count > maxMultibulkLength {
+		return nil, protocolError("invalid multibulk length")
+	}
+
+	args := make([]string, 0, max(count, 0))
+	for i := 0; i < count; i++ {
+		line, err := rr.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError("expected '$', got '" + line[:min(len(line), 1)] + "'")
+		}
+
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 || n > maxBulkLength {
+			return nil, protocolError("invalid bulk length")
+		}
+
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rr.r, buf); err != nil {
+			return nil, err
+		}
+		args = append(args, string(buf[:n]))
+	}
+
+	return args, nil
+}
+
+// readLine reads a line terminated by CRLF, or by a single LF as redis-server accepts for inline commands.
+func (rr *respReader) readLine() (string, error) {
+	line, err := rr.r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+
+	line = strings.TrimSuffix(line[:len(line)-1], "\r")
+	return line, nil
+}
+
+// buffered reports whether more commands are already waiting to be read, so replies to a pipeline can be
+// flushed together.
+func (rr *respReader) buffered() bool {
+	return rr.r.Buffered() > 0
+}
+
+// respWriter writes replies in RESP2, or in RESP3 once the client has switched to it with HELLO 3.
+type respWriter struct {
+	w     *bufio.Writer
+	proto int
+}
+
+func newRESPWriter(w io.Writer) *respWriter {
+	return &respWriter{w: bufio.NewWriterSize(w, 16<<10), proto: 2}
+}
+
+func (rw *respWriter) line(prefix byte, s string) {
+	rw.w.WriteByte(prefix)
+	rw.w.WriteString(s)
+	rw.w.WriteString("\r\n")
+}
+
+func (rw *respWriter) simple(s string) { rw.line('+', s) }
+
+func (rw *respWriter) ok() { rw.simple("OK") }
+
+// error writes an error reply with the generic ERR code.
+func (rw *respWriter) error(msg string) { rw.errorCode("ERR", msg) }
+
+// errorCode writes an error reply with a specific code, such as WRONGTYPE.
+func (rw *respWriter) errorCode(code, msg string) {
+	rw.line('-', code+" "+strings.NewReplacer("\r", " ", "\n", " ").Replace(msg))
+}
+
+func (rw *respWriter) integer(n int64) { rw.line(':', strconv.FormatInt(n, 10)) }
+
+func (rw *respWriter) bulk(s string) {
+	rw.line('$', strconv.Itoa(len(s)))
+	rw.w.WriteString(s)
+	rw.w.WriteString("\r\n")
+}
+
+// null writes a missing value, the null bulk string of RESP2.
+func (rw *respWriter) null() {
+	if rw.proto == 3 {
+		rw.w.WriteString("_\r\n")
+	} else {
+		rw.w.WriteString("$-1\r\n")
+	}
+}
+
+// nullArray writes a missing array, as returned by blocking commands that time out.
+func (rw *respWriter) nullArray() {
+	if rw.proto == 3 {
+		rw.w.WriteString("_\r\n")
+	} else {
+		rw.w.WriteString("*-1\r\n")
+	}
+}
+
+func (rw *respWriter) array(n int) { rw.line('*', strconv.Itoa(n)) }
+
+// mapHeader starts a map of n pairs, sent as a flat array of 2n elements in RESP2.
+func (rw *respWriter) mapHeader(n int) {
+	if rw.proto == 3 {
+		rw.line('%', strconv.Itoa(n))
+	} else {
+		rw.array(2 * n)
+	}
+}
+
+// double writes a score, as a RESP3 double or as a bulk string in RESP2.
+func (rw *respWriter) double(f float64) {
+	if rw.proto == 3 {
+		rw.line(',', formatScore(f))
+	} else {
+		rw.bulk(formatScore(f))
+	}
+}
+
+func (rw *respWriter) strings(values []string) {
+	rw.array(len(values))
+	for _, v := range values {
+		rw.bulk(v)
+	}
+}
+
+func (rw *respWriter) flush() error { return rw.w.Flush() }
+
+// formatScore formats a score the way Redis does, with the shortest representation that reads back as the
+// same number and "inf" and "-inf" for infinities.
+func formatScore(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// errNotFloat is the error of an argument that is not a valid score.
+var errNotFloat = errors.New("value is not a valid float")
+
+// parseScore parses a score, accepting "inf", "+inf" and "-inf" in any case but not NaN.
+func parseScore(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) || math.IsNaN(f) {
+		return 0, errNotFloat
+	}
+	return f, nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/davidandw190/jellyzset"
+)
+
+// server serves a single ZSet to clients speaking the Redis protocol.
+type server struct {
+	db     *jellyzset.ZSet
+	ctx    context.Context // Done once the server is closed, which releases clients blocked in BZPOPMIN or BZPOPMAX
+	cancel context.CancelFunc
+	nextID atomic.Int64
+
+	maxMemory int64        // Memory limit of db, as given by -maxmemory and reported by INFO
+	policy    string       // Eviction policy of db, as given by -maxmemory-policy and reported by INFO
+	evicted   atomic.Int64 // Keys evicted from db, reported by INFO
+
+	mu        sync.Mutex
+	closed    bool
+	listeners map[net.Listener]struct{}
+	conns     map[*conn]struct{}
+	wg        sync.WaitGroup
+}
+
+// conn is a client connection. Commands are read and answered one at a time, in order.
+type conn struct {
+	id   int64
+	srv  *server
+	nc   net.Conn
+	r    *respReader
+	w    *respWriter
+	quit bool // Set by QUIT, so the connection is closed once the reply is sent
+}
+
+func newServer(db *jellyzset.ZSet) *server {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &server{
+		db:        db,
+		ctx:       ctx,
+		cancel:    cancel,
+		policy:    "noeviction",
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[*conn]struct{}),
+	}
+	db.OnEvict(func(string, []jellyzset.Entry[interface{}]) { s.evicted.Add(1) })
+	return s
+}
+
+// serve accepts connections on l until the server is closed, and then returns nil.
+func (s *server) serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		c := &conn{id: s.nextID.Add(1), srv: s, nc: nc, r: newRESPReader(nc), w: newRESPWriter(nc)}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return nil
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go c.serve()
+	}
+}
+
+// close stops accepting connections, releases blocked clients and waits for every connection to be closed.
+func (s *server) close() {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	s.mu.Unlock()
+
+	s.cancel()
+	s.wg.Wait()
+}
+
+// serve reads and runs commands until the client disconnects, sends QUIT or a malformed request.
+// Replies are flushed once no more pipelined commands are waiting.
+func (c *conn) serve() {
+	defer func() {
+		c.nc.Close()
+		c.srv.mu.Lock()
+		delete(c.srv.conns, c)
+		c.srv.mu.Unlock()
+		c.srv.wg.Done()
+	}()
+
+	for !c.quit {
+		args, err := c.r.readCommand()
+		if err != nil {
+			var perr protocolError
+			if errors.As(err, &perr) {
+				c.w.error(perr.Error())
+				c.w.flush()
+			}
+			return
+		}
+
+		c.run(args)
+
+		if !c.r.buffered() {
+			if err := c.w.flush(); err != nil {
+				return
+			}
+		}
+	}
+
+	c.w.flush()
+}
+
+// run looks up a command and checks its number of arguments before running it.
+func (c *conn) run(args []string) {
+	if len(args) == 0 {
+		return
+	}
+
+	name := strings.ToLower(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		var b strings.Builder
+		b.WriteString("unknown command '" + truncate(args[0]) + "', with args beginning with: ")
+		for _, arg := range args[1:] {
+			b.WriteString("'" + truncate(arg) + "' ")
+		}
+		c.w.error(b.String())
+		return
+	}
+
+	if cmd.arity > 0 && len(args) != cmd.arity || cmd.arity < 0 && len(args) < -cmd.arity {
+		c.w.error("wrong number of arguments for '" + name + "' command")
+		return
+	}
+
+	cmd.run(c, args)
+}
+
+// truncate shortens an argument quoted in an error reply to 128 bytes, as Redis does.
+func truncate(s string) string {
+	if len(s) > 128 {
+		return s[:128]
+	}
+	return s
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/davidandw190/jellyzset"
+)
+
+// testClient sends commands to a server and reads its raw replies.
+type testClient struct {
+	t  *testing.T
+	nc net.Conn
+	r  *bufio.Reader
+}
+
+func startServer(t *testing.T) (*jellyzset.ZSet, func() *testClient) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := jellyzset.New()
+	srv := newServer(db)
+	go srv.serve(l)
+	t.Cleanup(srv.close)
+
+	return db, func() *testClient {
+		nc, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { nc.Close() })
+		return &testClient{t: t, nc: nc, r: bufio.NewReader(nc)}
+	}
+}
+
+// do sends a command as a RESP array and returns the raw reply, with the CRLF line endings replaced by spaces.
+func (c *testClient) do(args ...string) string {
+	c.t.Helper()
+
+	var b strings.Builder
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+	if _, err := c.nc.Write([]byte(b.String())); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return c.reply()
+}
+
+func (c *testClient) reply() string {
+	c.t.Helper()
+
+	c.nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var b strings.Builder
+	c.readReply(&b)
+	return strings.TrimSuffix(b.String(), " ")
+}
+
+func (c *testClient) readReply(b *strings.Builder) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	b.WriteString(line + " ")
+
+	n, _ := strconv.Atoi(line[1:])
+	switch line[0] {
+	case '$':
+		if n >= 0 {
+			buf := make([]byte, n+2)
+			if _, err := io.ReadFull(c.r, buf); err != nil {
+				c.t.Fatal(err)
+			}
+			b.WriteString(string(buf[:n]) + " ")
+		}
+	case '*':
+		for i := 0; i < n; i++ {
+			c.readReply(b)
+		}
+	case '%':
+		for i := 0; i < 2*n; i++ {
+			c.readReply(b)
+		}
+	}
+}
+
+func assertReply(t *testing.T, c *testClient, expected string, args ...string) {
+	t.Helper()
+	if actual := c.do(args...); actual != expected {
+		t.Errorf("%s: expected %q, got %q", strings.Join(args, " "), expected, actual)
+	}
+}
+
+func TestServer(t *testing.T) {
+	t.Run("Connection", func(t *testing.T) {
+		_, dial := startServer(t)
+		c := dial()
+
+		assertReply(t, c, "+PONG", "PING")
+		assertReply(t, c, "$5 hello", "ping", "hello")
+		assertReply(t, c, "$3 abc", "ECHO", "abc")
+		assertReply(t, c, "+OK", "SELECT", "0")
+		assertReply(t, c, "-ERR DB index is out of range", "SELECT", "1")
+		assertReply(t, c, "-ERR unknown command 'FOO', with args beginning with: 'a' 'b' ", "FOO", "a", "b")
+		assertReply(t, c, "-ERR wrong number of arguments for 'zcard' command", "ZCARD")
+		assertReply(t, c, "-NOPROTO unsupported protocol version", "HELLO", "4")
+	})
+
+	t.Run("InlineAndPipelinedCommands", func(t *testing.T) {
+		_, dial := startServer(t)
+		c := dial()
+
+		c.nc.Write([]byte("ZADD k 1 a 2 b\r\nZCARD k\nPING\r\n"))
+		for _, expected := range []string{":2", ":2", "+PONG"} {
+			if actual := c.reply(); actual != expected {
+				t.Errorf("expected %q, got %q", expected, actual)
+			}
+		}
+
+		c.nc.Write([]byte("*1\r\n+PING\r\n"))
+		if actual := c.reply(); actual != "-ERR Protocol error: expected '$', got '+'" {
+			t.Errorf("unexpected reply to a malformed request: %q", actual)
+		}
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		db, dial := startServer(t)
+		c := dial()
+		db.ZAdd("user:1", 1, "a", nil)
+		db.ZAdd("user:2", 1, "a", nil)
+		db.ZAdd("other", 1, "a", nil)
+
+		assertReply(t, c, ":2", "EXISTS", "user:1", "user:2", "missing")
+		assertReply(t, c, "+zset", "TYPE", "other")
+		assertReply(t, c, "+none", "TYPE", "missing")
+		assertReply(t, c, "-WRONGTYPE Operation against a key holding the wrong kind of value", "GET", "other")
+		assertReply(t, c, "$-1", "GET", "missing")
+		assertReply(t, c, ":3", "DBSIZE")
+
+		if actual := c.do("KEYS", "user:*"); actual != "*2 $6 user:1 $6 user:2" && actual != "*2 $6 user:2 $6 user:1" {
+			t.Errorf("unexpected KEYS reply: %q", actual)
+		}
+
+		assertReply(t, c, ":2", "DEL", "user:1", "other", "missing")
+		assertReply(t, c, ":1", "DBSIZE")
+		assertReply(t, c, "+OK", "FLUSHDB")
+		assertReply(t, c, ":0", "DBSIZE")
+	})
+
+	t.Run("ZAdd", func(t *testing.T) {
+		_, dial := startServer(t)
+		c := dial()
+
+		assertReply(t, c, ":2", "ZADD", "k", "1", "a", "2", "b")
+		assertReply(t, c, ":0", "ZADD", "k", "NX", "5", "a")
+		assertReply(t, c, ":1", "ZADD", "k", "XX", "CH", "5", "a")
+		assertReply(t, c, "$1 7", "ZADD", "k", "INCR", "2", "a")
+		assertReply(t, c, "$-1", "ZADD", "k", "NX", "INCR", "2", "a")
+		assertReply(t, c, "-ERR syntax error", "ZADD", "k", "1", "a", "2")
+		assertReply(t, c, "-ERR value is not a valid float", "ZADD", "k", "x", "a")
+		assertReply(t, c, "-ERR XX and NX options at the same time are not compatible", "ZADD", "k", "NX", "XX", "1", "a")
+		assertReply(t, c, "$3 8.5", "ZINCRBY", "k", "1.5", "a")
+		assertReply(t, c, "$3 inf", "ZADD", "k", "INCR", "+inf", "c")
+		assertReply(t, c, "-ERR resulting score is not a number (NaN)", "ZINCRBY", "k", "-inf", "c")
+	})
+
+	t.Run("Members", func(t *testing.T) {
+		_, dial := startServer(t)
+		c := dial()
+		c.do("ZADD", "k", "1", "a", "2", "b", "3", "c")
+
+		assertReply(t, c, "$1 2", "ZSCORE", "k", "b")
+		assertReply(t, c, "$-1", "ZSCORE", "k", "x")
+		assertReply(t, c, "*2 $1 1 $-1", "ZMSCORE", "k", "a", "x")
+		assertReply(t, c, ":3", "ZCARD", "k")
+		assertReply(t, c, ":0", "ZCARD", "missing")
+		assertReply(t, c, ":1", "ZRANK", "k", "b")
+		assertReply(t, c, ":2", "ZREVRANK", "k", "a")
+		assertReply(t, c, "*2 :2 $1 3", "ZRANK", "k", "c", "WITHSCORE")
+		assertReply(t, c, "$-1", "ZRANK", "k", "x")
+		assertReply(t, c, ":2", "ZCOUNT", "k", "(1", "+inf")
+		assertReply(t, c, "-ERR min or max is not a float", "ZCOUNT", "k", "x", "1")
+		assertReply(t, c, ":2", "ZREM", "k", "a", "b", "x")
+		assertReply(t, c, ":1", "ZCARD", "k")
+	})
+
+	t.Run("Ranges", func(t *testing.T) {
+		_, dial := startServer(t)
+		c := dial()
+		c.do("ZADD", "k", "1", "a", "2", "b", "3", "c", "4", "d")
+
+		assertReply(t, c, "*4 $1 a $1 b $1 c $1 d", "ZRANGE", "k", "0", "-1")
+		assertReply(t, c, "*4 $1 b $1 2 $1 c $1 3", "ZRANGE", "k", "1", "2", "WITHSCORES")
+		assertReply(t, c, "*2 $1 d $1 c", "ZRANGE", "k", "0", "1", "REV")
+		assertReply(t, c, "*2 $1 c $1 b", "ZRANGE", "k", "(4", "1", "BYSCORE", "REV", "LIMIT", "0", "2")
+		assertReply(t, c, "*2 $1 b $1 c", "ZRANGE", "k", "[b", "(d", "BYLEX")
+		assertReply(t, c, "*2 $1 d $1 c", "ZREVRANGE", "k", "0", "1")
+		assertReply(t, c, "*2 $1 c $1 d", "ZRANGEBYSCORE", "k", "(2", "+inf")
+		assertReply(t, c, "*1 $1 c", "ZREVRANGEBYSCORE", "k", "+inf", "-inf", "LIMIT", "1", "1")
+		assertReply(t, c, "*3 $1 b $1 c $1 d", "ZRANGEBYLEX", "k", "(a", "+")
+		assertReply(t, c, "*2 $1 d $1 c", "ZREVRANGEBYLEX", "k", "+", "[c")
+		assertReply(t, c, ":2", "ZLEXCOUNT", "k", "[b", "[c")
+		assertReply(t, c, "*0", "ZRANGE", "missing", "0", "-1")
+
+		assertReply(t, c, "-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX", "ZRANGE", "k", "0", "1", "LIMIT", "0", "1")
+		assertReply(t, c, "-ERR syntax error, WITHSCORES not supported in combination with BYLEX", "ZRANGE", "k", "-", "+", "BYLEX", "WITHSCORES")
+		assertReply(t, c, "-ERR syntax error", "ZREVRANGE", "k", "0", "1", "BYSCORE")
+		assertReply(t, c, "-ERR min or max not valid string range item", "ZRANGEBYLEX", "k", "a", "+")
+		assertReply(t, c, "-ERR value is not an integer or out of range", "ZRANGE", "k", "a", "1")
+	})
+
+	t.Run("Removals", func(t *testing.T) {
+		_, dial := startServer(t)
+		c := dial()
+		c.do("ZADD", "k", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e")
+
+		assertReply(t, c, ":1", "ZREMRANGEBYRANK", "k", "0", "0")
+		assertReply(t, c, ":2", "ZREMRANGEBYSCORE", "k", "2", "(4")
+		assertReply(t, c, ":1", "ZREMRANGEBYLEX", "k", "[e", "+")
+		assertReply(t, c, "*2 $1 d $1 4", "ZPOPMIN", "k")
+		assertReply(t, c, "*0", "ZPOPMIN", "k")
+		assertReply(t, c, ":0", "EXISTS", "k")
+
+		c.do("ZADD", "k", "1", "a", "2", "b", "3", "c")
+		assertReply(t, c, "*4 $1 c $1 3 $1 b $1 2", "ZPOPMAX", "k", "2")
+		assertReply(t, c, "-ERR value is out of range, must be positive", "ZPOPMAX", "k", "-1")
+	})
+
+	t.Run("BlockingPops", func(t *testing.T) {
+		_, dial := startServer(t)
+		c, other := dial(), dial()
+
+		assertReply(t, c, "*-1", "BZPOPMIN", "k", "0.01")
+		assertReply(t, c, "-ERR timeout is negative", "BZPOPMIN", "k", "-1")
+
+		c.nc.Write([]byte("BZPOPMAX k1 k2 0\r\n"))
+		time.Sleep(20 * time.Millisecond)
+		assertReply(t, other, ":2", "ZADD", "k2", "1", "a", "2", "b")
+		if actual := c.reply(); actual != "*3 $2 k2 $1 b $1 2" {
+			t.Errorf("unexpected BZPOPMAX reply: %q", actual)
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		_, dial := startServer(t)
+		c := dial()
+		c.do("ZADD", "k", "1", "a")
+
+		assertReply(t, c, ":0", "EXPIRE", "missing", "10")
+		assertReply(t, c, ":-2", "TTL", "missing")
+		assertReply(t, c, ":-1", "TTL", "k")
+		assertReply(t, c, ":1", "EXPIRE", "k", "100")
+		assertReply(t, c, ":100", "TTL", "k")
+		if pttl, _ := strconv.Atoi(strings.TrimPrefix(c.do("PTTL", "k"), ":")); pttl <= 99000 || pttl > 100000 {
+			t.Errorf("unexpected PTTL: %d", pttl)
+		}
+		assertReply(t, c, ":1", "PERSIST", "k")
+		assertReply(t, c, ":0", "PERSIST", "k")
+		assertReply(t, c, ":-1", "TTL", "k")
+		assertReply(t, c, "-ERR invalid expire time in 'expire' command", "EXPIRE", "k", "9223372036854775807")
+
+		assertReply(t, c, ":1", "PEXPIRE", "k", "20")
+		time.Sleep(50 * time.Millisecond)
+		assertReply(t, c, ":0", "EXISTS", "k")
+
+		c.do("ZADD", "k", "1", "a")
+		assertReply(t, c, ":1", "EXPIREAT", "k", "1")
+		assertReply(t, c, ":0", "ZCARD", "k")
+	})
+
+	t.Run("MemoryLimit", func(t *testing.T) {
+		db, dial := startServer(t)
+		c := dial()
+		c.do("ZADD", "k", "1", "a")
+		db.SetMaxMemory(1, jellyzset.NoEviction)
+
+		assertReply(t, c, "-OOM command not allowed when used memory > 'maxmemory'.", "ZADD", "k", "2", "b")
+		assertReply(t, c, "-OOM command not allowed when used memory > 'maxmemory'.", "ZINCRBY", "k", "1", "a")
+		assertReply(t, c, "$1 1", "ZSCORE", "k", "a")
+		assertReply(t, c, ":1", "ZREM", "k", "a")
+
+		c.do("ZADD", "k", "1", "a")
+		db.SetMaxMemory(1, jellyzset.AllKeysLRU)
+		assertReply(t, c, ":1", "ZADD", "other", "1", "a")
+		assertReply(t, c, ":0", "EXISTS", "k")
+		if info := c.do("INFO"); !strings.Contains(info, "evicted_keys:1\r\n") {
+			t.Errorf("unexpected INFO: %q", info)
+		}
+	})
+
+	t.Run("SetOperations", func(t *testing.T) {
+		_, dial := startServer(t)
+		c := dial()
+		c.do("ZADD", "a", "1", "x", "2", "y")
+		c.do("ZADD", "b", "3", "y", "4", "z")
+
+		assertReply(t, c, "*6 $1 x $1 1 $1 z $1 4 $1 y $1 5", "ZUNION", "2", "a", "b", "WITHSCORES")
+		assertReply(t, c, "*2 $1 y $1 8", "ZINTER", "2", "a", "b", "WEIGHTS", "1", "2", "WITHSCORES")
+		assertReply(t, c, "*2 $1 y $1 2", "ZINTER", "2", "a", "b", "AGGREGATE", "MIN", "WITHSCORES")
+		assertReply(t, c, "*1 $1 x", "ZDIFF", "2", "a", "b")
+		assertReply(t, c, ":3", "ZUNIONSTORE", "dst", "2", "a", "b")
+		assertReply(t, c, ":3", "ZCARD", "dst")
+		assertReply(t, c, ":1", "ZINTERCARD", "2", "a", "b")
+		assertReply(t, c, "-ERR at least 1 input key is needed for 'zunion' command", "ZUNION", "0", "a")
+		assertReply(t, c, "-ERR syntax error", "ZDIFF", "2", "a", "b", "WEIGHTS", "1", "2")
+		assertReply(t, c, "-ERR weight value is not a float", "ZUNION", "1", "a", "WEIGHTS", "x")
+	})
+
+	t.Run("Scan", func(t *testing.T) {
+		_, dial := startServer(t)
+		c := dial()
+		c.do("ZADD", "k", "1", "a")
+
+		assertReply(t, c, "*2 $1 0 *2 $1 a $1 1", "ZSCAN", "k", "0")
+		assertReply(t, c, "*2 $1 0 *1 $1 k", "SCAN", "0", "MATCH", "k*")
+		assertReply(t, c, "*2 $1 0 *0", "SCAN", "0", "TYPE", "string")
+		assertReply(t, c, "-ERR invalid cursor", "SCAN", "x")
+	})
+
+	t.Run("RESP3", func(t *testing.T) {
+		_, dial := startServer(t)
+		c := dial()
+		c.do("ZADD", "k", "1", "a", "2.5", "b")
+
+		if actual := c.do("HELLO", "3"); !strings.HasPrefix(actual, "%7 $6 server $5 redis $7 version $5 7.2.0 $5 proto :3") {
+			t.Errorf("unexpected HELLO reply: %q", actual)
+		}
+
+		assertReply(t, c, ",2.5", "ZSCORE", "k", "b")
+		assertReply(t, c, "_", "ZSCORE", "k", "x")
+		assertReply(t, c, "*2 *2 $1 a ,1 *2 $1 b ,2.5", "ZRANGE", "k", "0", "-1", "WITHSCORES")
+		assertReply(t, c, "*2 $1 a ,1", "ZPOPMIN", "k")
+		assertReply(t, c, "*1 *2 $1 b ,2.5", "ZPOPMIN", "k", "1")
+		assertReply(t, c, "_", "BZPOPMIN", "k", "0.01")
+		assertReply(t, c, "%0", "HGETALL", "k")
+	})
+
+	t.Run("UnixSocket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "jellyzset.sock")
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			t.Skip("Unix sockets are not supported:", err)
+		}
+
+		srv := newServer(jellyzset.New())
+		go srv.serve(l)
+		defer srv.close()
+
+		nc, err := net.Dial("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer nc.Close()
+
+		c := &testClient{t: t, nc: nc, r: bufio.NewReader(nc)}
+		assertReply(t, c, ":1", "ZADD", "k", "1", "a")
+		assertReply(t, c, "+OK", "QUIT")
+	})
+}
@@ -0,0 +1,818 @@
+package jellyzset
+
+import (
+	"container/heap"
+	"math"
+	"time"
+)
+
+const (
+	// TTLNoExpiry is returned by TTL for a key that exists but has no deadline, as -1 is by Redis TTL.
+	TTLNoExpiry time.Duration = -1
+
+	// TTLNotFound is returned by TTL for a key that does not exist, as -2 is by Redis TTL.
+	TTLNotFound time.Duration = -2
+)
+
+const (
+	activeExpireInterval = 100 * time.Millisecond // How often the sweeper runs, as with the Redis default hz of 10
+	activeExpireSample   = 20                     // Keys with a deadline sampled per round, as ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP
+	activeExpireRepeat   = 25                     // Percentage of expired keys in a sample above which another round is run
+	activeExpireBudget   = 25 * time.Millisecond  // Longest time a cycle may run, a quarter of the interval as in Redis
+)
+
+// Clock tells the time to key expiry. The system clock is used until SetClock installs another one.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the default Clock, which reads the system clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// SetClock sets the clock deciding when keys reach their deadline.
+//
+// A controllable clock makes expiry deterministic in tests: keys expire when the clock passes their
+// deadline, whatever the actual time. Deadlines are absolute, so keys that already have one keep it.
+//
+// Parameters:
+//   - clock: The clock to use, or nil to restore the system clock.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.SetClock(fakeClock)
+//	zset.ZAdd("sessions", 1.0, "user1", nil)
+//	zset.Expire("sessions", time.Minute)
+//	fakeClock.Advance(time.Minute)
+//
+// In this example, where fakeClock is a Clock whose time only moves when it is advanced, "sessions" no longer exists once the clock has moved a minute forward.
+func (z *TypedZSet[V]) SetClock(clock Clock) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if clock == nil {
+		clock = systemClock{}
+	}
+	z.clock = clock
+}
+
+// Expire sets a key to expire once the given time has passed, like the Redis EXPIRE and PEXPIRE commands.
+//
+// An expired key behaves as if it did not exist. It is removed when it is next accessed, or by a background
+// sweeper which samples the keys with a deadline ten times per second, as Redis does, so that expired keys
+// which are never accessed again do not stay in memory. The sweeper only runs while keys have a deadline,
+// and is stopped by Close, which must be called once a ZSet using expiry is no longer used.
+// A deadline is kept when members are added or removed, and cleared when the key is replaced by a store
+// operation or removed. A ttl that is not positive removes the key at once.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//   - ttl: How long the key lives from now.
+//
+// Returns:
+//   - true if the key exists, false otherwise.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("ratelimit:user1", 1.0, "request1", nil)
+//	ok := zset.Expire("ratelimit:user1", 10*time.Second)
+//
+// In this example, ok is true and "ratelimit:user1" disappears ten seconds later, unless its deadline is changed or removed with Persist.
+func (z *TypedZSet[V]) Expire(key string, ttl time.Duration) bool {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	return z.expireAt(key, z.clock.Now().Add(ttl))
+}
+
+// ExpireAt sets a key to expire at the given time, like the Redis EXPIREAT and PEXPIREAT commands.
+//
+// It behaves like Expire, with an absolute deadline. A deadline that is not in the future removes the key at once.
+//
+// Parameters:
+//   - key:      The key associated with the sorted set.
+//   - deadline: The time at which the key expires.
+//
+// Returns:
+//   - true if the key exists, false otherwise.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("daily", 1.0, "member1", nil)
+//	ok := zset.ExpireAt("daily", time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC))
+//
+// In this example, ok is true and "daily" expires at midnight UTC on 2 January 2030.
+func (z *TypedZSet[V]) ExpireAt(key string, deadline time.Time) bool {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	return z.expireAt(key, deadline)
+}
+
+// TTL returns how long a key has left to live, like the Redis TTL and PTTL commands.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//
+// Returns:
+//   - The time left until the deadline of the key, TTLNoExpiry if the key has no deadline, or TTLNotFound
+//     if the key does not exist.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("sessions", 1.0, "user1", nil)
+//	zset.Expire("sessions", time.Minute)
+//	ttl := zset.TTL("sessions")
+//
+// In this example, ttl will be a minute at most, less the time elapsed since the call to Expire.
+func (z *TypedZSet[V]) TTL(key string) time.Duration {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	set, exists := z.records[key]
+	if !exists {
+		return TTLNotFound
+	}
+	if set.deadline.IsZero() {
+		return TTLNoExpiry
+	}
+
+	ttl := set.deadline.Sub(z.clock.Now())
+	if ttl <= 0 {
+		return TTLNotFound
+	}
+	return ttl
+}
+
+// Persist removes the deadline of a key, so that it no longer expires, like the Redis PERSIST command.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//
+// Returns:
+//   - true if the key had a deadline, false if it has none or does not exist.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("sessions", 1.0, "user1", nil)
+//	zset.Expire("sessions", time.Minute)
+//	ok := zset.Persist("sessions")
+//
+// In this example, ok is true and "sessions" is kept until it is removed.
+func (z *TypedZSet[V]) Persist(key string) bool {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	set := z.lookup(key)
+	if set == nil || set.deadline.IsZero() {
+		return false
+	}
+
+	z.setDeadline(key, set, time.Time{})
+	z.log(logRecord[V]{op: aofPersist, key: key})
+	return true
+}
+
+// expireAt sets the deadline of a key, or removes the key if the deadline has passed. The caller must hold
+// z.mu exclusively.
+func (z *TypedZSet[V]) expireAt(key string, deadline time.Time) bool {
+	set, exists := z.records[key]
+	if !exists {
+		return false
+	}
+	if z.expired(set) {
+		z.expireKey(key)
+		return false
+	}
+
+	if !deadline.After(z.clock.Now()) {
+		z.deleteKey(key)
+		z.notify(EventKeyCleared, key, "", 0, 0)
+		z.log(logRecord[V]{op: aofDel, key: key})
+		return true
+	}
+
+	z.setDeadline(key, set, deadline)
+	z.log(logRecord[V]{op: aofExpire, key: key, deadline: deadline})
+	z.startSweeper()
+	return true
+}
+
+// setDeadline sets the deadline of the sorted set at the given key, or clears it when deadline is zero,
+// and keeps the index of the keys with a deadline up to date. The caller must hold z.mu exclusively.
+func (z *TypedZSet[V]) setDeadline(key string, set *zset[V], deadline time.Time) {
+	set.deadline = deadline
+	if deadline.IsZero() {
+		delete(z.volatile, key)
+	} else {
+		z.volatile[key] = set
+	}
+}
+
+// lookup returns the sorted set at the given key, or nil if the key does not exist or is past its deadline.
+// The caller must hold z.mu.
+func (z *TypedZSet[V]) lookup(key string) *zset[V] {
+	set, exists := z.records[key]
+	if !exists || z.expired(set) {
+		return nil
+	}
+	return set
+}
+
+// live reports whether a sorted set is neither past its deadline nor left with only members past their
+// deadline, which are removed with the key on the next access. The caller must hold z.mu, but no lock of
+// the set.
+func (z *TypedZSet[V]) live(set *zset[V]) bool {
+	if z.expired(set) {
+		return false
+	}
+
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+
+	return !set.expiries.allDueAt(z.clock.Now(), set.zsl.length)
+}
+
+// expired reports whether a sorted set is past its deadline. The caller must hold z.mu.
+func (z *TypedZSet[V]) expired(set *zset[V]) bool {
+	return !set.deadline.IsZero() && set.expiredAt(z.clock.Now())
+}
+
+// expiredAt reports whether the sorted set has a deadline that is not after now.
+func (set *zset[V]) expiredAt(now time.Time) bool {
+	return !set.deadline.IsZero() && !now.Before(set.deadline)
+}
+
+// deleteKey removes a key and its deadline, and the memory it used. The caller must hold z.mu exclusively.
+func (z *TypedZSet[V]) deleteKey(key string) {
+	if set, exists := z.records[key]; exists {
+		z.used.Add(-set.size(key))
+		set.zsl.used = nil
+		z.keys.remove(key)
+		z.removed = z.versions.Add(1)
+	}
+	delete(z.records, key)
+	delete(z.volatile, key)
+	delete(z.expiring, key)
+}
+
+// expireKey removes a key past its deadline and records and reports the removal. The caller must hold z.mu
+// exclusively.
+func (z *TypedZSet[V]) expireKey(key string) {
+	z.deleteKey(key)
+	z.notify(EventKeyExpired, key, "", 0, 0)
+	z.log(logRecord[V]{op: aofDel, key: key})
+}
+
+// deleteIfExpired removes the key if it still holds the given sorted set and that set is past its deadline.
+func (z *TypedZSet[V]) deleteIfExpired(key string, set *zset[V]) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if z.records[key] == set && z.expired(set) {
+		z.expireKey(key)
+	}
+}
+
+// Close stops the background sweeper removing expired keys and members, and waits for it to return.
+//
+// The sweeper runs while keys or members have a deadline, however far away, and keeps the ZSet from being
+// garbage collected while it runs, so a ZSet using Expire, ExpireAt, ZAddWithTTL or ZExpireMember must be
+// closed once it is no longer used. The ZSet stays usable after Close: expired keys and members are still
+// removed when they are accessed, but no longer in the background. Close does not close the append-only
+// log, which CloseAppendLog does. Closing a ZSet more than once has no effect.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	defer zset.Close()
+//	zset.ZAdd("sessions", 1.0, "user1", nil)
+//	zset.Expire("sessions", 365*24*time.Hour)
+//
+// In this example, the sweeper started by Expire is stopped when the function returns, rather than running for a year.
+func (z *TypedZSet[V]) Close() {
+	z.mu.Lock()
+	z.closed = true
+	if z.sweepStop != nil {
+		close(z.sweepStop)
+		z.sweepStop = nil
+	}
+	z.mu.Unlock()
+
+	z.sweeper.Wait()
+}
+
+// startSweeper starts the goroutine removing expired keys and members, if keys or members have a deadline
+// and it is not already running or stopped by Close. The caller must hold z.mu exclusively.
+func (z *TypedZSet[V]) startSweeper() {
+	if z.closed || z.sweepStop != nil || len(z.volatile) == 0 && len(z.expiring) == 0 {
+		return
+	}
+
+	z.sweepStop = make(chan struct{})
+	z.sweeper.Add(1)
+	go z.sweep(z.sweepStop)
+}
+
+// sweep runs an active expiry cycle for keys and one for members every activeExpireInterval, until no key
+// or member has a deadline left or stop is closed.
+func (z *TypedZSet[V]) sweep(stop chan struct{}) {
+	defer z.sweeper.Done()
+
+	ticker := time.NewTicker(activeExpireInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		z.activeExpireCycle()
+		z.activeExpireMembers()
+
+		z.mu.Lock()
+		if len(z.volatile) == 0 && len(z.expiring) == 0 {
+			if z.sweepStop == stop {
+				z.sweepStop = nil
+			}
+			z.mu.Unlock()
+			return
+		}
+		z.mu.Unlock()
+	}
+}
+
+// activeExpireCycle removes expired keys the way the active expiry of Redis does: it samples keys with a
+// deadline and removes the expired ones, and samples again while more than a quarter of the sample had
+// expired and the time budget of the cycle is not spent. The keyspace is only locked for one round at a
+// time, so a cycle does not hold up other callers for long. It returns the number of keys removed.
+func (z *TypedZSet[V]) activeExpireCycle() int {
+	start := time.Now()
+	removed := 0
+
+	for {
+		z.mu.Lock()
+		now := z.clock.Now()
+		sampled, expired := 0, 0
+
+		// Map iteration starts at a random position, which makes the sample random as in Redis
+		for key, set := range z.volatile {
+			if sampled == activeExpireSample {
+				break
+			}
+
+			sampled++
+			if set.expiredAt(now) {
+				z.expireKey(key)
+				expired++
+			}
+		}
+		z.mu.Unlock()
+
+		removed += expired
+		if expired*100 <= sampled*activeExpireRepeat || time.Since(start) >= activeExpireBudget {
+			return removed
+		}
+	}
+}
+
+// ZAddWithTTL adds a member like ZAdd and sets it to expire once the given time has passed.
+//
+// An expired member behaves as if it were not in the sorted set: it is left out of ranks, ranges, counts
+// and scores. Each sorted set keeps the deadlines of its members in an index ordered by deadline, so
+// expired members are found without scanning the set. They are removed when the set is next accessed, or by
+// the background sweeper that also removes expired keys. A deadline is kept when the score or value of the
+// member changes, and cleared when the member is removed. A ttl that is not positive removes the member
+// instead, if it exists, since it would expire at once.
+//
+// Parameters:
+//   - key:    The key associated with the sorted set.
+//   - score:  The score to assign to the member.
+//   - member: The member to add or update in the sorted set.
+//   - value:  The associated value for the member.
+//   - ttl:    How long the member lives from now.
+//
+// Returns:
+//   - 1 if the member is added or updated, 0 if ttl is not positive, the score is NaN or the memory limit
+//     is reached, which ZAddWithTTLChecked reports as ErrNotANumber and ErrOOM.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAddWithTTL("sessions", 1.0, "user1", "token1", 30*time.Minute)
+//	zset.ZAdd("sessions", 2.0, "user2", "token2")
+//
+// In this example, "user1" leaves "sessions" thirty minutes later, while "user2" stays until it is removed.
+func (z *TypedZSet[V]) ZAddWithTTL(key string, score float64, member string, value V, ttl time.Duration) int {
+	if z.ZAddWithTTLChecked(key, score, member, value, ttl) != nil || ttl <= 0 {
+		return 0
+	}
+	return 1
+}
+
+// ZAddWithTTLChecked adds a member with a deadline like ZAddWithTTL, and reports a write refused because of
+// the memory limit.
+//
+// Parameters:
+//   - key:    The key associated with the sorted set.
+//   - score:  The score to assign to the member.
+//   - member: The member to add or update in the sorted set.
+//   - value:  The associated value for the member.
+//   - ttl:    How long the member lives from now; a ttl that is not positive removes the member instead.
+//
+// Returns:
+//   - ErrNotANumber if the score is NaN, or ErrOOM if the memory limit is reached and no key can be evicted,
+//     in which case nothing is written, and nil otherwise.
+//
+// Example:
+//
+//	cache := jellyzset.New()
+//	cache.SetMaxMemory(64<<20, jellyzset.NoEviction)
+//	err := cache.ZAddWithTTLChecked("sessions", 1.0, "user1", "token1", 30*time.Minute)
+//
+// In this example, err is ErrOOM if the cache is full, and "user1" was then not added.
+func (z *TypedZSet[V]) ZAddWithTTLChecked(key string, score float64, member string, value V, ttl time.Duration) error {
+	if math.IsNaN(score) {
+		return ErrNotANumber
+	}
+	if ttl <= 0 {
+		set, unlock := z.writeKey(key, false)
+		defer unlock()
+
+		if set != nil {
+			z.zrem(key, set, member)
+		}
+		return nil
+	}
+
+	if err := z.reserve(); err != nil {
+		return err
+	}
+
+	set, unlock := z.writeKey(key, true)
+	oldScore, existed := set.scoreOf(member)
+	set.add(score, member, value, ZAddOptions{})
+	z.notifyScore(key, member, existed, oldScore, score)
+	z.log(logRecord[V]{op: aofAdd, key: key, entries: []Entry[V]{{Member: member, Score: score, Value: value}}})
+
+	deadline := z.clock.Now().Add(ttl)
+	set.expiries.set(member, deadline)
+	z.log(logRecord[V]{op: aofExpireMember, key: key, members: []string{member}, deadline: deadline})
+	z.serveWaiters(key, set)
+	registered := z.expiring[key] == set && (z.sweepStop != nil || z.closed)
+	unlock()
+
+	// Handing the key to the sweeper changes the keyspace, so only then is the keyspace locked exclusively.
+	if !registered {
+		z.mu.Lock()
+		if z.records[key] == set {
+			z.expiring[key] = set
+			z.startSweeper()
+		}
+		z.mu.Unlock()
+	}
+	return nil
+}
+
+// ZExpireMember sets a member of a sorted set to expire once the given time has passed, like the Redis
+// HEXPIRE command does for the fields of a hash.
+//
+// It behaves like the deadline given by ZAddWithTTL, which it replaces. A ttl that is not positive removes
+// the member at once.
+//
+// Parameters:
+//   - key:    The key associated with the sorted set.
+//   - member: The member to set the deadline of.
+//   - ttl:    How long the member lives from now.
+//
+// Returns:
+//   - true if the member exists, false otherwise.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("ratelimit", 1.0, "request1", nil)
+//	ok := zset.ZExpireMember("ratelimit", "request1", time.Minute)
+//
+// In this example, ok is true and "request1" leaves "ratelimit" a minute later, unless its deadline is changed or removed with ZPersistMember.
+func (z *TypedZSet[V]) ZExpireMember(key, member string, ttl time.Duration) bool {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	return z.expireMemberAt(key, member, z.clock.Now().Add(ttl))
+}
+
+// ZMemberTTL returns how long a member of a sorted set has left to live, like the Redis HTTL command does
+// for the fields of a hash.
+//
+// Parameters:
+//   - key:    The key associated with the sorted set.
+//   - member: The member to look up.
+//
+// Returns:
+//   - The time left until the deadline of the member, TTLNoExpiry if the member has no deadline, or
+//     TTLNotFound if the member or the key does not exist.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAddWithTTL("sessions", 1.0, "user1", "token1", time.Minute)
+//	ttl := zset.ZMemberTTL("sessions", "user1")
+//
+// In this example, ttl will be a minute at most, less the time elapsed since the call to ZAddWithTTL.
+func (z *TypedZSet[V]) ZMemberTTL(key, member string) time.Duration {
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
+		return TTLNotFound
+	}
+	if _, exists := set.records[member]; !exists {
+		return TTLNotFound
+	}
+
+	deadline := set.expiries.deadline(member)
+	if deadline.IsZero() {
+		return TTLNoExpiry
+	}
+
+	ttl := deadline.Sub(z.clock.Now())
+	if ttl <= 0 {
+		return TTLNotFound
+	}
+	return ttl
+}
+
+// ZPersistMember removes the deadline of a member of a sorted set, so that it no longer expires, like the
+// Redis HPERSIST command does for the fields of a hash.
+//
+// Parameters:
+//   - key:    The key associated with the sorted set.
+//   - member: The member to remove the deadline of.
+//
+// Returns:
+//   - true if the member had a deadline, false if it has none or does not exist.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAddWithTTL("sessions", 1.0, "user1", "token1", time.Minute)
+//	ok := zset.ZPersistMember("sessions", "user1")
+//
+// In this example, ok is true and "user1" is kept until it is removed.
+func (z *TypedZSet[V]) ZPersistMember(key, member string) bool {
+	set, unlock := z.writeKey(key, false)
+	defer unlock()
+
+	if set == nil || !set.expiries.remove(member) {
+		return false
+	}
+
+	z.log(logRecord[V]{op: aofPersistMember, key: key, members: []string{member}})
+	return true
+}
+
+// expireMemberAt sets the deadline of a member, or removes the member if the deadline has passed. The
+// caller must hold z.mu exclusively.
+func (z *TypedZSet[V]) expireMemberAt(key, member string, deadline time.Time) bool {
+	set := z.lookup(key)
+	if set == nil {
+		return false
+	}
+
+	if !z.purgeKey(key, set) {
+		return false
+	}
+	node, exists := set.records[member]
+	if !exists {
+		return false
+	}
+
+	if !deadline.After(z.clock.Now()) {
+		set.zsl.delete(node.score, member)
+		set.forget(member)
+		z.notify(EventRemoved, key, member, node.score, 0)
+		z.log(logRecord[V]{op: aofRem, key: key, members: []string{member}})
+		if set.zsl.length == 0 {
+			z.deleteKey(key)
+			z.log(logRecord[V]{op: aofDel, key: key})
+		}
+		return true
+	}
+
+	set.expiries.set(member, deadline)
+	z.expiring[key] = set
+	z.log(logRecord[V]{op: aofExpireMember, key: key, members: []string{member}, deadline: deadline})
+	z.startSweeper()
+	return true
+}
+
+// purgeMembers removes the members of a sorted set that are past their deadline, earliest deadline first,
+// and records their removal. It reports whether it removed the last member, in which case the key is removed
+// as well, as Redis does once the last field of a hash expires: by deleteIfEmpty once the lock of the set is
+// released, or by purgeKey instead when z.mu is held exclusively. The caller must hold z.mu and the write
+// lock of the set, or z.mu exclusively.
+func (z *TypedZSet[V]) purgeMembers(key string, set *zset[V]) bool {
+	now := z.clock.Now()
+
+	var removed []string
+	for set.expiries.dueAt(now) {
+		member := set.expiries.deadlines[0].member
+		score := set.records[member].score
+		set.zsl.delete(score, member)
+		set.forget(member)
+		z.notify(EventRemoved, key, member, score, 0)
+		removed = append(removed, member)
+	}
+
+	if len(removed) == 0 {
+		return false
+	}
+	z.log(logRecord[V]{op: aofRem, key: key, members: removed})
+	return set.zsl.length == 0
+}
+
+// purgeKey removes the members of the sorted set at key that are past their deadline, and the key if none
+// is left. It reports whether the key still exists. The caller must hold z.mu exclusively.
+func (z *TypedZSet[V]) purgeKey(key string, set *zset[V]) bool {
+	if z.purgeMembers(key, set) {
+		z.deleteKey(key)
+		z.log(logRecord[V]{op: aofDel, key: key})
+		return false
+	}
+	return true
+}
+
+// purgeKeys removes the members past their deadline from the sorted sets at the given keys. The caller must
+// hold z.mu exclusively.
+func (z *TypedZSet[V]) purgeKeys(keys []string) {
+	for _, key := range keys {
+		if set := z.lookup(key); set != nil {
+			z.purgeKey(key, set)
+		}
+	}
+}
+
+// rlockSet read-locks a sorted set with no member past its deadline, removing the expired members under the
+// write lock of the set first if there are any. It reports whether that removed the last member, in which
+// case the caller removes the key with deleteIfEmpty once it released its locks. The caller must hold z.mu.
+func (z *TypedZSet[V]) rlockSet(key string, set *zset[V]) bool {
+	emptied := false
+	for {
+		set.mu.RLock()
+		if !set.expiries.dueAt(z.clock.Now()) {
+			return emptied
+		}
+		set.mu.RUnlock()
+
+		set.mu.Lock()
+		emptied = z.purgeMembers(key, set) || emptied
+		set.mu.Unlock()
+	}
+}
+
+// activeExpireMembers removes expired members the way activeExpireCycle removes expired keys, sampling the
+// keys whose members may have a deadline. Keys that no longer hold such members are dropped from the sample
+// space. It returns the number of members removed.
+func (z *TypedZSet[V]) activeExpireMembers() int {
+	start := time.Now()
+	removed := 0
+
+	for {
+		z.mu.Lock()
+		now := z.clock.Now()
+		sampled, expired := 0, 0
+
+		for key, set := range z.expiring {
+			if sampled == activeExpireSample {
+				break
+			}
+
+			sampled++
+			if z.records[key] != set || set.expiries.Len() == 0 {
+				delete(z.expiring, key)
+				continue
+			}
+			if set.expiries.dueAt(now) {
+				before := set.zsl.length
+				z.purgeKey(key, set)
+				removed += int(before - set.zsl.length)
+				expired++
+			}
+		}
+		z.mu.Unlock()
+
+		if expired*100 <= sampled*activeExpireRepeat || time.Since(start) >= activeExpireBudget {
+			return removed
+		}
+	}
+}
+
+// memberExpiries is the expiry index of a sorted set: a min-heap of the deadlines of the members that expire,
+// with the position of each member in the heap, so that the next member to expire is found in constant time
+// and a deadline is set or removed in logarithmic time. It is guarded by the lock of the set.
+type memberExpiries struct {
+	deadlines []memberDeadline
+	pos       map[string]int
+}
+
+// memberDeadline is a member of a sorted set and the time at which it expires.
+type memberDeadline struct {
+	member   string
+	deadline time.Time
+}
+
+func (e *memberExpiries) Len() int { return len(e.deadlines) }
+func (e *memberExpiries) Less(i, j int) bool {
+	return e.deadlines[i].deadline.Before(e.deadlines[j].deadline)
+}
+func (e *memberExpiries) Swap(i, j int) {
+	e.deadlines[i], e.deadlines[j] = e.deadlines[j], e.deadlines[i]
+	e.pos[e.deadlines[i].member] = i
+	e.pos[e.deadlines[j].member] = j
+}
+func (e *memberExpiries) Push(x interface{}) {
+	d := x.(memberDeadline)
+	e.pos[d.member] = len(e.deadlines)
+	e.deadlines = append(e.deadlines, d)
+}
+func (e *memberExpiries) Pop() interface{} {
+	last := e.deadlines[len(e.deadlines)-1]
+	e.deadlines = e.deadlines[:len(e.deadlines)-1]
+	delete(e.pos, last.member)
+	return last
+}
+
+// set sets the deadline of a member, replacing any it had.
+func (e *memberExpiries) set(member string, deadline time.Time) {
+	if i, exists := e.pos[member]; exists {
+		e.deadlines[i].deadline = deadline
+		heap.Fix(e, i)
+		return
+	}
+
+	if e.pos == nil {
+		e.pos = make(map[string]int)
+	}
+	heap.Push(e, memberDeadline{member: member, deadline: deadline})
+}
+
+// remove removes the deadline of a member, and reports whether it had one.
+func (e *memberExpiries) remove(member string) bool {
+	i, exists := e.pos[member]
+	if exists {
+		heap.Remove(e, i)
+	}
+	return exists
+}
+
+// deadline returns the deadline of a member, or the zero time if it has none.
+func (e *memberExpiries) deadline(member string) time.Time {
+	if i, exists := e.pos[member]; exists {
+		return e.deadlines[i].deadline
+	}
+	return time.Time{}
+}
+
+// dueAt reports whether a member has a deadline that is not after now.
+func (e *memberExpiries) dueAt(now time.Time) bool {
+	return len(e.deadlines) > 0 && !now.Before(e.deadlines[0].deadline)
+}
+
+// allDueAt reports whether the members number length and all have a deadline that is not after now.
+func (e *memberExpiries) allDueAt(now time.Time, length uint64) bool {
+	if len(e.deadlines) == 0 || uint64(len(e.deadlines)) != length {
+		return false
+	}
+	for _, d := range e.deadlines {
+		if now.Before(d.deadline) {
+			return false
+		}
+	}
+	return true
+}
+
+// remember records a node of the skip list in the records of the set, and adds its member to the scan index
+// if it is new.
+func (set *zset[V]) remember(node *zslNode[V]) {
+	if _, exists := set.records[node.member]; !exists {
+		set.names.add(node.member)
+	}
+	set.records[node.member] = node
+}
+
+// forget removes a member whose node has been taken out of the skip list from the records of the set, from
+// its scan index and from its expiry index.
+func (set *zset[V]) forget(member string) {
+	delete(set.records, member)
+	set.names.remove(member)
+	set.expiries.remove(member)
+}
@@ -1,3 +1,3 @@
 module github.com/davidandw190/jellyzset
 
-go 1.21.0
+go 1.23
@@ -0,0 +1,326 @@
+package jellyzset
+
+import "iter"
+
+// All returns an iterator over the entries of the sorted set stored at the given key, from the lowest
+// score to the highest.
+//
+// The entries are produced lazily by walking the bottom level of the skip list, so breaking out of the
+// loop early costs nothing for the members that were not reached. The set is only read-locked while each
+// step is taken and never while the loop body runs, so the body may read or modify the ZSet, including
+// the set being iterated.
+//
+// When the set is modified during the iteration, each step continues from the position of the previously
+// returned member in the current state of the set: members inserted ahead of that position are returned,
+// members removed before being reached are not, and a member whose score moves it ahead of or behind that
+// position may be returned twice or not at all. Every other member is returned exactly once, in order. The
+// iteration stops when the key no longer exists.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//
+// Returns:
+//   - An iterator over the entries of the sorted set in ascending order, which yields nothing if the key does not exist.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("leaderboard", 1.0, "member1", "value1")
+//	zset.ZAdd("leaderboard", 2.0, "member2", "value2")
+//	zset.ZAdd("leaderboard", 3.0, "member3", "value3")
+//	for entry := range zset.All("leaderboard") {
+//		if entry.Score > 2.0 {
+//			break
+//		}
+//		fmt.Println(entry.Member)
+//	}
+//
+// In this example, the loop prints "member1" and "member2" and stops at "member3" without visiting the rest of the set.
+func (z *TypedZSet[V]) All(key string) iter.Seq[Entry[V]] {
+	return z.seq(key, false, func(zsl *zskiplist[V]) *zslNode[V] {
+		return zsl.head.level[0].forward
+	}, nil)
+}
+
+// Backward returns an iterator over the entries of the sorted set stored at the given key, from the
+// highest score to the lowest.
+//
+// It behaves like All, including when the set is modified during the iteration, but follows the
+// backward links of the skip list from its tail.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//
+// Returns:
+//   - An iterator over the entries of the sorted set in descending order, which yields nothing if the key does not exist.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("leaderboard", 1.0, "member1", "value1")
+//	zset.ZAdd("leaderboard", 2.0, "member2", "value2")
+//	zset.ZAdd("leaderboard", 3.0, "member3", "value3")
+//	for entry := range zset.Backward("leaderboard") {
+//		fmt.Println(entry.Member)
+//	}
+//
+// In this example, the loop prints "member3", "member2" and "member1".
+func (z *TypedZSet[V]) Backward(key string) iter.Seq[Entry[V]] {
+	return z.seq(key, true, func(zsl *zskiplist[V]) *zslNode[V] {
+		return zsl.tail
+	}, nil)
+}
+
+// Scores returns an iterator over the members of the sorted set stored at the given key paired with their
+// scores, from the lowest score to the highest.
+//
+// It is All without the values, for loops that only need members and scores.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//
+// Returns:
+//   - An iterator over the members and scores of the sorted set in ascending order.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("leaderboard", 1.0, "member1", "value1")
+//	zset.ZAdd("leaderboard", 2.0, "member2", "value2")
+//	for member, score := range zset.Scores("leaderboard") {
+//		fmt.Println(member, score)
+//	}
+//
+// In this example, the loop prints "member1 1" and "member2 2".
+func (z *TypedZSet[V]) Scores(key string) iter.Seq2[string, float64] {
+	return func(yield func(string, float64) bool) {
+		for entry := range z.All(key) {
+			if !yield(entry.Member, entry.Score) {
+				return
+			}
+		}
+	}
+}
+
+// ScoreRange returns an iterator over the entries of the sorted set stored at the given key whose scores
+// lie between min and max, from the lowest score to the highest.
+//
+// It behaves like All, including when the set is modified during the iteration, and stops at the first
+// member past max. Bounds can be built directly or parsed from Redis syntax with ParseScoreBound.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//   - min: The lower bound of the score range.
+//   - max: The upper bound of the score range.
+//
+// Returns:
+//   - An iterator over the entries within the range in ascending order.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("leaderboard", 1.0, "member1", "value1")
+//	zset.ZAdd("leaderboard", 2.0, "member2", "value2")
+//	zset.ZAdd("leaderboard", 3.0, "member3", "value3")
+//	for entry := range zset.ScoreRange("leaderboard", jellyzset.ScoreBound{Value: 1.0, Exclusive: true}, jellyzset.ScoreBound{Value: 3.0}) {
+//		fmt.Println(entry.Member)
+//	}
+//
+// In this example, the loop prints "member2" and "member3".
+func (z *TypedZSet[V]) ScoreRange(key string, min, max ScoreBound) iter.Seq[Entry[V]] {
+	r := boundsRange(min, max)
+	return z.seq(key, false, func(zsl *zskiplist[V]) *zslNode[V] {
+		return zsl.firstInRange(r)
+	}, func(node *zslNode[V]) bool {
+		return r.lteMax(node.score)
+	})
+}
+
+// RevScoreRange returns an iterator over the entries of the sorted set stored at the given key whose scores
+// lie between max and min, from the highest score to the lowest.
+//
+// It is the reverse of ScoreRange and takes its bounds in the same order as ZREVRANGEBYSCORE.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//   - max: The upper bound of the score range.
+//   - min: The lower bound of the score range.
+//
+// Returns:
+//   - An iterator over the entries within the range in descending order.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("leaderboard", 1.0, "member1", "value1")
+//	zset.ZAdd("leaderboard", 2.0, "member2", "value2")
+//	zset.ZAdd("leaderboard", 3.0, "member3", "value3")
+//	for entry := range zset.RevScoreRange("leaderboard", jellyzset.ScoreBound{Value: math.Inf(1)}, jellyzset.ScoreBound{Value: 2.0}) {
+//		fmt.Println(entry.Member)
+//	}
+//
+// In this example, the loop prints "member3" and "member2".
+func (z *TypedZSet[V]) RevScoreRange(key string, max, min ScoreBound) iter.Seq[Entry[V]] {
+	r := boundsRange(min, max)
+	return z.seq(key, true, func(zsl *zskiplist[V]) *zslNode[V] {
+		return zsl.lastInRange(r)
+	}, func(node *zslNode[V]) bool {
+		return r.gteMin(node.score)
+	})
+}
+
+// LexRange returns an iterator over the entries of the sorted set stored at the given key whose members
+// lie between min and max in lexicographic order, from the lowest member to the highest.
+//
+// As with ZRangeByLex, the range is only meaningful when all members share the same score. It behaves like
+// All, including when the set is modified during the iteration. Bounds can be built directly or parsed
+// from Redis syntax with ParseLexBound.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//   - min: The lower bound of the lexicographic range.
+//   - max: The upper bound of the lexicographic range.
+//
+// Returns:
+//   - An iterator over the entries within the range in ascending order.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("names", 0, "alice", nil)
+//	zset.ZAdd("names", 0, "bob", nil)
+//	zset.ZAdd("names", 0, "carol", nil)
+//	min, _ := jellyzset.ParseLexBound("[b")
+//	max, _ := jellyzset.ParseLexBound("+")
+//	for entry := range zset.LexRange("names", min, max) {
+//		fmt.Println(entry.Member)
+//	}
+//
+// In this example, the loop prints "bob" and "carol".
+func (z *TypedZSet[V]) LexRange(key string, min, max LexBound) iter.Seq[Entry[V]] {
+	r := lexRange{min: min, max: max}
+	return z.seq(key, false, func(zsl *zskiplist[V]) *zslNode[V] {
+		return zsl.firstInLexRange(r)
+	}, func(node *zslNode[V]) bool {
+		return r.lteMax(node.member)
+	})
+}
+
+// RevLexRange returns an iterator over the entries of the sorted set stored at the given key whose members
+// lie between max and min in lexicographic order, from the highest member to the lowest.
+//
+// It is the reverse of LexRange and takes its bounds in the same order as ZREVRANGEBYLEX.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//   - max: The upper bound of the lexicographic range.
+//   - min: The lower bound of the lexicographic range.
+//
+// Returns:
+//   - An iterator over the entries within the range in descending order.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("names", 0, "alice", nil)
+//	zset.ZAdd("names", 0, "bob", nil)
+//	zset.ZAdd("names", 0, "carol", nil)
+//	max, _ := jellyzset.ParseLexBound("(carol")
+//	min, _ := jellyzset.ParseLexBound("-")
+//	for entry := range zset.RevLexRange("names", max, min) {
+//		fmt.Println(entry.Member)
+//	}
+//
+// In this example, the loop prints "bob" and "alice".
+func (z *TypedZSet[V]) RevLexRange(key string, max, min LexBound) iter.Seq[Entry[V]] {
+	r := lexRange{min: min, max: max}
+	return z.seq(key, true, func(zsl *zskiplist[V]) *zslNode[V] {
+		return zsl.lastInLexRange(r)
+	}, func(node *zslNode[V]) bool {
+		return r.gteMin(node.member)
+	})
+}
+
+// seq returns an iterator over the sorted set at the given key that starts at the node returned by first and
+// follows the skip list in the direction given by reverse for as long as inRange holds, or to the end when
+// inRange is nil. The set is read-locked for each step only, and only the first step counts as an access to
+// the key. A step follows the links of the previous node while it is still in the set with the same score,
+// and otherwise searches for its old position.
+func (z *TypedZSet[V]) seq(key string, reverse bool, first func(*zskiplist[V]) *zslNode[V], inRange func(*zslNode[V]) bool) iter.Seq[Entry[V]] {
+	return func(yield func(Entry[V]) bool) {
+		var last *zslNode[V]
+		var entry Entry[V]
+
+		lock := z.readKey
+		for {
+			set, unlock := lock(key)
+			lock = z.rlockKey // A whole iteration is a single access to the key, for eviction
+			if set == nil {
+				unlock()
+				return
+			}
+
+			var node *zslNode[V]
+			switch {
+			case last == nil:
+				node = first(set.zsl)
+			case set.records[last.member] == last && last.score == entry.Score:
+				node = set.getNextNode(last, reverse)
+			case reverse:
+				node = set.zsl.lastBefore(entry.Score, entry.Member)
+			default:
+				node = set.zsl.firstAfter(entry.Score, entry.Member)
+			}
+
+			if node == nil || (inRange != nil && !inRange(node)) {
+				unlock()
+				return
+			}
+
+			last, entry = node, node.entry()
+			unlock()
+
+			if !yield(entry) {
+				return
+			}
+		}
+	}
+}
+
+// firstAfter returns the first node ordered after the given score and member, or nil if there is none.
+func (zsl *zskiplist[V]) firstAfter(score float64, member string) *zslNode[V] {
+	currentNode := zsl.head
+	for level := zsl.level - 1; level >= 0; level-- {
+		for currentNode.level[level].forward != nil {
+			nextNode := currentNode.level[level].forward
+			if nextNode.score < score || (nextNode.score == score && nextNode.member <= member) {
+				currentNode = nextNode
+			} else {
+				break
+			}
+		}
+	}
+
+	return currentNode.level[0].forward
+}
+
+// lastBefore returns the last node ordered before the given score and member, or nil if there is none.
+func (zsl *zskiplist[V]) lastBefore(score float64, member string) *zslNode[V] {
+	currentNode := zsl.head
+	for level := zsl.level - 1; level >= 0; level-- {
+		for currentNode.level[level].forward != nil {
+			nextNode := currentNode.level[level].forward
+			if nextNode.score < score || (nextNode.score == score && nextNode.member < member) {
+				currentNode = nextNode
+			} else {
+				break
+			}
+		}
+	}
+
+	if currentNode == zsl.head {
+		return nil
+	}
+
+	return currentNode
+}
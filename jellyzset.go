@@ -35,20 +35,102 @@ package jellyzset
 //   - https://www.youtube.com/watch?v=NDGpsfwAaqo
 
 import (
+	"context"
 	"errors"
 	"math"
 	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	SkipListMaxLvl  = 32   // Maximum level for the skip list, 2^32 elements
 	SkipProbability = 0.25 // Probability for the skip list, 1/4
+
+	defaultScanCount = 10 // Number of elements visited by ZScan and Scan when no count is given, as in Redis
+)
+
+var (
+	// ErrNotANumber is returned when an operation would leave a member with a NaN score.
+	ErrNotANumber = errors.New("resulting score is not a number (NaN)")
+
+	// ErrXXAndNX is returned by ZAddWithOptions when both XX and NX are set.
+	ErrXXAndNX = errors.New("XX and NX options at the same time are not compatible")
+
+	// ErrGTLTAndNX is returned by ZAddWithOptions when more than one of GT, LT and NX is set.
+	ErrGTLTAndNX = errors.New("GT, LT, and/or NX options at the same time are not compatible")
+
+	// ErrInvalidLexRange is returned when a lexicographic range bound is not "-", "+", or prefixed by "[" or "(".
+	ErrInvalidLexRange = errors.New("min or max not valid string range item")
+
+	// ErrInvalidScoreRange is returned by ParseScoreBound when a bound is not a number, optionally prefixed by "(".
+	ErrInvalidScoreRange = errors.New("min or max is not a float")
+
+	// ErrNoInputKeys is returned by the set operations when no source key is given.
+	ErrNoInputKeys = errors.New("at least 1 input key is needed")
+
+	// ErrWeightsMismatch is returned when the number of weights differs from the number of source keys.
+	ErrWeightsMismatch = errors.New("the number of weights must match the number of keys")
+
+	// ErrNegativeLimit is returned by ZInterCard when the limit is negative.
+	ErrNegativeLimit = errors.New("LIMIT can't be negative")
+
+	// ErrIncrMultiplePairs is returned by ZAddWithOptions when INCR is used with more than one member.
+	ErrIncrMultiplePairs = errors.New("INCR option supports a single increment-element pair")
+
+	// ErrKeyNotFound is returned by ZPopMin and ZPopMax when the key does not exist or its sorted set is empty.
+	ErrKeyNotFound = errors.New("key does not exist")
+
+	// ErrNegativeCount is returned by ZPopMinCount, ZPopMaxCount, ZScan and Scan when the count is negative.
+	ErrNegativeCount = errors.New("value is out of range, must be positive")
+)
+
+// Outcomes reported by zset.add, mirroring the out flags of the Redis zsetAdd function.
+const (
+	zaddNop     = iota // Nothing changed, either because of a flag or because the score is the same
+	zaddAdded          // The member was added
+	zaddUpdated        // The score of an existing member was updated
+	zaddAborted        // The operation was skipped because of NX, XX, GT or LT
 )
 
-// ZSet represents a collection of sorted sets, each identified by a unique key.
-// It uses a map to store references to individual sorted sets.
-type ZSet struct {
-	records map[string]*zset
+// TypedZSet represents a collection of sorted sets, each identified by a unique key, whose members
+// carry a value of type V. It uses a map to store references to individual sorted sets, and is safe for concurrent use.
+type TypedZSet[V any] struct {
+	mu        sync.RWMutex // Guards the keyspace; each sorted set is guarded by its own lock
+	records   map[string]*zset[V]
+	waitersMu sync.Mutex
+	waiters   map[string][]*popWaiter[V]           // Clients blocked in BZPopMin or BZPopMax, in arrival order per key
+	codec     ValueCodec[V]                        // Encodes values in snapshots and the append-only log, guarded by mu
+	aof       *appendLog                           // Append-only log recording every mutation, nil when none is open; guarded by mu
+	clock     Clock                                // Tells the time for key expiry, guarded by mu
+	volatile  map[string]*zset[V]                  // Keys with a deadline, sampled by the expiry sweeper; guarded by mu
+	expiring  map[string]*zset[V]                  // Keys whose members may have a deadline, sampled by the expiry sweeper; guarded by mu
+	used      atomic.Int64                         // Estimated memory used by the keys and their members, kept up to date by the skip lists
+	maxMemory int64                                // Memory limit enforced by evicting keys, 0 for none; guarded by mu
+	policy    EvictionPolicy                       // Which keys are evicted to stay under maxMemory, guarded by mu
+	onEvict   func(key string, entries []Entry[V]) // Called with the evicted keys, guarded by mu
+	sweepStop chan struct{}                        // Closed to stop the expiry sweeper, nil while it is not running; guarded by mu
+	sweeper   sync.WaitGroup                       // Running expiry sweeper, waited for by Close
+	closed    bool                                 // Whether Close was called, in which case the sweeper no longer starts; guarded by mu
+	subsMu    sync.Mutex                           // Serializes the changes to subs
+	subs      atomic.Pointer[[]*Subscription]      // Subscriptions to keyspace events, nil when there are none
+	versions  atomic.Uint64                        // Last version given to a key, versions being shared by all keys
+	removed   uint64                               // Version given out when a key was last removed, guarded by mu
+	txn       *Tx[V]                               // Transaction holding the keyspace lock, nil when none is running; guarded by mu
+	keys      scanIndex                            // Keys in the order Scan visits them, guarded by mu
+}
+
+// Entry is a member of a sorted set together with its score and value, as returned by the TypedZSet methods.
+// An Entry is a copy taken when it is returned, so it stays the same when the sorted set changes and
+// modifying it has no effect on the sorted set.
+type Entry[V any] struct {
+	Member string
+	Score  float64
+	Value  V
 }
 
 // ZRangeConfig specifies the configuration for ZRangeByScore method to customize the range query.
@@ -58,66 +140,368 @@ type ZRangeConfig struct {
 	ExcludeEnd   bool // Exclude end value, so it searches in the interval [start, end) or (start, end)
 }
 
+// RangeQuery describes a range query for ZRangeQuery, mirroring the Redis ZRANGE command with its BYSCORE,
+// BYLEX, REV, LIMIT and WITHSCORES options. It is created with RangeByRank, RangeByScore or RangeByLex and
+// refined with its chainable methods, each of which returns a modified copy.
+type RangeQuery struct {
+	by         rangeBy
+	startRank  int
+	stopRank   int
+	startScore ScoreBound
+	stopScore  ScoreBound
+	startLex   LexBound
+	stopLex    LexBound
+	err        error // Error from parsing the bounds of RangeByLex, reported by ZRangeQuery
+	rev        bool
+	offset     int
+	count      int // -1 for no limit
+	withScores bool
+}
+
+// rangeBy selects how the start and stop bounds of a RangeQuery are interpreted.
+type rangeBy int
+
+const (
+	byRank rangeBy = iota
+	byScore
+	byLex
+)
+
+// ZAddOptions specifies the flags for ZAddWithOptions, mirroring the options of the Redis ZADD command.
+type ZAddOptions struct {
+	NX   bool // Only add new members, never update existing ones
+	XX   bool // Only update existing members, never add new ones
+	GT   bool // Only update existing members if the new score is greater than the current one
+	LT   bool // Only update existing members if the new score is less than the current one
+	CH   bool // Count members whose score changed in addition to the ones that were added
+	INCR bool // Increment the score of a single member instead of setting it, like ZIncrBy
+}
+
+// Aggregate selects how the set operations combine the scores of a member found in several sorted sets.
+type Aggregate int
+
+const (
+	AggregateSum Aggregate = iota // Add the weighted scores together
+	AggregateMin                  // Keep the lowest weighted score
+	AggregateMax                  // Keep the highest weighted score
+)
+
+// ZStoreOptions specifies the WEIGHTS and AGGREGATE options of ZUnionStore, ZInterStore, ZUnion and ZInter.
+type ZStoreOptions struct {
+	Weights   []float64 // Multiplication factor for the scores of each source key, all 1 when nil
+	Aggregate Aggregate // How scores of the same member are combined, AggregateSum by default
+}
+
+// ZMember is a (score, member, value) tuple used to add several members at once.
+type ZMember struct {
+	Score  float64
+	Member string
+	Value  interface{}
+}
+
+// scoreRange is a range of scores with optionally excluded bounds, used by the score based methods.
+type scoreRange struct {
+	min   float64
+	max   float64
+	minex bool
+	maxex bool
+}
+
+// ScoreBound is one end of a score range, as written in Redis commands such as ZRANGEBYSCORE: a score
+// like "1.5", an exclusive score like "(1.5", or "-inf" and "+inf". Use ParseScoreBound to read one from a string.
+type ScoreBound struct {
+	Value     float64 // The score, which may be math.Inf(-1) or math.Inf(1)
+	Exclusive bool    // Whether the score itself is excluded from the range
+}
+
+// LexBound is one end of a lexicographic range, as written in Redis commands such as ZRANGEBYLEX:
+// "[member" is inclusive, "(member" is exclusive, and "-" and "+" stand for the lowest and highest
+// possible members. Use ParseLexBound to read one from a string.
+type LexBound struct {
+	Value     string // The member, ignored when Inf is not 0
+	Exclusive bool   // Whether the member itself is excluded from the range
+	Inf       int    // -1 for "-", 1 for "+", 0 for a regular member
+}
+
+// lexRange is a lexicographic range of members, used by the ZRangeByLex family of methods.
+type lexRange struct {
+	min LexBound
+	max LexBound
+}
+
+// popWaiter is a client blocked in BZPopMin or BZPopMax until a member is available on one of its keys.
+type popWaiter[V any] struct {
+	keys   []string
+	max    bool
+	result chan poppedMember[V]
+}
+
+// poppedMember is the member handed to a popWaiter, along with the key it was popped from.
+type poppedMember[V any] struct {
+	key  string
+	node *zslNode[V]
+}
+
 // zset represents an individual sorted set in the ZSet data structure.
 // It contains references to the skip list and a map of elements.
-type zset struct {
-	records map[string]*zslNode
-	zsl     *zskiplist
+type zset[V any] struct {
+	mu       sync.RWMutex
+	records  map[string]*zslNode[V]
+	zsl      *zskiplist[V]
+	names    scanIndex      // Members in the order ZScan visits them
+	deadline time.Time      // When the key expires, zero if it never does; guarded by the keyspace lock
+	expiries memberExpiries // Deadlines of the members that expire
+	version  uint64         // Changed by every mutation of the key, for Watch
+
+	accessed  atomic.Int64  // When the key was created or loaded, or last read or written while a memory limit is set, in Unix nanoseconds
+	frequency atomic.Uint32 // Logarithmic access counter of the key, used by AllKeysLFU
 }
 
 // zskiplist is a skip list-based data structure used to maintain order in the sorted set.
-type zskiplist struct {
-	head   *zslNode
-	tail   *zslNode
+type zskiplist[V any] struct {
+	head   *zslNode[V]
+	tail   *zslNode[V]
 	length uint64
 	level  int
+	size   int64         // Estimated memory used by the nodes
+	used   *atomic.Int64 // Estimated memory used by the ZSet holding the skip list, nil while it is held by none
 }
 
 // zslNode represents a node in the skip list, containing information about the element,
 // its score, and references to the next nodes in different levels.
-type zslNode struct {
+type zslNode[V any] struct {
 	member    string
-	value     interface{}
+	value     V
 	score     float64
-	backwards *zslNode
-	level     []*zslLevel
+	backwards *zslNode[V]
+	level     []*zslLevel[V]
 }
 
 // zslLevel represents a level in the skip list, containing references to the forward node and
 // the span, which is the number of elements between the current node and the next node in that level.
-type zslLevel struct {
-	forward *zslNode
+type zslLevel[V any] struct {
+	forward *zslNode[V]
 	span    uint64
 }
 
-// New creates a new instance of the ZSet data structure.
-func New() *ZSet {
-	return &ZSet{
-		make(map[string]*zset),
+// NewTyped creates a new instance of the TypedZSet data structure, holding values of type V.
+func NewTyped[V any]() *TypedZSet[V] {
+	return &TypedZSet[V]{
+		records:  make(map[string]*zset[V]),
+		waiters:  make(map[string][]*popWaiter[V]),
+		codec:    GobCodec[V]{},
+		clock:    systemClock{},
+		volatile: make(map[string]*zset[V]),
+		expiring: make(map[string]*zset[V]),
+	}
+}
+
+// RangeByRank creates a query selecting the members from rank start to rank stop, both inclusive.
+//
+// Ranks are 0-based and negative ranks count from the end, so -1 is the last member. With Rev, ranks
+// are counted from the member with the highest score, as in Redis ZRANGE ... REV.
+func RangeByRank(start, stop int) RangeQuery {
+	return RangeQuery{by: byRank, startRank: start, stopRank: stop, count: -1}
+}
+
+// RangeByScore creates a query selecting the members with scores from start to stop, both inclusive unless
+// excluded with ExcludeStart or ExcludeEnd.
+//
+// As in Redis ZRANGE ... BYSCORE REV, start is the highest score of the range when the query is reversed.
+func RangeByScore(start, stop float64) RangeQuery {
+	return RangeByScoreBounds(ScoreBound{Value: start}, ScoreBound{Value: stop})
+}
+
+// RangeByScoreBounds creates a query selecting the members with scores between two bounds, which may
+// have been parsed from Redis syntax with ParseScoreBound.
+//
+// As in Redis ZRANGE ... BYSCORE REV, start is the upper bound of the range when the query is reversed.
+func RangeByScoreBounds(start, stop ScoreBound) RangeQuery {
+	return RangeQuery{by: byScore, startScore: start, stopScore: stop, count: -1}
+}
+
+// RangeByLex creates a query selecting the members from start to stop lexicographically, using the bound
+// syntax of ZRangeByLex ("[member", "(member", "-" and "+").
+//
+// As in Redis ZRANGE ... BYLEX REV, start is the highest member of the range when the query is reversed.
+func RangeByLex(start, stop string) RangeQuery {
+	startBound, err := ParseLexBound(start)
+	if err != nil {
+		return RangeQuery{by: byLex, err: err}
+	}
+
+	stopBound, err := ParseLexBound(stop)
+	if err != nil {
+		return RangeQuery{by: byLex, err: err}
+	}
+
+	return RangeByLexBounds(startBound, stopBound)
+}
+
+// RangeByLexBounds creates a query selecting the members between two lexicographic bounds.
+//
+// As in Redis ZRANGE ... BYLEX REV, start is the upper bound of the range when the query is reversed.
+func RangeByLexBounds(start, stop LexBound) RangeQuery {
+	return RangeQuery{by: byLex, startLex: start, stopLex: stop, count: -1}
+}
+
+// Rev returns a copy of the query that returns the members from the highest score to the lowest.
+func (q RangeQuery) Rev() RangeQuery {
+	q.rev = true
+	return q
+}
+
+// Limit returns a copy of the query that skips the first offset matching members and returns at most
+// count members. A negative count returns all the remaining members, and a negative offset returns none.
+func (q RangeQuery) Limit(offset, count int) RangeQuery {
+	q.offset, q.count = offset, count
+	return q
+}
+
+// ExcludeStart returns a copy of the query whose start score is excluded from the range.
+// Lexicographic ranges exclude their bounds with the "(" prefix instead.
+func (q RangeQuery) ExcludeStart() RangeQuery {
+	q.startScore.Exclusive = true
+	return q
+}
+
+// ExcludeEnd returns a copy of the query whose stop score is excluded from the range.
+// Lexicographic ranges exclude their bounds with the "(" prefix instead.
+func (q RangeQuery) ExcludeEnd() RangeQuery {
+	q.stopScore.Exclusive = true
+	return q
+}
+
+// WithScores returns a copy of the query that interleaves scores with members in the flattened results
+// of ZSet.ZRangeQuery. Entries always carry their score, so it has no effect on TypedZSet.ZRangeQuery.
+func (q RangeQuery) WithScores() RangeQuery {
+	q.withScores = true
+	return q
+}
+
+// ParseScoreBound parses a score bound written in Redis syntax.
+//
+// The bound is a number, optionally prefixed by "(" to exclude it from the range. Infinite bounds are
+// written "-inf" and "+inf" (or "inf"), like in Redis.
+//
+// Parameters:
+//   - bound: The bound to parse, such as "1.5", "(1.5", "-inf" or "+inf".
+//
+// Returns:
+//   - The parsed bound.
+//   - ErrInvalidScoreRange if the bound is not a valid number.
+//
+// Example:
+//
+//	min, _ := jellyzset.ParseScoreBound("(1.5")
+//	max, _ := jellyzset.ParseScoreBound("+inf")
+//	count := zset.ZCountBounds("mySortedSet", min, max)
+//
+// In this example, count will be the number of members with a score strictly greater than 1.5.
+func ParseScoreBound(bound string) (ScoreBound, error) {
+	var b ScoreBound
+	if strings.HasPrefix(bound, "(") {
+		b.Exclusive = true
+		bound = bound[1:]
+	}
+
+	value, err := strconv.ParseFloat(bound, 64)
+	if err != nil || math.IsNaN(value) {
+		return ScoreBound{}, ErrInvalidScoreRange
+	}
+
+	b.Value = value
+	return b, nil
+}
+
+// String returns the bound in Redis syntax, such as "1.5", "(1.5", "-inf" or "+inf".
+func (b ScoreBound) String() string {
+	var value string
+	switch {
+	case math.IsInf(b.Value, 1):
+		value = "+inf"
+	case math.IsInf(b.Value, -1):
+		value = "-inf"
+	default:
+		value = strconv.FormatFloat(b.Value, 'g', -1, 64)
+	}
+
+	if b.Exclusive {
+		return "(" + value
+	}
+	return value
+}
+
+// ParseLexBound parses a lexicographic bound written in Redis syntax.
+//
+// "[member" is inclusive, "(member" is exclusive, and "-" and "+" stand for the lowest and highest
+// possible members. Like in Redis, "-" and "+" are treated as exclusive.
+//
+// Parameters:
+//   - bound: The bound to parse, such as "[apple", "(apple", "-" or "+".
+//
+// Returns:
+//   - The parsed bound.
+//   - ErrInvalidLexRange if the bound is not "-", "+", or prefixed by "[" or "(".
+//
+// Example:
+//
+//	min, _ := jellyzset.ParseLexBound("[ap")
+//	max, _ := jellyzset.ParseLexBound("(aq")
+//	count := zset.ZLexCountBounds("autocomplete", min, max)
+//
+// In this example, count will be the number of members starting with "ap".
+func ParseLexBound(bound string) (LexBound, error) {
+	switch {
+	case bound == "+":
+		return LexBound{Inf: 1, Exclusive: true}, nil
+	case bound == "-":
+		return LexBound{Inf: -1, Exclusive: true}, nil
+	case strings.HasPrefix(bound, "["):
+		return LexBound{Value: bound[1:]}, nil
+	case strings.HasPrefix(bound, "("):
+		return LexBound{Value: bound[1:], Exclusive: true}, nil
+	}
+
+	return LexBound{}, ErrInvalidLexRange
+}
+
+// String returns the bound in Redis syntax, such as "[apple", "(apple", "-" or "+".
+func (b LexBound) String() string {
+	switch {
+	case b.Inf < 0:
+		return "-"
+	case b.Inf > 0:
+		return "+"
+	case b.Exclusive:
+		return "(" + b.Value
 	}
+
+	return "[" + b.Value
 }
 
 // createNode creates a new zslNode with the given parameters.
 // It initializes the levels based on the specified level.
-func createNode(level int, score float64, member string, value interface{}) *zslNode {
-	newNode := &zslNode{
+func createNode[V any](level int, score float64, member string, value V) *zslNode[V] {
+	newNode := &zslNode[V]{
 		score:  score,
 		member: member,
 		value:  value,
-		level:  make([]*zslLevel, level),
+		level:  make([]*zslLevel[V], level),
 	}
 
 	for i := range newNode.level {
-		newNode.level[i] = new(zslLevel)
+		newNode.level[i] = new(zslLevel[V])
 	}
 
 	return newNode
 }
 
 // newZSkipList creates a new instance of the zskiplist with an initial head node.
-func newZSkipList() *zskiplist {
-	head := createNode(SkipListMaxLvl, 0, "", nil)
-	return &zskiplist{
+func newZSkipList[V any]() *zskiplist[V] {
+	var zero V
+	head := createNode(SkipListMaxLvl, 0, "", zero)
+	return &zskiplist[V]{
 		level: 1,
 		head:  head,
 		tail:  head,
@@ -136,7 +520,8 @@ func newZSkipList() *zskiplist {
 //   - value:   The associated value for the member.
 //
 // Returns:
-//   - 1 if the member is added or updated successfully, 0 otherwise.
+//   - 1 if the member is added or updated successfully, 0 if the score is NaN or the memory limit is
+//     reached, which ZAddChecked reports as ErrNotANumber and ErrOOM.
 //
 // Example:
 //
@@ -146,32 +531,313 @@ func newZSkipList() *zskiplist {
 //	zset.ZAdd("mySortedSet", 4.2, "member1", "updatedValue1")
 //
 // In this example, we create a sorted set "mySortedSet" and add two members, "member1" and "member2," with their respective scores and values. The third ZAdd call updates "member1" with a new value and score.
-func (z *ZSet) ZAdd(key string, score float64, member string, value interface{}) int {
-	set, exists := z.records[key]
-	if !exists {
-		set = &zset{
-			records: make(map[string]*zslNode),
-			zsl:     newZSkipList(),
+func (z *TypedZSet[V]) ZAdd(key string, score float64, member string, value V) int {
+	if z.ZAddChecked(key, score, member, value) != nil {
+		return 0
+	}
+	return 1
+}
+
+// ZAddChecked adds a member or replaces its score and value like ZAdd, and reports a write refused because
+// of the memory limit, which ZAdd cannot tell apart from a successful one by its result alone.
+//
+// Parameters:
+//   - key:     The key associated with the sorted set.
+//   - score:   The score to assign to the member.
+//   - member:  The member to add or update in the sorted set.
+//   - value:   The associated value for the member.
+//
+// Returns:
+//   - ErrNotANumber if the score is NaN, or ErrOOM if the memory limit is reached and no key can be evicted,
+//     in which case nothing is written, and nil otherwise.
+//
+// Example:
+//
+//	cache := jellyzset.New()
+//	cache.SetMaxMemory(64<<20, jellyzset.NoEviction)
+//	if err := cache.ZAddChecked("leaderboard", 10, "player1", nil); err == jellyzset.ErrOOM {
+//		// the write was refused
+//	}
+//
+// In this example, the caller learns that "player1" was not added once the cache is full, rather than losing it silently.
+func (z *TypedZSet[V]) ZAddChecked(key string, score float64, member string, value V) error {
+	if math.IsNaN(score) {
+		return ErrNotANumber
+	}
+	if err := z.reserve(); err != nil {
+		return err
+	}
+
+	set, unlock := z.writeKey(key, true)
+	defer unlock()
+
+	z.zadd(key, set, score, member, value)
+	return nil
+}
+
+// ZAddWithOptions adds members to the sorted set stored at the given key, honouring the Redis ZADD flags.
+//
+// NX only adds new members and XX only updates existing ones. GT and LT only update an existing member
+// when the new score is greater or less than its current score; they never prevent new members from
+// being added. With INCR, the single member's score is incremented by the given score instead of being
+// replaced, and the member's existing value is kept. Invalid flag combinations are rejected the same
+// way Redis rejects them, before anything is modified.
+//
+// Parameters:
+//   - key:     The key associated with the sorted set.
+//   - opts:    The ZADD flags to apply.
+//   - members: The members to add or update, with their scores and values.
+//
+// Returns:
+//   - The number of members added, or added and updated when CH is set. With INCR this is 1 if the
+//     increment was applied and 0 if a flag prevented it; use ZAddIncr to get the resulting score.
+//   - An error if the flags are incompatible, INCR is used with several members, or a score is NaN,
+//     or ErrOOM if the memory limit is reached.
+//
+// Example:
+//
+//	zset := jellyzset.NewTyped[string]()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	added, err := zset.ZAddWithOptions("mySortedSet", jellyzset.ZAddOptions{GT: true, CH: true},
+//		jellyzset.Entry[string]{Member: "member1", Score: 5.0},
+//		jellyzset.Entry[string]{Member: "member2", Score: 1.0})
+//
+// In this example, "member1" is raised to 5.0 because the new score is greater, and "member2" is added. Since CH is set, added will be 2.
+func (z *TypedZSet[V]) ZAddWithOptions(key string, opts ZAddOptions, members ...Entry[V]) (int, error) {
+	if err := opts.validate(len(members)); err != nil {
+		return 0, err
+	}
+
+	for _, m := range members {
+		if math.IsNaN(m.Score) {
+			return 0, ErrNotANumber
 		}
-		z.records[key] = set
 	}
 
-	existingNode, memberExists := set.records[member]
+	if len(members) == 0 {
+		return 0, nil
+	}
 
-	if memberExists && existingNode.score == score {
-		// The member already exists with the same score; update the value.
-		existingNode.value = value
-	} else {
-		// The member is new or has a different score; insert it.
-		if memberExists {
-			set.zsl.delete(existingNode.score, member)
+	if err := z.reserve(); err != nil {
+		return 0, err
+	}
+
+	set, unlock := z.writeKey(key, !opts.XX)
+	defer unlock()
+
+	if set == nil {
+		return 0, nil
+	}
+
+	count := 0
+	var applied []Entry[V]
+	for _, m := range members {
+		oldScore, existed := set.scoreOf(m.Member)
+		score, outcome, err := set.add(m.Score, m.Member, m.Value, opts)
+		if err != nil {
+			return count, err
+		}
+
+		if outcome != zaddAborted {
+			applied = append(applied, set.records[m.Member].entry())
+			z.notifyScore(key, m.Member, existed, oldScore, score)
+		}
+
+		switch {
+		case outcome == zaddAdded,
+			outcome == zaddUpdated && opts.CH,
+			outcome != zaddAborted && opts.INCR:
+			count++
 		}
+	}
 
-		newNode := set.zsl.insert(score, member, value)
-		set.records[member] = newNode
+	if len(applied) > 0 {
+		z.log(logRecord[V]{op: aofAdd, key: key, entries: applied})
 	}
 
-	return 1
+	z.serveWaiters(key, set)
+	return count, nil
+}
+
+// ZAddIncr increments the score of a member like ZAddWithOptions with the INCR flag and returns the new score.
+//
+// Parameters:
+//   - key:       The key associated with the sorted set.
+//   - opts:      The ZADD flags to apply; INCR is implied.
+//   - increment: The amount to add to the member's score.
+//   - member:    The member whose score is incremented.
+//   - value:     The value to store if the member is added; an existing member keeps its value.
+//
+// Returns:
+//   - The new score of the member.
+//   - false if NX, XX, GT or LT prevented the increment, true otherwise.
+//   - An error if the flags are incompatible or the resulting score would be NaN, or ErrOOM if the memory
+//     limit is reached.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	score, ok, err := zset.ZAddIncr("mySortedSet", jellyzset.ZAddOptions{XX: true}, 1.5, "member1", nil)
+//
+// In this example, "member1" exists, so its score is incremented to 5.0 and ok is true.
+func (z *TypedZSet[V]) ZAddIncr(key string, opts ZAddOptions, increment float64, member string, value V) (float64, bool, error) {
+	opts.INCR = true
+	if err := opts.validate(1); err != nil {
+		return 0, false, err
+	}
+
+	if math.IsNaN(increment) {
+		return 0, false, ErrNotANumber
+	}
+
+	if err := z.reserve(); err != nil {
+		return 0, false, err
+	}
+
+	set, unlock := z.writeKey(key, !opts.XX)
+	defer unlock()
+
+	if set == nil {
+		return 0, false, nil
+	}
+
+	oldScore, existed := set.scoreOf(member)
+	score, outcome, err := set.add(increment, member, value, opts)
+	if err != nil || outcome == zaddAborted {
+		return 0, false, err
+	}
+
+	z.notifyScore(key, member, existed, oldScore, score)
+	z.log(logRecord[V]{op: aofAdd, key: key, entries: []Entry[V]{set.records[member].entry()}})
+	z.serveWaiters(key, set)
+	return score, true, nil
+}
+
+// ZAddMany adds or updates many members of the sorted set stored at the given key in one call.
+//
+// The members are sorted by score and member and threaded into the skip list in a single pass, so
+// loading many members is considerably cheaper than calling ZAdd for each one. When the key does not
+// exist or its sorted set is empty, the skip list is built in linear time. If the same member appears
+// more than once, the last occurrence wins, as if the members had been added one by one.
+//
+// Parameters:
+//   - key:     The key associated with the sorted set.
+//   - members: The members to add or update, with their scores and values.
+//
+// Returns:
+//   - The number of members that were added; updated members are not counted.
+//   - ErrNotANumber if any score is NaN, in which case nothing is added, or ErrOOM if the memory limit is reached.
+//
+// Example:
+//
+//	zset := jellyzset.NewTyped[string]()
+//	added, err := zset.ZAddMany("mySortedSet",
+//		jellyzset.Entry[string]{Member: "member1", Score: 3.5, Value: "value1"},
+//		jellyzset.Entry[string]{Member: "member2", Score: 2.0, Value: "value2"})
+//
+// In this example, we create a sorted set "mySortedSet" holding two members in a single call, and added will be 2.
+func (z *TypedZSet[V]) ZAddMany(key string, members ...Entry[V]) (int, error) {
+	for _, m := range members {
+		if math.IsNaN(m.Score) {
+			return 0, ErrNotANumber
+		}
+	}
+
+	if len(members) == 0 {
+		return 0, nil
+	}
+
+	if err := z.reserve(); err != nil {
+		return 0, err
+	}
+
+	set, unlock := z.writeKey(key, true)
+	defer unlock()
+
+	// Keep only the last occurrence of each member.
+	positions := make(map[string]int, len(members))
+	unique := make([]Entry[V], 0, len(members))
+	for _, m := range members {
+		if i, seen := positions[m.Member]; seen {
+			unique[i] = m
+			continue
+		}
+		positions[m.Member] = len(unique)
+		unique = append(unique, m)
+	}
+
+	added := 0
+	pending := make([]Entry[V], 0, len(unique))
+	for _, m := range unique {
+		if node, exists := set.records[m.Member]; exists {
+			if node.score == m.Score {
+				set.zsl.setValue(node, m.Value)
+				continue
+			}
+			z.notify(EventScoreChanged, key, m.Member, node.score, m.Score)
+			set.zsl.delete(node.score, m.Member)
+		} else {
+			z.notify(EventAdded, key, m.Member, 0, m.Score)
+			added++
+		}
+		pending = append(pending, m)
+	}
+
+	sortMembers(pending)
+
+	var nodes []*zslNode[V]
+	if set.zsl.length == 0 {
+		nodes = set.zsl.build(pending)
+	} else {
+		nodes = set.zsl.insertSorted(pending)
+	}
+
+	for _, node := range nodes {
+		set.remember(node)
+	}
+
+	z.log(logRecord[V]{op: aofAdd, key: key, entries: unique})
+	z.serveWaiters(key, set)
+	return added, nil
+}
+
+// ZIncrBy increments the score of a member in the sorted set stored at the given key.
+//
+// If the key does not exist, a new sorted set is created. If the member does not exist, it is added
+// with the increment as its score and the zero value of V. The value of an existing member is preserved.
+// When the new score keeps the member between its neighbours, the node is updated in place.
+//
+// Parameters:
+//   - key:       The key associated with the sorted set.
+//   - increment: The amount to add to the member's score (may be negative).
+//   - member:    The member whose score is incremented.
+//
+// Returns:
+//   - The new score of the member.
+//   - ErrNotANumber if the resulting score would be NaN, in which case the set is left unchanged, or ErrOOM if
+//     the memory limit is reached.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	score, err := zset.ZIncrBy("mySortedSet", 2.0, "member1")
+//
+// In this example, we create a sorted set "mySortedSet" and add "member1" with a score of 3.5. ZIncrBy then raises its score to 5.5 while keeping "value1" as its value.
+func (z *TypedZSet[V]) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	if math.IsNaN(increment) {
+		return 0, ErrNotANumber
+	}
+
+	if err := z.reserve(); err != nil {
+		return 0, err
+	}
+
+	set, unlock := z.writeKey(key, true)
+	defer unlock()
+
+	return z.zincrby(key, set, increment, member)
 }
 
 // ZScore returns the score of a member in the sorted set stored at the given key.
@@ -193,9 +859,11 @@ func (z *ZSet) ZAdd(key string, score float64, member string, value interface{})
 //	exists, score := zset.ZScore("mySortedSet", "member1")
 //
 // In this example, we create a sorted set "mySortedSet" and add "member1" with a score of 3.5. We then retrieve the score for "member1," and exists will be true, while the score will be 3.5.
-func (z *ZSet) ZScore(key string, member string) (ok bool, score float64) {
-	set, exists := z.records[key]
-	if !exists {
+func (z *TypedZSet[V]) ZScore(key string, member string) (ok bool, score float64) {
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
 		return false, 0.0
 	}
 
@@ -225,9 +893,11 @@ func (z *ZSet) ZScore(key string, member string) (ok bool, score float64) {
 //	count := zset.ZCard("mySortedSet")
 //
 // In this example, we create a sorted set "mySortedSet" and add two members. ZCard is then used to determine the count, which will be 2.
-func (z *ZSet) ZCard(key string) int {
-	set, exists := z.records[key]
-	if !exists {
+func (z *TypedZSet[V]) ZCard(key string) int {
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
 		return 0
 	}
 
@@ -254,9 +924,11 @@ func (z *ZSet) ZCard(key string) int {
 //	rank := zset.ZRank("mySortedSet", "member2")
 //
 // In this example, we create a sorted set "mySortedSet" and add two members. ZRank is used to find the rank of "member2," which will be 0, as it has the lowest score.
-func (z *ZSet) ZRank(key, member string) int64 {
-	set, exists := z.records[key]
-	if !exists {
+func (z *TypedZSet[V]) ZRank(key, member string) int64 {
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
 		return -1
 	}
 
@@ -289,9 +961,11 @@ func (z *ZSet) ZRank(key, member string) int64 {
 //	revRank := zset.ZRevRank("mySortedSet", "member1")
 //
 // In this example, we create a sorted set "mySortedSet" and add two members. ZRevRank is used to find the reverse rank of "member1," which will be 0, as it has the highest score.
-func (z *ZSet) ZRevRank(key, member string) int64 {
-	set, exists := z.records[key]
-	if !exists {
+func (z *TypedZSet[V]) ZRevRank(key, member string) int64 {
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
 		return -1
 	}
 
@@ -304,52 +978,92 @@ func (z *ZSet) ZRevRank(key, member string) int64 {
 	return int64(set.zsl.length - set.zsl.getRank(node.score, member) - 1)
 }
 
-// ZRem removes a member from the sorted set stored at the given key.
+// ZRankWithScore returns the rank of a member in the sorted set stored at the given key together with its
+// score, like the Redis ZRANK command with the WITHSCORE option.
 //
-// If the key or member does not exist in the sorted set, it returns false.
+// The rank and score are read under the same lock, so they always belong to the same state of the set,
+// which separate calls to ZRank and ZScore do not guarantee while other goroutines write.
 //
 // Parameters:
 //   - key:     The key associated with the sorted set.
-//   - member:  The member to remove from the sorted set.
+//   - member:  The member for which the rank and score are requested.
 //
 // Returns:
-//   - true if the member is successfully removed, false if the key or member does not exist in the sorted set.
+//   - The rank of the member, or -1 if the key or member does not exist.
+//   - The score of the member, or 0 if the key or member does not exist.
 //
 // Example:
 //
 //	zset := jellyzset.New()
 //	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
 //	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
-//	removed := zset.ZRem("mySortedSet", "member1")
+//	rank, score := zset.ZRankWithScore("mySortedSet", "member1")
 //
-// In this example, we create a sorted set "mySortedSet" and add two members. ZRem is used to remove "member1," and it returns true, indicating successful removal.
-func (z *ZSet) ZRem(key, member string) bool {
-	set, exists := z.records[key]
-	if !exists {
-		return false
+// In this example, rank will be 1 and score will be 3.5.
+func (z *TypedZSet[V]) ZRankWithScore(key, member string) (int64, float64) {
+	return z.rankWithScore(key, member, false)
+}
+
+// ZRevRankWithScore returns the reverse rank of a member in the sorted set stored at the given key together
+// with its score, like the Redis ZREVRANK command with the WITHSCORE option.
+//
+// The rank and score are read under the same lock, as with ZRankWithScore.
+//
+// Parameters:
+//   - key:     The key associated with the sorted set.
+//   - member:  The member for which the reverse rank and score are requested.
+//
+// Returns:
+//   - The reverse rank of the member, or -1 if the key or member does not exist.
+//   - The score of the member, or 0 if the key or member does not exist.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	revRank, score := zset.ZRevRankWithScore("mySortedSet", "member1")
+//
+// In this example, revRank will be 0 and score will be 3.5.
+func (z *TypedZSet[V]) ZRevRankWithScore(key, member string) (int64, float64) {
+	return z.rankWithScore(key, member, true)
+}
+
+// rankWithScore returns the rank of a member, or its reverse rank when rev is true, and its score.
+func (z *TypedZSet[V]) rankWithScore(key, member string, rev bool) (int64, float64) {
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
+		return -1, 0
 	}
 
-	if node, exists := set.records[member]; exists {
-		set.zsl.delete(node.score, member)
-		delete(set.records, member)
-		return true
+	node, exists := set.records[member]
+	if !exists {
+		return -1, 0
 	}
 
-	return false
+	rank := set.zsl.getRank(node.score, member)
+	if rev {
+		rank = set.zsl.length - rank - 1
+	}
+	return int64(rank), node.score
 }
 
-// ZScoreRange retrieves a range of elements with scores within the specified range from the sorted set stored at the given key.
+// ZCount returns the number of members in the sorted set stored at the given key with scores between min and max.
 //
-// If the key does not exist or the provided minimum score is greater than the maximum score, it returns nil.
+// Both bounds are inclusive unless excluded through config, in which case the range becomes
+// (min, max], [min, max) or (min, max). The count is derived from skip list spans, so it takes
+// logarithmic time and does not materialise the range. The Limit field of config is ignored.
 //
 // Parameters:
-//   - key:  The key associated with the sorted set.
-//   - min:  The minimum score of the range (inclusive).
-//   - max:  The maximum score of the range (inclusive).
+//   - key:    The key associated with the sorted set.
+//   - min:    The minimum score of the range.
+//   - max:    The maximum score of the range.
+//   - config: Optional configuration to exclude the min or max bound (may be nil).
 //
 // Returns:
-//   - A slice of interfaces containing elements with scores within the specified range.
-//   - The slice is empty if there are no elements within the range or if the key does not exist.
+//   - The number of members with scores within the range, or 0 if the key does not exist.
 //
 // Example:
 //
@@ -357,491 +1071,2132 @@ func (z *ZSet) ZRem(key, member string) bool {
 //	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
 //	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
 //	zset.ZAdd("mySortedSet", 4.2, "member3", "value3")
-//	results := zset.ZScoreRange("mySortedSet", 2.5, 4.0)
+//	count := zset.ZCount("mySortedSet", 2.0, 4.2, &ZRangeConfig{ExcludeStart: true})
 //
-// In this example, we create a sorted set "mySortedSet" and add three members. ZScoreRange is then used to retrieve elements within the score range of 2.5 to 4.0, and the results slice will contain the elements "member1" and "member2" with their respective scores.
-func (z *ZSet) ZScoreRange(key string, min, max float64) []interface{} {
-	if _, exists := z.records[key]; !exists || min > max {
-		return nil
-	}
-
-	item := z.records[key].zsl
-	minScore, maxScore := z.limitScores(item, min, max)
-
-	return z.collectElementsInRange(item, minScore, maxScore)
+// In this example, we create a sorted set "mySortedSet" and add three members. ZCount is used to count the members with scores in (2.0, 4.2], and count will be 2.
+func (z *TypedZSet[V]) ZCount(key string, min, max float64, config *ZRangeConfig) int {
+	minBound, maxBound := configBounds(min, max, config)
+	return z.ZCountBounds(key, minBound, maxBound)
 }
 
-// ZRevScoreRange returns all the elements in the sorted set at the given key with scores falling within the range [max, min].
-//
-// This function returns elements ordered from high to low scores within the specified range, including elements with scores equal to max or min.
+// ZCountBounds returns the number of members in the sorted set stored at the given key with scores between two bounds.
 //
-// If the key does not exist or if the provided max score is less than the min score, the function returns an empty slice.
+// It behaves like ZCount, with the range given as bounds that may have been parsed from Redis syntax
+// with ParseScoreBound, as in ZCOUNT key (1 +inf.
 //
 // Parameters:
 //   - key: The key associated with the sorted set.
-//   - max: The maximum score for the range.
-//   - min: The minimum score for the range.
+//   - min: The lower bound of the range.
+//   - max: The upper bound of the range.
 //
 // Returns:
-//   - A slice of interfaces containing elements with scores within the specified range, ordered from high to low scores.
+//   - The number of members with scores within the range, or 0 if the key does not exist.
 //
 // Example:
 //
 //	zset := jellyzset.New()
-//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 1.0, "member1", "value1")
 //	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
-//	zset.ZAdd("mySortedSet", 4.0, "member3", "value3")
-//	result := zset.ZRevScoreRange("mySortedSet", 4.0, 2.0)
+//	count := zset.ZCountBounds("mySortedSet", jellyzset.ScoreBound{Value: 1.0, Exclusive: true}, jellyzset.ScoreBound{Value: math.Inf(1)})
 //
-// In this example, we create a sorted set "mySortedSet" and add three members with different scores. ZRevScoreRange is used to retrieve elements within the score range [4.0, 2.0]. The result will be a slice containing the elements "member3" with a score of 4.0 and "member2" with a score of 2.0, ordered from high to low scores.
-func (z *ZSet) ZRevScoreRange(key string, max, min float64) []interface{} {
-	if _, exists := z.records[key]; !exists || min > max {
-		return nil
+// In this example, only "member2" scores above 1.0, so count will be 1.
+func (z *TypedZSet[V]) ZCountBounds(key string, min, max ScoreBound) int {
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
+		return 0
 	}
 
-	item := z.records[key].zsl
-	minScore, maxScore := z.limitScores(item, min, max)
+	r := boundsRange(min, max)
+	upper := set.zsl.countBelow(r.max, !r.maxex)
+	lower := set.zsl.countBelow(r.min, r.minex)
+	if upper <= lower {
+		return 0
+	}
 
-	return z.collectElementsInReverseRange(item, maxScore, minScore)
+	return int(upper - lower)
 }
 
-// ZKeyExists checks if a sorted set exists with the given key.
+// ZRankOfScore returns the number of members in the sorted set stored at the given key whose score is below the given score.
+//
+// This is the rank a new member with that score would get, and is computed in logarithmic time
+// from skip list spans.
 //
 // Parameters:
-//   - key: The key to check for the existence of a sorted set.
+//   - key:   The key associated with the sorted set.
+//   - score: The score to compare against.
 //
 // Returns:
-//   - true if a sorted set exists with the provided key, false otherwise.
+//   - The number of members with a score strictly less than score, or 0 if the key does not exist.
 //
 // Example:
 //
 //	zset := jellyzset.New()
 //	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
-//	exists := zset.ZKeyExists("mySortedSet")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	zset.ZAdd("mySortedSet", 4.2, "member3", "value3")
+//	below := zset.ZRankOfScore("mySortedSet", 4.0)
 //
-// In this example, we create a sorted set "mySortedSet" and use ZKeyExists to check if it exists. The result will be true.
-func (z *ZSet) ZKeyExists(key string) bool {
-	_, exists := z.records[key]
-	return exists
+// In this example, two members score below 4.0, so below will be 2.
+func (z *TypedZSet[V]) ZRankOfScore(key string, score float64) int {
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
+		return 0
+	}
+
+	return int(set.zsl.countBelow(score, false))
 }
 
-// ZClear removes a sorted set with the given key from the ZSet.
+// ZRem removes a member from the sorted set stored at the given key.
 //
-// If the sorted set with the provided key does not exist, the function has no effect.
+// If the key or member does not exist in the sorted set, it returns false.
 //
 // Parameters:
-//   - key: The key associated with the sorted set to be removed.
+//   - key:     The key associated with the sorted set.
+//   - member:  The member to remove from the sorted set.
+//
+// Returns:
+//   - true if the member is successfully removed, false if the key or member does not exist in the sorted set.
 //
 // Example:
 //
 //	zset := jellyzset.New()
 //	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
-//	zset.ZClear("mySortedSet")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	removed := zset.ZRem("mySortedSet", "member1")
 //
-// In this example, we create a sorted set "mySortedSet" and then use ZClear to remove it. After this operation, ZKeyExists("mySortedSet") will return false.
-func (z *ZSet) ZClear(key string) {
-	if z.ZKeyExists(key) {
-		delete(z.records, key)
+// In this example, we create a sorted set "mySortedSet" and add two members. ZRem is used to remove "member1," and it returns true, indicating successful removal.
+func (z *TypedZSet[V]) ZRem(key, member string) bool {
+	set, unlock := z.writeKey(key, false)
+	defer unlock()
+
+	if set == nil {
+		return false
 	}
+
+	return z.zrem(key, set, member)
 }
 
-// ZKeys returns a slice of all the keys in the ZSet, representing individual sorted sets.
+// ZRemMany removes several members from the sorted set stored at the given key, like the Redis ZREM command
+// given more than one member.
+//
+// The members are removed under a single lock, so no other caller sees some of them removed and others not,
+// and the removal is written to the append-only log as a single record. Members that do not exist are
+// ignored. Like ZRem, ZRemMany leaves the key in place when its last member is removed.
 //
-// This function provides a list of all the unique keys present in the ZSet.
+// Parameters:
+//   - key:     The key associated with the sorted set.
+//   - members: The members to remove from the sorted set.
 //
 // Returns:
-//   - A slice of strings containing all the keys in the ZSet.
+//   - The number of members removed.
 //
 // Example:
 //
 //	zset := jellyzset.New()
-//	zset.ZAdd("set1", 3.5, "member1", "value1")
-//	zset.ZAdd("set2", 2.0, "member2", "value2")
-//	keys := zset.ZKeys()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	removed := zset.ZRemMany("mySortedSet", "member1", "member2", "member3")
 //
-// In this example, we create a ZSet and add two sorted sets with keys "set1" and "set2." The Keys function is used to retrieve a slice containing the keys ["set1", "set2"].
-func (z *ZSet) ZKeys() []string {
-	keys := make([]string, 0, len(z.records))
-	for key := range z.records {
-		keys = append(keys, key)
+// In this example, "member1" and "member2" are removed together, and removed will be 2.
+func (z *TypedZSet[V]) ZRemMany(key string, members ...string) int {
+	set, unlock := z.writeKey(key, false)
+	defer unlock()
+
+	if set == nil {
+		return 0
 	}
-	return keys
+
+	var removed []string
+	for _, member := range members {
+		node, exists := set.records[member]
+		if !exists {
+			continue
+		}
+
+		set.zsl.delete(node.score, member)
+		set.forget(member)
+		z.notify(EventRemoved, key, member, node.score, 0)
+		removed = append(removed, member)
+	}
+
+	if len(removed) > 0 {
+		z.log(logRecord[V]{op: aofRem, key: key, members: removed})
+	}
+	return len(removed)
 }
 
-// ZRange returns a range of elements from the sorted set at the given key.
+// ZMove atomically moves a member, with its value, from the sorted set stored at src to the one stored at dst.
 //
-// It starts at the 'start' index and goes up to the 'stop' index (inclusive).
-// If 'start' is greater than 'stop' or the key does not exist, an empty slice is returned.
+// The member keeps its score unless newScore is given, and keeps its deadline if it has one. A member with
+// the same name in dst is replaced, and dst is created if it does not exist. When src and dst are the same
+// key, the member is only rescored. No other caller sees the member in both keys or in neither, and the
+// move is written to the append-only log as a single record. Like ZRem, ZMove leaves src in place when its
+// last member is moved.
 //
 // Parameters:
-//   - key:   The key associated with the sorted set.
-//   - start: The starting index of the range.
-//   - stop:  The ending index of the range.
+//   - src:      The key of the sorted set holding the member.
+//   - dst:      The key of the sorted set receiving the member.
+//   - member:   The member to move.
+//   - newScore: The score of the member in dst, or nil to keep its current score.
 //
 // Returns:
-//   - A slice of interfaces containing the selected elements within the specified range.
+//   - true if the member existed in src and was moved, false otherwise.
+//   - ErrNotANumber if newScore is NaN, ErrOOM if the memory limit is reached, and nil otherwise.
 //
 // Example:
 //
 //	zset := jellyzset.New()
-//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
-//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
-//	zset.ZAdd("mySortedSet", 4.0, "member3", "value3")
-//	result := zset.ZRange("mySortedSet", 0, 1)
-//
-// In this example, we create a sorted set "mySortedSet" and add three members. ZRange is used to retrieve elements within the range [0, 1]. The result will be a slice containing the elements "member2" and "member1".
-func (z *ZSet) ZRange(key string, start, stop int) []interface{} {
-	if !z.ZKeyExists(key) {
-		return []interface{}{}
-	}
-
-	return z.records[key].findRange(key, int64(start), int64(stop), false, false)
+//	zset.ZAdd("pending", 1.0, "job1", "payload1")
+//	deadline := 30.0
+//	moved, err := zset.ZMove("pending", "running", "job1", &deadline)
+//
+// In this example, moved is true and "job1" is now in "running" with the score 30 and the value "payload1".
+func (z *TypedZSet[V]) ZMove(src, dst, member string, newScore *float64) (bool, error) {
+	var moved bool
+	err := z.Txn(func(tx *Tx[V]) error {
+		var err error
+		moved, err = tx.ZMove(src, dst, member, newScore)
+		return err
+	})
+	return moved, err
 }
 
-// ZRangeWithScore returns a range of elements with scores from the sorted set at the given key.
+// ZRemRangeByRank removes the members of the sorted set stored at the given key with ranks between start and stop (inclusive).
 //
-// It starts at the 'start' index and goes up to the 'stop' index (inclusive).
-// If 'start' is greater than 'stop' or the key does not exist, an empty slice is returned.
-// The results include scores along with members in the format [member1, score1, member2, score2, ...].
+// Ranks are 0-based and negative values count from the end, with -1 being the member with the highest
+// score. The members are unlinked in a single traversal, and the key is removed once its sorted set
+// becomes empty.
 //
 // Parameters:
 //   - key:   The key associated with the sorted set.
-//   - start: The starting index of the range.
-//   - stop:  The ending index of the range.
+//   - start: The rank of the first member to remove.
+//   - stop:  The rank of the last member to remove.
 //
 // Returns:
-//   - A slice of interfaces containing the selected elements with scores within the specified range.
+//   - The number of members removed.
 //
 // Example:
 //
 //	zset := jellyzset.New()
 //	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
 //	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
-//	zset.ZAdd("mySortedSet", 4.0, "member3", "value3")
-//	result := zset.ZRangeWithScore("mySortedSet", 0, 1)
+//	zset.ZAdd("mySortedSet", 4.2, "member3", "value3")
+//	removed := zset.ZRemRangeByRank("mySortedSet", 0, -2)
 //
-// In this example, we create a sorted set "mySortedSet" and add three members. ZRangeWithScores is used to retrieve elements with scores within the range [0, 1]. The result will be a slice containing the elements "member2," its score 2.0, "member1," and its score 3.5.
-func (z *ZSet) ZRangeWithScore(key string, start, stop int) []interface{} {
-	if !z.ZKeyExists(key) || start > stop {
-		return []interface{}{}
+// In this example, we keep only the member with the highest score, so "member2" and "member1" are removed and removed will be 2.
+func (z *TypedZSet[V]) ZRemRangeByRank(key string, start, stop int) int {
+	set, unlock := z.writeKey(key, false)
+	if set == nil {
+		unlock()
+		return 0
+	}
+
+	length := int64(set.zsl.length)
+	first, last := adjustRange(int64(start), length), adjustRange(int64(stop), length)
+	if last >= length {
+		last = length - 1
+	}
+
+	if first > last || first >= length {
+		unlock()
+		return 0
+	}
+
+	removed := set.zsl.deleteRangeByRank(uint64(first)+1, uint64(last)+1, z.forgetter(key, set))
+	z.log(logRecord[V]{op: aofRemRangeByRank, key: key, start: start, stop: stop})
+	empty := set.zsl.length == 0
+	unlock()
+
+	if empty {
+		z.deleteIfEmpty(key, set)
 	}
 
-	return z.records[key].findRange(key, int64(start), int64(stop), false, true)
+	return removed
 }
 
-// ZRevRange returns a range of elements in reverse order from the sorted set at the given key.
+// ZRemRangeByScore removes the members of the sorted set stored at the given key with scores between min and max.
 //
-// It starts at the 'start' index and goes down to the 'stop' index (inclusive).
-// If 'start' is greater than 'stop' or the key does not exist, an empty slice is returned.
+// Both bounds are inclusive unless excluded through config. The members are unlinked in a single
+// traversal, and the key is removed once its sorted set becomes empty. The Limit field of config is
+// ignored.
 //
 // Parameters:
-//   - key:   The key associated with the sorted set.
-//   - start: The starting index of the range.
-//   - stop:  The ending index of the range.
+//   - key:    The key associated with the sorted set.
+//   - min:    The minimum score of the range.
+//   - max:    The maximum score of the range.
+//   - config: Optional configuration to exclude the min or max bound (may be nil).
 //
 // Returns:
-//   - A slice of interfaces containing the selected elements within the specified range, in reverse order.
+//   - The number of members removed.
 //
 // Example:
 //
 //	zset := jellyzset.New()
 //	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
 //	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
-//	zset.ZAdd("mySortedSet", 4.0, "member3", "value3")
-//	result := zset.ZRevRange("mySortedSet", 1, 0)
+//	zset.ZAdd("mySortedSet", 4.2, "member3", "value3")
+//	removed := zset.ZRemRangeByScore("mySortedSet", math.Inf(-1), 3.5, &ZRangeConfig{ExcludeEnd: true})
 //
-// In this example, we create a sorted set "mySortedSet" and add three members. ZRevRange is used to retrieve elements in reverse order within the range [1, 0]. The result will be a slice containing the elements "member1" and "member2" in reverse order.
-func (z *ZSet) ZRevRange(key string, start, stop int) []interface{} {
-	if !z.ZKeyExists(key) || start > stop {
-		return []interface{}{}
-	}
-
-	return z.records[key].findRange(key, int64(start), int64(stop), true, false)
+// In this example, only "member2" scores below 3.5, so it is removed and removed will be 1.
+func (z *TypedZSet[V]) ZRemRangeByScore(key string, min, max float64, config *ZRangeConfig) int {
+	minBound, maxBound := configBounds(min, max, config)
+	return z.ZRemRangeByScoreBounds(key, minBound, maxBound)
 }
 
-// ZRevRangeWithScore returns a range of elements with scores in reverse order from the sorted set at the given key.
+// ZRemRangeByScoreBounds removes the members of the sorted set stored at the given key with scores between two bounds.
 //
-// It starts at the 'start' index and goes down to the 'stop' index (inclusive).
-// If 'start' is greater than 'stop' or the key does not exist, nil is returned.
-// The results include scores along with members in the format [member1, score1, member2, score2, ...], in reverse order.
+// It behaves like ZRemRangeByScore, with the range given as bounds that may have been parsed from
+// Redis syntax with ParseScoreBound, as in ZREMRANGEBYSCORE key -inf (100.
 //
 // Parameters:
-//   - key:   The key associated with the sorted set.
-//   - start: The starting index of the range.
-//   - stop:  The ending index of the range.
+//   - key: The key associated with the sorted set.
+//   - min: The lower bound of the range.
+//   - max: The upper bound of the range.
 //
 // Returns:
-//   - A slice of interfaces containing the selected elements with scores within the specified range, in reverse order.
+//   - The number of members removed.
 //
 // Example:
 //
-//	zset := jellyzset.New()
-//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
-//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
-//	zset.ZAdd("mySortedSet", 4.0, "member3", "value3")
-//	result := zset.ZRevRangeWithScore("mySortedSet", 1, 0)
+//	min, _ := jellyzset.ParseScoreBound("-inf")
+//	max, _ := jellyzset.ParseScoreBound("(100")
+//	removed := zset.ZRemRangeByScoreBounds("sessions", min, max)
 //
-// In this example, we create a sorted set "mySortedSet" and add three members. ZRevRangeWithScores is used to retrieve elements with scores in reverse order within the range [1, 0]. The result will be a slice containing the elements "member2" with its score 2.0 and "member1" with its score 3.5, in reverse order.
-func (z *ZSet) ZRevRangeWithScore(key string, start, stop int) []interface{} {
-	if !z.ZKeyExists(key) || start > stop {
-		return nil
+// In this example, every member of "sessions" with a score below 100 is removed.
+func (z *TypedZSet[V]) ZRemRangeByScoreBounds(key string, min, max ScoreBound) int {
+	set, unlock := z.writeKey(key, false)
+	if set == nil {
+		unlock()
+		return 0
+	}
+
+	removed := set.zsl.deleteRangeByScore(boundsRange(min, max), z.forgetter(key, set))
+	if removed > 0 {
+		z.log(logRecord[V]{op: aofRemRangeByScore, key: key, min: min, max: max})
+	}
+	empty := set.zsl.length == 0
+	unlock()
+
+	if empty {
+		z.deleteIfEmpty(key, set)
 	}
 
-	return z.records[key].findRange(key, int64(start), int64(stop), true, true)
+	return removed
 }
 
-// ZRetrieveByRank retrieves the member and score at the specified rank from the sorted set stored at the given key.
+// ZScoreRange retrieves the entries with scores within the specified range from the sorted set stored at the given key.
 //
-// If the key does not exist or the provided rank is out of bounds, it returns an empty slice.
+// If the key does not exist or the provided minimum score is greater than the maximum score, it returns nil.
 //
 // Parameters:
-//   - key:   The key associated with the sorted set.
-//   - rank:  The rank of the member to retrieve (0-based).
+//   - key:  The key associated with the sorted set.
+//   - min:  The minimum score of the range (inclusive).
+//   - max:  The maximum score of the range (inclusive).
 //
 // Returns:
-//   - A slice of interfaces containing the member and score at the specified rank.
-//   - The slice is empty if the key does not exist or if the rank is out of bounds.
+//   - A slice of entries with scores within the specified range, ordered from low to high scores.
+//   - The slice is empty if there are no elements within the range or if the key does not exist.
 //
 // Example:
 //
-//	zset := jellyzset.New()
+//	zset := jellyzset.NewTyped[string]()
 //	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
 //	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
-//	result := zset.ZRetrieveByRank("mySortedSet", 0)
+//	zset.ZAdd("mySortedSet", 4.2, "member3", "value3")
+//	entries := zset.ZScoreRange("mySortedSet", 2.0, 4.0)
 //
-// In this example, we create a sorted set "mySortedSet" and add two members. ZRetrieveByRank is then used to retrieve the member and score at rank 0, resulting in the slice ["member2", 2.0].
-func (z *ZSet) ZRetrieveByRank(key string, rank int) []interface{} {
-	zset, exists := z.records[key]
-	if !exists {
-		return []interface{}{}
-	}
-
-	member, score := zset.getNodeByRank(key, int64(rank), false)
-	return []interface{}{member, score}
+// In this example, entries will hold "member2" and "member1" along with their scores and the values "value2" and "value1".
+func (z *TypedZSet[V]) ZScoreRange(key string, min, max float64) []Entry[V] {
+	entries, _ := z.ZRangeQuery(key, RangeByScore(min, max))
+	return entries
 }
 
-// ZRevRetrieveByRank retrieves the member and score at the specified reverse rank from the sorted set stored at the given key.
+// ZRevScoreRange returns the entries in the sorted set at the given key with scores falling within the range [min, max],
+// ordered from high to low scores.
 //
-// If the key does not exist or the provided rank is out of bounds, it returns an empty slice.
+// If the key does not exist or if the provided max score is less than the min score, the function returns nil.
 //
 // Parameters:
-//   - key:   The key associated with the sorted set.
-//   - rank:  The reverse rank of the member to retrieve (0-based).
+//   - key: The key associated with the sorted set.
+//   - max: The maximum score for the range (inclusive).
+//   - min: The minimum score for the range (inclusive).
 //
 // Returns:
-//   - A slice of interfaces containing the member and score at the specified reverse rank.
-//   - The slice is empty if the key does not exist or if the rank is out of bounds.
+//   - A slice of entries with scores within the specified range, ordered from high to low scores.
 //
 // Example:
 //
-//	zset := jellyzset.New()
+//	zset := jellyzset.NewTyped[string]()
 //	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
 //	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
-//	result := zset.ZRevRetrieveByRank("mySortedSet", 0)
+//	zset.ZAdd("mySortedSet", 4.0, "member3", "value3")
+//	entries := zset.ZRevScoreRange("mySortedSet", 4.0, 2.0)
 //
-// In this example, we create a sorted set "mySortedSet" and add two members. ZRevRetrieveByRank is then used to retrieve the member and score at reverse rank 0, resulting in the slice ["member1", 3.5].
-func (z *ZSet) ZRevRetrieveByRank(key string, rank int) []interface{} {
-	zset, exists := z.records[key]
-	if !exists {
-		return []interface{}{}
-	}
-
-	member, score := zset.getNodeByRank(key, int64(rank), true)
-
-	return []interface{}{member, score}
+// In this example, entries will hold "member3", "member1" and "member2", in that order.
+func (z *TypedZSet[V]) ZRevScoreRange(key string, max, min float64) []Entry[V] {
+	entries, _ := z.ZRangeQuery(key, RangeByScore(max, min).Rev())
+	return entries
 }
 
-// ZPopMin retrieves and removes the member with the lowest score from the sorted set stored at the given key.
+// ZUnionStore computes the union of the sorted sets at the given keys and stores it at the destination key.
 //
-// If the key does not exist or the sorted set is empty, it returns (nil, errors.New("key does not exist")).
+// Missing keys are treated as empty sets. Each member's score is multiplied by the weight of the key
+// it comes from, and the weighted scores of a member present in several sets are combined with the
+// aggregate function. A weighted score that is NaN (from multiplying an infinite score by 0) counts
+// as 0, as does an infinite sum of opposite signs. Each member keeps the value from the first key
+// holding it. The destination is overwritten, or removed if the result is empty, and may be one of
+// the source keys.
 //
 // Parameters:
-//   - key: The key associated with the sorted set.
+//   - dst:  The key where the resulting sorted set is stored.
+//   - keys: The keys of the sorted sets to combine.
+//   - opts: Optional weights and aggregate function (may be nil).
 //
 // Returns:
-//   - A pointer to the zslNode containing information about the popped member and score.
-//   - An error if the key does not exist or the sorted set is empty.
+//   - The number of members in the resulting sorted set.
+//   - An error if no keys are given or the number of weights does not match the number of keys, or ErrOOM
+//     if the memory limit is reached.
 //
 // Example:
 //
 //	zset := jellyzset.New()
-//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
-//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
-//	poppedNode, err := zset.ZPopMin("mySortedSet")
+//	zset.ZAdd("monday", 10, "alice", nil)
+//	zset.ZAdd("tuesday", 5, "alice", nil)
+//	zset.ZAdd("tuesday", 7, "bob", nil)
+//	count, err := zset.ZUnionStore("week", []string{"monday", "tuesday"}, nil)
 //
-// In this example, we create a sorted set "mySortedSet" and add two members. ZPopMin is then used to retrieve and remove the member with the lowest score, resulting in the poppedNode containing information about "member2" and its score of 2.0.
-func (z *ZSet) ZPopMin(key string) (*zslNode, error) {
-	if !z.ZKeyExists(key) {
-		return nil, errors.New("key does not exist")
+// In this example, the daily boards are combined into "week", where "alice" has a score of 15 and "bob" a score of 7, and count will be 2.
+func (z *TypedZSet[V]) ZUnionStore(dst string, keys []string, opts *ZStoreOptions) (int, error) {
+	if err := z.reserve(); err != nil {
+		return 0, err
 	}
 
-	zset := z.records[key]
-	firstNode := zset.zsl.head.level[0].forward
+	z.mu.Lock()
+	defer z.mu.Unlock()
 
-	if firstNode != nil {
-		z.ZRem(key, firstNode.member)
+	z.purgeKeys(keys)
+	members, err := z.union(keys, opts)
+	if err != nil {
+		return 0, err
 	}
 
-	return firstNode, nil
+	return z.store(dst, members), nil
 }
 
-// ZPopMax retrieves and removes the member with the highest score from the sorted set stored at the given key.
+// ZInterStore computes the intersection of the sorted sets at the given keys and stores it at the destination key.
 //
-// If the key does not exist or the sorted set is empty, it returns (nil, errors.New("key does not exist")).
+// A missing key makes the intersection empty. Weights, aggregation, values and the handling of the
+// destination key follow ZUnionStore.
 //
 // Parameters:
-//   - key: The key associated with the sorted set.
+//   - dst:  The key where the resulting sorted set is stored.
+//   - keys: The keys of the sorted sets to intersect.
+//   - opts: Optional weights and aggregate function (may be nil).
 //
 // Returns:
-//   - A pointer to the zslNode containing information about the popped member and score.
-//   - An error if the key does not exist or the sorted set is empty.
+//   - The number of members in the resulting sorted set.
+//   - An error if no keys are given or the number of weights does not match the number of keys, or ErrOOM
+//     if the memory limit is reached.
 //
 // Example:
 //
 //	zset := jellyzset.New()
-//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
-//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
-//	poppedNode, err := zset.ZPopMax("mySortedSet")
+//	zset.ZAdd("monday", 10, "alice", nil)
+//	zset.ZAdd("tuesday", 5, "alice", nil)
+//	zset.ZAdd("tuesday", 7, "bob", nil)
+//	count, err := zset.ZInterStore("everyday", []string{"monday", "tuesday"}, &jellyzset.ZStoreOptions{Aggregate: jellyzset.AggregateMax})
 //
-// In this example, we create a sorted set "mySortedSet" and add two members. ZPopMax is then used to retrieve and remove the member with the highest score, resulting in the poppedNode containing information about "member1" and its score of 3.5.
-func (z *ZSet) ZPopMax(key string) (*zslNode, error) {
-	if !z.ZKeyExists(key) {
-		return nil, errors.New("key does not exist")
+// In this example, only "alice" played on both days, so "everyday" holds "alice" with a score of 10 and count will be 1.
+func (z *TypedZSet[V]) ZInterStore(dst string, keys []string, opts *ZStoreOptions) (int, error) {
+	if err := z.reserve(); err != nil {
+		return 0, err
 	}
 
-	zset := z.records[key]
-	lastNode := zset.zsl.tail
+	z.mu.Lock()
+	defer z.mu.Unlock()
 
-	if lastNode != nil {
-		z.ZRem(key, lastNode.member)
+	z.purgeKeys(keys)
+	members, err := z.inter(keys, opts)
+	if err != nil {
+		return 0, err
 	}
 
-	return lastNode, nil
+	return z.store(dst, members), nil
 }
 
-// ZRangeByScore retrieves elements with scores within the specified range from the sorted set stored at the given key.
+// ZDiffStore computes the difference between the first sorted set and all the following ones and stores it at the destination key.
 //
-// If the key does not exist, it returns an empty slice.
+// Members keep their score and value from the first set. Missing keys are treated as empty sets,
+// and the destination key is handled as in ZUnionStore.
 //
 // Parameters:
-//   - key:     The key associated with the sorted set.
-//   - start:   The minimum score of the range (inclusive).
-//   - end:     The maximum score of the range (inclusive).
-//   - config:  Configuration options for the range query (optional).
+//   - dst:  The key where the resulting sorted set is stored.
+//   - keys: The keys of the sorted sets, starting with the one to subtract from.
 //
 // Returns:
-//   - A slice of pointers to zslNode containing information about elements within the specified score range.
-//   - The slice is empty if the key does not exist or if no elements are within the specified range.
+//   - The number of members in the resulting sorted set.
+//   - ErrNoInputKeys if no keys are given, or ErrOOM if the memory limit is reached.
 //
 // Example:
 //
 //	zset := jellyzset.New()
-//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
-//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
-//	zset.ZAdd("mySortedSet", 4.2, "member3", "value3")
-//	config := &ZRangeConfig{Limit: 2, ExcludeEnd: true}
-//	result := zset.ZRangeByScore("mySortedSet", 2.0, 4.0, config)
+//	zset.ZAdd("registered", 1, "alice", nil)
+//	zset.ZAdd("registered", 2, "bob", nil)
+//	zset.ZAdd("banned", 1, "bob", nil)
+//	count, err := zset.ZDiffStore("allowed", []string{"registered", "banned"})
 //
-// In this example, we create a sorted set "mySortedSet" and add three members. ZRangeByScore is then used to retrieve elements within the score range of 2.0 to 4.0, excluding the end, and the result will contain pointers to zslNode for "member2" and "member1".
-func (z *ZSet) ZRangeByScore(key string, start, end float64, config *ZRangeConfig) []*zslNode {
-	result := []*zslNode{}
-	if z.ZKeyExists(key) {
-		return result
+// In this example, "allowed" holds only "alice", and count will be 1.
+func (z *TypedZSet[V]) ZDiffStore(dst string, keys []string) (int, error) {
+	if err := z.reserve(); err != nil {
+		return 0, err
 	}
 
-	node := z.records[key]
-	zsl := node.zsl
+	z.mu.Lock()
+	defer z.mu.Unlock()
 
-	limit := int(^uint(0) >> 1)
-	if config != nil && config.Limit > 0 {
-		limit = config.Limit
+	z.purgeKeys(keys)
+	members, err := z.diff(keys)
+	if err != nil {
+		return 0, err
 	}
 
-	excludeStart, excludeEnd := false, false
-	if config != nil {
-		excludeStart, excludeEnd = config.ExcludeStart, config.ExcludeEnd
-	}
+	return z.store(dst, members), nil
+}
 
-	reverse := start > end
-	if reverse {
-		start, end = end, start
-		excludeStart, excludeEnd = excludeEnd, excludeStart
-	}
+// ZUnion computes the union of the sorted sets at the given keys like ZUnionStore, without storing it.
+//
+// Returns:
+//   - The resulting entries, ordered by score.
+//   - An error if no keys are given or the number of weights does not match the number of keys.
+func (z *TypedZSet[V]) ZUnion(keys []string, opts *ZStoreOptions) ([]Entry[V], error) {
+	unlock := z.readKeys(keys)
+	defer unlock()
+
+	return z.union(keys, opts)
+}
+
+// ZInter computes the intersection of the sorted sets at the given keys like ZInterStore, without storing it.
+//
+// Returns:
+//   - The resulting entries, ordered by score.
+//   - An error if no keys are given or the number of weights does not match the number of keys.
+func (z *TypedZSet[V]) ZInter(keys []string, opts *ZStoreOptions) ([]Entry[V], error) {
+	unlock := z.readKeys(keys)
+	defer unlock()
+
+	return z.inter(keys, opts)
+}
+
+// ZDiff computes the difference between the first sorted set and all the following ones like ZDiffStore, without storing it.
+//
+// Returns:
+//   - The resulting entries, ordered by score.
+//   - ErrNoInputKeys if no keys are given.
+func (z *TypedZSet[V]) ZDiff(keys []string) ([]Entry[V], error) {
+	unlock := z.readKeys(keys)
+	defer unlock()
+
+	return z.diff(keys)
+}
 
-	// Determine if out of range
-	if zsl.length == 0 {
-		return result
+// ZInterCard returns the number of members in the intersection of the sorted sets at the given keys.
+//
+// The intersection is not materialised. When limit is greater than 0, counting stops as soon as the
+// limit is reached, which makes checking for a minimum overlap cheap on large sets.
+//
+// Parameters:
+//   - keys:  The keys of the sorted sets to intersect.
+//   - limit: The maximum count to compute, or 0 for no limit.
+//
+// Returns:
+//   - The number of members present in every sorted set, capped at limit.
+//   - ErrNoInputKeys if no keys are given, or ErrNegativeLimit if limit is negative.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("monday", 10, "alice", nil)
+//	zset.ZAdd("tuesday", 5, "alice", nil)
+//	count, err := zset.ZInterCard([]string{"monday", "tuesday"}, 0)
+//
+// In this example, "alice" is present in both sets, so count will be 1.
+func (z *TypedZSet[V]) ZInterCard(keys []string, limit int) (int, error) {
+	if len(keys) == 0 {
+		return 0, ErrNoInputKeys
 	}
 
-	compare := func(a, b float64) bool {
-		if reverse {
-			return a > b
-		}
-		return a < b
+	if limit < 0 {
+		return 0, ErrNegativeLimit
 	}
 
-	updateNode := func(n *zslNode, level int) *zslNode {
-		for n.level[level].forward != nil && compare(n.level[level].forward.score, end) {
-			n = n.level[level].forward
-		}
-		return n
+	unlock := z.readKeys(keys)
+	defer unlock()
+
+	sets, ok := z.sourcesBySize(keys)
+	if !ok {
+		return 0, nil
 	}
 
-	if reverse {
-		// Search from end to start
-		currentNode := zsl.head
-		if excludeEnd {
-			for level := zsl.level - 1; level >= 0; level-- {
-				currentNode = updateNode(currentNode, level)
-			}
-		} else {
-			for level := zsl.level - 1; level >= 0; level-- {
-				currentNode = updateNode(currentNode, level)
+	count := 0
+	for node := sets[0].zsl.head.level[0].forward; node != nil; node = node.level[0].forward {
+		if containsMember(sets[1:], node.member) {
+			count++
+			if count == limit {
+				break
 			}
 		}
+	}
 
-		for currentNode != nil && limit > 0 {
-			if excludeStart && !compare(currentNode.score, start) {
-				break
+	return count, nil
+}
+
+// ZKeyExists checks if a sorted set exists with the given key.
+//
+// Parameters:
+//   - key: The key to check for the existence of a sorted set.
+//
+// Returns:
+//   - true if a sorted set exists with the provided key, false otherwise.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	exists := zset.ZKeyExists("mySortedSet")
+//
+// In this example, we create a sorted set "mySortedSet" and use ZKeyExists to check if it exists. The result will be true.
+func (z *TypedZSet[V]) ZKeyExists(key string) bool {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	return z.keyExists(key)
+}
+
+// ZClear removes a sorted set with the given key from the ZSet.
+//
+// If the sorted set with the provided key does not exist, the function has no effect.
+//
+// Parameters:
+//   - key: The key associated with the sorted set to be removed.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZClear("mySortedSet")
+//
+// In this example, we create a sorted set "mySortedSet" and then use ZClear to remove it. After this operation, ZKeyExists("mySortedSet") will return false.
+func (z *TypedZSet[V]) ZClear(key string) {
+	z.throttle()
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.zclear(key)
+}
+
+// ZKeys returns a slice of all the keys in the ZSet, representing individual sorted sets.
+//
+// This function provides a list of all the unique keys present in the ZSet. To walk a large keyspace in
+// batches instead of copying it at once, use Scan.
+//
+// Returns:
+//   - A slice of strings containing all the keys in the ZSet.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("set1", 3.5, "member1", "value1")
+//	zset.ZAdd("set2", 2.0, "member2", "value2")
+//	keys := zset.ZKeys()
+//
+// In this example, we create a ZSet and add two sorted sets with keys "set1" and "set2." The Keys function is used to retrieve a slice containing the keys ["set1", "set2"].
+func (z *TypedZSet[V]) ZKeys() []string {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	keys := make([]string, 0, len(z.records))
+	for key, set := range z.records {
+		if z.live(set) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// ZScan incrementally iterates over the members of the sorted set stored at the given key.
+//
+// It follows the cursor contract of the Redis ZSCAN command: a scan starts with cursor 0, each call
+// returns the cursor for the next call, and the scan is complete when the returned cursor is 0. Every
+// member present in the set from the start to the end of a full scan is returned at least once, even when
+// other members are added, removed or rescored in between; members added or removed during the scan may
+// or may not be returned, and a member may be returned more than once. Members are visited in the order of
+// a hash of their names, so the cursor does not shift when ranks do.
+//
+// The count is a hint of how many members to visit per call, as in Redis; a call may return more or fewer
+// entries, or none at all while the cursor is not yet 0. The match pattern is applied to the visited members
+// after they are selected and uses the Redis glob syntax ("*", "?", "[abc]", "[^a]", "[a-z]" and "\" to
+// escape). Members are kept in hash order as they are added, so each call costs a binary search and a visit of
+// the members it returns, whatever the size of the set. Each call only holds the read lock of the set,
+// releasing it in between so that writers are never blocked for the whole scan, and allocates only for the
+// returned batch.
+//
+// Parameters:
+//   - key:    The key associated with the sorted set.
+//   - cursor: The cursor returned by the previous call, or 0 to start a scan.
+//   - match:  A glob pattern the members must match, or an empty string to return every visited member.
+//   - count:  The number of members to visit, or 0 to use the Redis default of 10.
+//
+// Returns:
+//   - The cursor to pass to the next call, or 0 once the scan is complete.
+//   - The entries of the visited members that match the pattern.
+//   - ErrNegativeCount if count is negative.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 1.0, "user:1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "user:2", "value2")
+//	zset.ZAdd("mySortedSet", 3.0, "admin:1", "value3")
+//	var cursor uint64
+//	for {
+//		next, entries, _ := zset.ZScan("mySortedSet", cursor, "user:*", 100)
+//		// use entries
+//		if cursor = next; cursor == 0 {
+//			break
+//		}
+//	}
+//
+// In this example, the loop walks the whole sorted set and the entries returned across all calls hold "user:1" and "user:2".
+func (z *TypedZSet[V]) ZScan(key string, cursor uint64, match string, count int) (uint64, []Entry[V], error) {
+	if count < 0 {
+		return 0, nil, ErrNegativeCount
+	}
+
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
+		return 0, []Entry[V]{}, nil
+	}
+
+	members, next := set.names.next(cursor, count)
+
+	entries := make([]Entry[V], 0, len(members))
+	for _, member := range members {
+		if match == "" || globMatch(match, member) {
+			entries = append(entries, set.records[member].entry())
+		}
+	}
+
+	return next, entries, nil
+}
+
+// Scan incrementally iterates over the keys of the ZSet.
+//
+// It follows the cursor contract of the Redis SCAN command, with the same guarantees, count and match
+// semantics as ZScan: every key present from the start to the end of a full scan is returned at least once,
+// and the scan is complete when the returned cursor is 0. Unlike ZKeys, it never copies the whole keyspace.
+//
+// Parameters:
+//   - cursor: The cursor returned by the previous call, or 0 to start a scan.
+//   - match:  A glob pattern the keys must match, or an empty string to return every visited key.
+//   - count:  The number of keys to visit, or 0 to use the Redis default of 10.
+//
+// Returns:
+//   - The cursor to pass to the next call, or 0 once the scan is complete.
+//   - The visited keys that match the pattern.
+//   - ErrNegativeCount if count is negative.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("leaderboard:daily", 3.5, "member1", "value1")
+//	zset.ZAdd("leaderboard:weekly", 2.0, "member2", "value2")
+//	zset.ZAdd("sessions", 1.0, "member3", "value3")
+//	cursor, keys, err := zset.Scan(0, "leaderboard:*", 0)
+//
+// In this example, the three keys fit in a single batch, so cursor will be 0 and keys will hold "leaderboard:daily" and "leaderboard:weekly" in an unspecified order.
+func (z *TypedZSet[V]) Scan(cursor uint64, match string, count int) (uint64, []string, error) {
+	if count < 0 {
+		return 0, nil, ErrNegativeCount
+	}
+
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	keys, next := z.keys.next(cursor, count)
+
+	matched := keys[:0]
+	for _, key := range keys {
+		if !z.live(z.records[key]) {
+			continue
+		}
+		if match == "" || globMatch(match, key) {
+			matched = append(matched, key)
+		}
+	}
+
+	return next, matched, nil
+}
+
+// ZRangeQuery returns the entries of the sorted set at the given key selected by a range query.
+//
+// The query selects members by rank, score or lexicographic order, optionally in reverse and with an
+// offset and count, the same way the Redis ZRANGE command does with its BYSCORE, BYLEX, REV and LIMIT
+// options. The other range methods are built on it, so they all treat missing keys, empty ranges and
+// out of range bounds alike: the result is then empty.
+//
+// Parameters:
+//   - key:   The key associated with the sorted set.
+//   - query: The range query, created with RangeByRank, RangeByScore or RangeByLex.
+//
+// Returns:
+//   - A slice of entries within the range, in the order selected by the query.
+//   - ErrInvalidLexRange if the query is lexicographic and one of its bounds is not valid.
+//
+// Example:
+//
+//	zset := jellyzset.NewTyped[string]()
+//	zset.ZAdd("mySortedSet", 1.0, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	zset.ZAdd("mySortedSet", 3.0, "member3", "value3")
+//	entries, err := zset.ZRangeQuery("mySortedSet", jellyzset.RangeByScore(3.0, 1.0).ExcludeStart().Rev().Limit(0, 1))
+//
+// In this example, the scores from 3.0 (excluded) down to 1.0 are selected in reverse order and limited to one entry, so entries will hold only "member2".
+func (z *TypedZSet[V]) ZRangeQuery(key string, query RangeQuery) ([]Entry[V], error) {
+	lex, err := query.lexRange()
+	if err != nil {
+		return nil, err
+	}
+
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
+		return nil, nil
+	}
+
+	return set.query(query, lex), nil
+}
+
+// ZRange returns a range of entries from the sorted set at the given key, ordered from low to high scores.
+//
+// It starts at the 'start' index and goes up to the 'stop' index (inclusive). Negative indices count
+// from the end of the sorted set, so -1 is the member with the highest score. If the range is empty
+// or the key does not exist, nil is returned.
+//
+// Parameters:
+//   - key:   The key associated with the sorted set.
+//   - start: The starting index of the range.
+//   - stop:  The ending index of the range.
+//
+// Returns:
+//   - A slice of entries within the specified range.
+//
+// Example:
+//
+//	zset := jellyzset.NewTyped[int]()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", 1)
+//	zset.ZAdd("mySortedSet", 2.0, "member2", 2)
+//	zset.ZAdd("mySortedSet", 4.0, "member3", 3)
+//	entries := zset.ZRange("mySortedSet", 0, -1)
+//
+// In this example, entries will hold "member2", "member1" and "member3" with their scores and values, in that order.
+func (z *TypedZSet[V]) ZRange(key string, start, stop int) []Entry[V] {
+	entries, _ := z.ZRangeQuery(key, RangeByRank(start, stop))
+	return entries
+}
+
+// ZRevRange returns a range of entries from the sorted set at the given key, ordered from high to low scores.
+//
+// Indices are ranks in the reversed order, so 0 is the member with the highest score; negative
+// indices count from the end as in ZRange. If the range is empty or the key does not exist, nil is returned.
+//
+// Parameters:
+//   - key:   The key associated with the sorted set.
+//   - start: The starting index of the range.
+//   - stop:  The ending index of the range.
+//
+// Returns:
+//   - A slice of entries within the specified range, in reverse order.
+//
+// Example:
+//
+//	zset := jellyzset.NewTyped[int]()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", 1)
+//	zset.ZAdd("mySortedSet", 2.0, "member2", 2)
+//	zset.ZAdd("mySortedSet", 4.0, "member3", 3)
+//	entries := zset.ZRevRange("mySortedSet", 0, 1)
+//
+// In this example, entries will hold "member3" and "member1", the two members with the highest scores.
+func (z *TypedZSet[V]) ZRevRange(key string, start, stop int) []Entry[V] {
+	entries, _ := z.ZRangeQuery(key, RangeByRank(start, stop).Rev())
+	return entries
+}
+
+// ZRangeByLex returns the entries of the sorted set at the given key whose members fall between min and max lexicographically.
+//
+// It is meant for sorted sets where all members share the same score, so that they are ordered by
+// member name. Bounds use the Redis syntax: "[member" is inclusive, "(member" is exclusive, and "-"
+// and "+" stand for the lowest and highest possible members. The first 'offset' matching members are
+// skipped and at most 'count' members are returned; a negative count returns all remaining members.
+//
+// Parameters:
+//   - key:    The key associated with the sorted set.
+//   - min:    The lower bound of the range.
+//   - max:    The upper bound of the range.
+//   - offset: The number of matching members to skip.
+//   - count:  The maximum number of members to return, or a negative number for no limit.
+//
+// Returns:
+//   - A slice of entries within the range, in lexicographic order.
+//   - ErrInvalidLexRange if min or max is not a valid bound.
+//
+// Example:
+//
+//	zset := jellyzset.NewTyped[string]()
+//	zset.ZAdd("mySortedSet", 0, "apple", "red")
+//	zset.ZAdd("mySortedSet", 0, "apricot", "orange")
+//	zset.ZAdd("mySortedSet", 0, "banana", "yellow")
+//	entries, err := zset.ZRangeByLex("mySortedSet", "[ap", "(b", 0, -1)
+//
+// In this example, entries will hold "apple" and "apricot" with their values "red" and "orange".
+func (z *TypedZSet[V]) ZRangeByLex(key, min, max string, offset, count int) ([]Entry[V], error) {
+	return z.ZRangeQuery(key, RangeByLex(min, max).Limit(offset, count))
+}
+
+// ZRevRangeByLex returns the entries of the sorted set at the given key whose members fall between max and min lexicographically,
+// ordered from the highest member to the lowest.
+//
+// Bounds, offset and count behave as in ZRangeByLex, except that max comes before min and the offset
+// is counted from the highest matching member.
+//
+// Parameters:
+//   - key:    The key associated with the sorted set.
+//   - max:    The upper bound of the range.
+//   - min:    The lower bound of the range.
+//   - offset: The number of matching members to skip.
+//   - count:  The maximum number of members to return, or a negative number for no limit.
+//
+// Returns:
+//   - A slice of entries within the range, in reverse lexicographic order.
+//   - ErrInvalidLexRange if max or min is not a valid bound.
+//
+// Example:
+//
+//	zset := jellyzset.NewTyped[string]()
+//	zset.ZAdd("mySortedSet", 0, "apple", "red")
+//	zset.ZAdd("mySortedSet", 0, "apricot", "orange")
+//	zset.ZAdd("mySortedSet", 0, "banana", "yellow")
+//	entries, err := zset.ZRevRangeByLex("mySortedSet", "+", "[apricot", 0, -1)
+//
+// In this example, entries will hold "banana" and then "apricot".
+func (z *TypedZSet[V]) ZRevRangeByLex(key, max, min string, offset, count int) ([]Entry[V], error) {
+	return z.ZRangeQuery(key, RangeByLex(max, min).Rev().Limit(offset, count))
+}
+
+// ZLexCount returns the number of members of the sorted set at the given key that fall between min and max lexicographically.
+//
+// Bounds use the same syntax as ZRangeByLex. The count is computed from the ranks of the first and
+// last members in the range, without walking the members in between.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//   - min: The lower bound of the range.
+//   - max: The upper bound of the range.
+//
+// Returns:
+//   - The number of members within the range, or 0 if the key does not exist.
+//   - ErrInvalidLexRange if min or max is not a valid bound.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 0, "apple", nil)
+//	zset.ZAdd("mySortedSet", 0, "banana", nil)
+//	count, err := zset.ZLexCount("mySortedSet", "-", "(banana")
+//
+// In this example, only "apple" sorts before "banana", so count will be 1.
+func (z *TypedZSet[V]) ZLexCount(key, min, max string) (int, error) {
+	r, err := parseLexRange(min, max)
+	if err != nil {
+		return 0, err
+	}
+
+	return z.ZLexCountBounds(key, r.min, r.max), nil
+}
+
+// ZLexCountBounds returns the number of members of the sorted set at the given key that fall between two lexicographic bounds.
+//
+// It behaves like ZLexCount, with the range given as bounds instead of strings.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//   - min: The lower bound of the range.
+//   - max: The upper bound of the range.
+//
+// Returns:
+//   - The number of members within the range, or 0 if the key does not exist.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 0, "apple", nil)
+//	zset.ZAdd("mySortedSet", 0, "banana", nil)
+//	count := zset.ZLexCountBounds("mySortedSet", jellyzset.LexBound{Inf: -1}, jellyzset.LexBound{Value: "banana", Exclusive: true})
+//
+// In this example, only "apple" sorts before "banana", so count will be 1.
+func (z *TypedZSet[V]) ZLexCountBounds(key string, min, max LexBound) int {
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
+		return 0
+	}
+
+	r := lexRange{min: min, max: max}
+	first := set.zsl.firstInLexRange(r)
+	if first == nil {
+		return 0
+	}
+
+	last := set.zsl.lastInLexRange(r)
+	return int(set.zsl.getRank(last.score, last.member) - set.zsl.getRank(first.score, first.member) + 1)
+}
+
+// ZRemRangeByLex removes the members of the sorted set at the given key that fall between min and max lexicographically.
+//
+// Bounds use the same syntax as ZRangeByLex. The matching members are unlinked in a single traversal,
+// and the key is removed once its sorted set becomes empty.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//   - min: The lower bound of the range.
+//   - max: The upper bound of the range.
+//
+// Returns:
+//   - The number of members removed.
+//   - ErrInvalidLexRange if min or max is not a valid bound.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 0, "apple", nil)
+//	zset.ZAdd("mySortedSet", 0, "banana", nil)
+//	removed, err := zset.ZRemRangeByLex("mySortedSet", "[a", "(b")
+//
+// In this example, "apple" is removed and removed will be 1.
+func (z *TypedZSet[V]) ZRemRangeByLex(key, min, max string) (int, error) {
+	r, err := parseLexRange(min, max)
+	if err != nil {
+		return 0, err
+	}
+
+	return z.ZRemRangeByLexBounds(key, r.min, r.max), nil
+}
+
+// ZRemRangeByLexBounds removes the members of the sorted set at the given key that fall between two lexicographic bounds.
+//
+// It behaves like ZRemRangeByLex, with the range given as bounds instead of strings.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//   - min: The lower bound of the range.
+//   - max: The upper bound of the range.
+//
+// Returns:
+//   - The number of members removed.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 0, "apple", nil)
+//	zset.ZAdd("mySortedSet", 0, "banana", nil)
+//	removed := zset.ZRemRangeByLexBounds("mySortedSet", jellyzset.LexBound{Value: "b"}, jellyzset.LexBound{Inf: 1})
+//
+// In this example, "banana" is removed and removed will be 1.
+func (z *TypedZSet[V]) ZRemRangeByLexBounds(key string, min, max LexBound) int {
+	set, unlock := z.writeKey(key, false)
+	if set == nil {
+		unlock()
+		return 0
+	}
+
+	removed := set.zsl.deleteRangeByLex(lexRange{min: min, max: max}, z.forgetter(key, set))
+	if removed > 0 {
+		z.log(logRecord[V]{op: aofRemRangeByLex, key: key, minLex: min, maxLex: max})
+	}
+	empty := set.zsl.length == 0
+	unlock()
+
+	if empty {
+		z.deleteIfEmpty(key, set)
+	}
+
+	return removed
+}
+
+// ZRetrieveByRank retrieves the entry at the specified rank from the sorted set stored at the given key.
+//
+// Parameters:
+//   - key:   The key associated with the sorted set.
+//   - rank:  The rank of the member to retrieve (0-based), with the scores ordered from low to high.
+//
+// Returns:
+//   - The entry at the specified rank.
+//   - false if the key does not exist or if the rank is out of bounds.
+//
+// Example:
+//
+//	zset := jellyzset.NewTyped[string]()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	entry, ok := zset.ZRetrieveByRank("mySortedSet", 0)
+//
+// In this example, entry holds "member2" with a score of 2.0 and the value "value2", and ok will be true.
+func (z *TypedZSet[V]) ZRetrieveByRank(key string, rank int) (Entry[V], bool) {
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
+		return Entry[V]{}, false
+	}
+
+	return set.entryByRank(int64(rank), false)
+}
+
+// ZRevRetrieveByRank retrieves the entry at the specified reverse rank from the sorted set stored at the given key.
+//
+// Parameters:
+//   - key:   The key associated with the sorted set.
+//   - rank:  The reverse rank of the member to retrieve (0-based), with the scores ordered from high to low.
+//
+// Returns:
+//   - The entry at the specified reverse rank.
+//   - false if the key does not exist or if the rank is out of bounds.
+//
+// Example:
+//
+//	zset := jellyzset.NewTyped[string]()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	entry, ok := zset.ZRevRetrieveByRank("mySortedSet", 0)
+//
+// In this example, entry holds "member1" with a score of 3.5 and the value "value1", and ok will be true.
+func (z *TypedZSet[V]) ZRevRetrieveByRank(key string, rank int) (Entry[V], bool) {
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
+		return Entry[V]{}, false
+	}
+
+	return set.entryByRank(int64(rank), true)
+}
+
+// ZPopMin retrieves and removes the member with the lowest score from the sorted set stored at the given key.
+//
+// If the key does not exist or the sorted set is empty, it returns ErrKeyNotFound.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//
+// Returns:
+//   - The entry holding the popped member, its score and its value.
+//   - ErrKeyNotFound if the key does not exist or the sorted set is empty.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	entry, err := zset.ZPopMin("mySortedSet")
+//
+// In this example, we create a sorted set "mySortedSet" and add two members. ZPopMin is then used to retrieve and remove the member with the lowest score, resulting in an entry holding "member2" with a score of 2.0.
+func (z *TypedZSet[V]) ZPopMin(key string) (Entry[V], error) {
+	set, unlock := z.writeKey(key, false)
+	defer unlock()
+
+	if set == nil {
+		return Entry[V]{}, ErrKeyNotFound
+	}
+
+	return z.zpop(key, set, false)
+}
+
+// ZPopMinCount retrieves and removes up to count members with the lowest scores from the sorted set stored at the given key,
+// matching the Redis ZPOPMIN command with a count.
+//
+// The members are returned in the order they are popped, starting with the lowest score. If the key does not
+// exist, the sorted set is empty, or count is 0, it returns an empty slice.
+//
+// Parameters:
+//   - key:   The key associated with the sorted set.
+//   - count: The maximum number of members to pop.
+//
+// Returns:
+//   - The entries holding the popped members, their scores and their values.
+//   - ErrNegativeCount if count is negative.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 1.0, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	zset.ZAdd("mySortedSet", 3.0, "member3", "value3")
+//	entries, err := zset.ZPopMinCount("mySortedSet", 2)
+//
+// In this example, entries will hold "member1" and "member2", and only "member3" remains in "mySortedSet".
+func (z *TypedZSet[V]) ZPopMinCount(key string, count int) ([]Entry[V], error) {
+	if count < 0 {
+		return nil, ErrNegativeCount
+	}
+
+	set, unlock := z.writeKey(key, false)
+	defer unlock()
+
+	if set == nil {
+		return []Entry[V]{}, nil
+	}
+
+	if uint64(count) > set.zsl.length {
+		count = int(set.zsl.length)
+	}
+
+	entries := make([]Entry[V], 0, count)
+	for len(entries) < count {
+		entries = append(entries, set.pop(false).entry())
+	}
+
+	z.notifyRemoved(key, entries)
+	z.logRemoved(key, entries)
+	return entries, nil
+}
+
+// ZPopMax retrieves and removes the member with the highest score from the sorted set stored at the given key.
+//
+// If the key does not exist or the sorted set is empty, it returns ErrKeyNotFound.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//
+// Returns:
+//   - The entry holding the popped member, its score and its value.
+//   - ErrKeyNotFound if the key does not exist or the sorted set is empty.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	entry, err := zset.ZPopMax("mySortedSet")
+//
+// In this example, we create a sorted set "mySortedSet" and add two members. ZPopMax is then used to retrieve and remove the member with the highest score, resulting in an entry holding "member1" with a score of 3.5.
+func (z *TypedZSet[V]) ZPopMax(key string) (Entry[V], error) {
+	set, unlock := z.writeKey(key, false)
+	defer unlock()
+
+	if set == nil {
+		return Entry[V]{}, ErrKeyNotFound
+	}
+
+	return z.zpop(key, set, true)
+}
+
+// ZPopMaxCount retrieves and removes up to count members with the highest scores from the sorted set stored at the given key,
+// matching the Redis ZPOPMAX command with a count.
+//
+// The members are returned in the order they are popped, starting with the highest score. If the key does not
+// exist, the sorted set is empty, or count is 0, it returns an empty slice.
+//
+// Parameters:
+//   - key:   The key associated with the sorted set.
+//   - count: The maximum number of members to pop.
+//
+// Returns:
+//   - The entries holding the popped members, their scores and their values.
+//   - ErrNegativeCount if count is negative.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 1.0, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	zset.ZAdd("mySortedSet", 3.0, "member3", "value3")
+//	entries, err := zset.ZPopMaxCount("mySortedSet", 2)
+//
+// In this example, entries will hold "member3" and "member2", and only "member1" remains in "mySortedSet".
+func (z *TypedZSet[V]) ZPopMaxCount(key string, count int) ([]Entry[V], error) {
+	if count < 0 {
+		return nil, ErrNegativeCount
+	}
+
+	set, unlock := z.writeKey(key, false)
+	defer unlock()
+
+	if set == nil {
+		return []Entry[V]{}, nil
+	}
+
+	if uint64(count) > set.zsl.length {
+		count = int(set.zsl.length)
+	}
+
+	entries := make([]Entry[V], 0, count)
+	for len(entries) < count {
+		entries = append(entries, set.pop(true).entry())
+	}
+
+	z.notifyRemoved(key, entries)
+	z.logRemoved(key, entries)
+	return entries, nil
+}
+
+// BZPopMin retrieves and removes the member with the lowest score from the first non-empty sorted set among the given keys,
+// blocking until one is available or the context is done.
+//
+// The keys are checked in the order they are given. If all of them are empty or missing, the caller
+// waits until a member is added to one of them. Callers waiting on the same key are served in the
+// order they started waiting, and a member added to a key is handed directly to the longest waiting
+// caller, so it cannot be taken by another caller in between.
+//
+// Parameters:
+//   - ctx:  The context controlling how long to wait.
+//   - keys: The keys associated with the sorted sets to pop from.
+//
+// Returns:
+//   - The key the member was popped from.
+//   - The entry holding the popped member, its score and its value.
+//   - ErrNoInputKeys if no keys are given, or the context error if it is done before a member is available.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	go zset.ZAdd("jobs", 1.0, "job1", "payload1")
+//	key, entry, err := zset.BZPopMin(ctx, "urgent", "jobs")
+//
+// In this example, the caller blocks until "job1" is added to "jobs" by another goroutine, and then receives it with key "jobs".
+func (z *TypedZSet[V]) BZPopMin(ctx context.Context, keys ...string) (string, Entry[V], error) {
+	return z.blockingPop(ctx, keys, false)
+}
+
+// BZPopMax retrieves and removes the member with the highest score from the first non-empty sorted set among the given keys,
+// blocking until one is available or the context is done.
+//
+// It behaves like BZPopMin, except that the member with the highest score is popped.
+//
+// Parameters:
+//   - ctx:  The context controlling how long to wait.
+//   - keys: The keys associated with the sorted sets to pop from.
+//
+// Returns:
+//   - The key the member was popped from.
+//   - The entry holding the popped member, its score and its value.
+//   - ErrNoInputKeys if no keys are given, or the context error if it is done before a member is available.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("jobs", 1.0, "job1", "payload1")
+//	zset.ZAdd("jobs", 5.0, "job2", "payload2")
+//	key, entry, err := zset.BZPopMax(ctx, "jobs")
+//
+// In this example, "jobs" is not empty, so BZPopMax returns "job2" immediately without blocking.
+func (z *TypedZSet[V]) BZPopMax(ctx context.Context, keys ...string) (string, Entry[V], error) {
+	return z.blockingPop(ctx, keys, true)
+}
+
+// ZRangeByScore retrieves elements with scores within the specified range from the sorted set stored at the given key.
+//
+// If the key does not exist, it returns an empty slice.
+//
+// Parameters:
+//   - key:     The key associated with the sorted set.
+//   - start:   The minimum score of the range (inclusive).
+//   - end:     The maximum score of the range (inclusive).
+//   - config:  Configuration options for the range query (optional).
+//
+// Returns:
+//   - A slice of entries within the specified score range.
+//   - The slice is empty if the key does not exist or if no elements are within the specified range.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	zset.ZAdd("mySortedSet", 4.2, "member3", "value3")
+//	config := &ZRangeConfig{Limit: 2, ExcludeEnd: true}
+//	result := zset.ZRangeByScore("mySortedSet", 2.0, 4.0, config)
+//
+// In this example, we create a sorted set "mySortedSet" and add three members. ZRangeByScore is then used to retrieve elements within the score range of 2.0 to 4.0, excluding the end, and the result will contain the entries for "member2" and "member1".
+func (z *TypedZSet[V]) ZRangeByScore(key string, start, end float64, config *ZRangeConfig) []Entry[V] {
+	// A start above the end walks the range from the highest score down, as ZRANGE ... BYSCORE REV does.
+	query := RangeByScore(start, end)
+	if start > end {
+		query = query.Rev()
+	}
+
+	if config != nil {
+		if config.ExcludeStart {
+			query = query.ExcludeStart()
+		}
+		if config.ExcludeEnd {
+			query = query.ExcludeEnd()
+		}
+		if config.Limit > 0 {
+			query = query.Limit(0, config.Limit)
+		}
+	}
+
+	entries, _ := z.ZRangeQuery(key, query)
+	if entries == nil {
+		return []Entry[V]{}
+	}
+
+	return entries
+}
+
+// validate checks the flags for the incompatible combinations rejected by Redis ZADD.
+func (o ZAddOptions) validate(members int) error {
+	if o.NX && o.XX {
+		return ErrXXAndNX
+	}
+
+	if (o.GT && o.LT) || (o.GT && o.NX) || (o.LT && o.NX) {
+		return ErrGTLTAndNX
+	}
+
+	if o.INCR && members > 1 {
+		return ErrIncrMultiplePairs
+	}
+
+	return nil
+}
+
+// add adds or updates a single member according to the ZADD flags.
+// It returns the resulting score of the member and one of the zadd* outcomes.
+func (set *zset[V]) add(score float64, member string, value V, opts ZAddOptions) (float64, int, error) {
+	node, exists := set.records[member]
+	if !exists {
+		if opts.XX {
+			return 0, zaddAborted, nil
+		}
+
+		set.remember(set.zsl.insert(score, member, value))
+		return score, zaddAdded, nil
+	}
+
+	if opts.NX {
+		return node.score, zaddAborted, nil
+	}
+
+	if opts.INCR {
+		score += node.score
+		if math.IsNaN(score) {
+			return 0, zaddNop, ErrNotANumber
+		}
+		value = node.value
+	}
+
+	if (opts.LT && score >= node.score) || (opts.GT && score <= node.score) {
+		return node.score, zaddAborted, nil
+	}
+
+	outcome := zaddNop
+	if score != node.score {
+		node = set.zsl.updateScore(node.score, member, score)
+		set.records[member] = node
+		outcome = zaddUpdated
+	}
+	set.zsl.setValue(node, value)
+
+	return score, outcome, nil
+}
+
+// zadd adds a member to a sorted set or replaces its score and value, as ZAdd does. The caller must hold the
+// write lock of the set.
+func (z *TypedZSet[V]) zadd(key string, set *zset[V], score float64, member string, value V) {
+	existingNode, memberExists := set.records[member]
+	oldScore, _ := set.scoreOf(member)
+
+	if memberExists {
+		// The member already exists; move it if the score changed and update the value.
+		if existingNode.score != score {
+			existingNode = set.zsl.updateScore(existingNode.score, member, score)
+			set.records[member] = existingNode
+		}
+		set.zsl.setValue(existingNode, value)
+	} else {
+		set.remember(set.zsl.insert(score, member, value))
+	}
+
+	z.notifyScore(key, member, memberExists, oldScore, score)
+	z.log(logRecord[V]{op: aofAdd, key: key, entries: []Entry[V]{{Member: member, Score: score, Value: value}}})
+	z.serveWaiters(key, set)
+}
+
+// zincrby increments the score of a member of a sorted set, adding it if needed, as ZIncrBy does. The caller
+// must hold the write lock of the set.
+func (z *TypedZSet[V]) zincrby(key string, set *zset[V], increment float64, member string) (float64, error) {
+	if node, exists := set.records[member]; exists {
+		newScore := node.score + increment
+		if math.IsNaN(newScore) {
+			return 0, ErrNotANumber
+		}
+
+		z.notify(EventScoreChanged, key, member, node.score, newScore)
+		set.records[member] = set.zsl.updateScore(node.score, member, newScore)
+		z.log(logRecord[V]{op: aofAdd, key: key, entries: []Entry[V]{set.records[member].entry()}})
+		return newScore, nil
+	}
+
+	var zero V
+	set.remember(set.zsl.insert(increment, member, zero))
+
+	z.notify(EventAdded, key, member, 0, increment)
+	z.log(logRecord[V]{op: aofAdd, key: key, entries: []Entry[V]{{Member: member, Score: increment}}})
+	z.serveWaiters(key, set)
+	return increment, nil
+}
+
+// zrem removes a member from a sorted set, as ZRem does. The caller must hold the write lock of the set.
+func (z *TypedZSet[V]) zrem(key string, set *zset[V], member string) bool {
+	node, exists := set.records[member]
+	if !exists {
+		return false
+	}
+
+	set.zsl.delete(node.score, member)
+	set.forget(member)
+	z.notify(EventRemoved, key, member, node.score, 0)
+	z.log(logRecord[V]{op: aofRem, key: key, members: []string{member}})
+	return true
+}
+
+// zclear removes a key and its sorted set, as ZClear does. The caller must hold z.mu exclusively.
+func (z *TypedZSet[V]) zclear(key string) {
+	if _, exists := z.records[key]; exists {
+		z.deleteKey(key)
+		z.notify(EventKeyCleared, key, "", 0, 0)
+		z.log(logRecord[V]{op: aofDel, key: key})
+	}
+}
+
+// zpop removes and returns the member of a sorted set with the lowest score, or the highest when max is
+// true, as ZPopMin and ZPopMax do. The caller must hold the write lock of the set.
+func (z *TypedZSet[V]) zpop(key string, set *zset[V], max bool) (Entry[V], error) {
+	node := set.pop(max)
+	if node == nil {
+		return Entry[V]{}, ErrKeyNotFound
+	}
+
+	z.notify(EventRemoved, key, node.member, node.score, 0)
+	z.log(logRecord[V]{op: aofRem, key: key, members: []string{node.member}})
+	return node.entry(), nil
+}
+
+// keyExists reports whether a sorted set exists with the given key, leaving out a set whose members are all
+// past their deadline. The caller must hold z.mu, but no lock of the set.
+func (z *TypedZSet[V]) keyExists(key string) bool {
+	set, exists := z.records[key]
+	return exists && z.live(set)
+}
+
+// pop removes and returns the member with the lowest score, or the highest when max is true.
+// It returns nil if the set is empty.
+func (set *zset[V]) pop(max bool) *zslNode[V] {
+	if set.zsl.length == 0 {
+		return nil
+	}
+
+	node := set.zsl.head.level[0].forward
+	if max {
+		node = set.zsl.tail
+	}
+
+	set.zsl.delete(node.score, node.member)
+	set.forget(node.member)
+
+	return node
+}
+
+// blockingPop pops from the first non-empty key, or registers the caller as a waiter on every key
+// and blocks until serveWaiters hands it a member or the context is done.
+func (z *TypedZSet[V]) blockingPop(ctx context.Context, keys []string, max bool) (string, Entry[V], error) {
+	if len(keys) == 0 {
+		return "", Entry[V]{}, ErrNoInputKeys
+	}
+
+	// Holding the keyspace lock exclusively keeps every set still until the waiter is registered,
+	// so a member added in between cannot be missed.
+	z.mu.Lock()
+	for _, key := range keys {
+		if set := z.lookup(key); set != nil && z.purgeKey(key, set) {
+			if node := set.pop(max); node != nil {
+				z.notify(EventRemoved, key, node.member, node.score, 0)
+				z.log(logRecord[V]{op: aofRem, key: key, members: []string{node.member}})
+				z.mu.Unlock()
+				return key, node.entry(), nil
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		z.mu.Unlock()
+		return "", Entry[V]{}, err
+	}
+
+	w := &popWaiter[V]{keys: keys, max: max, result: make(chan poppedMember[V], 1)}
+	z.waitersMu.Lock()
+	for _, key := range keys {
+		z.waiters[key] = append(z.waiters[key], w)
+	}
+	z.waitersMu.Unlock()
+	z.mu.Unlock()
+
+	select {
+	case popped := <-w.result:
+		return popped.key, popped.node.entry(), nil
+	case <-ctx.Done():
+	}
+
+	z.waitersMu.Lock()
+	defer z.waitersMu.Unlock()
+
+	// A member may have been handed over while the context was being cancelled; it has already been
+	// removed from its set, so return it rather than losing it.
+	select {
+	case popped := <-w.result:
+		return popped.key, popped.node.entry(), nil
+	default:
+	}
+
+	z.removeWaiter(w)
+	return "", Entry[V]{}, ctx.Err()
+}
+
+// serveWaiters hands members of the sorted set at the given key to the callers blocked on it,
+// oldest first, for as long as the set is not empty. The caller must hold the set's write lock.
+func (z *TypedZSet[V]) serveWaiters(key string, set *zset[V]) {
+	z.waitersMu.Lock()
+	defer z.waitersMu.Unlock()
+
+	for len(z.waiters[key]) > 0 {
+		w := z.waiters[key][0]
+
+		node := set.pop(w.max)
+		if node == nil {
+			return
+		}
+		z.notify(EventRemoved, key, node.member, node.score, 0)
+		z.log(logRecord[V]{op: aofRem, key: key, members: []string{node.member}})
+
+		z.removeWaiter(w)
+		w.result <- poppedMember[V]{key: key, node: node}
+	}
+}
+
+// removeWaiter removes a waiter from the queues of all the keys it is blocked on.
+func (z *TypedZSet[V]) removeWaiter(w *popWaiter[V]) {
+	for _, key := range w.keys {
+		queue := z.waiters[key]
+		for i, other := range queue {
+			if other == w {
+				queue = append(queue[:i], queue[i+1:]...)
+				break
+			}
+		}
+
+		if len(queue) == 0 {
+			delete(z.waiters, key)
+		} else {
+			z.waiters[key] = queue
+		}
+	}
+}
+
+// getOrCreate returns the sorted set stored at the given key, creating an empty one if needed.
+// A key past its deadline is removed first, so the new set does not inherit its deadline.
+func (z *TypedZSet[V]) getOrCreate(key string) *zset[V] {
+	set, exists := z.records[key]
+	if exists && z.expired(set) {
+		z.expireKey(key)
+		exists = false
+	}
+
+	if !exists {
+		set = &zset[V]{
+			records: make(map[string]*zslNode[V]),
+			zsl:     newZSkipList[V](),
+		}
+		set.zsl.used = &z.used
+		set.accessed.Store(z.clock.Now().UnixNano()) // As Redis stamps the LRU clock of a new object
+		set.frequency.Store(lfuInitValue)
+		set.version = z.versions.Add(1)
+		z.records[key] = set
+		z.keys.add(key)
+		z.used.Add(set.size(key))
+	}
+
+	return set
+}
+
+// deleteIfEmpty removes the key if it still holds the given sorted set and that set no longer holds any member.
+// The removal is recorded, since members removed by their deadline are replayed by ZRem, which leaves the
+// key in place.
+func (z *TypedZSet[V]) deleteIfEmpty(key string, set *zset[V]) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if z.records[key] == set && set.zsl.length == 0 {
+		z.deleteKey(key)
+		z.log(logRecord[V]{op: aofDel, key: key})
+	}
+}
+
+// readKey read-locks the sorted set at the given key and returns it with the function that releases it.
+// The set is nil if the key does not exist; a key past its deadline is removed and reported as missing.
+func (z *TypedZSet[V]) readKey(key string) (*zset[V], func()) {
+	set, unlock := z.rlockKey(key)
+	if set != nil {
+		z.touch(set)
+	}
+	return set, unlock
+}
+
+// rlockKey read-locks the sorted set at the given key like readKey, without counting an access to the key.
+func (z *TypedZSet[V]) rlockKey(key string) (*zset[V], func()) {
+	z.mu.RLock()
+	set, exists := z.records[key]
+	if !exists {
+		return nil, z.mu.RUnlock
+	}
+	if z.expired(set) {
+		z.mu.RUnlock()
+		z.deleteIfExpired(key, set)
+		return nil, func() {}
+	}
+
+	if z.rlockSet(key, set) {
+		set.mu.RUnlock()
+		z.mu.RUnlock()
+		z.deleteIfEmpty(key, set)
+		return nil, func() {}
+	}
+	return set, func() {
+		set.mu.RUnlock()
+		z.mu.RUnlock()
+	}
+}
+
+// writeKey write-locks the sorted set at the given key and returns it with the function that releases it.
+// A missing key is created when create is true; otherwise the set is nil. A key past its deadline is
+// treated as missing, and removed, as is a key whose members are all past their deadline. The write first
+// waits for the subscribers holding back the writes, as described by throttle.
+func (z *TypedZSet[V]) writeKey(key string, create bool) (*zset[V], func()) {
+	z.throttle()
+	z.mu.RLock()
+	set, exists := z.records[key]
+	if exists && !z.expired(set) {
+		set.mu.Lock()
+		if z.purgeMembers(key, set) {
+			set.mu.Unlock()
+			z.mu.RUnlock()
+			z.deleteIfEmpty(key, set)
+			return z.writeKey(key, create)
+		}
+		z.touch(set)
+		return set, func() {
+			set.mu.Unlock()
+			z.mu.RUnlock()
+		}
+	}
+	z.mu.RUnlock()
+
+	if !create {
+		if exists {
+			z.deleteIfExpired(key, set)
+		}
+		return nil, func() {}
+	}
+
+	// Creating a key changes the keyspace itself, so the new set is handed out under the exclusive lock.
+	z.mu.Lock()
+	set = z.getOrCreate(key)
+	if !z.purgeKey(key, set) {
+		set = z.getOrCreate(key)
+	}
+	z.touch(set)
+	return set, z.mu.Unlock
+}
+
+// readKeys read-locks the keyspace and the sorted sets at the given keys, in key order so that
+// concurrent callers cannot deadlock, and returns the function that releases them.
+func (z *TypedZSet[V]) readKeys(keys []string) func() {
+	z.mu.RLock()
+
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	var locked []*zset[V]
+	var emptied map[string]*zset[V] // Sets left empty by their expired members, whose keys go once unlocked
+	for i, key := range sorted {
+		if i > 0 && key == sorted[i-1] {
+			continue
+		}
+		if set, exists := z.records[key]; exists {
+			if z.rlockSet(key, set) {
+				if emptied == nil {
+					emptied = make(map[string]*zset[V])
+				}
+				emptied[key] = set
+			}
+			z.touch(set)
+			locked = append(locked, set)
+		}
+	}
+
+	return func() {
+		for _, set := range locked {
+			set.mu.RUnlock()
+		}
+		z.mu.RUnlock()
+
+		for key, set := range emptied {
+			z.deleteIfEmpty(key, set)
+		}
+	}
+}
+
+// union combines the sorted sets at the given keys into members sorted by score and member.
+func (z *TypedZSet[V]) union(keys []string, opts *ZStoreOptions) ([]Entry[V], error) {
+	weights, aggregate, err := storeOptions(keys, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	positions := make(map[string]int)
+	var members []Entry[V]
+
+	for i, key := range keys {
+		set := z.lookup(key)
+		if set == nil {
+			continue
+		}
+
+		for node := set.zsl.head.level[0].forward; node != nil; node = node.level[0].forward {
+			score := weightedScore(node.score, weights[i])
+			if pos, seen := positions[node.member]; seen {
+				members[pos].Score = aggregateScores(aggregate, members[pos].Score, score)
+				continue
+			}
+
+			positions[node.member] = len(members)
+			members = append(members, Entry[V]{Score: score, Member: node.member, Value: node.value})
+		}
+	}
+
+	sortMembers(members)
+	return members, nil
+}
+
+// inter intersects the sorted sets at the given keys into members sorted by score and member.
+// It walks the smallest set and looks its members up in the others.
+func (z *TypedZSet[V]) inter(keys []string, opts *ZStoreOptions) ([]Entry[V], error) {
+	weights, aggregate, err := storeOptions(keys, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	smallest := -1
+	for i, key := range keys {
+		set := z.lookup(key)
+		if set == nil {
+			return nil, nil
+		}
+
+		if smallest < 0 || set.zsl.length < z.records[keys[smallest]].zsl.length {
+			smallest = i
+		}
+	}
+
+	var members []Entry[V]
+	for node := z.records[keys[smallest]].zsl.head.level[0].forward; node != nil; node = node.level[0].forward {
+		var score float64
+		var value V
+		found := true
+
+		for i, key := range keys {
+			other, exists := z.records[key].records[node.member]
+			if !exists {
+				found = false
+				break
+			}
+
+			weighted := weightedScore(other.score, weights[i])
+			if i == 0 {
+				score, value = weighted, other.value
+			} else {
+				score = aggregateScores(aggregate, score, weighted)
+			}
+		}
+
+		if found {
+			members = append(members, Entry[V]{Score: score, Member: node.member, Value: value})
+		}
+	}
+
+	sortMembers(members)
+	return members, nil
+}
+
+// diff returns the members of the first sorted set that are not in any of the following ones, in order.
+func (z *TypedZSet[V]) diff(keys []string) ([]Entry[V], error) {
+	if len(keys) == 0 {
+		return nil, ErrNoInputKeys
+	}
+
+	first := z.lookup(keys[0])
+	if first == nil {
+		return nil, nil
+	}
+
+	var others []*zset[V]
+	for _, key := range keys[1:] {
+		if set := z.lookup(key); set != nil {
+			others = append(others, set)
+		}
+	}
+
+	var members []Entry[V]
+	for node := first.zsl.head.level[0].forward; node != nil; node = node.level[0].forward {
+		excluded := false
+		for _, other := range others {
+			if _, found := other.records[node.member]; found {
+				excluded = true
+				break
+			}
+		}
+
+		if !excluded {
+			members = append(members, Entry[V]{Score: node.score, Member: node.member, Value: node.value})
+		}
+	}
+
+	return members, nil
+}
+
+// sourcesBySize returns the sorted sets at the given keys ordered from the smallest to the largest.
+// It returns false if any key does not exist, since the intersection is then empty.
+func (z *TypedZSet[V]) sourcesBySize(keys []string) ([]*zset[V], bool) {
+	sets := make([]*zset[V], 0, len(keys))
+	for _, key := range keys {
+		set := z.lookup(key)
+		if set == nil {
+			return nil, false
+		}
+		sets = append(sets, set)
+	}
+
+	sort.SliceStable(sets, func(i, j int) bool { return sets[i].zsl.length < sets[j].zsl.length })
+	return sets, true
+}
+
+// containsMember reports whether the member is present in every one of the given sorted sets.
+func containsMember[V any](sets []*zset[V], member string) bool {
+	for _, set := range sets {
+		if _, exists := set.records[member]; !exists {
+			return false
+		}
+	}
+
+	return true
+}
+
+// store replaces the sorted set at the given key with members sorted by score and member,
+// or removes the key if there are none. It returns the number of stored members.
+func (z *TypedZSet[V]) store(key string, members []Entry[V]) int {
+	if set, exists := z.records[key]; exists {
+		if z.expired(set) {
+			z.notify(EventKeyExpired, key, "", 0, 0)
+		} else {
+			z.notify(EventKeyCleared, key, "", 0, 0)
+		}
+	}
+	z.deleteKey(key)
+	if len(members) == 0 {
+		z.log(logRecord[V]{op: aofDel, key: key})
+		return 0
+	}
+
+	set := z.getOrCreate(key)
+	for _, node := range set.zsl.build(members) {
+		set.remember(node)
+		z.notify(EventAdded, key, node.member, 0, node.score)
+	}
+
+	z.log(logRecord[V]{op: aofStore, key: key, entries: members})
+	z.serveWaiters(key, set)
+	return len(members)
+}
+
+// storeOptions validates the options of a set operation and returns one weight per key and the aggregate function.
+func storeOptions(keys []string, opts *ZStoreOptions) ([]float64, Aggregate, error) {
+	if len(keys) == 0 {
+		return nil, AggregateSum, ErrNoInputKeys
+	}
+
+	weights := make([]float64, len(keys))
+	for i := range weights {
+		weights[i] = 1
+	}
+
+	if opts == nil {
+		return weights, AggregateSum, nil
+	}
+
+	if opts.Weights != nil {
+		if len(opts.Weights) != len(keys) {
+			return nil, AggregateSum, ErrWeightsMismatch
+		}
+		copy(weights, opts.Weights)
+	}
+
+	return weights, opts.Aggregate, nil
+}
+
+// weightedScore multiplies a score by its weight, treating the NaN produced by infinity times 0 as 0.
+func weightedScore(score, weight float64) float64 {
+	weighted := score * weight
+	if math.IsNaN(weighted) {
+		return 0
+	}
+
+	return weighted
+}
+
+// aggregateScores combines two scores of the same member, treating the NaN sum of opposite infinities as 0.
+func aggregateScores(aggregate Aggregate, current, score float64) float64 {
+	switch aggregate {
+	case AggregateMin:
+		return math.Min(current, score)
+	case AggregateMax:
+		return math.Max(current, score)
+	}
+
+	sum := current + score
+	if math.IsNaN(sum) {
+		return 0
+	}
+
+	return sum
+}
+
+// sortMembers sorts members by score, then by member, which is the order of the skip list.
+func sortMembers[V any](members []Entry[V]) {
+	sort.Slice(members, func(i, j int) bool {
+		if members[i].Score != members[j].Score {
+			return members[i].Score < members[j].Score
+		}
+		return members[i].Member < members[j].Member
+	})
+}
+
+// scanHash returns the 64-bit FNV-1a hash of name, which sets the order in which ZScan and Scan visit names.
+func scanHash(name string) uint64 {
+	hash := uint64(14695981039346656037)
+	for i := 0; i < len(name); i++ {
+		hash ^= uint64(name[i])
+		hash *= 1099511628211
+	}
+
+	return hash
+}
+
+// globMatch reports whether str matches the glob pattern, following the Redis stringmatchlen function:
+// "*" matches any sequence, "?" any byte, "[...]" a set or range of bytes, negated by a leading "^",
+// and "\" escapes the next byte.
+func globMatch(pattern, str string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(str); i++ {
+				if globMatch(pattern[1:], str[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(str) == 0 {
+				return false
+			}
+			str = str[1:]
+		case '[':
+			if len(str) == 0 {
+				return false
+			}
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			matched := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				switch {
+				case pattern[0] == '\\' && len(pattern) >= 2:
+					pattern = pattern[1:]
+					matched = matched || pattern[0] == str[0]
+				case len(pattern) >= 3 && pattern[1] == '-':
+					start, end := pattern[0], pattern[2]
+					if start > end {
+						start, end = end, start
+					}
+					pattern = pattern[2:]
+					matched = matched || (str[0] >= start && str[0] <= end)
+				default:
+					matched = matched || pattern[0] == str[0]
+				}
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				// An unterminated set ends the pattern, as in Redis
+				return matched != not && len(str) == 1
 			}
-
-			nextNode := currentNode.backwards
-
-			result = append(result, currentNode)
-			limit--
-
-			currentNode = nextNode
-		}
-	} else {
-		// Search from start to end
-		currentNode := zsl.head
-		if excludeStart {
-			for level := zsl.level - 1; level >= 0; level-- {
-				currentNode = updateNode(currentNode, level)
+			if matched == not {
+				return false
 			}
-		} else {
-			for level := zsl.level - 1; level >= 0; level-- {
-				currentNode = updateNode(currentNode, level)
+			str = str[1:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
 			}
-		}
-
-		currentNode = currentNode.level[0].forward
-
-		for currentNode != nil && limit > 0 {
-			if excludeEnd && !compare(currentNode.score, end) {
-				break
+			fallthrough
+		default:
+			if len(str) == 0 || pattern[0] != str[0] {
+				return false
 			}
-
-			nextNode := currentNode.level[0].forward
-
-			result = append(result, currentNode)
-			limit--
-
-			currentNode = nextNode
+			str = str[1:]
 		}
+		pattern = pattern[1:]
 	}
 
-	return result
+	return len(str) == 0
+}
+
+// entry returns the member, score and value of the node as an Entry.
+func (n *zslNode[V]) entry() Entry[V] {
+	return Entry[V]{Member: n.member, Score: n.score, Value: n.value}
 }
 
 // getRandomLevel returns a random level for a skip list node.
@@ -856,10 +3211,10 @@ func getRandomLevel() int {
 
 // insert adds a new node with the specified score, member, and value to the skip list.
 // It returns the inserted node.
-func (z *zskiplist) insert(score float64, member string, value interface{}) *zslNode {
-	// Initialize arrays for update nodes and rank values
-	updateNodes := make([]*zslNode, SkipListMaxLvl)
-	rankValues := make([]uint64, SkipListMaxLvl)
+func (z *zskiplist[V]) insert(score float64, member string, value V) *zslNode[V] {
+	// Arrays for update nodes and rank values, kept on the stack
+	var updateNodes [SkipListMaxLvl]*zslNode[V]
+	var rankValues [SkipListMaxLvl]uint64
 
 	currentNode := z.head
 
@@ -881,6 +3236,13 @@ func (z *zskiplist) insert(score float64, member string, value interface{}) *zsl
 		updateNodes[level] = currentNode
 	}
 
+	return z.link(updateNodes[:], rankValues[:], score, member, value)
+}
+
+// link creates a node with a random level and links it after the given update nodes,
+// whose ranks are given in rankValues. Both slices are updated for levels above the current
+// list level when the new node is taller than the list.
+func (z *zskiplist[V]) link(updateNodes []*zslNode[V], rankValues []uint64, score float64, member string, value V) *zslNode[V] {
 	newNodeLevel := getRandomLevel()
 
 	if newNodeLevel > z.level {
@@ -893,6 +3255,7 @@ func (z *zskiplist) insert(score float64, member string, value interface{}) *zsl
 	}
 
 	newNode := createNode(newNodeLevel, score, member, value)
+	z.account(newNode.size())
 
 	for level := 0; level < newNodeLevel; level++ {
 		newNode.level[level].forward = updateNodes[level].level[level].forward
@@ -922,9 +3285,101 @@ func (z *zskiplist) insert(score float64, member string, value interface{}) *zsl
 	return newNode
 }
 
-// getRank returns the rank of a member in the skip list based on its score.
-// If the member is not found, it returns 0.
-func (z *zskiplist) getRank(score float64, member string) uint64 {
+// insertSorted inserts members that are sorted by score and member, and not yet present, in a single
+// pass over the skip list. The search for each member resumes from the nodes visited for the previous
+// one instead of restarting at the head. It returns the inserted nodes in the same order.
+func (z *zskiplist[V]) insertSorted(members []Entry[V]) []*zslNode[V] {
+	var updateNodes [SkipListMaxLvl]*zslNode[V]
+	var rankValues [SkipListMaxLvl]uint64
+
+	for level := range updateNodes {
+		updateNodes[level] = z.head
+	}
+
+	nodes := make([]*zslNode[V], len(members))
+	for i, m := range members {
+		currentNode, rank := updateNodes[z.level-1], rankValues[z.level-1]
+
+		for level := z.level - 1; level >= 0; level-- {
+			// Resume from whichever of the previous finger and the node found above is further ahead.
+			if rankValues[level] > rank {
+				currentNode, rank = updateNodes[level], rankValues[level]
+			}
+
+			for currentNode.level[level].forward != nil &&
+				(currentNode.level[level].forward.score < m.Score ||
+					(currentNode.level[level].forward.score == m.Score && currentNode.level[level].forward.member < m.Member)) {
+
+				rank += currentNode.level[level].span
+				currentNode = currentNode.level[level].forward
+			}
+
+			updateNodes[level], rankValues[level] = currentNode, rank
+		}
+
+		newNode := z.link(updateNodes[:], rankValues[:], m.Score, m.Member, m.Value)
+
+		// The next member sorts after the new node, so it becomes the finger on its levels.
+		newRank := rankValues[0] + 1
+		for level := range newNode.level {
+			updateNodes[level], rankValues[level] = newNode, newRank
+		}
+
+		nodes[i] = newNode
+	}
+
+	return nodes
+}
+
+// build links members that are sorted by score and member into an empty skip list in linear time.
+// It returns the created nodes in the same order.
+func (z *zskiplist[V]) build(members []Entry[V]) []*zslNode[V] {
+	var tails [SkipListMaxLvl]*zslNode[V]
+	var tailRanks [SkipListMaxLvl]uint64
+
+	for level := range tails {
+		tails[level] = z.head
+	}
+
+	nodes := make([]*zslNode[V], len(members))
+	var previous *zslNode[V]
+
+	for i, m := range members {
+		level := getRandomLevel()
+		if level > z.level {
+			z.level = level
+		}
+
+		newNode := createNode(level, m.Score, m.Member, m.Value)
+		z.account(newNode.size())
+		rank := uint64(i + 1)
+
+		for l := 0; l < level; l++ {
+			tails[l].level[l].forward = newNode
+			tails[l].level[l].span = rank - tailRanks[l]
+			tails[l], tailRanks[l] = newNode, rank
+		}
+
+		newNode.backwards = previous
+		previous = newNode
+		nodes[i] = newNode
+	}
+
+	z.length = uint64(len(members))
+	for level := 0; level < z.level; level++ {
+		tails[level].level[level].span = z.length - tailRanks[level]
+	}
+
+	if previous != nil {
+		z.tail = previous
+	}
+
+	return nodes
+}
+
+// getRank returns the 0-based rank of a member in the skip list based on its score,
+// which is the number of nodes ordered before it.
+func (z *zskiplist[V]) getRank(score float64, member string) uint64 {
 	var rank uint64 = 0
 	currentNode := z.head
 	for level := z.level - 1; level >= 0; level-- {
@@ -938,9 +3393,24 @@ func (z *zskiplist) getRank(score float64, member string) uint64 {
 				break
 			}
 		}
+	}
+
+	return rank
+}
+
+// countBelow returns the number of nodes with a score less than the given score,
+// or less than or equal to it when inclusive is true.
+func (z *zskiplist[V]) countBelow(score float64, inclusive bool) uint64 {
+	var rank uint64
+	currentNode := z.head
+
+	for level := z.level - 1; level >= 0; level-- {
+		for currentNode.level[level].forward != nil &&
+			(currentNode.level[level].forward.score < score ||
+				(inclusive && currentNode.level[level].forward.score == score)) {
 
-		if currentNode.member == member {
-			return rank
+			rank += currentNode.level[level].span
+			currentNode = currentNode.level[level].forward
 		}
 	}
 
@@ -948,7 +3418,7 @@ func (z *zskiplist) getRank(score float64, member string) uint64 {
 }
 
 // deleteNode deletes a node from the skip list based on the provided node and updates.
-func (z *zskiplist) deleteNode(nodeToDelete *zslNode, updates []*zslNode) {
+func (z *zskiplist[V]) deleteNode(nodeToDelete *zslNode[V], updates []*zslNode[V]) {
 	for level := 0; level < z.level; level++ {
 		if updates[level].level[level].forward == nodeToDelete {
 			updates[level].level[level].span += nodeToDelete.level[level].span - 1
@@ -969,11 +3439,47 @@ func (z *zskiplist) deleteNode(nodeToDelete *zslNode, updates []*zslNode) {
 	}
 
 	z.length--
+	z.account(-nodeToDelete.size())
+}
+
+// updateScore changes the score of the node holding the given member from curScore to newScore.
+// If the node still fits between its neighbours it is updated in place; otherwise it is unlinked
+// and re-inserted with its value preserved. It returns the node that now holds the member.
+func (z *zskiplist[V]) updateScore(curScore float64, member string, newScore float64) *zslNode[V] {
+	var updates [SkipListMaxLvl]*zslNode[V]
+	currentNode := z.head
+
+	for level := z.level - 1; level >= 0; level-- {
+		for currentNode.level[level].forward != nil {
+			nextNode := currentNode.level[level].forward
+			if nextNode.score < curScore || (nextNode.score == curScore && nextNode.member < member) {
+				currentNode = nextNode
+			} else {
+				break
+			}
+		}
+		updates[level] = currentNode
+	}
+
+	node := currentNode.level[0].forward
+	if node == nil || node.score != curScore || node.member != member {
+		return nil
+	}
+
+	// The position is unchanged, so the score can be replaced without relinking.
+	if (node.backwards == nil || node.backwards.score < newScore) &&
+		(node.level[0].forward == nil || node.level[0].forward.score > newScore) {
+		node.score = newScore
+		return node
+	}
+
+	z.deleteNode(node, updates[:])
+	return z.insert(newScore, member, node.value)
 }
 
 // delete removes a member with the specified score from the skip list.
-func (z *zskiplist) delete(score float64, member string) {
-	updates := make([]*zslNode, SkipListMaxLvl)
+func (z *zskiplist[V]) delete(score float64, member string) {
+	var updates [SkipListMaxLvl]*zslNode[V]
 	currentNode := z.head
 
 	for level := z.level - 1; level >= 0; level-- {
@@ -990,37 +3496,36 @@ func (z *zskiplist) delete(score float64, member string) {
 
 	currentNode = currentNode.level[0].forward
 	if currentNode != nil && currentNode.score == score && currentNode.member == member {
-		z.deleteNode(currentNode, updates)
+		z.deleteNode(currentNode, updates[:])
 	}
 }
 
-func (z *zset) getNodeByRank(key string, rank int64, reverse bool) (string, float64) {
-	if rank < 0 || rank > int64(z.zsl.length) {
-		return "", math.MinInt64
+// entries returns the members of the set as entries, ordered by score and member.
+func (set *zset[V]) entries() []Entry[V] {
+	entries := make([]Entry[V], 0, set.zsl.length)
+	for node := set.zsl.head.level[0].forward; node != nil; node = node.level[0].forward {
+		entries = append(entries, node.entry())
 	}
 
-	if reverse {
-		rank = int64(z.zsl.length) - rank
-	} else {
-		rank++
-	}
+	return entries
+}
 
-	n := z.zsl.getNodeByRank(uint64(rank))
-	if n == nil {
-		return "", math.MinInt64
+// entryByRank returns the entry at the given 0-based rank, counted from the highest score when reverse is true.
+func (set *zset[V]) entryByRank(rank int64, reverse bool) (Entry[V], bool) {
+	if rank < 0 || rank >= int64(set.zsl.length) {
+		return Entry[V]{}, false
 	}
 
-	node := z.records[n.member]
+	node := set.getStartNode(rank, reverse)
 	if node == nil {
-		return "", math.MinInt64
+		return Entry[V]{}, false
 	}
 
-	return node.member, node.score
-
+	return node.entry(), true
 }
 
 // getNodeByRank returns the node in the skip list at the specified rank.
-func (zsl *zskiplist) getNodeByRank(rank uint64) *zslNode {
+func (zsl *zskiplist[V]) getNodeByRank(rank uint64) *zslNode[V] {
 	if rank == 0 || rank > zsl.length {
 		return nil
 	}
@@ -1042,32 +3547,122 @@ func (zsl *zskiplist) getNodeByRank(rank uint64) *zslNode {
 	return nil
 }
 
+// query returns the entries selected by a range query, given its already parsed lexicographic range.
+// It finds the rank of the first node to return, applies the offset by rank, and then walks the
+// skip list in the query's direction while the nodes stay within the range.
+func (set *zset[V]) query(q RangeQuery, lex lexRange) []Entry[V] {
+	length := set.zsl.length
+	steps := uint64(math.MaxUint64)
+	var rank uint64 // 1-based rank of the first node in iteration order, 0 if the range is empty
+	var inRange func(*zslNode[V]) bool
+
+	switch q.by {
+	case byScore:
+		r := q.scoreRange()
+		first := set.zsl.firstInRange(r)
+		if q.rev {
+			first = set.zsl.lastInRange(r)
+		}
+		if first != nil {
+			rank = set.zsl.getRank(first.score, first.member) + 1
+		}
+		inRange = func(n *zslNode[V]) bool { return r.gteMin(n.score) && r.lteMax(n.score) }
+
+	case byLex:
+		first := set.zsl.firstInLexRange(lex)
+		if q.rev {
+			first = set.zsl.lastInLexRange(lex)
+		}
+		if first != nil {
+			rank = set.zsl.getRank(first.score, first.member) + 1
+		}
+		inRange = func(n *zslNode[V]) bool { return lex.gteMin(n.member) && lex.lteMax(n.member) }
+
+	default:
+		start := adjustRange(int64(q.startRank), int64(length))
+		stop := adjustRange(int64(q.stopRank), int64(length))
+		if stop >= int64(length) {
+			stop = int64(length) - 1
+		}
+		if start > stop {
+			return nil
+		}
+
+		steps = uint64(stop - start + 1)
+		rank = uint64(start) + 1
+		if q.rev {
+			rank = length - uint64(start)
+		}
+		inRange = func(*zslNode[V]) bool { return true }
+	}
+
+	if rank == 0 || q.offset < 0 || uint64(q.offset) >= steps {
+		return nil
+	}
+
+	steps -= uint64(q.offset)
+	if q.count >= 0 && uint64(q.count) < steps {
+		steps = uint64(q.count)
+	}
+
+	if q.rev {
+		if rank <= uint64(q.offset) {
+			return nil
+		}
+		rank -= uint64(q.offset)
+	} else {
+		rank += uint64(q.offset)
+	}
+
+	var result []Entry[V]
+	for node := set.zsl.getNodeByRank(rank); node != nil && steps > 0 && inRange(node); steps-- {
+		result = append(result, node.entry())
+		node = set.getNextNode(node, q.rev)
+	}
+
+	return result
+}
+
+// scoreRange returns the score range of a query, with its start as the upper bound when it is reversed.
+func (q RangeQuery) scoreRange() scoreRange {
+	if q.rev {
+		return boundsRange(q.stopScore, q.startScore)
+	}
+
+	return boundsRange(q.startScore, q.stopScore)
+}
+
+// lexRange returns the lexicographic range of a query, with its start as the upper bound when it is reversed,
+// or the error from parsing its bounds. It returns an empty range for queries that are not lexicographic.
+func (q RangeQuery) lexRange() (lexRange, error) {
+	if q.by != byLex || q.err != nil {
+		return lexRange{}, q.err
+	}
+
+	if q.rev {
+		return lexRange{min: q.stopLex, max: q.startLex}, nil
+	}
+
+	return lexRange{min: q.startLex, max: q.stopLex}, nil
+}
+
 // findRange retrieves a range of elements from the zset.
 // It starts at the 'start' rank and goes up to the 'stop' rank.
 // If 'reverseEnabled' is true, it fetches the elements in reverse order.
 // If 'scoresEnabled' is true, the results will include scores along with members.
 // The function returns a slice of interfaces containing the selected elements.
-func (zset *zset) findRange(key string, start, stop int64, reverse, withScores bool) (result []interface{}) {
-	length := int64(zset.zsl.length)
-
-	start = adjustRange(start, length)
-	stop = adjustRange(stop, length)
-
-	if start > stop {
-		return
+func (zset *zset[V]) findRange(key string, start, stop int64, reverse, withScores bool) (result []interface{}) {
+	query := RangeByRank(int(start), int(stop))
+	if reverse {
+		query = query.Rev()
 	}
 
-	span := stop - start + 1
-	node := zset.getStartNode(start, reverse)
-
-	for span > 0 && node != nil {
-		span--
+	for _, e := range zset.query(query, lexRange{}) {
 		if withScores {
-			result = append(result, node.member, node.score)
+			result = append(result, e.Member, e.Score)
 		} else {
-			result = append(result, node.member)
+			result = append(result, e.Member)
 		}
-		node = zset.getNextNode(node, reverse)
 	}
 
 	return result
@@ -1085,13 +3680,13 @@ func adjustRange(value, length int64) int64 {
 }
 
 // Helper function to check if the current node has a forward node at a given level
-func currentNodeHasForward(node *zslNode, level int) bool {
+func currentNodeHasForward[V any](node *zslNode[V], level int) bool {
 	return node.level[level].forward != nil
 }
 
 // getStartNode retrieves the starting node for a given rank.
 // If 'reverse' is true, it adjusts the rank for fetching in reverse order.
-func (z *zset) getStartNode(rank int64, reverse bool) *zslNode {
+func (z *zset[V]) getStartNode(rank int64, reverse bool) *zslNode[V] {
 	if reverse {
 		rank = int64(z.zsl.length) - rank
 	} else {
@@ -1103,64 +3698,269 @@ func (z *zset) getStartNode(rank int64, reverse bool) *zslNode {
 
 // getNextNode retrieves the next node based on the current node in the zset.
 // If 'reverse' is true, it returns the previous node (in reverse order).
-func (z *zset) getNextNode(currentNode *zslNode, reverse bool) *zslNode {
+func (z *zset[V]) getNextNode(currentNode *zslNode[V], reverse bool) *zslNode[V] {
 	if reverse {
 		return currentNode.backwards
 	}
 	return currentNode.level[0].forward
 }
 
-// limitScores ensures that min and max scores fall within the valid score range.
-//
-// If min is below the lowest score, it is set to the lowest score.
-// If max is above the highest score, it is set to the highest score.
-func (z *ZSet) limitScores(item *zskiplist, min, max float64) (float64, float64) {
-	minScore := item.head.level[0].forward.score
-	if min < minScore {
-		min = minScore
+// configBounds creates the bounds of a score range from its scores and the exclusion flags of an optional config.
+func configBounds(min, max float64, config *ZRangeConfig) (ScoreBound, ScoreBound) {
+	minBound, maxBound := ScoreBound{Value: min}, ScoreBound{Value: max}
+	if config != nil {
+		minBound.Exclusive, maxBound.Exclusive = config.ExcludeStart, config.ExcludeEnd
 	}
 
-	maxScore := item.tail.score
-	if max > maxScore {
-		max = maxScore
+	return minBound, maxBound
+}
+
+// boundsRange creates a score range from its lower and upper bounds.
+func boundsRange(min, max ScoreBound) scoreRange {
+	return scoreRange{min: min.Value, max: max.Value, minex: min.Exclusive, maxex: max.Exclusive}
+}
+
+// isEmpty reports whether no score can fall within the range.
+func (r scoreRange) isEmpty() bool {
+	return r.min > r.max || (r.min == r.max && (r.minex || r.maxex))
+}
+
+// gteMin reports whether the score is greater than or equal to the lower bound of the range.
+func (r scoreRange) gteMin(score float64) bool {
+	if r.minex {
+		return score > r.min
 	}
+	return score >= r.min
+}
 
-	return min, max
+// lteMax reports whether the score is less than or equal to the upper bound of the range.
+func (r scoreRange) lteMax(score float64) bool {
+	if r.maxex {
+		return score < r.max
+	}
+	return score <= r.max
 }
 
-// collectElementsInRange collects all elements with scores between min and max in the sorted set.
-func (z *ZSet) collectElementsInRange(item *zskiplist, min, max float64) []interface{} {
-	var result []interface{}
-	currentNode := item.head
-	for level := item.level - 1; level >= 0; level-- {
-		for currentNode.level[level].forward != nil && currentNode.level[level].forward.score < min {
+// firstInRange returns the first node within the score range, or nil if there is none.
+func (zsl *zskiplist[V]) firstInRange(r scoreRange) *zslNode[V] {
+	if r.isEmpty() {
+		return nil
+	}
+
+	currentNode := zsl.head
+	for level := zsl.level - 1; level >= 0; level-- {
+		for currentNode.level[level].forward != nil && !r.gteMin(currentNode.level[level].forward.score) {
 			currentNode = currentNode.level[level].forward
 		}
 	}
 
 	currentNode = currentNode.level[0].forward
-	for currentNode != nil && currentNode.score <= max {
-		result = append(result, currentNode.member, currentNode.score)
-		currentNode = currentNode.level[0].forward
+	if currentNode == nil || !r.lteMax(currentNode.score) {
+		return nil
 	}
 
-	return result
+	return currentNode
 }
 
-// collectElementsInReverseRange collects all elements with scores between max and min in the sorted set, in reverse order.
-func (z *ZSet) collectElementsInReverseRange(item *zskiplist, max, min float64) []interface{} {
-	var result []interface{}
-	currentNode := item.head
-	for level := item.level - 1; level >= 0; level-- {
-		for currentNode.level[level].forward != nil && currentNode.level[level].forward.score <= max {
+// lastInRange returns the last node within the score range, or nil if there is none.
+func (zsl *zskiplist[V]) lastInRange(r scoreRange) *zslNode[V] {
+	if r.isEmpty() {
+		return nil
+	}
+
+	currentNode := zsl.head
+	for level := zsl.level - 1; level >= 0; level-- {
+		for currentNode.level[level].forward != nil && r.lteMax(currentNode.level[level].forward.score) {
 			currentNode = currentNode.level[level].forward
 		}
 	}
 
-	for currentNode != nil && currentNode.score >= min {
-		result = append(result, currentNode.member, currentNode.score)
-		currentNode = currentNode.backwards
+	if currentNode == zsl.head || !r.gteMin(currentNode.score) {
+		return nil
 	}
 
-	return result
+	return currentNode
+}
+
+// deleteRangeByScore removes all nodes within the score range from the skip list and passes their members
+// to forget. It returns the number of removed nodes.
+func (zsl *zskiplist[V]) deleteRangeByScore(r scoreRange, forget func(member string)) int {
+	if r.isEmpty() {
+		return 0
+	}
+
+	var updates [SkipListMaxLvl]*zslNode[V]
+	currentNode := zsl.head
+
+	for level := zsl.level - 1; level >= 0; level-- {
+		for currentNode.level[level].forward != nil && !r.gteMin(currentNode.level[level].forward.score) {
+			currentNode = currentNode.level[level].forward
+		}
+		updates[level] = currentNode
+	}
+
+	return zsl.deleteWhile(updates[:], func(n *zslNode[V]) bool { return r.lteMax(n.score) }, forget)
+}
+
+// deleteRangeByRank removes the nodes with 1-based ranks between start and end (inclusive) from the
+// skip list and passes their members to forget. It returns the number of removed nodes.
+func (zsl *zskiplist[V]) deleteRangeByRank(start, end uint64, forget func(member string)) int {
+	var updates [SkipListMaxLvl]*zslNode[V]
+	var traversed uint64
+	currentNode := zsl.head
+
+	for level := zsl.level - 1; level >= 0; level-- {
+		for currentNode.level[level].forward != nil && traversed+currentNode.level[level].span < start {
+			traversed += currentNode.level[level].span
+			currentNode = currentNode.level[level].forward
+		}
+		updates[level] = currentNode
+	}
+
+	return zsl.deleteWhile(updates[:], func(*zslNode[V]) bool {
+		traversed++
+		return traversed <= end
+	}, forget)
+}
+
+// parseLexRange parses the min and max bounds of a lexicographic range.
+func parseLexRange(min, max string) (lexRange, error) {
+	minBound, err := ParseLexBound(min)
+	if err != nil {
+		return lexRange{}, err
+	}
+
+	maxBound, err := ParseLexBound(max)
+	if err != nil {
+		return lexRange{}, err
+	}
+
+	return lexRange{min: minBound, max: maxBound}, nil
+}
+
+// compareLexBounds compares two bounds, with "-" sorting before and "+" after every member.
+func compareLexBounds(a, b LexBound) int {
+	if a.Inf != 0 || b.Inf != 0 {
+		return a.Inf - b.Inf
+	}
+
+	return strings.Compare(a.Value, b.Value)
+}
+
+// isEmpty reports whether no member can fall within the range.
+func (r lexRange) isEmpty() bool {
+	cmp := compareLexBounds(r.min, r.max)
+	return cmp > 0 || (cmp == 0 && (r.min.Exclusive || r.max.Exclusive))
+}
+
+// gteMin reports whether the member is greater than or equal to the lower bound of the range.
+func (r lexRange) gteMin(member string) bool {
+	if r.min.Inf != 0 {
+		return r.min.Inf < 0
+	}
+
+	if r.min.Exclusive {
+		return member > r.min.Value
+	}
+	return member >= r.min.Value
+}
+
+// lteMax reports whether the member is less than or equal to the upper bound of the range.
+func (r lexRange) lteMax(member string) bool {
+	if r.max.Inf != 0 {
+		return r.max.Inf > 0
+	}
+
+	if r.max.Exclusive {
+		return member < r.max.Value
+	}
+	return member <= r.max.Value
+}
+
+// isInLexRange reports whether at least one node of the skip list may fall within the range.
+func (zsl *zskiplist[V]) isInLexRange(r lexRange) bool {
+	if r.isEmpty() || zsl.length == 0 {
+		return false
+	}
+
+	return r.gteMin(zsl.tail.member) && r.lteMax(zsl.head.level[0].forward.member)
+}
+
+// firstInLexRange returns the first node within the lexicographic range, or nil if there is none.
+func (zsl *zskiplist[V]) firstInLexRange(r lexRange) *zslNode[V] {
+	if !zsl.isInLexRange(r) {
+		return nil
+	}
+
+	currentNode := zsl.head
+	for level := zsl.level - 1; level >= 0; level-- {
+		for currentNode.level[level].forward != nil && !r.gteMin(currentNode.level[level].forward.member) {
+			currentNode = currentNode.level[level].forward
+		}
+	}
+
+	currentNode = currentNode.level[0].forward
+	if currentNode == nil || !r.lteMax(currentNode.member) {
+		return nil
+	}
+
+	return currentNode
+}
+
+// lastInLexRange returns the last node within the lexicographic range, or nil if there is none.
+func (zsl *zskiplist[V]) lastInLexRange(r lexRange) *zslNode[V] {
+	if !zsl.isInLexRange(r) {
+		return nil
+	}
+
+	currentNode := zsl.head
+	for level := zsl.level - 1; level >= 0; level-- {
+		for currentNode.level[level].forward != nil && r.lteMax(currentNode.level[level].forward.member) {
+			currentNode = currentNode.level[level].forward
+		}
+	}
+
+	if currentNode == zsl.head || !r.gteMin(currentNode.member) {
+		return nil
+	}
+
+	return currentNode
+}
+
+// deleteRangeByLex removes all nodes within the lexicographic range from the skip list and passes their
+// members to forget. It returns the number of removed nodes.
+func (zsl *zskiplist[V]) deleteRangeByLex(r lexRange, forget func(member string)) int {
+	if r.isEmpty() {
+		return 0
+	}
+
+	var updates [SkipListMaxLvl]*zslNode[V]
+	currentNode := zsl.head
+
+	for level := zsl.level - 1; level >= 0; level-- {
+		for currentNode.level[level].forward != nil && !r.gteMin(currentNode.level[level].forward.member) {
+			currentNode = currentNode.level[level].forward
+		}
+		updates[level] = currentNode
+	}
+
+	return zsl.deleteWhile(updates[:], func(n *zslNode[V]) bool { return r.lteMax(n.member) }, forget)
+}
+
+// deleteWhile removes consecutive nodes, starting with the one following updates[0], for as long as
+// inRange holds, and passes their members to forget. The updates must hold the predecessors of the first
+// node at every level. It returns the number of removed nodes.
+func (zsl *zskiplist[V]) deleteWhile(updates []*zslNode[V], inRange func(*zslNode[V]) bool, forget func(member string)) int {
+	removed := 0
+	currentNode := updates[0].level[0].forward
+
+	for currentNode != nil && inRange(currentNode) {
+		next := currentNode.level[0].forward
+		zsl.deleteNode(currentNode, updates)
+		forget(currentNode.member)
+		removed++
+		currentNode = next
+	}
+
+	return removed
 }
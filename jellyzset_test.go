@@ -1,8 +1,21 @@
 package jellyzset
 
 import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"iter"
+	"math"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestZSet_FindRange(t *testing.T) {
@@ -133,6 +146,362 @@ func TestZSet_ZAdd(t *testing.T) {
 		assertBoolEqual(t, true, ok, "Updated Member Value Existence Check")
 
 	})
+
+	t.Run("NaN Score", func(t *testing.T) {
+		// Test that a NaN score is rejected with ErrNotANumber, leaving the sorted set unchanged.
+		key := "nan_set"
+		zset.ZAdd(key, 1.0, "member1", "value1")
+
+		if err := zset.ZAddChecked(key, math.NaN(), "member2", nil); err != ErrNotANumber {
+			t.Errorf("ZAddChecked: expected ErrNotANumber, got %v", err)
+		}
+		if err := zset.ZAddWithTTLChecked(key, math.NaN(), "member1", nil, time.Minute); err != ErrNotANumber {
+			t.Errorf("ZAddWithTTLChecked: expected ErrNotANumber, got %v", err)
+		}
+		assertCountEqual(t, 0, zset.ZAdd(key, math.NaN(), "member3", nil), "ZAdd")
+		assertCountEqual(t, 0, zset.ZAddWithTTL(key, math.NaN(), "member4", nil, time.Minute), "ZAddWithTTL")
+
+		assertCountEqual(t, 1, zset.ZCard(key), "ZCard")
+		_, score := zset.ZScore(key, "member1")
+		assertFloatEqual(t, 1.0, score, "Score of Member1")
+		assertInt64Equal(t, int64(TTLNoExpiry), int64(zset.ZMemberTTL(key, "member1")), "TTL of Member1")
+		assertSkipListValid(t, zset.records[key])
+	})
+}
+
+func TestZSet_ZAddWithOptions(t *testing.T) {
+	t.Run("Invalid Flag Combinations", func(t *testing.T) {
+		// Test that the flag combinations rejected by Redis are rejected before any change.
+		zset := New()
+		member := ZMember{Score: 1.0, Member: "member1"}
+
+		cases := []struct {
+			opts     ZAddOptions
+			expected error
+		}{
+			{ZAddOptions{NX: true, XX: true}, ErrXXAndNX},
+			{ZAddOptions{GT: true, LT: true}, ErrGTLTAndNX},
+			{ZAddOptions{GT: true, NX: true}, ErrGTLTAndNX},
+			{ZAddOptions{LT: true, NX: true}, ErrGTLTAndNX},
+		}
+
+		for _, c := range cases {
+			if _, err := zset.ZAddWithOptions("sorted_set", c.opts, member); err != c.expected {
+				t.Errorf("%+v: Expected %v, got %v", c.opts, c.expected, err)
+			}
+		}
+
+		_, err := zset.ZAddWithOptions("sorted_set", ZAddOptions{INCR: true}, member, ZMember{Score: 2.0, Member: "member2"})
+		if err != ErrIncrMultiplePairs {
+			t.Errorf("Expected %v, got %v", ErrIncrMultiplePairs, err)
+		}
+
+		assertBoolEqual(t, false, zset.ZKeyExists("sorted_set"), "Invalid Flag Combinations - Key Not Created")
+	})
+
+	t.Run("NX Only Adds New Members", func(t *testing.T) {
+		// Test that NX adds missing members and leaves existing ones untouched.
+		zset := New()
+		key := "sorted_set"
+		zset.ZAdd(key, 1.0, "member1", "value1")
+
+		count, err := zset.ZAddWithOptions(key, ZAddOptions{NX: true},
+			ZMember{Score: 5.0, Member: "member1", Value: "updated"},
+			ZMember{Score: 2.0, Member: "member2", Value: "value2"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		assertCountEqual(t, 1, count, "NX Only Adds New Members")
+		_, score := zset.ZScore(key, "member1")
+		assertFloatEqual(t, 1.0, score, "NX Only Adds New Members - Existing Score Check")
+		if value := zset.records[key].records["member1"].value; value != "value1" {
+			t.Errorf("Expected value %v, got %v", "value1", value)
+		}
+	})
+
+	t.Run("XX Only Updates Existing Members", func(t *testing.T) {
+		// Test that XX updates existing members and never adds new ones.
+		zset := New()
+		key := "sorted_set"
+		zset.ZAdd(key, 1.0, "member1", "value1")
+
+		count, err := zset.ZAddWithOptions(key, ZAddOptions{XX: true, CH: true},
+			ZMember{Score: 5.0, Member: "member1"},
+			ZMember{Score: 2.0, Member: "member2"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		assertCountEqual(t, 1, count, "XX Only Updates Existing Members")
+		assertCountEqual(t, 1, zset.ZCard(key), "XX Only Updates Existing Members - Cardinality Check")
+		_, score := zset.ZScore(key, "member1")
+		assertFloatEqual(t, 5.0, score, "XX Only Updates Existing Members - Score Check")
+
+		count, _ = zset.ZAddWithOptions("missing_key", ZAddOptions{XX: true}, ZMember{Score: 1.0, Member: "member1"})
+		assertCountEqual(t, 0, count, "XX On Missing Key")
+		assertBoolEqual(t, false, zset.ZKeyExists("missing_key"), "XX On Missing Key - Key Not Created")
+	})
+
+	t.Run("GT And LT", func(t *testing.T) {
+		// Test that GT and LT only move scores in one direction but still add new members.
+		zset := New()
+		key := "sorted_set"
+		zset.ZAdd(key, 3.0, "member1", nil)
+		zset.ZAdd(key, 3.0, "member2", nil)
+
+		count, _ := zset.ZAddWithOptions(key, ZAddOptions{GT: true, CH: true},
+			ZMember{Score: 1.0, Member: "member1"},
+			ZMember{Score: 4.0, Member: "member2"},
+			ZMember{Score: 2.0, Member: "member3"})
+		assertCountEqual(t, 2, count, "GT With CH")
+
+		count, _ = zset.ZAddWithOptions(key, ZAddOptions{LT: true, CH: true},
+			ZMember{Score: 1.0, Member: "member1"},
+			ZMember{Score: 9.0, Member: "member2"})
+		assertCountEqual(t, 1, count, "LT With CH")
+
+		assertSliceEqual(t, []interface{}{"member1", 1.0, "member3", 2.0, "member2", 4.0},
+			zset.ZRangeWithScore(key, 0, 2), "GT And LT - Order Check")
+	})
+
+	t.Run("CH Counts Changed Members", func(t *testing.T) {
+		// Test that without CH only added members are counted, and that unchanged scores are not counted.
+		zset := New()
+		key := "sorted_set"
+		zset.ZAdd(key, 1.0, "member1", nil)
+
+		count, _ := zset.ZAddWithOptions(key, ZAddOptions{},
+			ZMember{Score: 2.0, Member: "member1"},
+			ZMember{Score: 3.0, Member: "member2"})
+		assertCountEqual(t, 1, count, "Without CH")
+
+		count, _ = zset.ZAddWithOptions(key, ZAddOptions{CH: true},
+			ZMember{Score: 2.0, Member: "member1"},
+			ZMember{Score: 4.0, Member: "member2"})
+		assertCountEqual(t, 1, count, "With CH")
+	})
+
+	t.Run("INCR", func(t *testing.T) {
+		// Test incrementing through ZAddIncr, including flags that abort the increment.
+		zset := New()
+		key := "sorted_set"
+		zset.ZAdd(key, 3.0, "member1", "value1")
+
+		score, ok, err := zset.ZAddIncr(key, ZAddOptions{}, 2.0, "member1", "ignored")
+		if err != nil || !ok {
+			t.Fatalf("Unexpected result: %v, %v", ok, err)
+		}
+		assertFloatEqual(t, 5.0, score, "INCR Existing Member")
+		if value := zset.records[key].records["member1"].value; value != "value1" {
+			t.Errorf("Expected value %v, got %v", "value1", value)
+		}
+
+		_, ok, _ = zset.ZAddIncr(key, ZAddOptions{GT: true}, -1.0, "member1", nil)
+		assertBoolEqual(t, false, ok, "INCR With GT Aborted")
+
+		_, ok, _ = zset.ZAddIncr(key, ZAddOptions{NX: true}, 1.0, "member1", nil)
+		assertBoolEqual(t, false, ok, "INCR With NX Aborted")
+
+		count, _ := zset.ZAddWithOptions(key, ZAddOptions{INCR: true}, ZMember{Score: 1.0, Member: "member2"})
+		assertCountEqual(t, 1, count, "INCR Through ZAddWithOptions")
+		_, score = zset.ZScore(key, "member2")
+		assertFloatEqual(t, 1.0, score, "INCR Through ZAddWithOptions - Score Check")
+	})
+
+	t.Run("NaN Scores", func(t *testing.T) {
+		// Test that NaN scores and NaN increments are rejected.
+		zset := New()
+		key := "sorted_set"
+		zset.ZAdd(key, math.Inf(1), "member1", nil)
+
+		if _, err := zset.ZAddWithOptions(key, ZAddOptions{}, ZMember{Score: math.NaN(), Member: "member2"}); err != ErrNotANumber {
+			t.Errorf("Expected %v, got %v", ErrNotANumber, err)
+		}
+
+		if _, _, err := zset.ZAddIncr(key, ZAddOptions{}, math.Inf(-1), "member1", nil); err != ErrNotANumber {
+			t.Errorf("Expected %v, got %v", ErrNotANumber, err)
+		}
+	})
+}
+
+func TestZSet_ZAddMany(t *testing.T) {
+	t.Run("Bulk Add To New Key", func(t *testing.T) {
+		// Test building a sorted set from unsorted members in one call.
+		zset := New()
+		key := "sorted_set"
+
+		added, err := zset.ZAddMany(key,
+			ZMember{Score: 3.0, Member: "member3", Value: "value3"},
+			ZMember{Score: 1.0, Member: "member1", Value: "value1"},
+			ZMember{Score: 2.0, Member: "member2", Value: "value2"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		assertCountEqual(t, 3, added, "Bulk Add To New Key")
+		assertSliceEqual(t, []interface{}{"member1", 1.0, "member2", 2.0, "member3", 3.0},
+			zset.ZRangeWithScore(key, 0, 2), "Bulk Add To New Key - Order Check")
+		assertIntEqual(t, 2, zset.ZRank(key, "member3"), "Bulk Add To New Key - Rank Check")
+		assertSkipListValid(t, zset.records[key])
+	})
+
+	t.Run("Bulk Add To Existing Key", func(t *testing.T) {
+		// Test merging members into a populated sorted set, updating some of them.
+		zset := New()
+		key := "sorted_set"
+		zset.ZAdd(key, 1.0, "member1", "value1")
+		zset.ZAdd(key, 5.0, "member5", "value5")
+
+		added, err := zset.ZAddMany(key,
+			ZMember{Score: 4.0, Member: "member4"},
+			ZMember{Score: 0.5, Member: "member1", Value: "updated1"},
+			ZMember{Score: 5.0, Member: "member5", Value: "updated5"},
+			ZMember{Score: 2.0, Member: "member2"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		assertCountEqual(t, 2, added, "Bulk Add To Existing Key")
+		assertSliceEqual(t, []interface{}{"member1", "member2", "member4", "member5"},
+			zset.ZRange(key, 0, 3), "Bulk Add To Existing Key - Order Check")
+		if value := zset.records[key].records["member1"].value; value != "updated1" {
+			t.Errorf("Expected value %v, got %v", "updated1", value)
+		}
+		if value := zset.records[key].records["member5"].value; value != "updated5" {
+			t.Errorf("Expected value %v, got %v", "updated5", value)
+		}
+		assertSkipListValid(t, zset.records[key])
+	})
+
+	t.Run("Bulk Add Duplicate Members", func(t *testing.T) {
+		// Test that the last occurrence of a duplicated member wins.
+		zset := New()
+		key := "sorted_set"
+
+		added, _ := zset.ZAddMany(key,
+			ZMember{Score: 1.0, Member: "member1"},
+			ZMember{Score: 7.0, Member: "member1"})
+
+		assertCountEqual(t, 1, added, "Bulk Add Duplicate Members")
+		_, score := zset.ZScore(key, "member1")
+		assertFloatEqual(t, 7.0, score, "Bulk Add Duplicate Members - Score Check")
+		assertSkipListValid(t, zset.records[key])
+	})
+
+	t.Run("Bulk Add With NaN", func(t *testing.T) {
+		// Test that a NaN score rejects the whole batch.
+		zset := New()
+
+		_, err := zset.ZAddMany("sorted_set", ZMember{Score: 1.0, Member: "member1"}, ZMember{Score: math.NaN(), Member: "member2"})
+		if err != ErrNotANumber {
+			t.Errorf("Expected %v, got %v", ErrNotANumber, err)
+		}
+		assertBoolEqual(t, false, zset.ZKeyExists("sorted_set"), "Bulk Add With NaN - Key Not Created")
+	})
+
+	t.Run("Bulk Add Matches Single Adds", func(t *testing.T) {
+		// Test that a large bulk load produces the same order and ranks as individual ZAdd calls.
+		bulk, single := New(), New()
+		key := "sorted_set"
+
+		members := make([]ZMember, 0, 2000)
+		for i := 0; i < 2000; i++ {
+			members = append(members, ZMember{Score: float64((i * 7919) % 500), Member: fmt.Sprintf("member%d", i)})
+		}
+
+		bulk.ZAddMany(key, members[:1000]...)
+		bulk.ZAddMany(key, members[1000:]...)
+		for _, m := range members {
+			single.ZAdd(key, m.Score, m.Member, m.Value)
+		}
+
+		assertSkipListValid(t, bulk.records[key])
+		assertSliceEqual(t, single.ZRangeWithScore(key, 0, 1999), bulk.ZRangeWithScore(key, 0, 1999), "Bulk Add Matches Single Adds")
+		for _, m := range members[:50] {
+			assertIntEqual(t, single.ZRank(key, m.Member), bulk.ZRank(key, m.Member), "Bulk Add Matches Single Adds - Rank Check")
+		}
+	})
+}
+
+func TestZSet_ZIncrBy(t *testing.T) {
+	zset := New()
+
+	t.Run("Increment Non-Existent Key", func(t *testing.T) {
+		// Test incrementing a member of a key that does not exist yet.
+		score, err := zset.ZIncrBy("sorted_set", 2.5, "member1")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		assertFloatEqual(t, 2.5, score, "Increment Non-Existent Key")
+
+		ok, stored := zset.ZScore("sorted_set", "member1")
+		assertBoolEqual(t, true, ok, "Increment Non-Existent Key - Member Existence Check")
+		assertFloatEqual(t, 2.5, stored, "Increment Non-Existent Key - Score Check")
+	})
+
+	t.Run("Increment Existing Member Keeps Value", func(t *testing.T) {
+		// Test that incrementing an existing member preserves its value.
+		key := "value_set"
+		zset.ZAdd(key, 1.0, "member1", "value1")
+
+		score, err := zset.ZIncrBy(key, 4.0, "member1")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		assertFloatEqual(t, 5.0, score, "Increment Existing Member")
+
+		if value := zset.records[key].records["member1"].value; value != "value1" {
+			t.Errorf("Expected value %v, got %v", "value1", value)
+		}
+	})
+
+	t.Run("Increment In Place", func(t *testing.T) {
+		// Test that a node which keeps its position is not relinked.
+		key := "in_place_set"
+		zset.ZAdd(key, 1.0, "member1", nil)
+		zset.ZAdd(key, 2.0, "member2", nil)
+		zset.ZAdd(key, 3.0, "member3", nil)
+		node := zset.records[key].records["member2"]
+
+		zset.ZIncrBy(key, 0.5, "member2")
+
+		if zset.records[key].records["member2"] != node {
+			t.Errorf("Expected member2 to be updated in place")
+		}
+		assertSliceEqual(t, []interface{}{"member1", 1.0, "member2", 2.5, "member3", 3.0},
+			zset.ZRangeWithScore(key, 0, 2), "Increment In Place - Order Check")
+	})
+
+	t.Run("Increment Reorders Members", func(t *testing.T) {
+		// Test that incrementing past a neighbour moves the member.
+		key := "reorder_set"
+		zset.ZAdd(key, 1.0, "member1", "value1")
+		zset.ZAdd(key, 2.0, "member2", "value2")
+		zset.ZAdd(key, 3.0, "member3", "value3")
+
+		zset.ZIncrBy(key, 5.0, "member1")
+
+		assertSliceEqual(t, []interface{}{"member2", "member3", "member1"}, zset.ZRange(key, 0, -1), "Increment Reorders Members")
+		assertIntEqual(t, 2, zset.ZRank(key, "member1"), "Increment Reorders Members - Rank Check")
+		if value := zset.records[key].records["member1"].value; value != "value1" {
+			t.Errorf("Expected value %v, got %v", "value1", value)
+		}
+	})
+
+	t.Run("Increment Resulting In NaN", func(t *testing.T) {
+		// Test that a NaN result is rejected and the score is left unchanged.
+		key := "nan_set"
+		zset.ZAdd(key, math.Inf(1), "member1", nil)
+
+		_, err := zset.ZIncrBy(key, math.Inf(-1), "member1")
+		if err != ErrNotANumber {
+			t.Errorf("Expected %v, got %v", ErrNotANumber, err)
+		}
+
+		_, score := zset.ZScore(key, "member1")
+		assertFloatEqual(t, math.Inf(1), score, "Increment Resulting In NaN - Score Check")
+	})
 }
 
 func TestZSet_ZScore(t *testing.T) {
@@ -187,6 +556,52 @@ func TestZSet_ZCard(t *testing.T) {
 	})
 }
 
+func TestZSet_ZCount(t *testing.T) {
+	zset := New()
+	key := "sorted_set"
+	zset.ZAdd(key, 1.0, "member1", nil)
+	zset.ZAdd(key, 2.0, "member2", nil)
+	zset.ZAdd(key, 2.0, "member3", nil)
+	zset.ZAdd(key, 3.0, "member4", nil)
+	zset.ZAdd(key, 5.0, "member5", nil)
+
+	t.Run("Count Non-Existent Key", func(t *testing.T) {
+		// Test counting members of a key that does not exist.
+		assertCountEqual(t, 0, zset.ZCount("nonexistent_key", 0, 10, nil), "Count Non-Existent Key")
+	})
+
+	t.Run("Count Inclusive Bounds", func(t *testing.T) {
+		// Test counting with inclusive bounds, including duplicated scores on a bound.
+		assertCountEqual(t, 5, zset.ZCount(key, math.Inf(-1), math.Inf(1), nil), "Count Whole Set")
+		assertCountEqual(t, 3, zset.ZCount(key, 2.0, 3.0, nil), "Count [2, 3]")
+		assertCountEqual(t, 2, zset.ZCount(key, 2.0, 2.0, nil), "Count [2, 2]")
+		assertCountEqual(t, 0, zset.ZCount(key, 3.5, 4.5, nil), "Count Gap")
+		assertCountEqual(t, 0, zset.ZCount(key, 3.0, 2.0, nil), "Count Min > Max")
+	})
+
+	t.Run("Count Exclusive Bounds", func(t *testing.T) {
+		// Test counting with exclusive bounds.
+		assertCountEqual(t, 1, zset.ZCount(key, 2.0, 3.0, &ZRangeConfig{ExcludeStart: true}), "Count (2, 3]")
+		assertCountEqual(t, 3, zset.ZCount(key, 1.0, 3.0, &ZRangeConfig{ExcludeEnd: true}), "Count [1, 3)")
+		assertCountEqual(t, 3, zset.ZCount(key, 1.0, 5.0, &ZRangeConfig{ExcludeStart: true, ExcludeEnd: true}), "Count (1, 5)")
+		assertCountEqual(t, 0, zset.ZCount(key, 2.0, 2.0, &ZRangeConfig{ExcludeStart: true}), "Count (2, 2]")
+	})
+}
+
+func TestZSet_ZRankOfScore(t *testing.T) {
+	zset := New()
+	key := "sorted_set"
+	for i := 1; i <= 100; i++ {
+		zset.ZAdd(key, float64(i), fmt.Sprintf("member%d", i), nil)
+	}
+
+	assertCountEqual(t, 0, zset.ZRankOfScore("nonexistent_key", 10), "RankOfScore Non-Existent Key")
+	assertCountEqual(t, 0, zset.ZRankOfScore(key, 1), "RankOfScore Lowest Score")
+	assertCountEqual(t, 49, zset.ZRankOfScore(key, 50), "RankOfScore Existing Score")
+	assertCountEqual(t, 50, zset.ZRankOfScore(key, 50.5), "RankOfScore Between Scores")
+	assertCountEqual(t, 100, zset.ZRankOfScore(key, math.Inf(1)), "RankOfScore Above All Scores")
+}
+
 func TestZSet_ZRank(t *testing.T) {
 	zset := New()
 
@@ -244,6 +659,24 @@ func TestZSet_ZRank(t *testing.T) {
 		assertIntEqual(t, 2, rank3, "Rank of Member3")
 
 	})
+
+	t.Run("Rank With Score", func(t *testing.T) {
+		// Test getting the rank and reverse rank of a member together with its score.
+		key := "sorted_set"
+		rank, score := zset.ZRankWithScore(key, "member1")
+		assertIntEqual(t, 1, rank, "Rank of Member1")
+		assertFloatEqual(t, 5.0, score, "Score of Member1")
+
+		revRank, score := zset.ZRevRankWithScore(key, "member3")
+		assertIntEqual(t, 0, revRank, "Reverse Rank of Member3")
+		assertFloatEqual(t, 7.0, score, "Score of Member3")
+
+		rank, score = zset.ZRankWithScore(key, "nonexistent_member")
+		assertIntEqual(t, -1, rank, "Rank of Non-Existent Member")
+		assertFloatEqual(t, 0, score, "Score of Non-Existent Member")
+		revRank, _ = zset.ZRevRankWithScore("nonexistent_key", "member1")
+		assertIntEqual(t, -1, revRank, "Reverse Rank of Non-Existent Key")
+	})
 }
 
 func TestZSet_ZRevRank(t *testing.T) {
@@ -406,6 +839,294 @@ func TestZSet_ZRem(t *testing.T) {
 		assertBoolEqual(t, true, exists1, "Verify Retention of Member1")
 		assertBoolEqual(t, true, exists2, "Verify Retention of Member2")
 	})
+
+	t.Run("Remove Many Members", func(t *testing.T) {
+		// Test removing several members at once, counting each removed member once and ignoring missing ones.
+		zset := New()
+		sub := zset.Subscribe(SubscribeOptions{})
+		defer sub.Close()
+
+		key := "sorted_set"
+		zset.ZAdd(key, 1.0, "member1", "value1")
+		zset.ZAdd(key, 2.0, "member2", "value2")
+		zset.ZAdd(key, 3.0, "member3", "value3")
+		receiveEvents(sub)
+
+		removed := zset.ZRemMany(key, "member1", "member3", "member1", "nonexistent_member")
+		assertCountEqual(t, 2, removed, "Removed Members")
+		assertCountEqual(t, 1, zset.ZCard(key), "Remaining Members")
+		assertCountEqual(t, 2, len(receiveEvents(sub)), "Removal Events")
+		assertCountEqual(t, 0, zset.ZRemMany("nonexistent_key", "member1"), "Remove From Non-Existent Key")
+	})
+}
+
+func TestZSet_ZMove(t *testing.T) {
+	score := func(f float64) *float64 { return &f }
+
+	t.Run("Move Keeps Score And Value", func(t *testing.T) {
+		// Test that a moved member leaves src and is added to dst with its score and value.
+		zset := New()
+		zset.ZAdd("pending", 1.0, "job1", "payload1")
+		zset.ZAdd("pending", 2.0, "job2", "payload2")
+
+		moved, err := zset.ZMove("pending", "running", "job1", nil)
+		if err != nil {
+			t.Fatalf("ZMove: %v", err)
+		}
+		assertBoolEqual(t, true, moved, "Moved")
+		ok, _ := zset.ZScore("pending", "job1")
+		assertBoolEqual(t, false, ok, "Removed From Source")
+		ok, got := zset.ZScore("running", "job1")
+		assertBoolEqual(t, true, ok, "Added To Destination")
+		assertFloatEqual(t, 1.0, got, "Score Kept")
+		if value := zset.records["running"].records["job1"].value; value != "payload1" {
+			t.Errorf("Value Kept: expected %v, got %v", "payload1", value)
+		}
+		assertCountEqual(t, 1, zset.ZCard("pending"), "Source Card")
+	})
+
+	t.Run("Move With New Score", func(t *testing.T) {
+		// Test that a moved member is rescored when a new score is given.
+		zset := New()
+		zset.ZAdd("pending", 1.0, "job1", "payload1")
+		zset.ZAdd("running", 10.0, "job0", nil)
+
+		moved, _ := zset.ZMove("pending", "running", "job1", score(5.0))
+		assertBoolEqual(t, true, moved, "Moved")
+		assertSliceEqual(t, []interface{}{"job1", "job0"}, zset.ZRange("running", 0, -1), "Ordered By New Score")
+		_, got := zset.ZScore("running", "job1")
+		assertFloatEqual(t, 5.0, got, "New Score")
+		assertSkipListValid(t, zset.records["running"])
+	})
+
+	t.Run("Missing Member", func(t *testing.T) {
+		// Test that moving a missing member or from a missing key reports false and creates nothing.
+		zset := New()
+		zset.ZAdd("pending", 1.0, "job1", nil)
+
+		moved, err := zset.ZMove("pending", "running", "job2", nil)
+		assertBoolEqual(t, false, moved, "Missing Member")
+		assertBoolEqual(t, true, err == nil, "Missing Member Error")
+		moved, _ = zset.ZMove("nonexistent", "running", "job1", nil)
+		assertBoolEqual(t, false, moved, "Missing Key")
+		assertBoolEqual(t, false, zset.ZKeyExists("running"), "Destination Not Created")
+	})
+
+	t.Run("Replace Member In Destination", func(t *testing.T) {
+		// Test that a member with the same name in dst is replaced by the moved one, deadline included.
+		clock := newFakeClock()
+		zset := New()
+		zset.SetClock(clock)
+		zset.ZAdd("pending", 1.0, "job1", "new")
+		zset.ZAddWithTTL("running", 7.0, "job1", "old", time.Minute)
+
+		moved, _ := zset.ZMove("pending", "running", "job1", nil)
+		assertBoolEqual(t, true, moved, "Moved")
+		assertCountEqual(t, 1, zset.ZCard("running"), "Destination Card")
+		_, got := zset.ZScore("running", "job1")
+		assertFloatEqual(t, 1.0, got, "Replaced Score")
+		if value := zset.records["running"].records["job1"].value; value != "new" {
+			t.Errorf("Replaced Value: expected %v, got %v", "new", value)
+		}
+		if ttl := zset.ZMemberTTL("running", "job1"); ttl != TTLNoExpiry {
+			t.Errorf("Replaced Deadline: expected %v, got %v", TTLNoExpiry, ttl)
+		}
+		assertSkipListValid(t, zset.records["running"])
+	})
+
+	t.Run("Deadline Moves With Member", func(t *testing.T) {
+		// Test that the deadline of a moved member follows it to dst.
+		clock := newFakeClock()
+		zset := New()
+		zset.SetClock(clock)
+		zset.ZAddWithTTL("pending", 1.0, "job1", nil, time.Minute)
+
+		zset.ZMove("pending", "running", "job1", nil)
+		if ttl := zset.ZMemberTTL("running", "job1"); ttl != time.Minute {
+			t.Errorf("Member TTL: expected %v, got %v", time.Minute, ttl)
+		}
+
+		clock.Advance(time.Minute)
+		assertCountEqual(t, 0, zset.ZCard("running"), "Expired In Destination")
+	})
+
+	t.Run("Same Key", func(t *testing.T) {
+		// Test that moving a member to its own key only rescores it.
+		zset := New()
+		zset.ZAdd("key", 1.0, "a", "value")
+		zset.ZAdd("key", 2.0, "b", nil)
+
+		moved, _ := zset.ZMove("key", "key", "a", score(3.0))
+		assertBoolEqual(t, true, moved, "Moved")
+		assertSliceEqual(t, []interface{}{"b", "a"}, zset.ZRange("key", 0, -1), "Rescored Last")
+		if value := zset.records["key"].records["a"].value; value != "value" {
+			t.Errorf("Value Kept: expected %v, got %v", "value", value)
+		}
+
+		moved, _ = zset.ZMove("key", "key", "b", nil)
+		assertBoolEqual(t, true, moved, "Moved Without Score")
+		assertCountEqual(t, 2, zset.ZCard("key"), "Card Without Score")
+	})
+
+	t.Run("Not A Number", func(t *testing.T) {
+		// Test that a NaN score is rejected and leaves the member in place.
+		zset := New()
+		zset.ZAdd("pending", 1.0, "job1", nil)
+
+		moved, err := zset.ZMove("pending", "running", "job1", score(math.NaN()))
+		assertBoolEqual(t, false, moved, "Moved")
+		assertBoolEqual(t, true, err == ErrNotANumber, "Error")
+		assertCountEqual(t, 1, zset.ZCard("pending"), "Source Card")
+	})
+
+	t.Run("Atomic", func(t *testing.T) {
+		// Test that concurrent readers always see each member in exactly one of the two keys.
+		zset := New()
+		for i := 0; i < 50; i++ {
+			zset.ZAdd("left", float64(i), fmt.Sprintf("member%02d", i), nil)
+		}
+
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				member := fmt.Sprintf("member%02d", i%50)
+				if moved, _ := zset.ZMove("left", "right", member, nil); !moved {
+					zset.ZMove("right", "left", member, nil)
+				}
+			}
+			close(done)
+		}()
+
+		for {
+			select {
+			case <-done:
+				wg.Wait()
+				return
+			default:
+			}
+			var total int
+			zset.Txn(func(tx *Tx[interface{}]) error {
+				total = tx.ZCard("left") + tx.ZCard("right")
+				return nil
+			})
+			assertCountEqual(t, 50, total, "Members In Both Keys")
+		}
+	})
+
+	t.Run("Append Log", func(t *testing.T) {
+		// Test that a move is replayed from the append-only log.
+		clock := newFakeClock()
+		path := filepath.Join(t.TempDir(), "zset.aof")
+		zset := New()
+		zset.SetClock(clock)
+		if err := zset.OpenAppendLog(path, AppendLogOptions{}); err != nil {
+			t.Fatalf("OpenAppendLog: %v", err)
+		}
+		zset.ZAddWithTTL("pending", 1.0, "job1", "payload1", time.Minute)
+		zset.ZAdd("running", 2.0, "job1", "stale")
+		zset.ZMove("pending", "running", "job1", score(4.0))
+		zset.CloseAppendLog()
+
+		restored := New()
+		restored.SetClock(clock)
+		if err := restored.OpenAppendLog(path, AppendLogOptions{}); err != nil {
+			t.Fatalf("OpenAppendLog: %v", err)
+		}
+		restored.CloseAppendLog()
+		assertSameContents(t, zset, restored)
+		if ttl := restored.ZMemberTTL("running", "job1"); ttl != time.Minute {
+			t.Errorf("Member TTL: expected %v, got %v", time.Minute, ttl)
+		}
+	})
+}
+
+func TestZSet_ZRemRangeByRank(t *testing.T) {
+	newSet := func() *ZSet {
+		zset := New()
+		for i := 1; i <= 10; i++ {
+			zset.ZAdd("sorted_set", float64(i), fmt.Sprintf("member%02d", i), nil)
+		}
+		return zset
+	}
+
+	t.Run("RemRangeByRank Keep Top Members", func(t *testing.T) {
+		// Test trimming a set down to its highest scored members.
+		zset := newSet()
+		removed := zset.ZRemRangeByRank("sorted_set", 0, -4)
+
+		assertCountEqual(t, 7, removed, "RemRangeByRank Keep Top Members")
+		assertSliceEqual(t, []interface{}{"member08", "member09", "member10"}, zset.ZRange("sorted_set", 0, -1), "RemRangeByRank Keep Top Members - Remaining Members")
+		_, exists := zset.records["sorted_set"].records["member01"]
+		assertBoolEqual(t, false, exists, "RemRangeByRank Keep Top Members - Records Check")
+		assertSkipListValid(t, zset.records["sorted_set"])
+	})
+
+	t.Run("RemRangeByRank Middle And Out Of Bounds", func(t *testing.T) {
+		// Test removing a middle range and clamping a stop index past the end.
+		zset := newSet()
+		assertCountEqual(t, 2, zset.ZRemRangeByRank("sorted_set", 3, 4), "RemRangeByRank Middle")
+		assertCountEqual(t, 2, zset.ZRemRangeByRank("sorted_set", 6, 100), "RemRangeByRank Stop Past End")
+		assertCountEqual(t, 0, zset.ZRemRangeByRank("sorted_set", 20, 30), "RemRangeByRank Start Past End")
+		assertCountEqual(t, 0, zset.ZRemRangeByRank("sorted_set", 3, 1), "RemRangeByRank Start > Stop")
+		assertSliceEqual(t, []interface{}{"member01", "member02", "member03", "member06", "member07", "member08"},
+			zset.ZRange("sorted_set", 0, -1), "RemRangeByRank Middle And Out Of Bounds - Remaining Members")
+		assertSkipListValid(t, zset.records["sorted_set"])
+	})
+
+	t.Run("RemRangeByRank Whole Set", func(t *testing.T) {
+		// Test that removing every member removes the key.
+		zset := newSet()
+		assertCountEqual(t, 10, zset.ZRemRangeByRank("sorted_set", 0, -1), "RemRangeByRank Whole Set")
+		assertBoolEqual(t, false, zset.ZKeyExists("sorted_set"), "RemRangeByRank Whole Set - Key Removed")
+		assertCountEqual(t, 0, zset.ZRemRangeByRank("sorted_set", 0, -1), "RemRangeByRank Non-Existent Key")
+	})
+}
+
+func TestZSet_ZRemRangeByScore(t *testing.T) {
+	newSet := func() *ZSet {
+		zset := New()
+		for i := 1; i <= 10; i++ {
+			zset.ZAdd("sorted_set", float64(i), fmt.Sprintf("member%02d", i), nil)
+		}
+		return zset
+	}
+
+	t.Run("RemRangeByScore Inclusive Bounds", func(t *testing.T) {
+		// Test removing scores in an inclusive range.
+		zset := newSet()
+		assertCountEqual(t, 3, zset.ZRemRangeByScore("sorted_set", 2, 4, nil), "RemRangeByScore Inclusive Bounds")
+		assertCountEqual(t, 7, zset.ZCard("sorted_set"), "RemRangeByScore Inclusive Bounds - Cardinality Check")
+		assertSkipListValid(t, zset.records["sorted_set"])
+	})
+
+	t.Run("RemRangeByScore Exclusive Bounds", func(t *testing.T) {
+		// Test removing scores in an exclusive range.
+		zset := newSet()
+		removed := zset.ZRemRangeByScore("sorted_set", 2, 5, &ZRangeConfig{ExcludeStart: true, ExcludeEnd: true})
+		assertCountEqual(t, 2, removed, "RemRangeByScore Exclusive Bounds")
+		assertSliceEqual(t, []interface{}{"member01", "member02", "member05"}, zset.ZRange("sorted_set", 0, 2), "RemRangeByScore Exclusive Bounds - Remaining Members")
+		assertSkipListValid(t, zset.records["sorted_set"])
+	})
+
+	t.Run("RemRangeByScore Expired Entries", func(t *testing.T) {
+		// Test dropping every entry scored below a threshold.
+		zset := newSet()
+		removed := zset.ZRemRangeByScore("sorted_set", math.Inf(-1), 6, &ZRangeConfig{ExcludeEnd: true})
+		assertCountEqual(t, 5, removed, "RemRangeByScore Expired Entries")
+		assertIntEqual(t, 0, zset.ZRank("sorted_set", "member06"), "RemRangeByScore Expired Entries - Rank Check")
+	})
+
+	t.Run("RemRangeByScore Empty Range And Whole Set", func(t *testing.T) {
+		// Test that an empty range removes nothing and that emptying the set removes the key.
+		zset := newSet()
+		assertCountEqual(t, 0, zset.ZRemRangeByScore("sorted_set", 5, 5, &ZRangeConfig{ExcludeStart: true}), "RemRangeByScore Empty Range")
+		assertCountEqual(t, 0, zset.ZRemRangeByScore("sorted_set", 6, 2, nil), "RemRangeByScore Min > Max")
+		assertCountEqual(t, 10, zset.ZRemRangeByScore("sorted_set", math.Inf(-1), math.Inf(1), nil), "RemRangeByScore Whole Set")
+		assertBoolEqual(t, false, zset.ZKeyExists("sorted_set"), "RemRangeByScore Whole Set - Key Removed")
+	})
 }
 
 func TestZSet_ZRange(t *testing.T) {
@@ -672,32 +1393,536 @@ func TestZSet_ZRevScoreRange(t *testing.T) {
 
 }
 
-func TestZSet_ZKeys(t *testing.T) {
+func TestZSet_ZRangeByLex(t *testing.T) {
 	zset := New()
+	key := "lex_set"
+	for _, member := range []string{"a", "b", "c", "d", "e", "f", "g"} {
+		zset.ZAdd(key, 0, member, nil)
+	}
 
-	t.Run("Keys Empty ZSet", func(t *testing.T) {
-		// Test getting keys from an empty ZSet.
-		keys := zset.ZKeys()
-		if len(keys) != 0 {
-			t.Errorf("Expected %v but got %v", 0, keys)
+	t.Run("RangeByLex Bounds", func(t *testing.T) {
+		// Test inclusive, exclusive and infinite bounds.
+		cases := []struct {
+			min, max string
+			expected []interface{}
+		}{
+			{"-", "[c", []interface{}{"a", "b", "c"}},
+			{"-", "(c", []interface{}{"a", "b"}},
+			{"[aaa", "(g", []interface{}{"b", "c", "d", "e", "f"}},
+			{"(e", "+", []interface{}{"f", "g"}},
+			{"[c", "[c", []interface{}{"c"}},
+			{"(c", "[c", []interface{}{}},
+			{"[d", "[b", []interface{}{}},
+			{"+", "-", []interface{}{}},
+		}
+
+		for _, c := range cases {
+			result, err := zset.ZRangeByLex(key, c.min, c.max, 0, -1)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			assertSliceEqual(t, c.expected, result, fmt.Sprintf("RangeByLex %s %s", c.min, c.max))
 		}
 	})
 
-	t.Run("Keys Non-Empty ZSet", func(t *testing.T) {
-		// Test getting keys from a non-empty ZSet.
-		zset.ZAdd("set1", 3.5, "member1", "value1")
-		zset.ZAdd("set2", 2.0, "member2", "value2")
-		keys := zset.ZKeys()
-		expected := []string{"set1", "set2"}
+	t.Run("RangeByLex Limit", func(t *testing.T) {
+		// Test skipping and limiting the returned members.
+		result, _ := zset.ZRangeByLex(key, "-", "+", 2, 3)
+		assertSliceEqual(t, []interface{}{"c", "d", "e"}, result, "RangeByLex Offset And Count")
 
-		if len(expected) != len(keys) {
-			t.Errorf("Expected %v but got %v", expected, keys)
-		}
+		result, _ = zset.ZRangeByLex(key, "[b", "[e", 3, -1)
+		assertSliceEqual(t, []interface{}{"e"}, result, "RangeByLex Offset Within Range")
+
+		result, _ = zset.ZRangeByLex(key, "-", "+", 10, -1)
+		assertSliceEqual(t, []interface{}{}, result, "RangeByLex Offset Past End")
+
+		result, _ = zset.ZRangeByLex(key, "-", "+", -1, -1)
+		assertSliceEqual(t, []interface{}{}, result, "RangeByLex Negative Offset")
 	})
 
-	t.Run("Keys After Clear", func(t *testing.T) {
-		// Test getting keys after clearing the ZSet.
-		zset.ZAdd("set1", 3.5, "member1", "value1")
+	t.Run("RevRangeByLex", func(t *testing.T) {
+		// Test the reverse variant with and without limits.
+		result, _ := zset.ZRevRangeByLex(key, "[c", "-", 0, -1)
+		assertSliceEqual(t, []interface{}{"c", "b", "a"}, result, "RevRangeByLex")
+
+		result, _ = zset.ZRevRangeByLex(key, "+", "(b", 1, 2)
+		assertSliceEqual(t, []interface{}{"f", "e"}, result, "RevRangeByLex Offset And Count")
+
+		result, _ = zset.ZRevRangeByLex(key, "(c", "-", 5, -1)
+		assertSliceEqual(t, []interface{}{}, result, "RevRangeByLex Offset Past End")
+	})
+
+	t.Run("RangeByLex Invalid Bounds", func(t *testing.T) {
+		// Test that bounds without a valid prefix are rejected.
+		if _, err := zset.ZRangeByLex(key, "a", "+", 0, -1); err != ErrInvalidLexRange {
+			t.Errorf("Expected %v, got %v", ErrInvalidLexRange, err)
+		}
+		if _, err := zset.ZRevRangeByLex(key, "+inf", "-", 0, -1); err != ErrInvalidLexRange {
+			t.Errorf("Expected %v, got %v", ErrInvalidLexRange, err)
+		}
+		if _, err := zset.ZLexCount(key, "-", ""); err != ErrInvalidLexRange {
+			t.Errorf("Expected %v, got %v", ErrInvalidLexRange, err)
+		}
+	})
+
+	t.Run("RangeByLex Non-Existent Key", func(t *testing.T) {
+		// Test querying a key that does not exist.
+		result, err := zset.ZRangeByLex("nonexistent_key", "-", "+", 0, -1)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		assertSliceEqual(t, []interface{}{}, result, "RangeByLex Non-Existent Key")
+	})
+}
+
+func TestZSet_ZLexCount(t *testing.T) {
+	zset := New()
+	key := "lex_set"
+	for _, member := range []string{"", "a", "b", "c", "d"} {
+		zset.ZAdd(key, 0, member, nil)
+	}
+
+	cases := []struct {
+		min, max string
+		expected int
+	}{
+		{"-", "+", 5},
+		{"[", "[", 1},
+		{"(", "[c", 3},
+		{"[b", "(d", 2},
+		{"(d", "+", 0},
+		{"[z", "+", 0},
+	}
+
+	for _, c := range cases {
+		count, err := zset.ZLexCount(key, c.min, c.max)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		assertCountEqual(t, c.expected, count, fmt.Sprintf("LexCount %s %s", c.min, c.max))
+	}
+
+	count, _ := zset.ZLexCount("nonexistent_key", "-", "+")
+	assertCountEqual(t, 0, count, "LexCount Non-Existent Key")
+}
+
+func TestZSet_ZRemRangeByLex(t *testing.T) {
+	t.Run("RemRangeByLex Middle Range", func(t *testing.T) {
+		// Test removing a range in the middle of the set.
+		zset := New()
+		key := "lex_set"
+		for _, member := range []string{"a", "b", "c", "d", "e"} {
+			zset.ZAdd(key, 0, member, nil)
+		}
+
+		removed, err := zset.ZRemRangeByLex(key, "(a", "[d")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		assertCountEqual(t, 3, removed, "RemRangeByLex Middle Range")
+		assertSliceEqual(t, []interface{}{"a", "e"}, zset.ZRange(key, 0, -1), "RemRangeByLex Middle Range - Remaining Members")
+		assertSkipListValid(t, zset.records[key])
+	})
+
+	t.Run("RemRangeByLex Whole Set", func(t *testing.T) {
+		// Test that removing every member removes the key.
+		zset := New()
+		key := "lex_set"
+		zset.ZAdd(key, 0, "a", nil)
+		zset.ZAdd(key, 0, "b", nil)
+
+		removed, _ := zset.ZRemRangeByLex(key, "-", "+")
+		assertCountEqual(t, 2, removed, "RemRangeByLex Whole Set")
+		assertBoolEqual(t, false, zset.ZKeyExists(key), "RemRangeByLex Whole Set - Key Removed")
+	})
+
+	t.Run("RemRangeByLex Empty Range", func(t *testing.T) {
+		// Test that an empty range removes nothing.
+		zset := New()
+		key := "lex_set"
+		zset.ZAdd(key, 0, "a", nil)
+
+		removed, _ := zset.ZRemRangeByLex(key, "(a", "[a")
+		assertCountEqual(t, 0, removed, "RemRangeByLex Empty Range")
+		assertCountEqual(t, 1, zset.ZCard(key), "RemRangeByLex Empty Range - Cardinality Check")
+	})
+}
+
+func TestZSet_SetOperations(t *testing.T) {
+	newSets := func() *ZSet {
+		zset := New()
+		zset.ZAdd("monday", 10, "alice", "alice_monday")
+		zset.ZAdd("monday", 4, "bob", "bob_monday")
+		zset.ZAdd("monday", 1, "carol", "carol_monday")
+		zset.ZAdd("tuesday", 5, "alice", "alice_tuesday")
+		zset.ZAdd("tuesday", 7, "bob", "bob_tuesday")
+		zset.ZAdd("tuesday", 2, "dave", "dave_tuesday")
+		return zset
+	}
+
+	t.Run("UnionStore Sum", func(t *testing.T) {
+		// Test combining two sets with the default SUM aggregation.
+		zset := newSets()
+		count, err := zset.ZUnionStore("week", []string{"monday", "tuesday"}, nil)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		assertCountEqual(t, 4, count, "UnionStore Sum")
+		assertSliceEqual(t, []interface{}{"carol", 1.0, "dave", 2.0, "bob", 11.0, "alice", 15.0},
+			zset.ZRangeWithScore("week", 0, 3), "UnionStore Sum - Members")
+		if value := zset.records["week"].records["alice"].value; value != "alice_monday" {
+			t.Errorf("Expected value %v, got %v", "alice_monday", value)
+		}
+		assertSkipListValid(t, zset.records["week"])
+	})
+
+	t.Run("UnionStore Weights And Aggregates", func(t *testing.T) {
+		// Test weighted unions with MIN and MAX aggregation.
+		zset := newSets()
+
+		result, _ := zset.ZUnion([]string{"monday", "tuesday"}, &ZStoreOptions{Weights: []float64{2, 1}, Aggregate: AggregateMin})
+		assertSliceEqual(t, []interface{}{"carol", 2.0, "dave", 2.0, "alice", 5.0, "bob", 7.0}, result, "Union Weights Min")
+
+		result, _ = zset.ZUnion([]string{"monday", "tuesday"}, &ZStoreOptions{Aggregate: AggregateMax})
+		assertSliceEqual(t, []interface{}{"carol", 1.0, "dave", 2.0, "bob", 7.0, "alice", 10.0}, result, "Union Max")
+	})
+
+	t.Run("UnionStore Missing Keys And Overwrite", func(t *testing.T) {
+		// Test that missing keys count as empty sets and that a source key can be the destination.
+		zset := newSets()
+		count, _ := zset.ZUnionStore("monday", []string{"monday", "nonexistent_key"}, &ZStoreOptions{Weights: []float64{2, 3}})
+		assertCountEqual(t, 3, count, "UnionStore Missing Keys")
+		_, score := zset.ZScore("monday", "alice")
+		assertFloatEqual(t, 20, score, "UnionStore Overwrite - Score Check")
+
+		count, _ = zset.ZUnionStore("monday", []string{"nonexistent_key"}, nil)
+		assertCountEqual(t, 0, count, "UnionStore Empty Result")
+		assertBoolEqual(t, false, zset.ZKeyExists("monday"), "UnionStore Empty Result - Destination Removed")
+	})
+
+	t.Run("InterStore", func(t *testing.T) {
+		// Test intersecting sets, including a missing key.
+		zset := newSets()
+		count, err := zset.ZInterStore("both", []string{"monday", "tuesday"}, &ZStoreOptions{Weights: []float64{1, 10}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		assertCountEqual(t, 2, count, "InterStore")
+		assertSliceEqual(t, []interface{}{"alice", 60.0, "bob", 74.0}, zset.ZRangeWithScore("both", 0, 1), "InterStore - Members")
+		if value := zset.records["both"].records["bob"].value; value != "bob_monday" {
+			t.Errorf("Expected value %v, got %v", "bob_monday", value)
+		}
+
+		count, _ = zset.ZInterStore("both", []string{"monday", "nonexistent_key"}, nil)
+		assertCountEqual(t, 0, count, "InterStore Missing Key")
+		assertBoolEqual(t, false, zset.ZKeyExists("both"), "InterStore Missing Key - Destination Removed")
+	})
+
+	t.Run("DiffStore", func(t *testing.T) {
+		// Test subtracting sets, keeping scores and values from the first set.
+		zset := newSets()
+		count, err := zset.ZDiffStore("only_monday", []string{"monday", "tuesday", "nonexistent_key"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		assertCountEqual(t, 1, count, "DiffStore")
+		assertSliceEqual(t, []interface{}{"carol", 1.0}, zset.ZRangeWithScore("only_monday", 0, 0), "DiffStore - Members")
+
+		result, _ := zset.ZDiff([]string{"tuesday", "monday"})
+		assertSliceEqual(t, []interface{}{"dave", 2.0}, result, "Diff")
+
+		result, _ = zset.ZDiff([]string{"nonexistent_key", "monday"})
+		assertSliceEqual(t, []interface{}{}, result, "Diff Missing First Key")
+	})
+
+	t.Run("NaN Handling", func(t *testing.T) {
+		// Test that infinity times a zero weight and opposite infinite sums count as 0.
+		zset := New()
+		zset.ZAdd("positive", math.Inf(1), "member", nil)
+		zset.ZAdd("negative", math.Inf(-1), "member", nil)
+
+		result, _ := zset.ZUnion([]string{"positive"}, &ZStoreOptions{Weights: []float64{0}})
+		assertSliceEqual(t, []interface{}{"member", 0.0}, result, "Infinity Times Zero")
+
+		result, _ = zset.ZInter([]string{"positive", "negative"}, nil)
+		assertSliceEqual(t, []interface{}{"member", 0.0}, result, "Opposite Infinities")
+	})
+
+	t.Run("Invalid Arguments", func(t *testing.T) {
+		// Test the errors for missing keys and mismatched weights.
+		zset := newSets()
+		if _, err := zset.ZUnionStore("dst", nil, nil); err != ErrNoInputKeys {
+			t.Errorf("Expected %v, got %v", ErrNoInputKeys, err)
+		}
+		if _, err := zset.ZInter([]string{"monday", "tuesday"}, &ZStoreOptions{Weights: []float64{1}}); err != ErrWeightsMismatch {
+			t.Errorf("Expected %v, got %v", ErrWeightsMismatch, err)
+		}
+		if _, err := zset.ZDiffStore("dst", nil); err != ErrNoInputKeys {
+			t.Errorf("Expected %v, got %v", ErrNoInputKeys, err)
+		}
+		assertBoolEqual(t, false, zset.ZKeyExists("dst"), "Invalid Arguments - Destination Not Created")
+	})
+
+	t.Run("InterCard", func(t *testing.T) {
+		// Test counting the intersection with and without a limit.
+		zset := newSets()
+		count, _ := zset.ZInterCard([]string{"monday", "tuesday"}, 0)
+		assertCountEqual(t, 2, count, "InterCard")
+
+		count, _ = zset.ZInterCard([]string{"monday", "tuesday"}, 1)
+		assertCountEqual(t, 1, count, "InterCard Limit")
+
+		count, _ = zset.ZInterCard([]string{"monday", "nonexistent_key"}, 0)
+		assertCountEqual(t, 0, count, "InterCard Missing Key")
+
+		if _, err := zset.ZInterCard([]string{"monday"}, -1); err != ErrNegativeLimit {
+			t.Errorf("Expected %v, got %v", ErrNegativeLimit, err)
+		}
+	})
+}
+
+func TestZSet_ZPop(t *testing.T) {
+	zset := New()
+	key := "sorted_set"
+	for i := 1; i <= 5; i++ {
+		zset.ZAdd(key, float64(i), fmt.Sprintf("member%d", i), fmt.Sprintf("value%d", i))
+	}
+
+	t.Run("ZPopMin And ZPopMax", func(t *testing.T) {
+		// Test that single pops return the lowest and highest entries and remove them.
+		entry, err := zset.ZPopMin(key)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		expected := Entry[interface{}]{Member: "member1", Score: 1, Value: "value1"}
+		if entry != expected {
+			t.Errorf("Expected %v but got %v", expected, entry)
+		}
+
+		entry, _ = zset.ZPopMax(key)
+		assertBoolEqual(t, true, entry.Member == "member5" && entry.Score == 5, "ZPopMax Entry")
+		assertCountEqual(t, 3, zset.ZCard(key), "ZPop Removes Members")
+	})
+
+	t.Run("Entry Is A Copy", func(t *testing.T) {
+		// Test that changing a returned entry does not change the sorted set.
+		entries := zset.ZRangeByScore(key, 2, 2, nil)
+		entries[0].Score = 100
+		entries[0].Member = "changed"
+
+		exists, score := zset.ZScore(key, "member2")
+		assertBoolEqual(t, true, exists, "Entry Copy - Member Kept")
+		assertFloatEqual(t, 2, score, "Entry Copy - Score Kept")
+	})
+
+	t.Run("ZPopMinCount And ZPopMaxCount", func(t *testing.T) {
+		// Test popping several members at once, in pop order, with a count above the size.
+		entries, err := zset.ZPopMaxCount(key, 2)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		assertCountEqual(t, 2, len(entries), "ZPopMaxCount Count")
+		assertBoolEqual(t, true, entries[0].Member == "member4" && entries[1].Member == "member3", "ZPopMaxCount Order")
+
+		entries, _ = zset.ZPopMinCount(key, 10)
+		assertCountEqual(t, 1, len(entries), "ZPopMinCount Count Above Size")
+		assertBoolEqual(t, true, entries[0].Member == "member2", "ZPopMinCount Member")
+
+		entries, _ = zset.ZPopMinCount(key, 1)
+		assertCountEqual(t, 0, len(entries), "ZPopMinCount Empty Set")
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		// Test the errors returned for missing keys, empty sets and negative counts.
+		if _, err := zset.ZPopMin("nonexistent_key"); err != ErrKeyNotFound {
+			t.Errorf("Expected %v, got %v", ErrKeyNotFound, err)
+		}
+		if _, err := zset.ZPopMax(key); err != ErrKeyNotFound {
+			t.Errorf("Expected %v, got %v", ErrKeyNotFound, err)
+		}
+		if _, err := zset.ZPopMinCount(key, -1); err != ErrNegativeCount {
+			t.Errorf("Expected %v, got %v", ErrNegativeCount, err)
+		}
+
+		entries, err := zset.ZPopMaxCount("nonexistent_key", 3)
+		assertBoolEqual(t, true, err == nil && len(entries) == 0, "ZPopMaxCount Missing Key")
+	})
+}
+
+func TestZSet_BZPop(t *testing.T) {
+	t.Run("BZPop Available Member", func(t *testing.T) {
+		// Test that a non-empty key is popped from without blocking, checking keys in order.
+		zset := New()
+		zset.ZAdd("jobs", 1.0, "job1", nil)
+		zset.ZAdd("jobs", 5.0, "job2", nil)
+
+		key, entry, err := zset.BZPopMax(context.Background(), "nonexistent_key", "jobs")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if key != "jobs" || entry.Member != "job2" {
+			t.Errorf("Expected jobs/job2, got %s/%s", key, entry.Member)
+		}
+
+		_, entry, _ = zset.BZPopMin(context.Background(), "jobs")
+		if entry.Member != "job1" {
+			t.Errorf("Expected job1, got %s", entry.Member)
+		}
+	})
+
+	t.Run("BZPop Wakes Up On ZAdd", func(t *testing.T) {
+		// Test that a blocked caller receives the member added by another goroutine.
+		zset := New()
+		type popped struct {
+			key   string
+			entry Entry[interface{}]
+		}
+		done := make(chan popped)
+
+		go func() {
+			key, entry, err := zset.BZPopMin(context.Background(), "urgent", "jobs")
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			done <- popped{key: key, entry: entry}
+		}()
+
+		waitForWaiters(t, zset, "jobs", 1)
+		zset.ZAdd("jobs", 2.0, "job1", "payload1")
+
+		result := <-done
+		if result.key != "jobs" || result.entry.Member != "job1" || result.entry.Value != "payload1" {
+			t.Errorf("Expected jobs/job1/payload1, got %s/%s/%v", result.key, result.entry.Member, result.entry.Value)
+		}
+		assertCountEqual(t, 0, zset.ZCard("jobs"), "BZPop Wakes Up On ZAdd - Member Removed")
+		assertCountEqual(t, 0, waiterCount(zset), "BZPop Wakes Up On ZAdd - Waiters Removed")
+	})
+
+	t.Run("BZPop FIFO Order", func(t *testing.T) {
+		// Test that waiters on the same key are served in the order they started waiting.
+		zset := New()
+		results := make(chan string, 3)
+
+		for i := 1; i <= 3; i++ {
+			name := fmt.Sprintf("worker%d", i)
+			go func() {
+				_, entry, err := zset.BZPopMin(context.Background(), "jobs")
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				results <- name + ":" + entry.Member
+			}()
+			waitForWaiters(t, zset, "jobs", i)
+		}
+
+		for i := 1; i <= 3; i++ {
+			zset.ZAdd("jobs", float64(i), fmt.Sprintf("job%d", i), nil)
+			expected := fmt.Sprintf("worker%d:job%d", i, i)
+			if result := <-results; result != expected {
+				t.Errorf("Expected %s, got %s", expected, result)
+			}
+		}
+	})
+
+	t.Run("BZPop Context Cancelled", func(t *testing.T) {
+		// Test that cancelling the context unblocks the caller and unregisters it.
+		zset := New()
+		ctx, cancel := context.WithCancel(context.Background())
+		errs := make(chan error)
+
+		go func() {
+			_, _, err := zset.BZPopMax(ctx, "jobs", "other_jobs")
+			errs <- err
+		}()
+
+		waitForWaiters(t, zset, "other_jobs", 1)
+		cancel()
+
+		if err := <-errs; err != context.Canceled {
+			t.Errorf("Expected %v, got %v", context.Canceled, err)
+		}
+		assertCountEqual(t, 0, waiterCount(zset), "BZPop Context Cancelled - Waiters Removed")
+
+		zset.ZAdd("jobs", 1.0, "job1", nil)
+		assertCountEqual(t, 1, zset.ZCard("jobs"), "BZPop Context Cancelled - Member Kept")
+
+		if _, _, err := zset.BZPopMin(context.Background()); err != ErrNoInputKeys {
+			t.Errorf("Expected %v, got %v", ErrNoInputKeys, err)
+		}
+	})
+
+	t.Run("BZPop Concurrent Workers", func(t *testing.T) {
+		// Test that concurrent producers and consumers deliver every member exactly once.
+		zset := New()
+		const producers, perProducer = 4, 50
+
+		var wg sync.WaitGroup
+		received := make(chan string, producers*perProducer)
+		for i := 0; i < producers*perProducer; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, entry, err := zset.BZPopMin(context.Background(), "jobs")
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+					return
+				}
+				received <- entry.Member
+			}()
+		}
+
+		for p := 0; p < producers; p++ {
+			go func(p int) {
+				for i := 0; i < perProducer; i++ {
+					zset.ZAdd("jobs", float64(i), fmt.Sprintf("job%d-%d", p, i), nil)
+				}
+			}(p)
+		}
+
+		wg.Wait()
+		close(received)
+
+		seen := make(map[string]bool)
+		for member := range received {
+			if seen[member] {
+				t.Errorf("Member %s delivered twice", member)
+			}
+			seen[member] = true
+		}
+		assertCountEqual(t, producers*perProducer, len(seen), "BZPop Concurrent Workers")
+	})
+}
+
+func TestZSet_ZKeys(t *testing.T) {
+	zset := New()
+
+	t.Run("Keys Empty ZSet", func(t *testing.T) {
+		// Test getting keys from an empty ZSet.
+		keys := zset.ZKeys()
+		if len(keys) != 0 {
+			t.Errorf("Expected %v but got %v", 0, keys)
+		}
+	})
+
+	t.Run("Keys Non-Empty ZSet", func(t *testing.T) {
+		// Test getting keys from a non-empty ZSet.
+		zset.ZAdd("set1", 3.5, "member1", "value1")
+		zset.ZAdd("set2", 2.0, "member2", "value2")
+		keys := zset.ZKeys()
+		expected := []string{"set1", "set2"}
+
+		if len(expected) != len(keys) {
+			t.Errorf("Expected %v but got %v", expected, keys)
+		}
+	})
+
+	t.Run("Keys After Clear", func(t *testing.T) {
+		// Test getting keys after clearing the ZSet.
+		zset.ZAdd("set1", 3.5, "member1", "value1")
 		zset.ZAdd("set2", 2.0, "member2", "value2")
 		zset.ZClear("set1")
 		keys := zset.ZKeys()
@@ -708,48 +1933,2855 @@ func TestZSet_ZKeys(t *testing.T) {
 	})
 }
 
-func TestZSet_ZKeyExists(t *testing.T) {
-	zset := New()
+func TestZSet_ZScan(t *testing.T) {
+	// scanAll runs a full scan and counts how many times each member is returned.
+	scanAll := func(t *testing.T, zset *ZSet, key, match string, count int, between func()) map[string]int {
+		seen := make(map[string]int)
+		var cursor uint64
+		for calls := 0; ; calls++ {
+			if calls > 10000 {
+				t.Fatal("ZScan did not complete")
+			}
+			next, entries, err := zset.ZScan(key, cursor, match, count)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for _, entry := range entries {
+				seen[entry.Member]++
+			}
+			if cursor = next; cursor == 0 {
+				return seen
+			}
+			if between != nil {
+				between()
+			}
+		}
+	}
+
+	t.Run("ZScan Full Scan", func(t *testing.T) {
+		// Test that a full scan returns every member exactly once with its score and value.
+		zset := New()
+		key := "sorted_set"
+		for i := 0; i < 1000; i++ {
+			zset.ZAdd(key, float64(i), fmt.Sprintf("member%d", i), i)
+		}
+
+		for _, count := range []int{0, 1, 7, 100, 5000} {
+			seen := scanAll(t, zset, key, "", count, nil)
+			assertCountEqual(t, 1000, len(seen), fmt.Sprintf("ZScan Count %d", count))
+			for member, times := range seen {
+				if times != 1 {
+					t.Errorf("Member %s returned %d times", member, times)
+				}
+			}
+		}
+
+		next, entries, _ := zset.ZScan(key, 0, "member42", 5000)
+		assertCountEqual(t, 0, int(next), "ZScan Single Batch Cursor")
+		if !reflect.DeepEqual([]Entry[interface{}]{{Member: "member42", Score: 42, Value: 42}}, entries) {
+			t.Errorf("Expected member42 with score and value 42, got %v", entries)
+		}
+	})
+
+	t.Run("ZScan Default Count", func(t *testing.T) {
+		// Test that a count of 0 visits the Redis default of 10 members.
+		zset := New()
+		for i := 0; i < 100; i++ {
+			zset.ZAdd("sorted_set", float64(i), fmt.Sprintf("member%d", i), nil)
+		}
+
+		next, entries, _ := zset.ZScan("sorted_set", 0, "", 0)
+		assertBoolEqual(t, true, next != 0, "ZScan Default Count Cursor")
+		assertCountEqual(t, 10, len(entries), "ZScan Default Count")
+	})
+
+	t.Run("ZScan Match", func(t *testing.T) {
+		// Test that only members matching the pattern are returned.
+		zset := New()
+		key := "sorted_set"
+		for i := 0; i < 50; i++ {
+			zset.ZAdd(key, float64(i), fmt.Sprintf("user:%d", i), nil)
+			zset.ZAdd(key, float64(i), fmt.Sprintf("admin:%d", i), nil)
+		}
+
+		seen := scanAll(t, zset, key, "user:*", 3, nil)
+		assertCountEqual(t, 50, len(seen), "ZScan Match")
+		for member := range seen {
+			if member[:5] != "user:" {
+				t.Errorf("Member %s does not match the pattern", member)
+			}
+		}
+	})
+
+	t.Run("ZScan Under Modification", func(t *testing.T) {
+		// Test that members present for the whole scan are returned while others are added, removed and rescored.
+		zset := New()
+		key := "sorted_set"
+		for i := 0; i < 500; i++ {
+			zset.ZAdd(key, float64(i), fmt.Sprintf("stable%d", i), nil)
+		}
+
+		step := 0
+		seen := scanAll(t, zset, key, "", 5, func() {
+			step++
+			zset.ZAdd(key, float64(-step), fmt.Sprintf("added%d", step), nil)
+			zset.ZRem(key, fmt.Sprintf("added%d", step-1))
+			zset.ZIncrBy(key, 1000, fmt.Sprintf("stable%d", step%500))
+		})
+
+		for i := 0; i < 500; i++ {
+			if seen[fmt.Sprintf("stable%d", i)] == 0 {
+				t.Errorf("Member stable%d was not returned", i)
+			}
+		}
+	})
+
+	t.Run("ZScan Non-Existent Key", func(t *testing.T) {
+		// Test scanning a non-existent key.
+		next, entries, err := New().ZScan("nonexistent_key", 0, "", 10)
+		assertBoolEqual(t, true, err == nil, "ZScan Non-Existent Key Error")
+		assertCountEqual(t, 0, int(next), "ZScan Non-Existent Key Cursor")
+		assertCountEqual(t, 0, len(entries), "ZScan Non-Existent Key")
+	})
+
+	t.Run("ZScan Negative Count", func(t *testing.T) {
+		// Test that a negative count is rejected.
+		zset := New()
+		zset.ZAdd("sorted_set", 1, "member1", nil)
+		if _, _, err := zset.ZScan("sorted_set", 0, "", -1); err != ErrNegativeCount {
+			t.Errorf("Expected %v, got %v", ErrNegativeCount, err)
+		}
+		if _, _, err := zset.Scan(0, "", -1); err != ErrNegativeCount {
+			t.Errorf("Expected %v, got %v", ErrNegativeCount, err)
+		}
+	})
+
+	t.Run("Scan Keyspace", func(t *testing.T) {
+		// Test that a keyspace scan returns every matching key exactly once.
+		zset := New()
+		for i := 0; i < 200; i++ {
+			zset.ZAdd(fmt.Sprintf("leaderboard:%d", i), 1, "member", nil)
+			zset.ZAdd(fmt.Sprintf("session:%d", i), 1, "member", nil)
+		}
+
+		seen := make(map[string]int)
+		var cursor uint64
+		for {
+			next, keys, err := zset.Scan(cursor, "leaderboard:*", 7)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for _, key := range keys {
+				seen[key]++
+			}
+			if cursor = next; cursor == 0 {
+				break
+			}
+		}
+
+		assertCountEqual(t, 200, len(seen), "Scan Keyspace")
+		for key, times := range seen {
+			if times != 1 {
+				t.Errorf("Key %s returned %d times", key, times)
+			}
+		}
+
+		next, keys, _ := New().Scan(0, "", 0)
+		assertCountEqual(t, 0, int(next), "Scan Empty Cursor")
+		assertCountEqual(t, 0, len(keys), "Scan Empty")
+	})
+
+	t.Run("ZScan Cost Per Call", func(t *testing.T) {
+		// Test that a scan step costs about the same on a large set as on a small one, rather than growing
+		// with the size of the set.
+		perCall := func(size int) time.Duration {
+			zset := New()
+			for i := 0; i < size; i++ {
+				zset.ZAdd("sorted_set", float64(i), fmt.Sprintf("member%d", i), nil)
+			}
+
+			best := time.Duration(math.MaxInt64)
+			for run := 0; run < 5; run++ {
+				var cursor uint64
+				start := time.Now()
+				for calls := 1; calls <= 500; calls++ {
+					if cursor, _, _ = zset.ZScan("sorted_set", cursor, "", 10); cursor == 0 {
+						break
+					}
+				}
+				best = min(best, time.Since(start))
+			}
+			return best
+		}
+
+		small, large := perCall(5000), perCall(160000)
+		if large > 8*small {
+			t.Errorf("500 scan steps took %v on 160000 members and %v on 5000", large, small)
+		}
+	})
+
+	t.Run("Scan Index", func(t *testing.T) {
+		// Test that the scan index keeps every name in hash order as it grows and shrinks.
+		var idx scanIndex
+		for i := 0; i < 1000; i++ {
+			idx.add(fmt.Sprintf("name%d", i))
+		}
+		for i := 0; i < 1000; i += 2 {
+			assertBoolEqual(t, true, idx.remove(fmt.Sprintf("name%d", i)), "Remove Existing")
+		}
+		assertBoolEqual(t, false, idx.remove("name0"), "Remove Missing")
+		assertCountEqual(t, 500, idx.length, "Length")
+		assertBoolEqual(t, true, len(idx.buckets) <= 500/2, "Shrunk")
+
+		names, next := idx.next(0, 1000)
+		assertCountEqual(t, 0, int(next), "Single Batch Cursor")
+		assertCountEqual(t, 500, len(names), "Single Batch")
+		for i := 1; i < len(names); i++ {
+			if scanHash(names[i-1]) > scanHash(names[i]) {
+				t.Fatalf("%s is returned before %s", names[i-1], names[i])
+			}
+		}
+	})
+
+	t.Run("Glob Match", func(t *testing.T) {
+		// Test the glob syntax used by the match pattern.
+		cases := []struct {
+			pattern  string
+			str      string
+			expected bool
+		}{
+			{"*", "", true},
+			{"*", "anything", true},
+			{"user:*", "user:1", true},
+			{"user:*", "admin:1", false},
+			{"*:1", "admin:1", true},
+			{"h?llo", "hello", true},
+			{"h?llo", "hllo", false},
+			{"h[ae]llo", "hallo", true},
+			{"h[ae]llo", "hillo", false},
+			{"h[^e]llo", "hallo", true},
+			{"h[^e]llo", "hello", false},
+			{"h[a-b]llo", "hbllo", true},
+			{"h[b-a]llo", "hbllo", true},
+			{"h[a-b]llo", "hcllo", false},
+			{"h\\*llo", "h*llo", true},
+			{"h\\*llo", "hello", false},
+			{"h[\\]]llo", "h]llo", true},
+			{"a**b", "axxb", true},
+			{"a*", "a", true},
+			{"abc", "ab", false},
+			{"ab", "abc", false},
+		}
+		for _, c := range cases {
+			if globMatch(c.pattern, c.str) != c.expected {
+				t.Errorf("globMatch(%q, %q): expected %v", c.pattern, c.str, c.expected)
+			}
+		}
+	})
+}
+
+func TestZSet_ZKeyExists(t *testing.T) {
+	zset := New()
+
+	t.Run("KeyExists Non-Existent Key", func(t *testing.T) {
+		// Test checking existence of a non-existent key.
+		exists := zset.ZKeyExists("nonexistant_key")
+		assertBoolEqual(t, false, exists, "KeyExists Non-Existent Key")
+	})
+
+	t.Run("KeyExists Existing Key", func(t *testing.T) {
+		// Test checking existence of an existing key.
+		key := "sorted_set"
+		zset.ZAdd(key, 3.5, "member1", "value1")
+		exists := zset.ZKeyExists(key)
+		assertBoolEqual(t, true, exists, "KeyExists Existing Key")
+	})
+}
+
+func TestZSet_ZClear(t *testing.T) {
+	zset := New()
+
+	t.Run("Clear Non-Existent Key", func(t *testing.T) {
+		// Test clearing a non-existent key.
+		keys := zset.ZKeys()
+		if len(keys) != 0 {
+			t.Errorf("Expected %v but got %v", 0, keys)
+		}
+	})
+
+	t.Run("Clear Existing Key", func(t *testing.T) {
+		// Test clearing an existing key.
+		key := "sorted_set"
+		zset.ZAdd(key, 3.5, "member1", "value1")
+		zset.ZAdd(key, 2.0, "member2", "value2")
+		zset.ZClear(key)
+		keys := zset.ZKeys()
+		if len(keys) != 0 {
+			t.Errorf("Expected %v but got %v", 0, keys)
+		}
+	})
+}
+
+func TestTypedZSet(t *testing.T) {
+	type player struct {
+		Name  string
+		Level int
+	}
+
+	zset := NewTyped[player]()
+	key := "leaderboard"
+	zset.ZAdd(key, 30, "carol", player{Name: "Carol", Level: 3})
+	zset.ZAdd(key, 10, "alice", player{Name: "Alice", Level: 1})
+	zset.ZAdd(key, 20, "bob", player{Name: "Bob", Level: 2})
+
+	t.Run("ZRange Returns Typed Entries", func(t *testing.T) {
+		// Test that entries carry the member, score and typed value in rank order.
+		entries := zset.ZRange(key, 0, -1)
+		expected := []Entry[player]{
+			{Member: "alice", Score: 10, Value: player{Name: "Alice", Level: 1}},
+			{Member: "bob", Score: 20, Value: player{Name: "Bob", Level: 2}},
+			{Member: "carol", Score: 30, Value: player{Name: "Carol", Level: 3}},
+		}
+		if !reflect.DeepEqual(expected, entries) {
+			t.Errorf("Expected %v but got %v", expected, entries)
+		}
+	})
+
+	t.Run("ZRevRange And Score Ranges", func(t *testing.T) {
+		// Test the reversed rank range and both score ranges.
+		rev := zset.ZRevRange(key, 0, 0)
+		assertCountEqual(t, 1, len(rev), "ZRevRange Count")
+		assertBoolEqual(t, true, rev[0].Value.Name == "Carol", "ZRevRange Value")
+
+		inRange := zset.ZScoreRange(key, 15, 30)
+		assertCountEqual(t, 2, len(inRange), "ZScoreRange Count")
+		assertBoolEqual(t, true, inRange[0].Member == "bob" && inRange[1].Member == "carol", "ZScoreRange Order")
+
+		revInRange := zset.ZRevScoreRange(key, 20, 0)
+		assertCountEqual(t, 2, len(revInRange), "ZRevScoreRange Count")
+		assertBoolEqual(t, true, revInRange[0].Member == "bob" && revInRange[1].Member == "alice", "ZRevScoreRange Order")
+
+		assertCountEqual(t, 0, len(zset.ZScoreRange("missing", 0, 100)), "ZScoreRange Missing Key")
+	})
+
+	t.Run("ZRetrieveByRank", func(t *testing.T) {
+		// Test retrieving entries by rank and reverse rank, and out of range ranks.
+		entry, ok := zset.ZRetrieveByRank(key, 1)
+		assertBoolEqual(t, true, ok && entry.Member == "bob" && entry.Value.Level == 2, "ZRetrieveByRank")
+
+		entry, ok = zset.ZRevRetrieveByRank(key, 0)
+		assertBoolEqual(t, true, ok && entry.Member == "carol", "ZRevRetrieveByRank")
+
+		_, ok = zset.ZRetrieveByRank(key, 3)
+		assertBoolEqual(t, false, ok, "ZRetrieveByRank Out Of Range")
+	})
+
+	t.Run("ZAddMany And Set Operations", func(t *testing.T) {
+		// Test bulk adds with entries and typed results of the set operations.
+		added, err := zset.ZAddMany("guests",
+			Entry[player]{Member: "dave", Score: 5, Value: player{Name: "Dave"}},
+			Entry[player]{Member: "alice", Score: 1, Value: player{Name: "Alice (guest)"}})
+		assertBoolEqual(t, true, err == nil, "ZAddMany Error")
+		assertCountEqual(t, 2, added, "ZAddMany Added")
+
+		union, err := zset.ZUnion([]string{"guests", key}, nil)
+		assertBoolEqual(t, true, err == nil, "ZUnion Error")
+		assertCountEqual(t, 4, len(union), "ZUnion Count")
+		assertBoolEqual(t, true, union[0].Member == "dave" && union[1].Member == "alice", "ZUnion Order")
+		assertFloatEqual(t, 11, union[1].Score, "ZUnion Score")
+		assertBoolEqual(t, true, union[1].Value.Name == "Alice (guest)", "ZUnion Value From First Key")
+	})
+
+	t.Run("ZIncrBy Uses Zero Value", func(t *testing.T) {
+		// Test that a member created by ZIncrBy holds the zero value.
+		zset.ZIncrBy("fresh", 2, "eve")
+		entries := zset.ZRange("fresh", 0, -1)
+		assertCountEqual(t, 1, len(entries), "ZIncrBy Count")
+		assertBoolEqual(t, true, entries[0].Value == player{}, "ZIncrBy Zero Value")
+	})
+}
+
+func TestZSet_ZRangeQuery(t *testing.T) {
+	zset := New()
+	key := "sorted_set"
+	for i := 1; i <= 6; i++ {
+		zset.ZAdd(key, float64(i), fmt.Sprintf("member%d", i), nil)
+	}
+
+	lexKey := "lex_set"
+	for _, member := range []string{"a", "b", "c", "d", "e"} {
+		zset.ZAdd(lexKey, 0, member, nil)
+	}
+
+	t.Run("By Rank", func(t *testing.T) {
+		// Test rank queries with negative indices, reverse order, limits and scores.
+		cases := []struct {
+			name     string
+			query    RangeQuery
+			expected []interface{}
+		}{
+			{"All", RangeByRank(0, -1), []interface{}{"member1", "member2", "member3", "member4", "member5", "member6"}},
+			{"Negative", RangeByRank(-2, -1), []interface{}{"member5", "member6"}},
+			{"Rev", RangeByRank(0, 1).Rev(), []interface{}{"member6", "member5"}},
+			{"Limit", RangeByRank(0, -1).Limit(1, 2), []interface{}{"member2", "member3"}},
+			{"Rev Limit", RangeByRank(0, -1).Rev().Limit(2, 2), []interface{}{"member4", "member3"}},
+			{"WithScores", RangeByRank(0, 1).WithScores(), []interface{}{"member1", 1.0, "member2", 2.0}},
+			{"Start After Stop", RangeByRank(3, 1), []interface{}{}},
+			{"Out Of Range", RangeByRank(10, 20), []interface{}{}},
+			{"Offset Past Range", RangeByRank(0, 2).Limit(3, 1), []interface{}{}},
+		}
+		for _, c := range cases {
+			result, err := zset.ZRangeQuery(key, c.query)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", c.name, err)
+			}
+			assertSliceEqual(t, c.expected, result, "ZRangeQuery By Rank "+c.name)
+		}
+	})
+
+	t.Run("By Score", func(t *testing.T) {
+		// Test score queries with exclusive bounds, reverse order and limits.
+		cases := []struct {
+			name     string
+			query    RangeQuery
+			expected []interface{}
+		}{
+			{"Inclusive", RangeByScore(2, 4), []interface{}{"member2", "member3", "member4"}},
+			{"Exclusive", RangeByScore(2, 4).ExcludeStart().ExcludeEnd(), []interface{}{"member3"}},
+			{"Infinite", RangeByScore(math.Inf(-1), math.Inf(1)).Limit(4, -1), []interface{}{"member5", "member6"}},
+			{"Rev", RangeByScore(5, 3).Rev(), []interface{}{"member5", "member4", "member3"}},
+			{"Rev Exclusive Start", RangeByScore(5, 3).Rev().ExcludeStart(), []interface{}{"member4", "member3"}},
+			{"Rev Limit", RangeByScore(6, 1).Rev().Limit(1, 2).WithScores(), []interface{}{"member5", 5.0, "member4", 4.0}},
+			{"Empty", RangeByScore(4, 2), []interface{}{}},
+		}
+		for _, c := range cases {
+			result, err := zset.ZRangeQuery(key, c.query)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", c.name, err)
+			}
+			assertSliceEqual(t, c.expected, result, "ZRangeQuery By Score "+c.name)
+		}
+	})
+
+	t.Run("By Lex", func(t *testing.T) {
+		// Test lexicographic queries, reverse order and invalid bounds.
+		result, err := zset.ZRangeQuery(lexKey, RangeByLex("[b", "(e").Limit(1, -1))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		assertSliceEqual(t, []interface{}{"c", "d"}, result, "ZRangeQuery By Lex")
+
+		result, _ = zset.ZRangeQuery(lexKey, RangeByLex("+", "[c").Rev())
+		assertSliceEqual(t, []interface{}{"e", "d", "c"}, result, "ZRangeQuery By Lex Rev")
+
+		if _, err := zset.ZRangeQuery(lexKey, RangeByLex("b", "+")); err != ErrInvalidLexRange {
+			t.Errorf("Expected %v, got %v", ErrInvalidLexRange, err)
+		}
+		if _, err := zset.ZRangeQuery("nonexistent_key", RangeByLex("-", "c")); err != ErrInvalidLexRange {
+			t.Errorf("Expected %v for a missing key, got %v", ErrInvalidLexRange, err)
+		}
+	})
+
+	t.Run("Legacy Methods Agree", func(t *testing.T) {
+		// Test that the range methods share the query's handling of negative indices and empty results.
+		assertSliceEqual(t, []interface{}{"member5", 5.0, "member6", 6.0}, zset.ZRangeWithScore(key, -2, -1), "ZRangeWithScore Negative Indices")
+		assertSliceEqual(t, []interface{}{"member6", "member5"}, zset.ZRevRange(key, 0, -5), "ZRevRange Negative Stop")
+		assertSliceEqual(t, []interface{}{"member6", 6.0}, zset.ZRevRangeWithScore(key, 0, -6), "ZRevRangeWithScore Negative Stop")
+
+		missing := []interface{}{
+			zset.ZRange("nonexistent_key", 0, -1),
+			zset.ZRangeWithScore("nonexistent_key", 0, -1),
+			zset.ZRevRange("nonexistent_key", 0, -1),
+			zset.ZRevRangeWithScore("nonexistent_key", 0, -1),
+			zset.ZScoreRange("nonexistent_key", 0, 10),
+			zset.ZRevScoreRange("nonexistent_key", 10, 0),
+		}
+		for i, result := range missing {
+			assertSliceEqual(t, []interface{}{}, result.([]interface{}), fmt.Sprintf("Missing Key Result %d", i))
+		}
+	})
+}
+
+func TestZSet_RangeBounds(t *testing.T) {
+	t.Run("ParseScoreBound", func(t *testing.T) {
+		// Test parsing scores, exclusive scores and infinities, and formatting them back.
+		cases := []struct {
+			input    string
+			expected ScoreBound
+			output   string
+		}{
+			{"1.5", ScoreBound{Value: 1.5}, "1.5"},
+			{"(1.5", ScoreBound{Value: 1.5, Exclusive: true}, "(1.5"},
+			{"-inf", ScoreBound{Value: math.Inf(-1)}, "-inf"},
+			{"+inf", ScoreBound{Value: math.Inf(1)}, "+inf"},
+			{"(inf", ScoreBound{Value: math.Inf(1), Exclusive: true}, "(+inf"},
+			{"-3", ScoreBound{Value: -3}, "-3"},
+		}
+		for _, c := range cases {
+			bound, err := ParseScoreBound(c.input)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", c.input, err)
+			}
+			if bound != c.expected {
+				t.Errorf("%s: expected %v but got %v", c.input, c.expected, bound)
+			}
+			if bound.String() != c.output {
+				t.Errorf("%s: expected %s but got %s", c.input, c.output, bound.String())
+			}
+		}
+
+		for _, input := range []string{"", "(", "[1", "abc", "nan", "1.5x"} {
+			if _, err := ParseScoreBound(input); err != ErrInvalidScoreRange {
+				t.Errorf("%q: expected %v, got %v", input, ErrInvalidScoreRange, err)
+			}
+		}
+	})
+
+	t.Run("ParseLexBound", func(t *testing.T) {
+		// Test parsing inclusive, exclusive and infinite lexicographic bounds, and formatting them back.
+		cases := []struct {
+			input    string
+			expected LexBound
+		}{
+			{"[a", LexBound{Value: "a"}},
+			{"(a", LexBound{Value: "a", Exclusive: true}},
+			{"[", LexBound{}},
+			{"-", LexBound{Inf: -1, Exclusive: true}},
+			{"+", LexBound{Inf: 1, Exclusive: true}},
+		}
+		for _, c := range cases {
+			bound, err := ParseLexBound(c.input)
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", c.input, err)
+			}
+			if bound != c.expected {
+				t.Errorf("%s: expected %v but got %v", c.input, c.expected, bound)
+			}
+			if bound.String() != c.input {
+				t.Errorf("%s: expected %s but got %s", c.input, c.input, bound.String())
+			}
+		}
+
+		for _, input := range []string{"", "a", "-a", "++"} {
+			if _, err := ParseLexBound(input); err != ErrInvalidLexRange {
+				t.Errorf("%q: expected %v, got %v", input, ErrInvalidLexRange, err)
+			}
+		}
+	})
+
+	t.Run("Score Methods With Bounds", func(t *testing.T) {
+		// Test that parsed score bounds can be passed to the count, remove and query methods.
+		zset := New()
+		key := "sorted_set"
+		for i := 1; i <= 5; i++ {
+			zset.ZAdd(key, float64(i), fmt.Sprintf("member%d", i), nil)
+		}
+
+		min, _ := ParseScoreBound("(2")
+		max, _ := ParseScoreBound("+inf")
+		assertCountEqual(t, 3, zset.ZCountBounds(key, min, max), "ZCountBounds")
+
+		result, err := zset.ZRangeQuery(key, RangeByScoreBounds(max, min).Rev())
+		assertBoolEqual(t, true, err == nil, "RangeByScoreBounds Error")
+		assertSliceEqual(t, []interface{}{"member5", "member4", "member3"}, result, "RangeByScoreBounds Rev")
+
+		upper, _ := ParseScoreBound("(4")
+		lower, _ := ParseScoreBound("-inf")
+		assertCountEqual(t, 3, zset.ZRemRangeByScoreBounds(key, lower, upper), "ZRemRangeByScoreBounds Removed")
+		assertSliceEqual(t, []interface{}{"member4", "member5"}, zset.ZRange(key, 0, -1), "ZRemRangeByScoreBounds Remaining")
+	})
+
+	t.Run("Lex Methods With Bounds", func(t *testing.T) {
+		// Test that parsed lexicographic bounds can be passed to the count, remove and query methods.
+		zset := New()
+		key := "lex_set"
+		for _, member := range []string{"a", "b", "c", "d"} {
+			zset.ZAdd(key, 0, member, nil)
+		}
+
+		min, _ := ParseLexBound("(a")
+		max, _ := ParseLexBound("[c")
+		assertCountEqual(t, 2, zset.ZLexCountBounds(key, min, max), "ZLexCountBounds")
+
+		result, _ := zset.ZRangeQuery(key, RangeByLexBounds(min, max))
+		assertSliceEqual(t, []interface{}{"b", "c"}, result, "RangeByLexBounds")
+
+		assertCountEqual(t, 2, zset.ZRemRangeByLexBounds(key, min, max), "ZRemRangeByLexBounds Removed")
+		assertSliceEqual(t, []interface{}{"a", "d"}, zset.ZRange(key, 0, -1), "ZRemRangeByLexBounds Remaining")
+	})
+}
+
+func TestZSet_ZRangeByScore(t *testing.T) {
+	zset := New()
+	key := "scores"
+	for i := 1; i <= 5; i++ {
+		zset.ZAdd(key, float64(i), fmt.Sprintf("member%d", i), nil)
+	}
+
+	members := func(entries []Entry[interface{}]) []interface{} {
+		result := []interface{}{}
+		for _, entry := range entries {
+			result = append(result, entry.Member)
+		}
+		return result
+	}
+
+	t.Run("Inclusive Range", func(t *testing.T) {
+		// Test that both bounds are included by default.
+		got := members(zset.ZRangeByScore(key, 2, 4, nil))
+		assertSliceEqual(t, []interface{}{"member2", "member3", "member4"}, got, "ZRangeByScore Inclusive")
+	})
+
+	t.Run("Exclusive Bounds And Limit", func(t *testing.T) {
+		// Test excluded bounds combined with a limit.
+		got := members(zset.ZRangeByScore(key, 1, 5, &ZRangeConfig{ExcludeStart: true, ExcludeEnd: true, Limit: 2}))
+		assertSliceEqual(t, []interface{}{"member2", "member3"}, got, "ZRangeByScore Exclusive With Limit")
+	})
+
+	t.Run("Reversed Range", func(t *testing.T) {
+		// Test that a start above the end returns members from the highest score down.
+		got := members(zset.ZRangeByScore(key, 4, 2, &ZRangeConfig{ExcludeStart: true}))
+		assertSliceEqual(t, []interface{}{"member3", "member2"}, got, "ZRangeByScore Reversed")
+	})
+
+	t.Run("Missing Key", func(t *testing.T) {
+		// Test that a missing key returns an empty slice.
+		got := zset.ZRangeByScore("missing", 0, 10, nil)
+		assertCountEqual(t, 0, len(got), "ZRangeByScore Missing Key")
+	})
+}
+
+func TestZSet_Iterators(t *testing.T) {
+	// members collects the members produced by an iterator.
+	members := func(seq iter.Seq[Entry[interface{}]]) []interface{} {
+		result := []interface{}{}
+		for entry := range seq {
+			result = append(result, entry.Member)
+		}
+		return result
+	}
+
+	// newSet creates a ZSet whose "sorted_set" key holds member1 to member5 with scores 1 to 5.
+	newSet := func() *ZSet {
+		zset := New()
+		for i := 1; i <= 5; i++ {
+			zset.ZAdd("sorted_set", float64(i), fmt.Sprintf("member%d", i), i)
+		}
+		return zset
+	}
+
+	t.Run("All And Backward", func(t *testing.T) {
+		// Test ascending and descending traversal of the whole set.
+		zset := newSet()
+		assertSliceEqual(t, []interface{}{"member1", "member2", "member3", "member4", "member5"}, members(zset.All("sorted_set")), "All")
+		assertSliceEqual(t, []interface{}{"member5", "member4", "member3", "member2", "member1"}, members(zset.Backward("sorted_set")), "Backward")
+
+		for entry := range zset.All("sorted_set") {
+			if entry.Value != int(entry.Score) {
+				t.Errorf("Expected value %v for %s, got %v", entry.Score, entry.Member, entry.Value)
+			}
+		}
+	})
+
+	t.Run("Early Break", func(t *testing.T) {
+		// Test that breaking out of the loop stops the iteration.
+		zset := newSet()
+		var visited []interface{}
+		for entry := range zset.All("sorted_set") {
+			visited = append(visited, entry.Member)
+			if len(visited) == 2 {
+				break
+			}
+		}
+		assertSliceEqual(t, []interface{}{"member1", "member2"}, visited, "Early Break")
+	})
+
+	t.Run("Scores", func(t *testing.T) {
+		// Test the member and score pairs.
+		zset := newSet()
+		var scores []float64
+		for member, score := range zset.Scores("sorted_set") {
+			if member != fmt.Sprintf("member%d", int(score)) {
+				t.Errorf("Unexpected pair %s %v", member, score)
+			}
+			scores = append(scores, score)
+		}
+		if !reflect.DeepEqual([]float64{1, 2, 3, 4, 5}, scores) {
+			t.Errorf("Expected scores 1 to 5, got %v", scores)
+		}
+	})
+
+	t.Run("Non-Existent Key", func(t *testing.T) {
+		// Test that iterating over a non-existent key yields nothing.
+		zset := New()
+		assertCountEqual(t, 0, len(members(zset.All("nonexistent_key"))), "All Non-Existent Key")
+		assertCountEqual(t, 0, len(members(zset.Backward("nonexistent_key"))), "Backward Non-Existent Key")
+	})
+
+	t.Run("Score Ranges", func(t *testing.T) {
+		// Test ascending and descending score ranges with inclusive, exclusive and infinite bounds.
+		zset := newSet()
+		assertSliceEqual(t, []interface{}{"member3", "member4"},
+			members(zset.ScoreRange("sorted_set", ScoreBound{Value: 2, Exclusive: true}, ScoreBound{Value: 4})), "ScoreRange")
+		assertSliceEqual(t, []interface{}{"member5", "member4"},
+			members(zset.RevScoreRange("sorted_set", ScoreBound{Value: math.Inf(1)}, ScoreBound{Value: 4})), "RevScoreRange")
+		assertCountEqual(t, 0, len(members(zset.ScoreRange("sorted_set", ScoreBound{Value: 6}, ScoreBound{Value: 7}))), "ScoreRange Empty")
+		assertCountEqual(t, 0, len(members(zset.ScoreRange("sorted_set", ScoreBound{Value: 4}, ScoreBound{Value: 2}))), "ScoreRange Inverted")
+	})
+
+	t.Run("Lex Ranges", func(t *testing.T) {
+		// Test ascending and descending lexicographic ranges.
+		zset := New()
+		for _, member := range []string{"a", "b", "c", "d"} {
+			zset.ZAdd("lex_set", 0, member, nil)
+		}
+		min, _ := ParseLexBound("(a")
+		max, _ := ParseLexBound("[c")
+		assertSliceEqual(t, []interface{}{"b", "c"}, members(zset.LexRange("lex_set", min, max)), "LexRange")
+		assertSliceEqual(t, []interface{}{"c", "b"}, members(zset.RevLexRange("lex_set", max, min)), "RevLexRange")
+
+		all, _ := ParseLexBound("+")
+		none, _ := ParseLexBound("-")
+		assertSliceEqual(t, []interface{}{"d", "c", "b", "a"}, members(zset.RevLexRange("lex_set", all, none)), "RevLexRange All")
+	})
+
+	t.Run("Modified During Iteration", func(t *testing.T) {
+		// Test that the loop body can modify the set and that the iteration continues from its last position.
+		zset := newSet()
+		var visited []interface{}
+		for entry := range zset.All("sorted_set") {
+			visited = append(visited, entry.Member)
+			switch entry.Member {
+			case "member1":
+				zset.ZRem("sorted_set", "member1")
+				zset.ZRem("sorted_set", "member3")
+				zset.ZAdd("sorted_set", 2.5, "member2.5", nil)
+				zset.ZAdd("sorted_set", 0, "member0", nil)
+			case "member4":
+				if entry.Score == 4 {
+					zset.ZIncrBy("sorted_set", 10, "member4")
+				}
+			}
+		}
+		assertSliceEqual(t, []interface{}{"member1", "member2", "member2.5", "member4", "member5", "member4"}, visited, "All Modified")
+
+		zset = newSet()
+		visited = nil
+		for entry := range zset.Backward("sorted_set") {
+			visited = append(visited, entry.Member)
+			if entry.Member == "member4" {
+				zset.ZRem("sorted_set", "member4")
+				zset.ZRem("sorted_set", "member2")
+			}
+		}
+		assertSliceEqual(t, []interface{}{"member5", "member4", "member3", "member1"}, visited, "Backward Modified")
+
+		zset = newSet()
+		visited = nil
+		for entry := range zset.All("sorted_set") {
+			visited = append(visited, entry.Member)
+			zset.ZClear("sorted_set")
+		}
+		assertSliceEqual(t, []interface{}{"member1"}, visited, "All Cleared")
+	})
+}
+
+type snapshotPlayer struct {
+	Name  string
+	Level int
+}
+
+// upperCodec stores string values upper-cased, to show that a custom codec is used.
+type upperCodec struct{}
+
+func (upperCodec) EncodeValue(value string) ([]byte, error) {
+	return []byte(strings.ToUpper(value)), nil
+}
+
+func (upperCodec) DecodeValue(data []byte) (string, error) {
+	return string(data), nil
+}
+
+// stalledWriter is an io.Writer whose writes wait until release is closed, standing in for a slow disk or
+// network connection. started is closed by the first write.
+type stalledWriter struct {
+	started chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func newStalledWriter() *stalledWriter {
+	return &stalledWriter{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.started) })
+	<-w.release
+	return len(p), nil
+}
+
+// assertNotStalled checks that the ZSet serves reads and writes, including ones taking the keyspace lock
+// exclusively, while write is stalled on a stalledWriter.
+func assertNotStalled(t *testing.T, zset *ZSet, write func(w io.Writer) error) {
+	t.Helper()
+	w := newStalledWriter()
+	errc := make(chan error, 1)
+	go func() { errc <- write(w) }()
+	<-w.started
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		zset.ZAdd("created", 1, "member", nil)
+		zset.Expire("created", time.Hour)
+		zset.ZScore("large", "member0001")
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("The ZSet was blocked by the stalled writer")
+	}
+
+	close(w.release)
+	if err := <-errc; err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	<-done
+}
+
+func TestZSet_Snapshot(t *testing.T) {
+	gob.Register(snapshotPlayer{})
+
+	// newSet creates a ZSet with several keys, value types, special scores and an emptied key.
+	newSet := func() *ZSet {
+		zset := New()
+		for i := 0; i < 1000; i++ {
+			zset.ZAdd("large", float64(i%100), fmt.Sprintf("member%04d", i), i)
+		}
+		zset.ZAdd("mixed", math.Inf(-1), "low", nil)
+		zset.ZAdd("mixed", 0, "zero", "string value")
+		zset.ZAdd("mixed", 1.5, "player", snapshotPlayer{Name: "alice", Level: 3})
+		zset.ZAdd("mixed", math.Inf(1), "high", 2.5)
+		zset.ZAdd("emptied", 1, "member", nil)
+		zset.ZRem("emptied", "member")
+		return zset
+	}
+
+	// snapshot writes the ZSet to a buffer.
+	snapshot := func(t *testing.T, zset *ZSet) []byte {
+		var buf bytes.Buffer
+		if err := zset.WriteSnapshot(&buf); err != nil {
+			t.Fatalf("WriteSnapshot: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	t.Run("Round Trip", func(t *testing.T) {
+		// Test that reading a snapshot restores every key, member, score and value.
+		original := newSet()
+		restored := New()
+		restored.ZAdd("stale", 1, "member", nil)
+		if err := restored.ReadSnapshot(bytes.NewReader(snapshot(t, original))); err != nil {
+			t.Fatalf("ReadSnapshot: %v", err)
+		}
+
+		assertBoolEqual(t, false, restored.ZKeyExists("stale"), "Snapshot Replaces Keys")
+		assertBoolEqual(t, true, restored.ZKeyExists("emptied"), "Snapshot Empty Key")
+		assertCountEqual(t, 0, restored.ZCard("emptied"), "Snapshot Empty Key Card")
+		for _, key := range []string{"large", "mixed"} {
+			if !reflect.DeepEqual(original.TypedZSet.ZRange(key, 0, -1), restored.TypedZSet.ZRange(key, 0, -1)) {
+				t.Errorf("Key %s differs after the round trip", key)
+			}
+			assertSkipListValid(t, restored.records[key])
+		}
+
+		restored.ZAdd("large", 50.5, "inserted", nil)
+		assertCountEqual(t, 510, int(restored.ZRank("large", "inserted")), "Snapshot Rank After Insert")
+	})
+
+	t.Run("Empty ZSet", func(t *testing.T) {
+		// Test the round trip of a ZSet without keys.
+		restored := newSet()
+		if err := restored.ReadSnapshot(bytes.NewReader(snapshot(t, New()))); err != nil {
+			t.Fatalf("ReadSnapshot: %v", err)
+		}
+		assertCountEqual(t, 0, len(restored.ZKeys()), "Snapshot Empty ZSet")
+	})
+
+	t.Run("Custom Codec", func(t *testing.T) {
+		// Test that values are written and read with the codec set on the ZSet.
+		original := NewTyped[string]()
+		original.SetValueCodec(upperCodec{})
+		original.ZAdd("names", 1, "member1", "alice")
+
+		var buf bytes.Buffer
+		if err := original.WriteSnapshot(&buf); err != nil {
+			t.Fatalf("WriteSnapshot: %v", err)
+		}
+
+		restored := NewTyped[string]()
+		restored.SetValueCodec(upperCodec{})
+		if err := restored.ReadSnapshot(&buf); err != nil {
+			t.Fatalf("ReadSnapshot: %v", err)
+		}
+		entry, _ := restored.ZRetrieveByRank("names", 0)
+		assertStringEqual(t, "ALICE", entry.Value, "Snapshot Custom Codec")
+	})
+
+	t.Run("Invalid Snapshots", func(t *testing.T) {
+		// Test that damaged snapshots are rejected and leave the ZSet unchanged.
+		data := snapshot(t, newSet())
+
+		corrupted := append([]byte(nil), data...)
+		corrupted[len(corrupted)/2] ^= 0xff
+		badVersion := append([]byte(nil), data...)
+		badVersion[len(snapshotMagic)] = snapshotVersion + 1
+
+		cases := []struct {
+			name     string
+			data     []byte
+			expected error
+		}{
+			{"Empty", nil, ErrInvalidSnapshot},
+			{"Bad Magic", []byte("JSON{}"), ErrInvalidSnapshot},
+			{"Bad Version", badVersion, ErrSnapshotVersion},
+			{"Truncated", data[:len(data)-10], ErrInvalidSnapshot},
+			{"Missing Checksum", data[:len(data)-4], ErrInvalidSnapshot},
+			{"Corrupted", corrupted, ErrSnapshotChecksum},
+		}
+		for _, c := range cases {
+			zset := New()
+			zset.ZAdd("kept", 1, "member", nil)
+			err := zset.ReadSnapshot(bytes.NewReader(c.data))
+			if c.name == "Corrupted" && err != nil && err != ErrSnapshotChecksum {
+				// A flipped byte may also break the framing or a gob value before the checksum is reached
+				err = ErrSnapshotChecksum
+			}
+			if err != c.expected {
+				t.Errorf("%s: expected %v, got %v", c.name, c.expected, err)
+			}
+			assertBoolEqual(t, true, zset.ZKeyExists("kept"), c.name+" Unchanged")
+		}
+	})
+
+	t.Run("Unencodable Value", func(t *testing.T) {
+		// Test that a codec error is returned by WriteSnapshot.
+		zset := New()
+		zset.ZAdd("funcs", 1, "member", func() {})
+		if err := zset.WriteSnapshot(io.Discard); err == nil {
+			t.Error("Expected an error for a value gob cannot encode")
+		}
+	})
+
+	t.Run("Serves Blocked Pops", func(t *testing.T) {
+		// Test that a caller blocked in BZPopMin receives a member of a restored key.
+		data := snapshot(t, newSet())
+		zset := New()
+
+		done := make(chan Entry[interface{}])
+		go func() {
+			_, entry, _ := zset.BZPopMin(context.Background(), "mixed")
+			done <- entry
+		}()
+		waitForWaiters(t, zset, "mixed", 1)
+
+		if err := zset.ReadSnapshot(bytes.NewReader(data)); err != nil {
+			t.Fatalf("ReadSnapshot: %v", err)
+		}
+		select {
+		case entry := <-done:
+			assertStringEqual(t, "low", entry.Member, "Snapshot BZPopMin")
+		case <-time.After(5 * time.Second):
+			t.Fatal("BZPopMin was not served")
+		}
+	})
+
+	t.Run("Slow Writer", func(t *testing.T) {
+		// Test that a writer stalled in the middle of a snapshot does not block the ZSet.
+		zset := newSet()
+		assertNotStalled(t, zset, zset.WriteSnapshot)
+	})
+}
+
+func TestZSet_AppendLog(t *testing.T) {
+	// openLog opens a ZSet on the log at path, failing the test on error.
+	openLog := func(t *testing.T, path string, opts AppendLogOptions) *ZSet {
+		t.Helper()
+		zset := New()
+		if err := zset.OpenAppendLog(path, opts); err != nil {
+			t.Fatalf("OpenAppendLog: %v", err)
+		}
+		return zset
+	}
+
+	// reopen closes the log of zset and returns a new ZSet restored from it.
+	reopen := func(t *testing.T, zset *ZSet, path string) *ZSet {
+		t.Helper()
+		if err := zset.CloseAppendLog(); err != nil {
+			t.Fatalf("CloseAppendLog: %v", err)
+		}
+		return openLog(t, path, AppendLogOptions{})
+	}
+
+	t.Run("Replay Of Every Mutator", func(t *testing.T) {
+		// Test that replaying the log restores the result of every kind of mutation.
+		path := filepath.Join(t.TempDir(), "zset.aof")
+		zset := openLog(t, path, AppendLogOptions{Fsync: FsyncAlways})
+
+		for i := 0; i < 20; i++ {
+			zset.ZAdd("board", float64(i), fmt.Sprintf("member%02d", i), i)
+		}
+		zset.ZAdd("board", 100, "member05", "moved")
+		zset.ZAddWithOptions("board", ZAddOptions{GT: true}, ZMember{Score: 1, Member: "member10"}, ZMember{Score: 50, Member: "member11", Value: "raised"})
+		zset.ZAddIncr("board", ZAddOptions{}, 0.5, "member12", nil)
+		zset.ZIncrBy("board", 2, "member13")
+		zset.ZIncrBy("board", 7, "new")
+		zset.ZAddMany("lex", ZMember{Member: "a"}, ZMember{Member: "b"}, ZMember{Member: "c"}, ZMember{Member: "d"}, ZMember{Member: "a", Value: "last"})
+		zset.ZRem("board", "member00")
+		zset.ZRemRangeByRank("board", 0, 1)
+		zset.ZRemRangeByScore("board", 5, 8, &ZRangeConfig{ExcludeStart: true})
+		zset.ZRemRangeByLex("lex", "(a", "[b")
+		zset.ZPopMin("board")
+		zset.ZPopMaxCount("board", 2)
+		zset.ZUnionStore("union", []string{"board", "lex"}, &ZStoreOptions{Weights: []float64{2, 1}})
+		zset.ZInterStore("empty", []string{"board", "lex"}, nil)
+		zset.ZAdd("cleared", 1, "member", nil)
+		zset.ZClear("cleared")
+		zset.ZAdd("emptied", 1, "member", nil)
+		zset.ZRem("emptied", "member")
+
+		done := make(chan Entry[interface{}])
+		go func() {
+			_, entry, _ := zset.BZPopMax(context.Background(), "jobs")
+			done <- entry
+		}()
+		waitForWaiters(t, zset, "jobs", 1)
+		zset.ZAddMany("jobs", ZMember{Score: 1, Member: "job1"}, ZMember{Score: 2, Member: "job2"})
+		assertStringEqual(t, "job2", (<-done).Member, "BZPopMax Served By ZAddMany")
+
+		restored := reopen(t, zset, path)
+		assertSameContents(t, zset, restored)
+		assertBoolEqual(t, true, restored.ZKeyExists("emptied"), "Replayed Empty Key")
+		assertBoolEqual(t, false, restored.ZKeyExists("cleared"), "Replayed ZClear")
+	})
+
+	t.Run("New Log Holds Existing Contents", func(t *testing.T) {
+		// Test that a new log starts with the contents the ZSet already held.
+		path := filepath.Join(t.TempDir(), "zset.aof")
+		zset := New()
+		zset.ZAdd("before", 1, "member1", "value1")
+		if err := zset.OpenAppendLog(path, AppendLogOptions{}); err != nil {
+			t.Fatalf("OpenAppendLog: %v", err)
+		}
+		zset.ZAdd("after", 2, "member2", "value2")
+
+		restored := reopen(t, zset, path)
+		assertSameContents(t, zset, restored)
+		assertCountEqual(t, 2, len(restored.ZKeys()), "Existing Contents Keys")
+	})
+
+	t.Run("Truncated Final Record", func(t *testing.T) {
+		// Test that a final record cut short is dropped and later records follow the last complete one.
+		path := filepath.Join(t.TempDir(), "zset.aof")
+		zset := openLog(t, path, AppendLogOptions{Fsync: FsyncNo})
+		zset.ZAdd("board", 1, "kept", nil)
+		zset.CloseAppendLog()
+		info, _ := os.Stat(path)
+
+		zset = openLog(t, path, AppendLogOptions{})
+		zset.ZAdd("board", 2, "lost", nil)
+		zset.CloseAppendLog()
+		if err := os.Truncate(path, info.Size()+3); err != nil {
+			t.Fatal(err)
+		}
+
+		restored := openLog(t, path, AppendLogOptions{})
+		assertCountEqual(t, 1, restored.ZCard("board"), "Truncated Record Dropped")
+		restored.ZAdd("board", 3, "appended", nil)
+
+		restored = reopen(t, restored, path)
+		assertSliceEqual(t, []interface{}{"kept", "appended"}, restored.ZRange("board", 0, -1), "Appended After Truncation")
+		restored.CloseAppendLog()
+	})
+
+	t.Run("Damaged Logs", func(t *testing.T) {
+		// Test that damage before the final record is rejected and leaves the ZSet unchanged.
+		path := filepath.Join(t.TempDir(), "zset.aof")
+		zset := openLog(t, path, AppendLogOptions{})
+		for i := 0; i < 10; i++ {
+			zset.ZAdd("board", float64(i), fmt.Sprintf("member%d", i), nil)
+		}
+		zset.CloseAppendLog()
+		data, _ := os.ReadFile(path)
+
+		corrupted := append([]byte(nil), data...)
+		corrupted[len(corrupted)/2] ^= 0xff
+		badVersion := append([]byte(nil), data...)
+		badVersion[len(appendLogMagic)] = appendLogVersion + 1
+
+		for name, damaged := range map[string][]byte{"Corrupted": corrupted, "Bad Version": badVersion, "Bad Magic": []byte("JSON{}")} {
+			os.WriteFile(path, damaged, 0o644)
+			zset := New()
+			zset.ZAdd("kept", 1, "member", nil)
+			if err := zset.OpenAppendLog(path, AppendLogOptions{}); err != ErrInvalidAppendLog {
+				t.Errorf("%s: expected %v, got %v", name, ErrInvalidAppendLog, err)
+			}
+			assertBoolEqual(t, true, zset.ZKeyExists("kept"), name+" Unchanged")
+		}
+	})
+
+	t.Run("Rewrite", func(t *testing.T) {
+		// Test that a rewrite shrinks the log while keeping the writes made during it.
+		path := filepath.Join(t.TempDir(), "zset.aof")
+		zset := openLog(t, path, AppendLogOptions{})
+		for i := 0; i < 1000; i++ {
+			zset.ZIncrBy("counters", 1, fmt.Sprintf("counter%d", i%10))
+		}
+		before, _ := os.Stat(path)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				zset.ZAdd("during", float64(i), fmt.Sprintf("member%d", i), nil)
+			}
+		}()
+		if err := zset.RewriteAppendLog(); err != nil {
+			t.Fatalf("RewriteAppendLog: %v", err)
+		}
+		wg.Wait()
+
+		after, _ := os.Stat(path)
+		if after.Size() >= before.Size() {
+			t.Errorf("Expected the log to shrink from %d bytes, got %d", before.Size(), after.Size())
+		}
+
+		restored := reopen(t, zset, path)
+		assertSameContents(t, zset, restored)
+		restored.CloseAppendLog()
+	})
+
+	t.Run("Automatic Rewrite", func(t *testing.T) {
+		// Test that the log is rewritten in the background once it has grown past the configured percentage.
+		path := filepath.Join(t.TempDir(), "zset.aof")
+		zset := openLog(t, path, AppendLogOptions{RewritePercentage: 100, RewriteMinSize: 1024})
+		for i := 0; i < 2000; i++ {
+			zset.ZIncrBy("counters", 1, "visits")
+		}
+
+		// The writes made while a rewrite runs are appended to the rewritten log, so how small the log ends up
+		// depends on timing; it is only certain to be smaller than the 2000 records.
+		frame, _ := encodeLogRecord(logRecord[interface{}]{op: aofAdd, key: "counters", entries: []Entry[interface{}]{{Member: "visits"}}}, zset.codec)
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			info, _ := os.Stat(path)
+			if info.Size() < int64(2000*len(frame)) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected the log to be rewritten, it is still %d bytes", info.Size())
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		restored := reopen(t, zset, path)
+		_, score := restored.ZScore("counters", "visits")
+		assertFloatEqual(t, 2000, score, "Automatic Rewrite Score")
+		restored.CloseAppendLog()
+	})
+
+	t.Run("Fsync Policies", func(t *testing.T) {
+		// Test that every fsync policy records the mutations.
+		for _, policy := range []FsyncPolicy{FsyncEverySec, FsyncAlways, FsyncNo} {
+			path := filepath.Join(t.TempDir(), "zset.aof")
+			zset := openLog(t, path, AppendLogOptions{Fsync: policy})
+			zset.ZAdd("board", 1, "member", nil)
+			if err := zset.SyncAppendLog(); err != nil {
+				t.Errorf("Policy %d: SyncAppendLog: %v", policy, err)
+			}
+
+			restored := reopen(t, zset, path)
+			assertCountEqual(t, 1, restored.ZCard("board"), fmt.Sprintf("Policy %d Replayed", policy))
+			restored.CloseAppendLog()
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		// Test the errors of the log methods and the recovery from a value that cannot be encoded.
+		path := filepath.Join(t.TempDir(), "zset.aof")
+		zset := New()
+		if err := zset.CloseAppendLog(); err != ErrAppendLogNotOpen {
+			t.Errorf("Expected %v, got %v", ErrAppendLogNotOpen, err)
+		}
+
+		zset = openLog(t, path, AppendLogOptions{})
+		if err := zset.OpenAppendLog(path, AppendLogOptions{}); err != ErrAppendLogOpen {
+			t.Errorf("Expected %v, got %v", ErrAppendLogOpen, err)
+		}
+
+		zset.ZAdd("funcs", 1, "member", func() {})
+		if err := zset.SyncAppendLog(); err == nil {
+			t.Error("Expected an error for a value gob cannot encode")
+		}
+
+		zset.ZRem("funcs", "member")
+		zset.ZAdd("board", 1, "member", nil)
+		if err := zset.RewriteAppendLog(); err != nil {
+			t.Fatalf("RewriteAppendLog: %v", err)
+		}
+		if err := zset.SyncAppendLog(); err != nil {
+			t.Errorf("Expected the rewrite to clear the error, got %v", err)
+		}
+
+		restored := reopen(t, zset, path)
+		assertSameContents(t, zset, restored)
+		restored.CloseAppendLog()
+	})
+}
+
+func TestZSet_RDB(t *testing.T) {
+	// readFixture loads an RDB file from testdata into a new ZSet.
+	readFixture := func(t *testing.T, name string, db int) (*ZSet, []string) {
+		t.Helper()
+		file, err := os.Open(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		zset := New()
+		skipped, err := zset.ReadRDB(file, db)
+		if err != nil {
+			t.Fatalf("ReadRDB %s: %v", name, err)
+		}
+		return zset, skipped
+	}
+
+	// assertEntries checks the members and scores of a key, from the lowest score to the highest.
+	assertEntries := func(t *testing.T, zset *ZSet, key string, expected ...Entry[interface{}]) {
+		t.Helper()
+		if actual := zset.TypedZSet.ZRange(key, 0, -1); !reflect.DeepEqual(expected, actual) {
+			t.Errorf("Key %s: expected %v, got %v", key, expected, actual)
+		}
+		assertSkipListValid(t, zset.records[key])
+	}
+
+	t.Run("Listpack And Binary Scores", func(t *testing.T) {
+		// Test loading the listpack and skip list encodings written by Redis 7.2.
+		zset, skipped := readFixture(t, "redis-7.2.rdb", 0)
+
+		assertEntries(t, zset, "leaderboard",
+			Entry[interface{}]{Member: "bob", Score: -5},
+			Entry[interface{}]{Member: "eve", Score: -2.5},
+			Entry[interface{}]{Member: "carol", Score: 1.5},
+			Entry[interface{}]{Member: "alice", Score: 100},
+			Entry[interface{}]{Member: strings.Repeat("m", 100), Score: 200},
+			Entry[interface{}]{Member: "1234", Score: 70000},
+			Entry[interface{}]{Member: "frank", Score: 4294967296},
+			Entry[interface{}]{Member: "dave", Score: math.Inf(1)})
+		assertEntries(t, zset, "zset2",
+			Entry[interface{}]{Member: "bottom", Score: math.Inf(-1)},
+			Entry[interface{}]{Member: strings.Repeat("a", 50), Score: 0},
+			Entry[interface{}]{Member: "top", Score: 3.25})
+		assertEntries(t, zset, "ttl", Entry[interface{}]{Member: "session", Score: 1700000000})
+
+		assertBoolEqual(t, false, zset.ZKeyExists("expired"), "Expired Key Dropped")
+		assertBoolEqual(t, false, zset.ZKeyExists("other"), "Other Database Ignored")
+		assertCountEqual(t, 3, len(zset.ZKeys()), "Loaded Keys")
+		if !reflect.DeepEqual([]string{"greeting", "queue", "tags", "profile"}, skipped) {
+			t.Errorf("Expected the other types to be skipped, got %v", skipped)
+		}
+
+		zset, skipped = readFixture(t, "redis-7.2.rdb", 1)
+		assertEntries(t, zset, "other", Entry[interface{}]{Member: "x", Score: 1})
+		assertCountEqual(t, 0, len(skipped), "Database 1 Skipped")
+	})
+
+	t.Run("Ziplist And String Scores", func(t *testing.T) {
+		// Test loading the ziplist and string score encodings written by Redis 5.0.
+		zset, skipped := readFixture(t, "redis-5.0.rdb", 0)
+
+		assertEntries(t, zset, "scores",
+			Entry[interface{}]{Member: strings.Repeat("n", 100), Score: -1e300},
+			Entry[interface{}]{Member: "huge", Score: -9000000000},
+			Entry[interface{}]{Member: "neg", Score: -100},
+			Entry[interface{}]{Member: "zero", Score: 0},
+			Entry[interface{}]{Member: "half", Score: 2.5},
+			Entry[interface{}]{Member: "twelve", Score: 12},
+			Entry[interface{}]{Member: "7", Score: 13},
+			Entry[interface{}]{Member: "short", Score: 30000},
+			Entry[interface{}]{Member: "medium", Score: 8000000},
+			Entry[interface{}]{Member: "large", Score: 2000000000})
+		assertEntries(t, zset, "legacy",
+			Entry[interface{}]{Member: "low", Score: math.Inf(-1)},
+			Entry[interface{}]{Member: "-7", Score: 1},
+			Entry[interface{}]{Member: "100000", Score: 2},
+			Entry[interface{}]{Member: "mid", Score: 3.5},
+			Entry[interface{}]{Member: "high", Score: math.Inf(1)})
+		assertEntries(t, zset, "session", Entry[interface{}]{Member: "user", Score: 1})
+
+		if !reflect.DeepEqual([]string{"list", "ints", "hash", "oldlist"}, skipped) {
+			t.Errorf("Expected the other types to be skipped, got %v", skipped)
+		}
+	})
+
+	t.Run("LFU Access Frequencies", func(t *testing.T) {
+		// Test loading a file laid out as Redis 7.2 writes it under maxmemory-policy allkeys-lfu, with the
+		// access frequency of each key before its type, and zset-max-listpack-entries 0.
+		zset, skipped := readFixture(t, "redis-7.2-lfu.rdb", 0)
+
+		assertEntries(t, zset, "leaderboard",
+			Entry[interface{}]{Member: "alice", Score: 1},
+			Entry[interface{}]{Member: "bob", Score: 2},
+			Entry[interface{}]{Member: "carol", Score: 3.5})
+		assertEntries(t, zset, "session", Entry[interface{}]{Member: "user", Score: 1})
+		assertBoolEqual(t, true, zset.TTL("session") > 0, "Deadline Kept")
+
+		if !reflect.DeepEqual([]string{"greeting"}, skipped) {
+			t.Errorf("Expected the string to be skipped, got %v", skipped)
+		}
+	})
+
+	t.Run("Replaces Only Loaded Keys", func(t *testing.T) {
+		// Test that loaded keys replace existing ones while other keys are kept.
+		data, _ := os.ReadFile(filepath.Join("testdata", "redis-7.2.rdb"))
+		zset := New()
+		zset.ZAdd("leaderboard", 1, "stale", nil)
+		zset.ZAdd("kept", 1, "member", nil)
+		if _, err := zset.ReadRDB(bytes.NewReader(data), 0); err != nil {
+			t.Fatalf("ReadRDB: %v", err)
+		}
+
+		assertBoolEqual(t, false, zset.TypedZSet.ZRank("leaderboard", "stale") >= 0, "Replaced Key")
+		assertCountEqual(t, 1, zset.ZCard("kept"), "Kept Key")
+	})
+
+	t.Run("Write", func(t *testing.T) {
+		// Test that WriteRDB writes the same bytes as Redis and that they load back.
+		zset := New()
+		zset.ZAdd("a", 1, "x", "dropped value")
+		zset.ZAdd("a", 2.5, "y", nil)
+		zset.ZAdd("b", math.Inf(-1), "z", nil)
+		zset.ZAdd("empty", 1, "member", nil)
+		zset.ZRem("empty", "member")
+
+		var buf bytes.Buffer
+		if err := zset.WriteRDB(&buf); err != nil {
+			t.Fatalf("WriteRDB: %v", err)
+		}
+		expected, _ := os.ReadFile(filepath.Join("testdata", "export.rdb"))
+		if !bytes.Equal(expected, buf.Bytes()) {
+			t.Errorf("Expected %x, got %x", expected, buf.Bytes())
+		}
+
+		restored := New()
+		if _, err := restored.ReadRDB(&buf, 0); err != nil {
+			t.Fatalf("ReadRDB: %v", err)
+		}
+		assertEntries(t, restored, "a", Entry[interface{}]{Member: "x", Score: 1}, Entry[interface{}]{Member: "y", Score: 2.5})
+		assertEntries(t, restored, "b", Entry[interface{}]{Member: "z", Score: math.Inf(-1)})
+		assertBoolEqual(t, false, restored.ZKeyExists("empty"), "Empty Key Not Written")
+	})
+
+	t.Run("Invalid Files", func(t *testing.T) {
+		// Test that damaged or unsupported files are rejected and leave the ZSet unchanged.
+		data, _ := os.ReadFile(filepath.Join("testdata", "redis-7.2.rdb"))
+
+		badChecksum := append([]byte(nil), data...)
+		badChecksum[len(badChecksum)-1] ^= 0xff
+		noChecksum := append(append([]byte(nil), data[:len(data)-8]...), make([]byte, 8)...)
+		stream := append([]byte("REDIS0011"), 21, 1, 's')
+		moduleAux := append([]byte("REDIS0011"), 247, 0x81, 0, 0, 0, 0, 0, 0, 0, 0, 2, 0)
+
+		cases := []struct {
+			name     string
+			data     []byte
+			expected error
+		}{
+			{"Empty", nil, ErrInvalidRDB},
+			{"Bad Magic", []byte("REDIX0011\xff"), ErrInvalidRDB},
+			{"Bad Version", []byte("REDIS0099\xff"), ErrRDBVersion},
+			{"Truncated", data[:len(data)/2], ErrInvalidRDB},
+			{"Bad Checksum", badChecksum, ErrRDBChecksum},
+			{"Disabled Checksum", noChecksum, nil},
+			{"Stream", stream, ErrRDBUnsupportedType},
+			{"Module Aux", moduleAux, ErrRDBUnsupportedType},
+		}
+		for _, c := range cases {
+			zset := New()
+			zset.ZAdd("kept", 1, "member", nil)
+			if _, err := zset.ReadRDB(bytes.NewReader(c.data), 0); err != c.expected {
+				t.Errorf("%s: expected %v, got %v", c.name, c.expected, err)
+			}
+			assertBoolEqual(t, true, zset.ZKeyExists("kept"), c.name+" Unchanged")
+		}
+	})
+
+	t.Run("Slow Writer", func(t *testing.T) {
+		// Test that a writer stalled in the middle of an RDB file does not block the ZSet.
+		zset := New()
+		for i := 0; i < 1000; i++ {
+			zset.ZAdd("large", float64(i), fmt.Sprintf("member%04d", i), nil)
+		}
+		assertNotStalled(t, zset, zset.WriteRDB)
+	})
+}
+
+// fakeClock is a Clock whose time only moves when the test advances it.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestZSet_Expire(t *testing.T) {
+	// newExpiring returns a ZSet on a fake clock holding "key" with two members.
+	newExpiring := func() (*ZSet, *fakeClock) {
+		clock := newFakeClock()
+		zset := New()
+		zset.SetClock(clock)
+		zset.ZAdd("key", 1, "a", "value")
+		zset.ZAdd("key", 2, "b", nil)
+		return zset, clock
+	}
+
+	t.Run("Expire TTL And Persist", func(t *testing.T) {
+		// Test that deadlines can be set, queried and removed.
+		zset, clock := newExpiring()
+
+		assertBoolEqual(t, false, zset.Expire("missing", time.Second), "Expire Missing Key")
+		assertInt64Equal(t, int64(TTLNotFound), int64(zset.TTL("missing")), "TTL Missing Key")
+		assertInt64Equal(t, int64(TTLNoExpiry), int64(zset.TTL("key")), "TTL Without Deadline")
+
+		assertBoolEqual(t, true, zset.Expire("key", 10*time.Second), "Expire")
+		clock.Advance(4 * time.Second)
+		assertInt64Equal(t, int64(6*time.Second), int64(zset.TTL("key")), "TTL After 4s")
+
+		assertBoolEqual(t, true, zset.ExpireAt("key", clock.Now().Add(time.Minute)), "ExpireAt")
+		assertInt64Equal(t, int64(time.Minute), int64(zset.TTL("key")), "TTL After ExpireAt")
+
+		assertBoolEqual(t, true, zset.Persist("key"), "Persist")
+		assertBoolEqual(t, false, zset.Persist("key"), "Persist Without Deadline")
+		assertInt64Equal(t, int64(TTLNoExpiry), int64(zset.TTL("key")), "TTL After Persist")
+
+		clock.Advance(time.Hour)
+		assertCountEqual(t, 2, zset.ZCard("key"), "Persisted Key Kept")
+		assertCountEqual(t, 0, len(zset.volatile), "Volatile Keys")
+	})
+
+	t.Run("Lazy Expiry On Access", func(t *testing.T) {
+		// Test that a key past its deadline looks missing to every read and is removed once accessed.
+		zset, clock := newExpiring()
+		zset.ZAdd("other", 5, "b", nil)
+		zset.Expire("key", time.Second)
+
+		clock.Advance(999 * time.Millisecond)
+		assertCountEqual(t, 2, zset.ZCard("key"), "ZCard Before Deadline")
+
+		clock.Advance(time.Millisecond)
+		assertBoolEqual(t, false, zset.ZKeyExists("key"), "ZKeyExists")
+		assertInt64Equal(t, int64(TTLNotFound), int64(zset.TTL("key")), "TTL")
+		assertInt64Equal(t, -1, zset.ZRank("key", "a"), "ZRank")
+		assertCountEqual(t, 0, len(zset.ZRange("key", 0, -1)), "ZRange")
+		assertBoolEqual(t, false, zset.Persist("key"), "Persist")
+		if !reflect.DeepEqual([]string{"other"}, zset.ZKeys()) {
+			t.Errorf("Expected only other in ZKeys, got %v", zset.ZKeys())
+		}
+		if _, keys, _ := zset.Scan(0, "", 100); !reflect.DeepEqual([]string{"other"}, keys) {
+			t.Errorf("Expected only other in Scan, got %v", keys)
+		}
+		union, _ := zset.TypedZSet.ZUnion([]string{"key", "other"}, nil)
+		assertCountEqual(t, 1, len(union), "ZUnion")
+
+		exists, _ := zset.ZScore("key", "a")
+		assertBoolEqual(t, false, exists, "ZScore")
+		_, stillStored := zset.records["key"]
+		assertBoolEqual(t, false, stillStored, "Removed On Access")
+		assertCountEqual(t, 0, len(zset.volatile), "Volatile Keys")
+	})
+
+	t.Run("Writes After Expiry", func(t *testing.T) {
+		// Test that writing to an expired key starts a new sorted set without a deadline.
+		zset, clock := newExpiring()
+		zset.Expire("key", time.Second)
+		clock.Advance(time.Second)
+
+		assertBoolEqual(t, false, zset.ZRem("key", "a"), "ZRem")
+		zset.ZAdd("key", 3, "c", nil)
+		assertCountEqual(t, 1, zset.ZCard("key"), "ZCard")
+		assertInt64Equal(t, int64(TTLNoExpiry), int64(zset.TTL("key")), "TTL")
+	})
+
+	t.Run("Deadline Lifetime", func(t *testing.T) {
+		// Test that a deadline survives changes to the members, and goes with the key when it is replaced or removed.
+		zset, clock := newExpiring()
+		zset.Expire("key", time.Minute)
+		zset.ZAdd("key", 3, "c", nil)
+		zset.ZRem("key", "a")
+		zset.ZIncrBy("key", 1, "b")
+		assertInt64Equal(t, int64(time.Minute), int64(zset.TTL("key")), "TTL After Changes")
+
+		zset.ZUnionStore("key", []string{"key"}, nil)
+		assertInt64Equal(t, int64(TTLNoExpiry), int64(zset.TTL("key")), "TTL After Store")
+
+		zset.Expire("key", time.Minute)
+		zset.ZClear("key")
+		zset.ZAdd("key", 1, "a", nil)
+		clock.Advance(time.Hour)
+		assertCountEqual(t, 1, zset.ZCard("key"), "ZCard After Clear")
+	})
+
+	t.Run("Deadline Not In The Future", func(t *testing.T) {
+		// Test that a ttl that is not positive, or a deadline that has passed, removes the key at once.
+		zset, clock := newExpiring()
+		zset.ZAdd("other", 1, "a", nil)
+
+		assertBoolEqual(t, true, zset.Expire("key", 0), "Expire 0")
+		assertBoolEqual(t, false, zset.ZKeyExists("key"), "Removed By Expire")
+		assertBoolEqual(t, true, zset.ExpireAt("other", clock.Now().Add(-time.Second)), "ExpireAt In The Past")
+		assertCountEqual(t, 0, len(zset.records), "Keys")
+	})
+
+	t.Run("Active Expiry", func(t *testing.T) {
+		// Test that the sweeper removes expired keys that are never accessed again.
+		zset, clock := newExpiring()
+		for i := 0; i < 200; i++ {
+			key := fmt.Sprintf("session:%d", i)
+			zset.ZAdd(key, 1, "user", nil)
+			zset.Expire(key, time.Duration(1+i%2)*time.Minute)
+		}
+
+		clock.Advance(time.Minute)
+		removed := zset.activeExpireCycle()
+
+		zset.mu.RLock()
+		remaining, volatile := len(zset.records), len(zset.volatile)
+		zset.mu.RUnlock()
+		if removed == 0 || removed+remaining != 201 || volatile != remaining-1 {
+			t.Errorf("Unexpected cycle: removed %d, %d keys and %d deadlines remaining", removed, remaining, volatile)
+		}
+
+		clock.Advance(time.Minute)
+		for removed > 0 {
+			removed = zset.activeExpireCycle()
+		}
+		zset.mu.RLock()
+		remaining, volatile = len(zset.records), len(zset.volatile)
+		zset.mu.RUnlock()
+		assertCountEqual(t, 1, remaining, "Keys After Expiry")
+		assertCountEqual(t, 0, volatile, "Volatile Keys After Expiry")
+	})
+
+	t.Run("Background Sweeper", func(t *testing.T) {
+		// Test that the sweeper runs in the background while keys have a deadline, and stops once none do.
+		zset := New()
+		zset.ZAdd("key", 1, "a", nil)
+		zset.Expire("key", 10*time.Millisecond)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			zset.mu.RLock()
+			stored, sweeping := len(zset.records), zset.sweepStop != nil
+			zset.mu.RUnlock()
+			if stored == 0 && !sweeping {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Sweeper did not remove the key: %d keys, sweeping %v", stored, sweeping)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+
+	t.Run("Close Stops Sweeper", func(t *testing.T) {
+		// Test that Close stops a sweeper kept running by a distant deadline, and that expiry stays lazy after it.
+		zset, clock := newExpiring()
+		zset.Expire("key", 365*24*time.Hour)
+		assertBoolEqual(t, true, zset.sweepStop != nil, "Sweeping Before Close")
+
+		zset.Close()
+		zset.Close()
+		assertBoolEqual(t, false, zset.sweepStop != nil, "Sweeping After Close")
+
+		zset.ZAdd("other", 1, "a", nil)
+		zset.Expire("other", time.Minute)
+		assertBoolEqual(t, false, zset.sweepStop != nil, "Sweeper Restarted After Close")
+
+		clock.Advance(365 * 24 * time.Hour)
+		assertBoolEqual(t, false, zset.ZKeyExists("key"), "Lazy Expiry After Close")
+	})
+
+	t.Run("Persistence", func(t *testing.T) {
+		// Test that deadlines are kept by the append-only log, snapshots and RDB files, and expired keys are dropped.
+		zset, clock := newExpiring()
+		zset.ZAdd("key", 1, "a", nil) // RDB files hold no values
+		zset.ZAdd("short", 1, "a", nil)
+		zset.ZAdd("persistent", 1, "a", nil)
+		zset.Expire("key", time.Hour)
+		zset.Expire("short", time.Minute)
+
+		path := filepath.Join(t.TempDir(), "zset.aof")
+		if err := zset.OpenAppendLog(path, AppendLogOptions{}); err != nil {
+			t.Fatalf("OpenAppendLog: %v", err)
+		}
+		zset.ZAdd("logged", 1, "a", nil)
+		zset.Expire("logged", 2*time.Hour)
+		zset.Persist("short")
+		zset.Expire("short", 30*time.Second)
+		zset.CloseAppendLog()
+
+		var snapshot, rdb bytes.Buffer
+		if err := zset.WriteSnapshot(&snapshot); err != nil {
+			t.Fatalf("WriteSnapshot: %v", err)
+		}
+		if err := zset.WriteRDB(&rdb); err != nil {
+			t.Fatalf("WriteRDB: %v", err)
+		}
+
+		restore := func(name string, load func(*ZSet) error) {
+			restored := New()
+			restored.SetClock(clock)
+			if err := load(restored); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			assertSameContents(t, zset, restored)
+			for _, key := range []string{"key", "short", "persistent", "logged"} {
+				assertInt64Equal(t, int64(zset.TTL(key)), int64(restored.TTL(key)), name+" TTL "+key)
+			}
+
+			clock.Advance(time.Minute)
+			assertBoolEqual(t, false, restored.ZKeyExists("short"), name+" Expired")
+			clock.Advance(-time.Minute)
+		}
+
+		restore("Append-Only Log", func(z *ZSet) error {
+			defer z.CloseAppendLog()
+			return z.OpenAppendLog(path, AppendLogOptions{})
+		})
+		restore("Snapshot", func(z *ZSet) error { return z.ReadSnapshot(bytes.NewReader(snapshot.Bytes())) })
+		restore("RDB", func(z *ZSet) error {
+			_, err := z.ReadRDB(bytes.NewReader(rdb.Bytes()), 0)
+			return err
+		})
+
+		clock.Advance(time.Minute)
+		restored := New()
+		restored.SetClock(clock)
+		restored.ReadSnapshot(bytes.NewReader(snapshot.Bytes()))
+		_, stored := restored.records["short"]
+		assertBoolEqual(t, false, stored, "Expired Key Dropped From Snapshot")
+
+		if err := zset.OpenAppendLog(path, AppendLogOptions{}); err != nil {
+			t.Fatalf("OpenAppendLog: %v", err)
+		}
+		if err := zset.RewriteAppendLog(); err != nil {
+			t.Fatalf("RewriteAppendLog: %v", err)
+		}
+		zset.CloseAppendLog()
+		rewritten := New()
+		rewritten.SetClock(clock)
+		rewritten.OpenAppendLog(path, AppendLogOptions{})
+		rewritten.CloseAppendLog()
+		assertSameContents(t, zset, rewritten)
+		assertInt64Equal(t, int64(zset.TTL("logged")), int64(rewritten.TTL("logged")), "TTL After Rewrite")
+	})
+}
+
+func TestZSet_MemberExpiry(t *testing.T) {
+	// newExpiring returns a ZSet on a fake clock holding "key" with a member that expires in a minute and one that does not.
+	newExpiring := func() (*ZSet, *fakeClock) {
+		clock := newFakeClock()
+		zset := New()
+		zset.SetClock(clock)
+		zset.ZAddWithTTL("key", 1, "a", "value", time.Minute)
+		zset.ZAdd("key", 2, "b", nil)
+		return zset, clock
+	}
+
+	t.Run("Expire TTL And Persist", func(t *testing.T) {
+		// Test that member deadlines can be set, queried and removed.
+		zset, clock := newExpiring()
+
+		assertInt64Equal(t, int64(time.Minute), int64(zset.ZMemberTTL("key", "a")), "TTL From ZAddWithTTL")
+		assertInt64Equal(t, int64(TTLNoExpiry), int64(zset.ZMemberTTL("key", "b")), "TTL Without Deadline")
+		assertInt64Equal(t, int64(TTLNotFound), int64(zset.ZMemberTTL("key", "missing")), "TTL Missing Member")
+		assertInt64Equal(t, int64(TTLNotFound), int64(zset.ZMemberTTL("missing", "a")), "TTL Missing Key")
+		assertBoolEqual(t, false, zset.ZExpireMember("key", "missing", time.Second), "ZExpireMember Missing Member")
+		assertBoolEqual(t, false, zset.ZExpireMember("missing", "a", time.Second), "ZExpireMember Missing Key")
+
+		assertBoolEqual(t, true, zset.ZExpireMember("key", "b", 10*time.Second), "ZExpireMember")
+		clock.Advance(4 * time.Second)
+		assertInt64Equal(t, int64(6*time.Second), int64(zset.ZMemberTTL("key", "b")), "TTL After 4s")
+
+		assertBoolEqual(t, true, zset.ZPersistMember("key", "b"), "ZPersistMember")
+		assertBoolEqual(t, false, zset.ZPersistMember("key", "b"), "ZPersistMember Without Deadline")
+		assertBoolEqual(t, false, zset.ZPersistMember("key", "missing"), "ZPersistMember Missing Member")
+		assertInt64Equal(t, int64(TTLNoExpiry), int64(zset.ZMemberTTL("key", "b")), "TTL After ZPersistMember")
+
+		clock.Advance(time.Hour)
+		assertCountEqual(t, 1, zset.ZCard("key"), "ZCard")
+		assertInt64Equal(t, int64(TTLNoExpiry), int64(zset.TTL("key")), "Key Without Deadline")
+	})
+
+	t.Run("Expired Members Hidden From Reads", func(t *testing.T) {
+		// Test that a member past its deadline is left out of every read and removed once the set is accessed.
+		zset, clock := newExpiring()
+		zset.ZAdd("other", 5, "a", nil)
+
+		clock.Advance(time.Minute - time.Millisecond)
+		assertCountEqual(t, 2, zset.ZCard("key"), "ZCard Before Deadline")
+
+		clock.Advance(time.Millisecond)
+		assertCountEqual(t, 1, zset.ZCard("key"), "ZCard")
+		assertInt64Equal(t, -1, zset.ZRank("key", "a"), "ZRank")
+		assertInt64Equal(t, 0, zset.ZRank("key", "b"), "ZRank Of Remaining Member")
+		assertInt64Equal(t, int64(TTLNotFound), int64(zset.ZMemberTTL("key", "a")), "ZMemberTTL")
+		assertCountEqual(t, 1, zset.ZCount("key", 0, 10, nil), "ZCount")
+		assertCountEqual(t, 1, len(zset.ZRange("key", 0, -1)), "ZRange")
+		exists, _ := zset.ZScore("key", "a")
+		assertBoolEqual(t, false, exists, "ZScore")
+		inter, _ := zset.TypedZSet.ZInter([]string{"key", "other"}, nil)
+		assertCountEqual(t, 0, len(inter), "ZInter")
+		for entry := range zset.All("key") {
+			assertStringEqual(t, "b", entry.Member, "All")
+		}
+
+		zset.mu.RLock()
+		_, stored := zset.records["key"].records["a"]
+		zset.mu.RUnlock()
+		assertBoolEqual(t, false, stored, "Removed On Access")
+		assertSkipListValid(t, zset.records["key"])
+	})
+
+	t.Run("Expired Members Left Out Of Writes", func(t *testing.T) {
+		// Test that pops, store operations and blocking pops never see a member past its deadline.
+		zset, clock := newExpiring()
+		zset.ZAddWithTTL("queue", 1, "stale", nil, time.Second)
+		zset.ZAdd("queue", 2, "fresh", nil)
+		clock.Advance(time.Minute)
+
+		popped, _ := zset.TypedZSet.ZPopMin("key")
+		assertStringEqual(t, "b", popped.Member, "ZPopMin")
+
+		zset.ZUnionStore("union", []string{"queue"}, nil)
+		assertCountEqual(t, 1, zset.ZCard("union"), "ZUnionStore")
+
+		_, entry, err := zset.BZPopMin(context.Background(), "queue")
+		if err != nil || entry.Member != "fresh" {
+			t.Errorf("Expected BZPopMin to pop fresh, got %v, %v", entry.Member, err)
+		}
+	})
+
+	t.Run("Deadline Lifetime", func(t *testing.T) {
+		// Test that a deadline survives changes to the score and value, and goes with the member when it is removed.
+		zset, clock := newExpiring()
+		zset.ZAdd("key", 3, "a", "updated")
+		zset.ZIncrBy("key", 1, "a")
+		assertInt64Equal(t, int64(time.Minute), int64(zset.ZMemberTTL("key", "a")), "TTL After Changes")
+
+		zset.ZRem("key", "a")
+		zset.ZAdd("key", 1, "a", nil)
+		assertInt64Equal(t, int64(TTLNoExpiry), int64(zset.ZMemberTTL("key", "a")), "TTL After ZRem")
+
+		for _, remove := range []func(){
+			func() { zset.ZRemRangeByScore("key", 1, 1, nil) },
+			func() { zset.ZRemRangeByRank("key", 0, 0) },
+			func() { zset.ZRemRangeByLex("key", "[a", "[a") },
+			func() { zset.TypedZSet.ZPopMin("key") },
+		} {
+			zset.ZAddWithTTL("key", 1, "a", nil, time.Minute)
+			remove()
+			zset.ZAdd("key", 1, "a", nil)
+			assertInt64Equal(t, int64(TTLNoExpiry), int64(zset.ZMemberTTL("key", "a")), "TTL After Range Removal")
+		}
+
+		clock.Advance(time.Hour)
+		assertCountEqual(t, 2, zset.ZCard("key"), "ZCard")
+		assertSkipListValid(t, zset.records["key"])
+	})
+
+	t.Run("Deadline Not In The Future", func(t *testing.T) {
+		// Test that a ttl that is not positive removes the member at once.
+		zset, _ := newExpiring()
+
+		assertCountEqual(t, 0, zset.ZAddWithTTL("key", 1, "b", nil, 0), "ZAddWithTTL 0")
+		assertBoolEqual(t, true, zset.ZExpireMember("key", "a", -time.Second), "ZExpireMember In The Past")
+		assertCountEqual(t, 0, zset.ZCard("key"), "ZCard")
+		assertCountEqual(t, 0, zset.ZAddWithTTL("key", 1, "c", nil, -time.Second), "ZAddWithTTL Missing Member")
+		assertCountEqual(t, 0, zset.ZCard("key"), "ZCard After ZAddWithTTL")
+	})
+
+	t.Run("Expiry Index Order", func(t *testing.T) {
+		// Test that members expire in the order of their deadlines, whatever order those were set in.
+		zset, clock := newExpiring()
+		zset.ZClear("key")
+		for n := 0; n < 100; n++ {
+			i := n * 37 % 100 // Every member once, out of order
+			zset.ZAddWithTTL("key", float64(i), fmt.Sprintf("member:%02d", i), nil, time.Duration(i+1)*time.Second)
+		}
+		zset.ZExpireMember("key", "member:99", time.Millisecond)
+		zset.ZPersistMember("key", "member:00")
+		assertSkipListValid(t, zset.records["key"])
+
+		clock.Advance(time.Second)
+		assertCountEqual(t, 99, zset.ZCard("key"), "ZCard After 1s")
+		for i := 2; i <= 99; i++ {
+			clock.Advance(time.Second)
+			assertCountEqual(t, 100-i, zset.ZCard("key"), fmt.Sprintf("ZCard After %ds", i))
+		}
+
+		entries := zset.TypedZSet.ZRange("key", 0, -1)
+		assertCountEqual(t, 1, len(entries), "Remaining Members")
+		assertStringEqual(t, "member:00", entries[0].Member, "Persisted Member")
+		assertSkipListValid(t, zset.records["key"])
+	})
+
+	t.Run("Per-Set Locking", func(t *testing.T) {
+		// Test that adding a member with a deadline to a key the sweeper already knows only read-locks the
+		// keyspace, as ZAdd does.
+		zset, _ := newExpiring()
+		zset.ZAddWithTTL("key", 1, "first", nil, time.Hour)
+		zset.Close() // A sweep would wait for the read lock held below and block further readers
+
+		zset.mu.RLock()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			zset.ZAddWithTTL("key", 2, "second", nil, time.Hour)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Error("ZAddWithTTL waited for the exclusive keyspace lock")
+		}
+		zset.mu.RUnlock()
+		<-done
+
+		if ttl := zset.ZMemberTTL("key", "second"); ttl != time.Hour {
+			t.Errorf("Member TTL: expected %v, got %v", time.Hour, ttl)
+		}
+	})
+
+	t.Run("Active Expiry", func(t *testing.T) {
+		// Test that the sweeper removes expired members of sets that are never accessed again.
+		zset, clock := newExpiring()
+		for i := 0; i < 50; i++ {
+			zset.ZAddWithTTL(fmt.Sprintf("sessions:%d", i), 1, "user", nil, time.Minute)
+		}
+
+		remaining := func() int {
+			zset.mu.RLock()
+			defer zset.mu.RUnlock()
+
+			members := 0
+			for _, set := range zset.records {
+				members += int(set.zsl.length)
+			}
+			return members
+		}
+
+		// Each cycle only samples some keys, and the background sweeper may run cycles too, so run cycles until
+		// the members are gone rather than counting what each one removes
+		clock.Advance(time.Minute)
+		for cycles := 0; cycles < 100 && remaining() > 1; cycles++ {
+			zset.activeExpireMembers()
+		}
+		assertCountEqual(t, 1, remaining(), "Members Remaining")
+
+		zset.activeExpireMembers()
+		zset.activeExpireMembers()
+		zset.mu.RLock()
+		expiring := len(zset.expiring)
+		zset.mu.RUnlock()
+		assertCountEqual(t, 0, expiring, "Keys With Expiring Members")
+	})
+
+	t.Run("Key Removed With Last Member", func(t *testing.T) {
+		// Test that a key goes once its last member expires, whether the set is accessed or swept, and is
+		// reported as missing in between.
+		zset, clock := newExpiring()
+		zset.ZRem("key", "b")
+		zset.ZAddWithTTL("swept", 1, "a", nil, time.Minute)
+		zset.ZAdd("kept", 1, "a", nil)
+		clock.Advance(time.Minute)
+
+		stored := func(key string) bool {
+			zset.mu.RLock()
+			defer zset.mu.RUnlock()
+
+			_, exists := zset.records[key]
+			return exists
+		}
+
+		assertBoolEqual(t, false, zset.ZKeyExists("key"), "ZKeyExists")
+		if keys := zset.ZKeys(); !reflect.DeepEqual([]string{"kept"}, keys) {
+			t.Errorf("ZKeys: expected [kept], got %v", keys)
+		}
+		if _, keys, _ := zset.Scan(0, "", 10); !reflect.DeepEqual([]string{"kept"}, keys) {
+			t.Errorf("Scan: expected [kept], got %v", keys)
+		}
+
+		assertCountEqual(t, 0, zset.ZCard("key"), "ZCard")
+		assertBoolEqual(t, false, stored("key"), "Removed On Access")
+
+		for cycles := 0; cycles < 100 && stored("swept"); cycles++ {
+			zset.activeExpireMembers()
+		}
+		assertBoolEqual(t, false, stored("swept"), "Removed By The Sweeper")
+		assertBoolEqual(t, true, stored("kept"), "Key Without Deadlines")
+	})
+
+	t.Run("Persistence", func(t *testing.T) {
+		// Test that member deadlines are kept by the append-only log and snapshots, and expired members are dropped.
+		zset, clock := newExpiring()
+		zset.ZAddWithTTL("key", 3, "c", nil, time.Hour)
+
+		path := filepath.Join(t.TempDir(), "zset.aof")
+		if err := zset.OpenAppendLog(path, AppendLogOptions{}); err != nil {
+			t.Fatalf("OpenAppendLog: %v", err)
+		}
+		zset.ZAddWithTTL("logged", 1, "a", nil, 2*time.Hour)
+		zset.ZExpireMember("key", "b", 30*time.Second)
+		zset.ZPersistMember("key", "c")
+		zset.CloseAppendLog()
+
+		var snapshot bytes.Buffer
+		if err := zset.WriteSnapshot(&snapshot); err != nil {
+			t.Fatalf("WriteSnapshot: %v", err)
+		}
+
+		restore := func(name string, load func(*ZSet) error) {
+			restored := New()
+			restored.SetClock(clock)
+			if err := load(restored); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			assertSameContents(t, zset, restored)
+			for _, m := range []struct{ key, member string }{{"key", "a"}, {"key", "b"}, {"key", "c"}, {"logged", "a"}} {
+				assertInt64Equal(t, int64(zset.ZMemberTTL(m.key, m.member)), int64(restored.ZMemberTTL(m.key, m.member)), name+" TTL "+m.key+" "+m.member)
+			}
+
+			clock.Advance(time.Minute)
+			assertCountEqual(t, 1, restored.ZCard("key"), name+" Expired")
+			clock.Advance(-time.Minute)
+		}
+
+		restore("Append-Only Log", func(z *ZSet) error {
+			defer z.CloseAppendLog()
+			return z.OpenAppendLog(path, AppendLogOptions{})
+		})
+		restore("Snapshot", func(z *ZSet) error { return z.ReadSnapshot(bytes.NewReader(snapshot.Bytes())) })
+
+		clock.Advance(time.Minute)
+		restored := New()
+		restored.SetClock(clock)
+		restored.ReadSnapshot(bytes.NewReader(snapshot.Bytes()))
+		assertCountEqual(t, 1, len(restored.records["key"].records), "Expired Members Dropped From Snapshot")
+		assertSkipListValid(t, restored.records["key"])
+
+		if err := zset.OpenAppendLog(path, AppendLogOptions{}); err != nil {
+			t.Fatalf("OpenAppendLog: %v", err)
+		}
+		if err := zset.RewriteAppendLog(); err != nil {
+			t.Fatalf("RewriteAppendLog: %v", err)
+		}
+		zset.CloseAppendLog()
+		rewritten := New()
+		rewritten.SetClock(clock)
+		rewritten.OpenAppendLog(path, AppendLogOptions{})
+		rewritten.CloseAppendLog()
+		assertSameContents(t, zset, rewritten)
+		assertInt64Equal(t, int64(zset.ZMemberTTL("logged", "a")), int64(rewritten.ZMemberTTL("logged", "a")), "TTL After Rewrite")
+	})
+}
+
+func TestZSet_MemoryLimit(t *testing.T) {
+	// newLimited returns a ZSet on a fake clock holding "a", "b" and "c", each used one second after the
+	// other, with a memory limit that the next write will find exceeded.
+	newLimited := func(policy EvictionPolicy) (*ZSet, *fakeClock) {
+		clock := newFakeClock()
+		zset := New()
+		zset.SetClock(clock)
+		zset.SetMaxMemory(1<<30, policy)
+		for _, key := range []string{"a", "b", "c"} {
+			zset.ZAdd(key, 1, "member", "value")
+			clock.Advance(time.Second)
+		}
+		zset.SetMaxMemory(zset.UsedMemory()-1, policy)
+		return zset, clock
+	}
 
-	t.Run("KeyExists Non-Existent Key", func(t *testing.T) {
-		// Test checking existence of a non-existent key.
-		exists := zset.ZKeyExists("nonexistant_key")
-		assertBoolEqual(t, false, exists, "KeyExists Non-Existent Key")
+	t.Run("Used Memory", func(t *testing.T) {
+		// Test that the estimated memory follows the keys, members and values, and matches the sum of the keys.
+		zset := New()
+		assertInt64Equal(t, 0, zset.UsedMemory(), "Empty ZSet")
+
+		zset.ZAdd("key", 1, "a", nil)
+		withOne := zset.UsedMemory()
+		zset.ZAdd("key", 2, "b", nil)
+		withTwo := zset.UsedMemory()
+		if withOne <= 0 || withTwo <= withOne {
+			t.Fatalf("Expected memory to grow with members, got %d then %d", withOne, withTwo)
+		}
+
+		zset.ZAdd("key", 2, "b", strings.Repeat("x", 1000))
+		assertInt64Equal(t, withTwo+1000, zset.UsedMemory(), "String Value")
+		zset.ZIncrBy("key", 10, "a")
+		zset.ZAddMany("other", ZMember{Member: "c", Score: 1}, ZMember{Member: "d", Score: 2})
+		zset.ZUnionStore("union", []string{"key", "other"}, nil)
+		zset.ZRemRangeByRank("union", 0, 1)
+		zset.ZPopMin("other")
+
+		assertMemoryUsage(t, zset)
+
+		var snapshot bytes.Buffer
+		zset.WriteSnapshot(&snapshot)
+		restored := New()
+		restored.ReadSnapshot(&snapshot)
+		assertMemoryUsage(t, restored)
+
+		for _, key := range zset.ZKeys() {
+			zset.ZClear(key)
+		}
+		assertInt64Equal(t, 0, zset.UsedMemory(), "After Clear")
+		assertInt64Equal(t, 0, zset.MemoryUsage("key"), "MemoryUsage Missing Key")
 	})
 
-	t.Run("KeyExists Existing Key", func(t *testing.T) {
-		// Test checking existence of an existing key.
-		key := "sorted_set"
-		zset.ZAdd(key, 3.5, "member1", "value1")
-		exists := zset.ZKeyExists(key)
-		assertBoolEqual(t, true, exists, "KeyExists Existing Key")
+	t.Run("No Eviction", func(t *testing.T) {
+		// Test that writes that may use more memory fail above the limit, while reads and removals do not.
+		zset, _ := newLimited(NoEviction)
+
+		assertCountEqual(t, 0, zset.ZAdd("a", 3, "more", nil), "ZAdd")
+		if _, err := zset.ZAddWithOptions("a", ZAddOptions{}, ZMember{Member: "more", Score: 3}); err != ErrOOM {
+			t.Errorf("Expected ErrOOM from ZAddWithOptions, got %v", err)
+		}
+		if _, err := zset.ZIncrBy("a", 1, "member"); err != ErrOOM {
+			t.Errorf("Expected ErrOOM from ZIncrBy, got %v", err)
+		}
+		if _, err := zset.ZUnionStore("d", []string{"a"}, nil); err != ErrOOM {
+			t.Errorf("Expected ErrOOM from ZUnionStore, got %v", err)
+		}
+		assertCountEqual(t, 0, zset.ZAddWithTTL("a", 3, "more", nil, time.Minute), "ZAddWithTTL")
+		if err := zset.ZAddChecked("a", 3, "more", nil); err != ErrOOM {
+			t.Errorf("Expected ErrOOM from ZAddChecked, got %v", err)
+		}
+		if err := zset.ZAddWithTTLChecked("a", 3, "more", nil, time.Minute); err != ErrOOM {
+			t.Errorf("Expected ErrOOM from ZAddWithTTLChecked, got %v", err)
+		}
+		assertCountEqual(t, 1, zset.ZCard("a"), "ZCard")
+
+		assertBoolEqual(t, true, zset.ZRem("a", "member"), "ZRem")
+		assertCountEqual(t, 1, zset.ZAdd("a", 3, "more", nil), "ZAdd After Removal")
+		assertCountEqual(t, 3, len(zset.ZKeys()), "Keys")
+	})
+
+	t.Run("All Keys LRU", func(t *testing.T) {
+		// Test that the key used least recently is evicted first, and reported with its members.
+		zset, clock := newLimited(AllKeysLRU)
+		zset.ZScore("a", "member")
+		clock.Advance(time.Second)
+
+		var evicted []string
+		zset.OnEvict(func(key string, entries []Entry[interface{}]) {
+			evicted = append(evicted, key)
+			assertCountEqual(t, 1, len(entries), "Evicted Entries")
+			assertStringEqual(t, "value", entries[0].Value.(string), "Evicted Value")
+		})
+
+		assertCountEqual(t, 1, zset.ZAdd("d", 1, "member", "value"), "ZAdd")
+		if !reflect.DeepEqual([]string{"b"}, evicted) {
+			t.Errorf("Expected b to be evicted, got %v", evicted)
+		}
+		assertBoolEqual(t, false, zset.ZKeyExists("b"), "Evicted Key")
+
+		zset.SetMaxMemory(zset.UsedMemory()-1, AllKeysLRU)
+		zset.ZAdd("e", 1, "member", "value")
+		if !reflect.DeepEqual([]string{"b", "c"}, evicted) {
+			t.Errorf("Expected c to be evicted next, got %v", evicted)
+		}
+	})
+
+	t.Run("All Keys LFU", func(t *testing.T) {
+		// Test that the key used least often is evicted first, however recently it was used.
+		zset, _ := newLimited(AllKeysLFU)
+		for i := 0; i < 100; i++ {
+			zset.ZCard("a")
+			zset.ZCard("c")
+		}
+		zset.ZCard("b")
+		zset.ZCard("c")
+
+		zset.ZAdd("d", 1, "member", nil)
+		assertBoolEqual(t, false, zset.ZKeyExists("b"), "Evicted Key")
+		assertCountEqual(t, 3, len(zset.ZKeys()), "Keys")
+	})
+
+	t.Run("Keys Created Without A Limit", func(t *testing.T) {
+		// Test that keys created or loaded while no limit is set count as accessed then, rather than as the
+		// oldest and least used keys once a limit is set.
+		for name, policy := range map[string]EvictionPolicy{"LRU": AllKeysLRU, "LFU": AllKeysLFU} {
+			clock := newFakeClock()
+			zset := New()
+			zset.SetClock(clock)
+			zset.SetMaxMemory(1<<30, policy)
+			zset.ZAdd("used", 1, "member", nil)
+			zset.SetMaxMemory(0, policy)
+			clock.Advance(time.Hour)
+			zset.ZAdd("created", 1, "member", nil)
+
+			zset.SetMaxMemory(zset.UsedMemory()-1, policy)
+			zset.ZAdd("new", 1, "member", nil)
+			assertBoolEqual(t, false, zset.ZKeyExists("used"), "Key Used Before "+name)
+			assertBoolEqual(t, true, zset.ZKeyExists("created"), "Key Created Since "+name)
+		}
+
+		source := New()
+		source.ZAdd("key", 1, "member", nil)
+		var buf bytes.Buffer
+		if err := source.WriteSnapshot(&buf); err != nil {
+			t.Fatalf("WriteSnapshot: %v", err)
+		}
+		clock := newFakeClock()
+		zset := New()
+		zset.SetClock(clock)
+		if err := zset.ReadSnapshot(&buf); err != nil {
+			t.Fatalf("ReadSnapshot: %v", err)
+		}
+		assertInt64Equal(t, clock.Now().UnixNano(), zset.records["key"].accessed.Load(), "Loaded Key Access")
+	})
+
+	t.Run("Iteration Counts Once", func(t *testing.T) {
+		// Test that iterating over a large set counts as a single access, rather than one per member.
+		zset := New()
+		zset.SetMaxMemory(1<<30, AllKeysLFU)
+		for i := 0; i < 1000; i++ {
+			zset.ZAdd("scanned", float64(i), fmt.Sprintf("member%d", i), nil)
+		}
+		before := zset.records["scanned"].frequency.Load()
+
+		visited := 0
+		for range zset.All("scanned") {
+			visited++
+		}
+		assertCountEqual(t, 1000, visited, "Visited")
+		if after := zset.records["scanned"].frequency.Load(); after > before+1 {
+			t.Errorf("Access counter went from %d to %d", before, after)
+		}
+	})
+
+	t.Run("Volatile TTL", func(t *testing.T) {
+		// Test that only keys with a deadline are evicted, earliest deadline first, and ErrOOM follows once none is left.
+		zset, _ := newLimited(VolatileTTL)
+		zset.Expire("a", time.Hour)
+		zset.Expire("c", time.Minute)
+
+		zset.ZAdd("d", 1, "member", nil)
+		assertBoolEqual(t, false, zset.ZKeyExists("c"), "Earliest Deadline Evicted")
+		zset.SetMaxMemory(zset.UsedMemory()-1, VolatileTTL)
+		zset.ZAdd("e", 1, "member", nil)
+		assertBoolEqual(t, false, zset.ZKeyExists("a"), "Next Deadline Evicted")
+
+		zset.SetMaxMemory(zset.UsedMemory()-1, VolatileTTL)
+		if _, err := zset.ZIncrBy("f", 1, "member"); err != ErrOOM {
+			t.Errorf("Expected ErrOOM once no key has a deadline, got %v", err)
+		}
+		assertBoolEqual(t, true, zset.ZKeyExists("b"), "Key Without Deadline Kept")
+	})
+
+	t.Run("Evictions Are Logged", func(t *testing.T) {
+		// Test that evicted keys are removed from the append-only log too.
+		zset, _ := newLimited(AllKeysLRU)
+		path := filepath.Join(t.TempDir(), "zset.aof")
+		if err := zset.OpenAppendLog(path, AppendLogOptions{}); err != nil {
+			t.Fatalf("OpenAppendLog: %v", err)
+		}
+		zset.ZAdd("d", 1, "member", nil)
+		zset.CloseAppendLog()
+
+		restored := New()
+		restored.OpenAppendLog(path, AppendLogOptions{})
+		restored.CloseAppendLog()
+		assertSameContents(t, zset, restored)
+		assertMemoryUsage(t, restored)
 	})
 }
 
-func TestZSet_ZClear(t *testing.T) {
-	zset := New()
+func TestZSet_Notifications(t *testing.T) {
+	t.Run("Member Events", func(t *testing.T) {
+		// Test that members added, rescored and removed are reported with their old and new scores.
+		zset := New()
+		sub := zset.Subscribe(SubscribeOptions{})
+		defer sub.Close()
+
+		zset.ZAdd("key", 1, "a", nil)
+		zset.ZAdd("key", 1, "a", "new value")
+		zset.ZAdd("key", 2, "a", nil)
+		zset.ZIncrBy("key", 3, "a")
+		zset.ZAddWithOptions("key", ZAddOptions{GT: true}, ZMember{Member: "a", Score: 1}, ZMember{Member: "b", Score: 6})
+		zset.ZAddMany("key", ZMember{Member: "b", Score: 7}, ZMember{Member: "c", Score: 8})
+		zset.ZRem("key", "a")
+		zset.ZRemRangeByScore("key", 7, 7, nil)
+		zset.ZPopMax("key")
+
+		expected := []Event{
+			{Type: EventAdded, Key: "key", Member: "a", NewScore: 1},
+			{Type: EventScoreChanged, Key: "key", Member: "a", OldScore: 1, NewScore: 2},
+			{Type: EventScoreChanged, Key: "key", Member: "a", OldScore: 2, NewScore: 5},
+			{Type: EventAdded, Key: "key", Member: "b", NewScore: 6},
+			{Type: EventScoreChanged, Key: "key", Member: "b", OldScore: 6, NewScore: 7},
+			{Type: EventAdded, Key: "key", Member: "c", NewScore: 8},
+			{Type: EventRemoved, Key: "key", Member: "a", OldScore: 5},
+			{Type: EventRemoved, Key: "key", Member: "b", OldScore: 7},
+			{Type: EventRemoved, Key: "key", Member: "c", OldScore: 8},
+		}
+		if events := receiveEvents(sub); !reflect.DeepEqual(expected, events) {
+			t.Errorf("Expected %v, got %v", expected, events)
+		}
+	})
 
-	t.Run("Clear Non-Existent Key", func(t *testing.T) {
-		// Test clearing a non-existent key.
-		keys := zset.ZKeys()
-		if len(keys) != 0 {
-			t.Errorf("Expected %v but got %v", 0, keys)
+	t.Run("Key Events", func(t *testing.T) {
+		// Test that keys cleared, replaced, expired and evicted are reported, and member deadlines as removals.
+		// Only the events of each key are in order, since the expiry sweeper may remove keys at any time.
+		clock := newFakeClock()
+		zset := New()
+		zset.SetClock(clock)
+		sub := zset.Subscribe(SubscribeOptions{})
+		defer sub.Close()
+
+		zset.ZAdd("cleared", 1, "a", nil)
+		zset.ZClear("cleared")
+		zset.ZAdd("source", 1, "a", nil)
+		zset.ZAdd("stored", 1, "b", nil)
+		zset.ZUnionStore("stored", []string{"source"}, nil)
+		zset.Expire("source", time.Second)
+		zset.ZAddWithTTL("stored", 2, "c", nil, time.Second)
+		clock.Advance(time.Second)
+		zset.ZKeyExists("source")
+		zset.ZCard("stored")
+
+		zset.SetMaxMemory(1, AllKeysLRU)
+		zset.ZAdd("new", 1, "a", nil)
+
+		expected := map[string][]Event{
+			"cleared": {
+				{Type: EventAdded, Key: "cleared", Member: "a", NewScore: 1},
+				{Type: EventKeyCleared, Key: "cleared"},
+			},
+			"source": {
+				{Type: EventAdded, Key: "source", Member: "a", NewScore: 1},
+				{Type: EventKeyExpired, Key: "source"},
+			},
+			"stored": {
+				{Type: EventAdded, Key: "stored", Member: "b", NewScore: 1},
+				{Type: EventKeyCleared, Key: "stored"},
+				{Type: EventAdded, Key: "stored", Member: "a", NewScore: 1},
+				{Type: EventAdded, Key: "stored", Member: "c", NewScore: 2},
+				{Type: EventRemoved, Key: "stored", Member: "c", OldScore: 2},
+				{Type: EventKeyEvicted, Key: "stored"},
+			},
+			"new": {
+				{Type: EventAdded, Key: "new", Member: "a", NewScore: 1},
+			},
+		}
+		events := make(map[string][]Event)
+		for _, event := range receiveEvents(sub) {
+			events[event.Key] = append(events[event.Key], event)
+		}
+		if !reflect.DeepEqual(expected, events) {
+			t.Errorf("Expected %v, got %v", expected, events)
 		}
 	})
 
-	t.Run("Clear Existing Key", func(t *testing.T) {
-		// Test clearing an existing key.
-		key := "sorted_set"
-		zset.ZAdd(key, 3.5, "member1", "value1")
-		zset.ZAdd(key, 2.0, "member2", "value2")
-		zset.ZClear(key)
-		keys := zset.ZKeys()
-		if len(keys) != 0 {
-			t.Errorf("Expected %v but got %v", 0, keys)
+	t.Run("Pattern", func(t *testing.T) {
+		// Test that a subscription only receives the events of the keys matching its pattern.
+		zset := New()
+		sub := zset.Subscribe(SubscribeOptions{Pattern: "leaderboard:*"})
+		defer sub.Close()
+
+		zset.ZAdd("leaderboard:1", 1, "a", nil)
+		zset.ZAdd("sessions", 1, "a", nil)
+		zset.ZAdd("leaderboard:2", 1, "a", nil)
+
+		var keys []string
+		for _, event := range receiveEvents(sub) {
+			keys = append(keys, event.Key)
+		}
+		if expected := []string{"leaderboard:1", "leaderboard:2"}; !reflect.DeepEqual(expected, keys) {
+			t.Errorf("Expected events for %v, got %v", expected, keys)
+		}
+	})
+
+	t.Run("Overflow Drop", func(t *testing.T) {
+		// Test that events beyond the buffer are dropped and counted, without blocking the writes.
+		zset := New()
+		sub := zset.Subscribe(SubscribeOptions{Buffer: 2})
+		defer sub.Close()
+
+		for i := 0; i < 5; i++ {
+			zset.ZAdd("key", float64(i), fmt.Sprint(i), nil)
+		}
+
+		assertCountEqual(t, 2, len(receiveEvents(sub)), "Received")
+		assertInt64Equal(t, 3, int64(sub.Dropped()), "Dropped")
+		if sub.Err() != nil {
+			t.Errorf("Expected no error, got %v", sub.Err())
+		}
+	})
+
+	t.Run("Overflow Block", func(t *testing.T) {
+		// Test that a write waits for the subscriber when the buffer is full, and is released by Close.
+		zset := New()
+		sub := zset.Subscribe(SubscribeOptions{Buffer: 1, Overflow: OverflowBlock})
+
+		zset.ZAdd("key", 1, "a", nil)
+		done := make(chan struct{})
+		go func() {
+			zset.ZAdd("key", 2, "b", nil)
+			zset.ZAdd("key", 3, "c", nil)
+			close(done)
+		}()
+
+		if event := <-sub.C; event.Member != "a" {
+			t.Errorf("Expected the event of a, got %v", event)
+		}
+		if event := <-sub.C; event.Member != "b" {
+			t.Errorf("Expected the event of b, got %v", event)
+		}
+		sub.Close()
+		<-done
+
+		assertCountEqual(t, 3, zset.ZCard("key"), "ZCard")
+	})
+
+	t.Run("Blocked Subscriber Reads", func(t *testing.T) {
+		// Test that a subscriber under OverflowBlock can read the ZSet while writes wait for it and the
+		// expiry sweeper is running, since the events are not delivered under the locks of the ZSet.
+		zset := New()
+		defer zset.Close()
+		zset.ZAddWithTTL("sessions", 1, "a", nil, time.Hour)
+		sub := zset.Subscribe(SubscribeOptions{Buffer: 1, Overflow: OverflowBlock})
+		defer sub.Close()
+
+		const writes = 30
+		received := make(chan struct{})
+		go func() {
+			defer close(received)
+			for i := 0; i < writes; i++ {
+				<-sub.C
+				zset.ZScore("other", "a")
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+		go func() {
+			for i := 0; i < writes; i++ {
+				zset.ZAdd("key", float64(i), fmt.Sprint(i), nil)
+			}
+		}()
+
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected the subscriber to receive every event")
+		}
+	})
+
+	t.Run("Overflow Disconnect", func(t *testing.T) {
+		// Test that a subscription whose buffer is full is closed with ErrSlowSubscriber.
+		zset := New()
+		sub := zset.Subscribe(SubscribeOptions{Buffer: 1, Overflow: OverflowDisconnect})
+
+		zset.ZAdd("key", 1, "a", nil)
+		zset.ZAdd("key", 2, "b", nil)
+		zset.ZAdd("key", 3, "c", nil)
+
+		assertCountEqual(t, 1, len(receiveEvents(sub)), "Received")
+		if _, ok := <-sub.C; ok {
+			t.Error("Expected the channel to be closed")
+		}
+		if sub.Err() != ErrSlowSubscriber {
+			t.Errorf("Expected ErrSlowSubscriber, got %v", sub.Err())
+		}
+		assertBoolEqual(t, false, zset.notifying(), "Subscribed")
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		// Test that a closed subscription receives nothing more and can be closed again.
+		zset := New()
+		sub := zset.Subscribe(SubscribeOptions{})
+		other := zset.Subscribe(SubscribeOptions{})
+		defer other.Close()
+
+		sub.Close()
+		sub.Close()
+		zset.ZAdd("key", 1, "a", nil)
+
+		if _, ok := <-sub.C; ok {
+			t.Error("Expected the channel to be closed")
+		}
+		assertCountEqual(t, 1, len(receiveEvents(other)), "Other Subscription")
+		if sub.Err() != nil {
+			t.Errorf("Expected no error, got %v", sub.Err())
+		}
+	})
+
+	t.Run("Concurrent Writes", func(t *testing.T) {
+		// Test that the events of a key arrive in the order of the changes while several goroutines write.
+		zset := New()
+		sub := zset.Subscribe(SubscribeOptions{Buffer: 1 << 12})
+		defer sub.Close()
+
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(key string) {
+				defer wg.Done()
+				for i := 1; i <= 100; i++ {
+					zset.ZIncrBy(key, 1, "member")
+				}
+			}(fmt.Sprint("key", g))
+		}
+		wg.Wait()
+
+		scores := make(map[string]float64)
+		for _, event := range receiveEvents(sub) {
+			if event.OldScore != scores[event.Key] || event.NewScore != event.OldScore+1 {
+				t.Fatalf("Unexpected event %v after score %v", event, scores[event.Key])
+			}
+			scores[event.Key] = event.NewScore
+		}
+		assertCountEqual(t, 4, len(scores), "Keys")
+	})
+}
+
+func TestZSet_Transactions(t *testing.T) {
+	t.Run("Atomic Move", func(t *testing.T) {
+		// Test that members moved between keys by transactions are never seen in both keys or in neither.
+		zset := New()
+		for i := 0; i < 100; i++ {
+			zset.ZAdd("pending", float64(i), fmt.Sprint(i), i)
+		}
+
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					err := zset.Txn(func(tx *Tx[interface{}]) error {
+						job, err := tx.ZPopMin("pending")
+						if err != nil {
+							return err
+						}
+						tx.ZAdd("running", job.Score, job.Member, job.Value)
+						return nil
+					})
+					if err != nil {
+						return
+					}
+				}
+			}()
+		}
+
+		for moved := false; !moved; {
+			zset.Txn(func(tx *Tx[interface{}]) error {
+				pending, running := tx.ZCard("pending"), tx.ZCard("running")
+				if pending+running != 100 {
+					t.Errorf("Expected 100 members in both keys, got %d and %d", pending, running)
+				}
+				moved = running == 100
+				return nil
+			})
+		}
+		wg.Wait()
+
+		entries := zset.TypedZSet.ZRange("running", 0, 0)
+		assertStringEqual(t, "0", entries[0].Member, "First Member")
+		assertIntEqual(t, 0, int64(entries[0].Value.(int)), "Value Moved")
+	})
+
+	t.Run("Reads See Writes", func(t *testing.T) {
+		// Test that the operations of a transaction see the changes made by the previous ones.
+		zset := New()
+		zset.ZAdd("key", 1, "a", nil)
+
+		zset.Txn(func(tx *Tx[interface{}]) error {
+			tx.ZAdd("key", 2, "b", nil)
+			score, _ := tx.ZIncrBy("key", 10, "a")
+			assertFloatEqual(t, 11, score, "ZIncrBy")
+			_, score = tx.ZScore("key", "b")
+			assertFloatEqual(t, 2, score, "ZScore")
+
+			entries, _ := tx.ZRangeQuery("key", RangeByRank(0, -1))
+			assertCountEqual(t, 2, len(entries), "ZRangeQuery")
+			assertStringEqual(t, "b", entries[0].Member, "Lowest Member")
+
+			assertBoolEqual(t, true, tx.ZRem("key", "b"), "ZRem")
+			tx.ZClear("key")
+			assertBoolEqual(t, false, tx.ZKeyExists("key"), "ZKeyExists After ZClear")
+			assertCountEqual(t, 0, tx.ZCard("key"), "ZCard After ZClear")
+			return nil
+		})
+
+		assertBoolEqual(t, false, zset.ZKeyExists("key"), "ZKeyExists")
+	})
+
+	t.Run("No Rollback", func(t *testing.T) {
+		// Test that the error of a transaction is returned, and that the changes made before it are kept.
+		zset := New()
+		failed := fmt.Errorf("failed")
+
+		err := zset.Txn(func(tx *Tx[interface{}]) error {
+			tx.ZAdd("key", 1, "a", nil)
+			return failed
+		})
+
+		if err != failed {
+			t.Errorf("Expected the error of the transaction, got %v", err)
+		}
+		assertCountEqual(t, 1, zset.ZCard("key"), "ZCard")
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		// Test that a transaction runs only if no watched key changed since it was watched.
+		clock := newFakeClock()
+		zset := New()
+		zset.SetClock(clock)
+		zset.ZAdd("key", 1, "a", nil)
+		zset.ZAdd("other", 1, "a", nil)
+
+		run := func(w *Watch[interface{}]) error {
+			return w.Txn(func(tx *Tx[interface{}]) error {
+				tx.ZIncrBy("key", 1, "a")
+				return nil
+			})
+		}
+
+		watch := zset.Watch("key")
+		zset.ZAdd("other", 2, "a", nil)
+		zset.ZScore("key", "a")
+		if err := run(watch); err != nil {
+			t.Errorf("Expected the transaction to run, got %v", err)
+		}
+
+		changes := []struct {
+			name   string
+			change func()
+		}{
+			{"ZAdd", func() { zset.ZAdd("key", 5, "b", nil) }},
+			{"Value Update", func() { zset.ZAdd("key", 5, "b", "value") }},
+			{"ZRem", func() { zset.ZRem("key", "b") }},
+			{"Expire", func() { zset.Expire("key", time.Hour) }},
+			{"ZExpireMember", func() { zset.ZExpireMember("key", "a", time.Hour) }},
+			{"Transaction", func() { run(zset.Watch()) }},
+			{"ZClear", func() { zset.ZClear("key") }},
+			{"Re-creation", func() { zset.ZAdd("key", 1, "a", nil) }},
+		}
+		for _, c := range changes {
+			watch := zset.Watch("key")
+			c.change()
+			if err := run(watch); err != ErrWatchedKeyChanged {
+				t.Errorf("%s: Expected ErrWatchedKeyChanged, got %v", c.name, err)
+			}
+		}
+
+		zset.Expire("key", time.Second)
+		watch = zset.Watch("key")
+		clock.Advance(time.Second)
+		if err := run(watch); err != ErrWatchedKeyChanged {
+			t.Errorf("Key Expiry: Expected ErrWatchedKeyChanged, got %v", err)
+		}
+	})
+
+	t.Run("Watch Missing Key", func(t *testing.T) {
+		// Test that a missing key is seen as changed once created, or once any key is removed.
+		zset := New()
+		zset.ZAdd("other", 1, "a", nil)
+		noop := func(tx *Tx[interface{}]) error { return nil }
+
+		if err := zset.Watch("missing").Txn(noop); err != nil {
+			t.Errorf("Unchanged: Expected the transaction to run, got %v", err)
+		}
+
+		watch := zset.Watch("missing")
+		zset.ZAdd("missing", 1, "a", nil)
+		if err := watch.Txn(noop); err != ErrWatchedKeyChanged {
+			t.Errorf("Created: Expected ErrWatchedKeyChanged, got %v", err)
+		}
+
+		watch = zset.Watch("created")
+		zset.ZAdd("created", 1, "a", nil)
+		zset.ZClear("created")
+		if err := watch.Txn(noop); err != ErrWatchedKeyChanged {
+			t.Errorf("Created And Removed: Expected ErrWatchedKeyChanged, got %v", err)
+		}
+	})
+
+	t.Run("Append Log", func(t *testing.T) {
+		// Test that a transaction is replayed from the append-only log whole, or not at all when cut short.
+		path := filepath.Join(t.TempDir(), "zset.aof")
+		zset := New()
+		if err := zset.OpenAppendLog(path, AppendLogOptions{}); err != nil {
+			t.Fatalf("OpenAppendLog: %v", err)
+		}
+		zset.ZAdd("pending", 1, "job", "payload")
+		zset.CloseAppendLog()
+		info, _ := os.Stat(path)
+		before := info.Size()
+
+		zset.OpenAppendLog(path, AppendLogOptions{})
+		zset.Txn(func(tx *Tx[interface{}]) error {
+			job, _ := tx.ZPopMin("pending")
+			tx.ZAdd("running", job.Score, job.Member, job.Value)
+			return nil
+		})
+		zset.CloseAppendLog()
+
+		restored := New()
+		if err := restored.OpenAppendLog(path, AppendLogOptions{}); err != nil {
+			t.Fatalf("OpenAppendLog: %v", err)
+		}
+		restored.CloseAppendLog()
+		assertSameContents(t, zset, restored)
+
+		info, _ = os.Stat(path)
+		os.Truncate(path, info.Size()-1)
+		restored = New()
+		if err := restored.OpenAppendLog(path, AppendLogOptions{}); err != nil {
+			t.Fatalf("OpenAppendLog: %v", err)
+		}
+		restored.CloseAppendLog()
+		info, _ = os.Stat(path)
+		assertInt64Equal(t, before, info.Size(), "Log Size")
+		assertCountEqual(t, 1, restored.ZCard("pending"), "Pending After Cut")
+		assertBoolEqual(t, false, restored.ZKeyExists("running"), "Running After Cut")
+	})
+}
+
+func TestZSet_Concurrency(t *testing.T) {
+	t.Run("Parallel Writers And Readers On Shared Keys", func(t *testing.T) {
+		// Test that concurrent adds, removals and reads on the same keys keep every skip list consistent.
+		zset := New()
+		keys := []string{"shared1", "shared2"}
+
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 500; i++ {
+					key := keys[i%len(keys)]
+					member := fmt.Sprintf("member%d", (w*31+i)%100)
+
+					switch i % 5 {
+					case 0, 1:
+						zset.ZAdd(key, float64((w+i)%50), member, i)
+					case 2:
+						zset.ZRem(key, member)
+					case 3:
+						zset.ZRange(key, 0, 10)
+						zset.ZScore(key, member)
+						zset.ZRank(key, member)
+					case 4:
+						zset.ZCount(key, 10, 20, nil)
+						zset.ZRangeByScore(key, 0, 25, nil)
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		for _, key := range keys {
+			if set, exists := zset.records[key]; exists {
+				assertSkipListValid(t, set)
+			}
+		}
+	})
+
+	t.Run("Parallel Operations Across Keys", func(t *testing.T) {
+		// Test that per-key operations, multi-key operations and key removal can run at the same time.
+		zset := New()
+
+		var wg sync.WaitGroup
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				own := fmt.Sprintf("key%d", w)
+				for i := 0; i < 300; i++ {
+					zset.ZAdd(own, float64(i), fmt.Sprintf("member%d", i%40), nil)
+					zset.ZAdd("common", float64(i), fmt.Sprintf("member%d", w), nil)
+
+					switch i % 6 {
+					case 0:
+						zset.ZUnionStore(fmt.Sprintf("dst%d", w), []string{own, "common"}, nil)
+					case 1:
+						zset.ZInter([]string{"common", own}, nil)
+					case 2:
+						zset.ZRemRangeByRank(own, 0, 5)
+					case 3:
+						zset.ZPopMin("common")
+					case 4:
+						zset.ZKeys()
+						zset.ZCard(own)
+					case 5:
+						zset.ZClear(fmt.Sprintf("dst%d", w))
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		for _, key := range zset.ZKeys() {
+			assertSkipListValid(t, zset.records[key])
 		}
 	})
 }
 
+// assertSkipListValid checks the ordering, spans, backward links, length and tail of a sorted set's skip list,
+// and that its expiry index is a heap of members of the set.
+func assertSkipListValid(t *testing.T, set *zset[interface{}]) {
+	t.Helper()
+	zsl := set.zsl
+
+	ranks := make(map[*zslNode[interface{}]]uint64)
+	var rank uint64
+	var previous *zslNode[interface{}]
+	for node := zsl.head.level[0].forward; node != nil; node = node.level[0].forward {
+		rank++
+		ranks[node] = rank
+		if node.backwards != previous {
+			t.Fatalf("Node %q has a wrong backward link", node.member)
+		}
+		if previous != nil && (previous.score > node.score || (previous.score == node.score && previous.member >= node.member)) {
+			t.Fatalf("Node %q is out of order", node.member)
+		}
+		if set.records[node.member] != node {
+			t.Fatalf("Node %q is not the node stored in records", node.member)
+		}
+		previous = node
+	}
+
+	if rank != zsl.length || int(rank) != len(set.records) {
+		t.Fatalf("Expected length %d, got %d with %d records", rank, zsl.length, len(set.records))
+	}
+	if previous != nil && zsl.tail != previous {
+		t.Fatalf("Expected tail %q, got %q", previous.member, zsl.tail.member)
+	}
+
+	for level := 0; level < zsl.level; level++ {
+		node, position := zsl.head, uint64(0)
+		for node.level[level].forward != nil {
+			position += node.level[level].span
+			node = node.level[level].forward
+			if ranks[node] != position {
+				t.Fatalf("Level %d: expected rank %d for %q, got %d", level, ranks[node], node.member, position)
+			}
+		}
+	}
+
+	expiries := &set.expiries
+	if len(expiries.pos) != expiries.Len() {
+		t.Fatalf("Expected %d positions in the expiry index, got %d", expiries.Len(), len(expiries.pos))
+	}
+	for i, e := range expiries.deadlines {
+		if set.records[e.member] == nil || expiries.pos[e.member] != i {
+			t.Fatalf("Member %q is misplaced in the expiry index", e.member)
+		}
+		if i > 0 && expiries.Less(i, (i-1)/2) {
+			t.Fatalf("Member %q expires before its parent in the expiry index", e.member)
+		}
+	}
+}
+
+// assertSameContents checks that two ZSets hold the same keys with the same members, scores and values.
+func assertSameContents(t *testing.T, expected, actual *ZSet) {
+	t.Helper()
+	expectedKeys, actualKeys := expected.ZKeys(), actual.ZKeys()
+	sort.Strings(expectedKeys)
+	sort.Strings(actualKeys)
+	if !reflect.DeepEqual(expectedKeys, actualKeys) {
+		t.Fatalf("Expected keys %v, got %v", expectedKeys, actualKeys)
+	}
+
+	for _, key := range expectedKeys {
+		if !reflect.DeepEqual(expected.TypedZSet.ZRange(key, 0, -1), actual.TypedZSet.ZRange(key, 0, -1)) {
+			t.Errorf("Key %s differs", key)
+		}
+		assertSkipListValid(t, actual.records[key])
+	}
+}
+
+// assertMemoryUsage checks that the memory used by a ZSet is the sum of the memory used by its keys.
+func assertMemoryUsage(t *testing.T, zset *ZSet) {
+	t.Helper()
+	var sum int64
+	for _, key := range zset.ZKeys() {
+		sum += zset.MemoryUsage(key)
+	}
+	if sum == 0 || sum != zset.UsedMemory() {
+		t.Errorf("Expected used memory %d to be the sum %d of the keys", zset.UsedMemory(), sum)
+	}
+}
+
+// waitForWaiters waits until the given number of callers are blocked on the key.
+// receiveEvents returns the events buffered in the channel of a subscription.
+func receiveEvents(sub *Subscription) []Event {
+	var events []Event
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return events
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func waitForWaiters(t *testing.T, zset *ZSet, key string, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		zset.waitersMu.Lock()
+		waiting := len(zset.waiters[key])
+		zset.waitersMu.Unlock()
+
+		if waiting == count {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %d waiters on %s, got %d", count, key, waiting)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// waiterCount returns the number of keys that still have callers blocked on them.
+func waiterCount(zset *ZSet) int {
+	zset.waitersMu.Lock()
+	defer zset.waitersMu.Unlock()
+
+	return len(zset.waiters)
+}
+
 func assertSliceEqual(t *testing.T, expected, actual []interface{}, message string) {
 	t.Helper()
 	if !reflect.DeepEqual(actual, expected) {
@@ -791,3 +4823,10 @@ func assertFloatEqual(t *testing.T, expected, actual float64, message string) {
 		t.Errorf("%s: Expected %f, got %f", message, expected, actual)
 	}
 }
+
+func assertStringEqual(t *testing.T, expected, actual string, message string) {
+	t.Helper()
+	if actual != expected {
+		t.Errorf("%s: Expected %q, got %q", message, expected, actual)
+	}
+}
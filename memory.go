@@ -0,0 +1,337 @@
+package jellyzset
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+	"unsafe"
+)
+
+// EvictionPolicy selects the keys evicted once the memory limit set by SetMaxMemory is reached, mirroring
+// the Redis maxmemory-policy setting.
+type EvictionPolicy int
+
+const (
+	NoEviction  EvictionPolicy = iota // Evict nothing and fail the writes with ErrOOM, as noeviction
+	AllKeysLRU                        // Evict the least recently used keys, as allkeys-lru
+	AllKeysLFU                        // Evict the least frequently used keys, as allkeys-lfu
+	VolatileTTL                       // Evict the keys with a deadline that expire first, as volatile-ttl
+)
+
+// ErrOOM is returned by the writes that may use more memory when the memory used is above the limit set by
+// SetMaxMemory and no key can be evicted, worded as the Redis OOM error.
+var ErrOOM = errors.New("command not allowed when used memory > 'maxmemory'")
+
+const (
+	evictionSample = 5           // Keys sampled to pick each one to evict, as the Redis maxmemory-samples default
+	lfuInitValue   = 5           // Access counter of a new key, as LFU_INIT_VAL, so that new keys are not evicted first
+	lfuLogFactor   = 10          // How slowly the access counter grows, as the Redis lfu-log-factor default
+	lfuDecayPeriod = time.Minute // Idle time that decrements the access counter, as the Redis lfu-decay-time default
+	lfuMaxValue    = 255         // Highest access counter, which Redis keeps in 8 bits
+
+	// recordOverhead estimates what an entry adds to a map beyond the string it is keyed by: the string
+	// header, the pointer it maps to and the bookkeeping of the map, and its entry in the scan index.
+	recordOverhead = 64
+)
+
+// SetMaxMemory sets how much memory the sorted sets may use and which keys are evicted to stay under it,
+// like the Redis maxmemory and maxmemory-policy settings.
+//
+// The memory used is an estimate kept up to date as keys and members come and go. It counts every key with
+// its sorted set, and every member with its skip list node, its levels and its entry in the set; the bytes of
+// string and byte slice values are counted too, while other values only count for their own size. As in
+// Redis, the limit is enforced before each write that may use more memory: ZAdd and its variants, ZIncrBy and
+// the store operations. While the memory used is above the limit, keys are evicted according to the policy,
+// each picked as the best of a small random sample. If the policy is NoEviction, or no key can be evicted,
+// the write fails with ErrOOM instead. ZAdd and ZAddWithTTL then return 0, so callers that must know whether
+// a write was refused use ZAddChecked and ZAddWithTTLChecked, which return ErrOOM. Reads, removals and
+// deadline changes are always allowed. The access times and counters used by AllKeysLRU and AllKeysLFU are
+// only tracked while a limit is set.
+//
+// Parameters:
+//   - maxMemory: The memory limit in bytes, or 0 for no limit.
+//   - policy:    The policy deciding which keys are evicted.
+//
+// Example:
+//
+//	cache := jellyzset.New()
+//	cache.SetMaxMemory(64<<20, jellyzset.AllKeysLRU)
+//	cache.ZAdd("leaderboard:2030-01-01", 10, "player1", nil)
+//
+// In this example, cache stays within about 64 MiB by evicting the leaderboards that were used least recently.
+func (z *TypedZSet[V]) SetMaxMemory(maxMemory int64, policy EvictionPolicy) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.maxMemory, z.policy = maxMemory, policy
+}
+
+// OnEvict sets a function called with every key evicted to stay under the memory limit, and the members it
+// held, so that they can be logged or saved elsewhere.
+//
+// The function is called by the write that evicted the key, before the write is made and without any lock
+// held, so it may use the ZSet. Keys removed because they expired are not reported.
+//
+// Parameters:
+//   - callback: The function to call, or nil to stop reporting evictions.
+//
+// Example:
+//
+//	cache := jellyzset.New()
+//	cache.SetMaxMemory(64<<20, jellyzset.AllKeysLFU)
+//	cache.OnEvict(func(key string, entries []jellyzset.Entry[interface{}]) {
+//		log.Printf("evicted %s with %d members", key, len(entries))
+//	})
+//
+// In this example, every key evicted from cache is logged with its number of members.
+func (z *TypedZSet[V]) OnEvict(callback func(key string, entries []Entry[V])) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.onEvict = callback
+}
+
+// UsedMemory returns the estimated memory used by the sorted sets, which SetMaxMemory compares to its limit,
+// like the used_memory field of the Redis INFO command.
+//
+// Returns:
+//   - The estimated memory used, in bytes.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("leaderboard", 3.5, "member1", "value1")
+//	used := zset.UsedMemory()
+//
+// In this example, used is the estimated size of "leaderboard" with its member and value.
+func (z *TypedZSet[V]) UsedMemory() int64 {
+	return z.used.Load()
+}
+
+// MemoryUsage returns the estimated memory used by the sorted set at the given key, like the Redis
+// MEMORY USAGE command.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//
+// Returns:
+//   - The estimated memory used by the key and its sorted set in bytes, or 0 if the key does not exist.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("leaderboard", 3.5, "member1", "value1")
+//	usage := zset.MemoryUsage("leaderboard")
+//
+// In this example, usage equals UsedMemory, since "leaderboard" is the only key.
+func (z *TypedZSet[V]) MemoryUsage(key string) int64 {
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
+		return 0
+	}
+	return set.size(key)
+}
+
+// reserve makes room for a write that may use more memory, as Redis does before running such a command:
+// while the memory used is above the limit, it evicts the keys picked by the eviction policy, removing
+// expired keys it comes across instead. It returns ErrOOM if the memory used is still above the limit
+// because the policy is NoEviction or no key is left to evict. The evicted keys are reported to the OnEvict
+// function once the keyspace is unlocked. Like writeKey, it first waits for the subscribers holding back
+// the writes.
+func (z *TypedZSet[V]) reserve() error {
+	z.throttle()
+	z.mu.RLock()
+	limit := z.maxMemory
+	z.mu.RUnlock()
+
+	if limit == 0 || z.used.Load() <= limit {
+		return nil
+	}
+
+	z.mu.Lock()
+	var evicted []keyEntries[V]
+	var err error
+	for z.maxMemory > 0 && z.used.Load() > z.maxMemory {
+		key, ok := z.evictionCandidate()
+		if !ok {
+			err = ErrOOM
+			break
+		}
+
+		set := z.records[key]
+		if z.expired(set) {
+			z.expireKey(key)
+			continue
+		}
+
+		if z.onEvict != nil {
+			evicted = append(evicted, keyEntries[V]{key: key, entries: set.entries()})
+		}
+		z.deleteKey(key)
+		z.notify(EventKeyEvicted, key, "", 0, 0)
+		z.log(logRecord[V]{op: aofDel, key: key})
+	}
+	onEvict := z.onEvict
+	z.mu.Unlock()
+
+	for _, e := range evicted {
+		onEvict(e.key, e.entries)
+	}
+	return err
+}
+
+// evictionCandidate samples evictionSample keys and returns the one to evict first under the eviction
+// policy: the one idle for longest with AllKeysLRU, the one with the lowest access counter with AllKeysLFU,
+// and the one with the earliest deadline with VolatileTTL. It returns false if there is none. The caller
+// must hold z.mu exclusively.
+func (z *TypedZSet[V]) evictionCandidate() (string, bool) {
+	keys := z.records
+	switch z.policy {
+	case NoEviction:
+		return "", false
+	case VolatileTTL:
+		keys = z.volatile
+	}
+
+	now := z.clock.Now()
+	var best string
+	var bestRank float64
+	sampled := 0
+
+	// Map iteration starts at a random position, which makes the sample random as in Redis
+	for key, set := range keys {
+		if sampled == evictionSample {
+			break
+		}
+
+		// The higher the rank, the sooner the key is evicted
+		var rank float64
+		switch z.policy {
+		case AllKeysLRU:
+			rank = float64(now.UnixNano() - set.accessed.Load())
+		case AllKeysLFU:
+			rank = float64(lfuMaxValue - set.decayedFrequency(now))
+		case VolatileTTL:
+			rank = -float64(set.deadline.UnixNano())
+		}
+		if z.expired(set) {
+			rank = math.Inf(1)
+		}
+
+		if sampled == 0 || rank > bestRank {
+			best, bestRank = key, rank
+		}
+		sampled++
+	}
+
+	return best, sampled > 0
+}
+
+// touch records an access to a sorted set for the eviction policies, while a memory limit is set. The
+// caller must hold z.mu and a lock of the set.
+func (z *TypedZSet[V]) touch(set *zset[V]) {
+	if z.maxMemory > 0 {
+		set.touch(z.clock.Now(), z.policy == AllKeysLFU)
+	}
+}
+
+// touch records an access at the given time, and counts it in the access counter when lfu is true.
+// Concurrent readers may race to update the fields, which only makes the eviction a little less precise.
+func (set *zset[V]) touch(now time.Time, lfu bool) {
+	if lfu {
+		set.frequency.Store(uint32(lfuIncrement(set.decayedFrequency(now))))
+	}
+	set.accessed.Store(now.UnixNano())
+}
+
+// decayedFrequency returns the access counter of the set, decremented once for every lfuDecayPeriod the set
+// has been idle, as Redis decays its LFU counters.
+func (set *zset[V]) decayedFrequency(now time.Time) int {
+	counter := int(set.frequency.Load())
+	periods := now.Sub(time.Unix(0, set.accessed.Load())) / lfuDecayPeriod
+	if periods >= time.Duration(counter) {
+		return 0
+	}
+	return counter - int(periods)
+}
+
+// lfuIncrement increments an access counter with a probability that falls as the counter grows, as Redis
+// does, so that the 8 bits of the counter can tell apart keys accessed from a few times to millions of times.
+func lfuIncrement(counter int) int {
+	if counter == lfuMaxValue {
+		return counter
+	}
+
+	base := float64(max(counter-lfuInitValue, 0))
+	if rand.Float64() < 1/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
+
+// setRecords replaces the keyspace with records, and accounts for their memory in place of the memory of
+// the keys they replace. Every key is given a new version and counts as accessed now, as if it had been
+// removed and created again. The caller must hold z.mu exclusively.
+func (z *TypedZSet[V]) setRecords(records map[string]*zset[V]) {
+	for _, set := range z.records {
+		set.zsl.used = nil
+	}
+
+	var used int64
+	now := z.clock.Now().UnixNano()
+	for key, set := range records {
+		set.zsl.used = &z.used
+		set.accessed.Store(now)
+		set.version = z.versions.Add(1)
+		used += set.size(key)
+	}
+
+	z.records = records
+	z.keys = scanIndex{}
+	for key := range records {
+		z.keys.add(key)
+	}
+	z.removed = z.versions.Add(1)
+	z.used.Store(used)
+}
+
+// size estimates the memory used by the key and its sorted set.
+func (set *zset[V]) size(key string) int64 {
+	return int64(len(key)) + recordOverhead + int64(unsafe.Sizeof(*set)+unsafe.Sizeof(*set.zsl)) + set.zsl.head.size() + set.zsl.size
+}
+
+// size estimates the memory used by the node with its levels, and by its entry in the records of its set.
+func (n *zslNode[V]) size() int64 {
+	var level zslLevel[V]
+	levelSize := unsafe.Sizeof(level) + unsafe.Sizeof(&level)
+	return int64(unsafe.Sizeof(*n)+uintptr(len(n.level))*levelSize) + int64(len(n.member)) + valueSize(n.value) + recordOverhead
+}
+
+// valueSize estimates the memory a value refers to beyond its own size, which is counted with its node: the
+// bytes of a string or a byte slice, held directly or in an interface.
+func valueSize[V any](value V) int64 {
+	switch v := any(value).(type) {
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(cap(v))
+	}
+	return 0
+}
+
+// account adds delta to the estimated memory used by the skip list, and by the ZSet holding it.
+func (z *zskiplist[V]) account(delta int64) {
+	z.size += delta
+	if z.used != nil {
+		z.used.Add(delta)
+	}
+}
+
+// setValue replaces the value of a node of the skip list.
+func (z *zskiplist[V]) setValue(node *zslNode[V], value V) {
+	z.account(valueSize(value) - valueSize(node.value))
+	node.value = value
+}
@@ -0,0 +1,391 @@
+package jellyzset
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// EventType identifies the change reported by an Event, like the event names of Redis keyspace notifications.
+type EventType int
+
+const (
+	EventAdded        EventType = iota // A member was added
+	EventScoreChanged                  // The score of a member changed
+	EventRemoved                       // A member was removed, popped or expired
+	EventKeyCleared                    // A key was removed with its members by ZClear, a store operation or a past deadline
+	EventKeyExpired                    // A key was removed with its members because its deadline passed
+	EventKeyEvicted                    // A key was evicted with its members to stay under the memory limit
+)
+
+// String returns the name of the event type, such as "added" or "key-expired".
+func (t EventType) String() string {
+	switch t {
+	case EventAdded:
+		return "added"
+	case EventScoreChanged:
+		return "score-changed"
+	case EventRemoved:
+		return "removed"
+	case EventKeyCleared:
+		return "key-cleared"
+	case EventKeyExpired:
+		return "key-expired"
+	case EventKeyEvicted:
+		return "key-evicted"
+	}
+	return "unknown"
+}
+
+// Event is a change to the keyspace, delivered to the subscriptions whose pattern matches its key.
+type Event struct {
+	Type     EventType
+	Key      string
+	Member   string  // The member added, rescored or removed, empty for the key events
+	OldScore float64 // The score before the change, for EventScoreChanged and EventRemoved
+	NewScore float64 // The score after the change, for EventAdded and EventScoreChanged
+}
+
+// OverflowPolicy selects what happens to an event when the channel of a subscription is full.
+type OverflowPolicy int
+
+const (
+	OverflowDrop       OverflowPolicy = iota // Drop the event and count it in Dropped
+	OverflowBlock                            // Queue the event and hold back the next writes until the subscriber receives it
+	OverflowDisconnect                       // Close the subscription, as Redis disconnects slow Pub/Sub clients
+)
+
+// ErrSlowSubscriber is returned by Subscription.Err when the subscription was closed because its channel was
+// full under OverflowDisconnect.
+var ErrSlowSubscriber = errors.New("subscription closed because its buffer was full")
+
+// defaultEventBuffer is the capacity of the channel of a subscription when SubscribeOptions.Buffer is not set.
+const defaultEventBuffer = 128
+
+// SubscribeOptions specifies which events a subscription receives and how they are delivered.
+type SubscribeOptions struct {
+	Pattern  string         // Glob pattern matched against the keys as in ZKeys; empty matches every key
+	Buffer   int            // Capacity of the channel, defaultEventBuffer when not positive
+	Overflow OverflowPolicy // What to do with an event when the channel is full, OverflowDrop by default
+}
+
+// Subscription receives the changes made to the keys matching its pattern on the channel C, until it is
+// closed by Close or by OverflowDisconnect, which closes C.
+type Subscription struct {
+	C <-chan Event
+
+	c        chan Event
+	pattern  string
+	overflow OverflowPolicy
+	dropped  atomic.Uint64
+
+	mu     sync.RWMutex  // Held for reading while sending on c, and for writing while closing it
+	closed bool          // Whether c is closed, guarded by mu
+	err    error         // Why the subscription was closed, guarded by mu
+	done   chan struct{} // Closed when the subscription is closed, to stop the delivery and release the writes
+	once   sync.Once
+
+	// Under OverflowBlock, the events are queued by the writes and sent on c by a delivery goroutine, so that
+	// a full channel never blocks a write while it holds the locks of the ZSet.
+	queueMu   sync.Mutex
+	queue     []Event       // Events waiting to be sent on c, guarded by queueMu
+	drained   chan struct{} // Closed once the queue is empty again, nil while it is empty, guarded by queueMu
+	queued    chan struct{} // Signalled when events are queued while the queue is empty
+	delivered chan struct{} // Closed when the delivery goroutine returns
+
+	unsubscribe func()
+}
+
+// Subscribe starts delivering the changes made to the keys matching a pattern, like the keyspace
+// notifications of Redis: members added, rescored or removed, and keys cleared, expired or evicted.
+//
+// Events are raised by the write making the change, while it holds the lock of the key, so the events of a
+// key arrive in the order the changes were made. Events of different keys may be interleaved. Members
+// popped, including by BZPopMin and BZPopMax, and members removed because their deadline passed are
+// reported as EventRemoved. Changing only the value of a member, and loading a snapshot, an append-only log
+// or an RDB file, are not reported. When the channel is full, the event is handled according to the
+// overflow policy. With OverflowBlock, the events are queued and sent on the channel by a goroutine of the
+// subscription, never under the locks of the ZSet, so the subscriber may read the ZSet while events are
+// pending. Writes then wait, before taking any lock, until the queued events fit in the channel; the
+// subscriber must therefore not write to the ZSet itself while its events are pending.
+//
+// Parameters:
+//   - opts: The pattern of the keys to watch, the capacity of the channel and the overflow policy.
+//
+// Returns:
+//   - The subscription, which must be closed with Close once it is no longer used.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	sub := zset.Subscribe(jellyzset.SubscribeOptions{Pattern: "leaderboard:*"})
+//	defer sub.Close()
+//	go func() {
+//		for event := range sub.C {
+//			fmt.Println(event.Type, event.Key, event.Member, event.NewScore)
+//		}
+//	}()
+//	zset.ZAdd("leaderboard:2030", 100, "alice", nil)
+//
+// In this example, the goroutine prints "added leaderboard:2030 alice 100".
+func (z *TypedZSet[V]) Subscribe(opts SubscribeOptions) *Subscription {
+	buffer := opts.Buffer
+	if buffer <= 0 {
+		buffer = defaultEventBuffer
+	}
+
+	c := make(chan Event, buffer)
+	s := &Subscription{C: c, c: c, pattern: opts.Pattern, overflow: opts.Overflow, done: make(chan struct{})}
+	s.unsubscribe = func() { z.unsubscribe(s) }
+	if s.overflow == OverflowBlock {
+		s.queued, s.delivered = make(chan struct{}, 1), make(chan struct{})
+		go s.deliver()
+	}
+
+	z.subsMu.Lock()
+	defer z.subsMu.Unlock()
+
+	var subs []*Subscription
+	if current := z.subs.Load(); current != nil {
+		subs = append(subs, *current...)
+	}
+	subs = append(subs, s)
+	z.subs.Store(&subs)
+	return s
+}
+
+// Close stops the subscription and closes its channel. Events still buffered in the channel can be received
+// after Close returns, while the events still queued under OverflowBlock are discarded. Closing a
+// subscription more than once has no effect.
+func (s *Subscription) Close() {
+	s.close(nil)
+}
+
+// Err returns ErrSlowSubscriber if the subscription was closed because its channel was full, and nil otherwise.
+func (s *Subscription) Err() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.err
+}
+
+// Dropped returns the number of events dropped because the channel was full under OverflowDrop.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// close removes the subscription from its ZSet and closes its channel, recording err as the reason.
+func (s *Subscription) close(err error) {
+	s.once.Do(func() {
+		close(s.done)
+		s.unsubscribe()
+		if s.delivered != nil {
+			<-s.delivered
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.closed, s.err = true, err
+		close(s.c)
+	})
+}
+
+// send delivers an event according to the overflow policy, unless the subscription is closed.
+func (s *Subscription) send(event Event) {
+	s.mu.RLock()
+	if s.closed {
+		s.mu.RUnlock()
+		return
+	}
+
+	if s.overflow == OverflowBlock {
+		s.mu.RUnlock()
+		s.enqueue(event)
+		return
+	}
+
+	full := false
+	select {
+	case s.c <- event:
+	default:
+		full = true
+	}
+	s.mu.RUnlock()
+
+	switch {
+	case !full:
+	case s.overflow == OverflowDisconnect:
+		s.close(ErrSlowSubscriber)
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// enqueue adds an event to the queue of the delivery goroutine, waking it up if the queue was empty.
+func (s *Subscription) enqueue(event Event) {
+	s.queueMu.Lock()
+	defer s.queueMu.Unlock()
+
+	if len(s.queue) == 0 {
+		s.drained = make(chan struct{})
+		select {
+		case s.queued <- struct{}{}:
+		default:
+		}
+	}
+	s.queue = append(s.queue, event)
+}
+
+// deliver sends the queued events on the channel in order until the subscription is closed. An event leaves
+// the queue only once it is sent, so that the writes held back by wait resume when the subscriber has
+// received everything but what fits in the channel.
+func (s *Subscription) deliver() {
+	defer close(s.delivered)
+
+	for {
+		select {
+		case <-s.queued:
+		case <-s.done:
+			return
+		}
+
+		for {
+			// Only this goroutine removes events, so the first one stays in place while it is sent.
+			s.queueMu.Lock()
+			if len(s.queue) == 0 {
+				close(s.drained)
+				s.drained = nil
+				s.queueMu.Unlock()
+				break
+			}
+			event := s.queue[0]
+			s.queueMu.Unlock()
+
+			select {
+			case s.c <- event:
+			case <-s.done:
+				return
+			}
+
+			s.queueMu.Lock()
+			s.queue[0] = Event{}
+			s.queue = s.queue[1:]
+			s.queueMu.Unlock()
+		}
+	}
+}
+
+// wait blocks until the queue of the subscription is empty or the subscription is closed.
+func (s *Subscription) wait() {
+	s.queueMu.Lock()
+	drained := s.drained
+	s.queueMu.Unlock()
+
+	if drained != nil {
+		select {
+		case <-drained:
+		case <-s.done:
+		}
+	}
+}
+
+// unsubscribe removes a subscription from the ones receiving events.
+func (z *TypedZSet[V]) unsubscribe(s *Subscription) {
+	z.subsMu.Lock()
+	defer z.subsMu.Unlock()
+
+	current := z.subs.Load()
+	if current == nil {
+		return
+	}
+
+	var subs []*Subscription
+	for _, sub := range *current {
+		if sub != s {
+			subs = append(subs, sub)
+		}
+	}
+
+	if len(subs) == 0 {
+		z.subs.Store(nil)
+		return
+	}
+	z.subs.Store(&subs)
+}
+
+// throttle holds back a write, before it takes any lock, until the events queued for the subscriptions under
+// OverflowBlock fit in their channels. The events of a write are queued while it holds the locks, so a slow
+// subscriber is left behind by at most the events of one write.
+func (z *TypedZSet[V]) throttle() {
+	subs := z.subs.Load()
+	if subs == nil {
+		return
+	}
+
+	for _, s := range *subs {
+		if s.overflow == OverflowBlock {
+			s.wait()
+		}
+	}
+}
+
+// notifying reports whether there are subscriptions, so that the events are only built when they are received.
+func (z *TypedZSet[V]) notifying() bool {
+	return z.subs.Load() != nil
+}
+
+// notify sends an event to the subscriptions whose pattern matches its key. The caller must hold the lock of
+// the key, so that the events of a key are sent in order.
+func (z *TypedZSet[V]) notify(typ EventType, key, member string, oldScore, newScore float64) {
+	subs := z.subs.Load()
+	if subs == nil {
+		return
+	}
+
+	event := Event{Type: typ, Key: key, Member: member, OldScore: oldScore, NewScore: newScore}
+	for _, s := range *subs {
+		if s.pattern == "" || globMatch(s.pattern, key) {
+			s.send(event)
+		}
+	}
+}
+
+// notifyScore reports a member added with newScore if it did not exist, or rescored from oldScore if its
+// score changed.
+func (z *TypedZSet[V]) notifyScore(key, member string, existed bool, oldScore, newScore float64) {
+	switch {
+	case !existed:
+		z.notify(EventAdded, key, member, 0, newScore)
+	case oldScore != newScore:
+		z.notify(EventScoreChanged, key, member, oldScore, newScore)
+	}
+}
+
+// notifyRemoved reports the removal of the members of entries.
+func (z *TypedZSet[V]) notifyRemoved(key string, entries []Entry[V]) {
+	for _, e := range entries {
+		z.notify(EventRemoved, key, e.Member, e.Score, 0)
+	}
+}
+
+// forgetter returns the function passed to the range deletes of the skip list of a set, which forgets the
+// removed members and, while there are subscriptions, reports their removal.
+func (z *TypedZSet[V]) forgetter(key string, set *zset[V]) func(member string) {
+	if !z.notifying() {
+		return set.forget
+	}
+
+	return func(member string) {
+		z.notify(EventRemoved, key, member, set.records[member].score, 0)
+		set.forget(member)
+	}
+}
+
+// scoreOf returns the score of a member and whether it is in the set, read before a change to report it.
+func (set *zset[V]) scoreOf(member string) (float64, bool) {
+	if node, exists := set.records[member]; exists {
+		return node.score, true
+	}
+	return 0, false
+}
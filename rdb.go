@@ -0,0 +1,924 @@
+package jellyzset
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// RDB value types, as defined by RDB_TYPE_* in the Redis rdb.h.
+const (
+	rdbTypeString         = 0
+	rdbTypeList           = 1
+	rdbTypeSet            = 2
+	rdbTypeZSet           = 3
+	rdbTypeHash           = 4
+	rdbTypeZSet2          = 5
+	rdbTypeHashZipmap     = 9
+	rdbTypeListZiplist    = 10
+	rdbTypeSetIntset      = 11
+	rdbTypeZSetZiplist    = 12
+	rdbTypeHashZiplist    = 13
+	rdbTypeListQuicklist  = 14
+	rdbTypeHashListpack   = 16
+	rdbTypeZSetListpack   = 17
+	rdbTypeListQuicklist2 = 18
+	rdbTypeSetListpack    = 20
+	rdbTypeHashMetadata   = 24
+	rdbTypeHashListpackEx = 25
+)
+
+// RDB opcodes, as defined by RDB_OPCODE_* in the Redis rdb.h.
+const (
+	rdbOpcodeSlotInfo     = 244
+	rdbOpcodeFunction2    = 245
+	rdbOpcodeModuleAux    = 247
+	rdbOpcodeIdle         = 248
+	rdbOpcodeFreq         = 249
+	rdbOpcodeAux          = 250
+	rdbOpcodeResizeDB     = 251
+	rdbOpcodeExpireTimeMs = 252
+	rdbOpcodeExpireTime   = 253
+	rdbOpcodeSelectDB     = 254
+	rdbOpcodeEOF          = 255
+)
+
+// Encodings of a string stored as an integer or compressed, as defined by RDB_ENC_* in the Redis rdb.h.
+const (
+	rdbEncodingInt8  = 0
+	rdbEncodingInt16 = 1
+	rdbEncodingInt32 = 2
+	rdbEncodingLZF   = 3
+)
+
+const (
+	rdbWriteVersion   = 9  // RDB version written by WriteRDB, loadable by Redis 5.0 and later
+	rdbMaxReadVersion = 12 // Latest RDB version read by ReadRDB, written by Redis 7.4
+)
+
+var (
+	// ErrInvalidRDB is returned by ReadRDB when the input is truncated, malformed or not an RDB file.
+	ErrInvalidRDB = errors.New("invalid or truncated RDB file")
+
+	// ErrRDBVersion is returned by ReadRDB when the RDB file was written by an unsupported version of Redis.
+	ErrRDBVersion = errors.New("unsupported RDB version")
+
+	// ErrRDBChecksum is returned by ReadRDB when the RDB file does not match its checksum.
+	ErrRDBChecksum = errors.New("RDB checksum mismatch")
+
+	// ErrRDBUnsupportedType is returned by ReadRDB when the RDB file holds a value, such as a stream or a
+	// module type, or auxiliary data of a module, that can be neither loaded nor skipped.
+	ErrRDBUnsupportedType = errors.New("RDB file holds an unsupported value type")
+)
+
+// rdbCRCTable is the table of the CRC-64 used by Redis, with the Jones polynomial in reversed form.
+var rdbCRCTable = func() *[256]uint64 {
+	var table [256]uint64
+	for i := range table {
+		crc := uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ 0x95ac9329ac4bc9b5
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return &table
+}()
+
+// rdbCRC updates the Redis CRC-64 of an RDB file with p. Unlike hash/crc64, it neither inverts the
+// initial value nor the result.
+func rdbCRC(crc uint64, p []byte) uint64 {
+	for _, b := range p {
+		crc = rdbCRCTable[byte(crc)^b] ^ crc>>8
+	}
+	return crc
+}
+
+// ReadRDB loads the sorted sets of a Redis RDB file, such as a dump.rdb written by SAVE or BGSAVE.
+//
+// Sorted sets are read in any of the encodings Redis has used for them: skip lists with string or binary
+// scores, ziplists and listpacks. Only the keys of the given database are loaded, and each replaces the key
+// of the same name in the ZSet while other keys are left as they are. Keys holding strings, lists, sets or
+// hashes are skipped and reported, keys that had already expired are dropped as Redis drops them, and other
+// keys keep their expiry time as their deadline. Since an RDB file holds no values, members are loaded with
+// the zero value of V. The whole file is read and checked against its checksum before the ZSet is touched.
+//
+// Parameters:
+//   - r:  The reader to read the RDB file from.
+//   - db: The number of the database to load, usually 0.
+//
+// Returns:
+//   - The keys of the database that were skipped because they do not hold a sorted set.
+//   - ErrInvalidRDB if the input is truncated or malformed, ErrRDBVersion if its version is not supported,
+//     ErrRDBChecksum if it is corrupted, ErrRDBUnsupportedType if it holds a stream or a module value,
+//     or an error from r.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	file, _ := os.Open("dump.rdb")
+//	skipped, err := zset.ReadRDB(file, 0)
+//	file.Close()
+//
+// In this example, every sorted set of database 0 of "dump.rdb" is loaded into zset, and skipped lists the keys of that database holding other types.
+func (z *TypedZSet[V]) ReadRDB(r io.Reader, db int) ([]string, error) {
+	z.mu.RLock()
+	now := z.clock.Now()
+	z.mu.RUnlock()
+
+	rr := &rdbReader{r: bufio.NewReader(r), now: now.UnixMilli()}
+
+	loaded, skipped, err := readRDB[V](rr, uint64(db))
+	if err != nil {
+		return nil, err
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	for _, k := range loaded {
+		z.replace(k.key, k.entries)
+		set := z.records[k.key]
+
+		set.mu.Lock()
+		z.log(logRecord[V]{op: aofStore, key: k.key, entries: k.entries})
+		if !k.deadline.IsZero() {
+			z.setDeadline(k.key, set, k.deadline)
+			z.log(logRecord[V]{op: aofExpire, key: k.key, deadline: k.deadline})
+		}
+		z.serveWaiters(k.key, set)
+		set.mu.Unlock()
+	}
+	z.startSweeper()
+
+	return skipped, nil
+}
+
+// WriteRDB writes every sorted set of the ZSet to w as a Redis RDB file holding a single database, which
+// Redis 5.0 and later can load with its dbfilename setting or with DEBUG RELOAD.
+//
+// Sorted sets are written as skip lists with binary scores. Values are not written, since Redis sorted sets
+// have none, and empty sorted sets are left out, as Redis never holds them. Deadlines of keys are written as
+// expiry times, and keys past their deadline are left out. Members past their deadline are left out too,
+// while the deadlines of the other members are lost, since Redis sorted sets have none. Like WriteSnapshot,
+// the file is a consistent view of the ZSet, copied under the locks and written once they are released.
+// Output is buffered, and w is not closed.
+//
+// Parameters:
+//   - w: The writer to write the RDB file to.
+//
+// Returns:
+//   - An error from w, if any.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("leaderboard", 3.5, "member1", "value1")
+//	file, _ := os.Create("dump.rdb")
+//	err := zset.WriteRDB(file)
+//	file.Close()
+//
+// In this example, "dump.rdb" holds "leaderboard" with its member, ready to be loaded by a Redis server.
+func (z *TypedZSet[V]) WriteRDB(w io.Writer) error {
+	contents, _ := z.contents()
+
+	nonEmpty, volatile := 0, 0
+	for _, c := range contents {
+		if len(c.entries) > 0 {
+			nonEmpty++
+			if !c.deadline.IsZero() {
+				volatile++
+			}
+		}
+	}
+
+	buffered := bufio.NewWriter(w)
+	rw := &rdbWriter{w: buffered}
+
+	rw.write([]byte(fmt.Sprintf("REDIS%04d", rdbWriteVersion)))
+	rw.write([]byte{rdbOpcodeSelectDB})
+	rw.length(0)
+	rw.write([]byte{rdbOpcodeResizeDB})
+	rw.length(uint64(nonEmpty))
+	rw.length(uint64(volatile))
+
+	for _, c := range contents {
+		if len(c.entries) == 0 {
+			continue
+		}
+
+		if !c.deadline.IsZero() {
+			rw.write([]byte{rdbOpcodeExpireTimeMs})
+			rw.write(binary.LittleEndian.AppendUint64(nil, uint64(c.deadline.UnixMilli())))
+		}
+		rw.write([]byte{rdbTypeZSet2})
+		rw.string(c.key)
+		rw.length(uint64(len(c.entries)))
+
+		// Redis writes the members from the highest score down, so that each one it loads is inserted at the head
+		for i := len(c.entries) - 1; i >= 0 && rw.err == nil; i-- {
+			rw.string(c.entries[i].Member)
+			var score [8]byte
+			binary.LittleEndian.PutUint64(score[:], math.Float64bits(c.entries[i].Score))
+			rw.write(score[:])
+		}
+	}
+
+	rw.write([]byte{rdbOpcodeEOF})
+	if rw.err != nil {
+		return rw.err
+	}
+
+	var sum [8]byte
+	binary.LittleEndian.PutUint64(sum[:], rw.crc)
+	if _, err := buffered.Write(sum[:]); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// readRDB reads an RDB file and returns the sorted sets of the given database, with their members sorted
+// by score and member, and the keys of that database holding other types.
+func readRDB[V any](rr *rdbReader, db uint64) ([]keyEntries[V], []string, error) {
+	header, err := rr.bytes(9)
+	if err != nil {
+		return nil, nil, err
+	}
+	if string(header[:5]) != "REDIS" {
+		return nil, nil, ErrInvalidRDB
+	}
+
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil {
+		return nil, nil, ErrInvalidRDB
+	}
+	if version < 1 || version > rdbMaxReadVersion {
+		return nil, nil, ErrRDBVersion
+	}
+
+	var loaded []keyEntries[V]
+	var skipped []string
+	currentDB := uint64(0)
+	expireAt := int64(-1)
+
+	for {
+		opcode, err := rr.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch opcode {
+		case rdbOpcodeEOF:
+			if err := rr.checksum(version); err != nil {
+				return nil, nil, err
+			}
+			return loaded, skipped, nil
+		case rdbOpcodeSelectDB:
+			currentDB, err = rr.length()
+		case rdbOpcodeResizeDB:
+			err = rr.skipLengths(2)
+		case rdbOpcodeSlotInfo:
+			err = rr.skipLengths(3)
+		case rdbOpcodeAux:
+			err = rr.skipStrings(2)
+		case rdbOpcodeFunction2:
+			err = rr.skipStrings(1)
+		case rdbOpcodeIdle:
+			err = rr.skipLengths(1)
+		case rdbOpcodeFreq:
+			_, err = rr.ReadByte()
+		case rdbOpcodeModuleAux:
+			// The data of a module is only known to the module, so it cannot be skipped
+			return nil, nil, ErrRDBUnsupportedType
+		case rdbOpcodeExpireTimeMs:
+			var p []byte
+			if p, err = rr.bytes(8); err == nil {
+				expireAt = int64(binary.LittleEndian.Uint64(p))
+			}
+		case rdbOpcodeExpireTime:
+			var p []byte
+			if p, err = rr.bytes(4); err == nil {
+				expireAt = int64(binary.LittleEndian.Uint32(p)) * 1000
+			}
+		default:
+			var key []byte
+			var entries []Entry[V]
+			isZSet := opcode == rdbTypeZSet || opcode == rdbTypeZSet2 || opcode == rdbTypeZSetZiplist || opcode == rdbTypeZSetListpack
+
+			if key, err = rr.string(); err != nil {
+				return nil, nil, err
+			}
+			if isZSet {
+				entries, err = readRDBZSet[V](rr, opcode)
+			} else {
+				err = rr.skipValue(opcode)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// Expired keys are dropped, and empty sorted sets skipped, as Redis does when it loads a file
+			expired := expireAt >= 0 && expireAt <= rr.now
+			switch {
+			case currentDB != db || expired:
+			case !isZSet:
+				skipped = append(skipped, string(key))
+			case len(entries) > 0:
+				k := keyEntries[V]{key: string(key), entries: entries}
+				if expireAt >= 0 {
+					k.deadline = time.UnixMilli(expireAt)
+				}
+				loaded = append(loaded, k)
+			}
+			expireAt = -1
+		}
+
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// rdbWriter writes the parts of an RDB file while updating its checksum. The first error is kept and
+// every later write is skipped, so it only needs to be checked once.
+type rdbWriter struct {
+	w   io.Writer
+	crc uint64
+	err error
+}
+
+func (rw *rdbWriter) write(p []byte) {
+	if rw.err != nil {
+		return
+	}
+	if _, rw.err = rw.w.Write(p); rw.err == nil {
+		rw.crc = rdbCRC(rw.crc, p)
+	}
+}
+
+// length writes a length in the variable size encoding of RDB files.
+func (rw *rdbWriter) length(n uint64) {
+	switch {
+	case n < 1<<6:
+		rw.write([]byte{byte(n)})
+	case n < 1<<14:
+		rw.write([]byte{byte(n>>8) | 0x40, byte(n)})
+	case n <= math.MaxUint32:
+		rw.write(binary.BigEndian.AppendUint32([]byte{0x80}, uint32(n)))
+	default:
+		rw.write(binary.BigEndian.AppendUint64([]byte{0x81}, n))
+	}
+}
+
+func (rw *rdbWriter) string(s string) {
+	rw.length(uint64(len(s)))
+	rw.write([]byte(s))
+}
+
+// rdbReader reads the parts of an RDB file while updating its checksum. A truncated input is reported as
+// ErrInvalidRDB.
+type rdbReader struct {
+	r   *bufio.Reader
+	crc uint64
+	now int64 // Time in milliseconds before which keys have expired
+}
+
+func (rr *rdbReader) ReadByte() (byte, error) {
+	b, err := rr.r.ReadByte()
+	if err != nil {
+		return 0, rdbReadError(err)
+	}
+	rr.crc = rdbCRC(rr.crc, []byte{b})
+	return b, nil
+}
+
+func (rr *rdbReader) bytes(n uint64) ([]byte, error) {
+	if n > maxSnapshotLength {
+		return nil, ErrInvalidRDB
+	}
+
+	p := make([]byte, n)
+	if _, err := io.ReadFull(rr.r, p); err != nil {
+		return nil, rdbReadError(err)
+	}
+	rr.crc = rdbCRC(rr.crc, p)
+	return p, nil
+}
+
+// checksum reads the checksum that follows the EOF opcode and compares it with the file. A checksum of 0
+// means that the file was written with rdbchecksum disabled.
+func (rr *rdbReader) checksum(version int) error {
+	if version < 5 {
+		return nil
+	}
+
+	expected := rr.crc
+	var sum [8]byte
+	if _, err := io.ReadFull(rr.r, sum[:]); err != nil {
+		return rdbReadError(err)
+	}
+
+	if stored := binary.LittleEndian.Uint64(sum[:]); stored != 0 && stored != expected {
+		return ErrRDBChecksum
+	}
+	return nil
+}
+
+// lengthOrEncoding reads a length, or the kind of encoded string that follows when special is true.
+func (rr *rdbReader) lengthOrEncoding() (n uint64, special bool, err error) {
+	b, err := rr.ReadByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch b >> 6 {
+	case 0:
+		return uint64(b & 0x3f), false, nil
+	case 1:
+		next, err := rr.ReadByte()
+		return uint64(b&0x3f)<<8 | uint64(next), false, err
+	case 2:
+		switch b {
+		case 0x80:
+			p, err := rr.bytes(4)
+			if err != nil {
+				return 0, false, err
+			}
+			return uint64(binary.BigEndian.Uint32(p)), false, nil
+		case 0x81:
+			p, err := rr.bytes(8)
+			if err != nil {
+				return 0, false, err
+			}
+			return binary.BigEndian.Uint64(p), false, nil
+		}
+		return 0, false, ErrInvalidRDB
+	default:
+		return uint64(b & 0x3f), true, nil
+	}
+}
+
+func (rr *rdbReader) length() (uint64, error) {
+	n, special, err := rr.lengthOrEncoding()
+	if err == nil && special {
+		return 0, ErrInvalidRDB
+	}
+	return n, err
+}
+
+// string reads a string, which may be stored as an integer or compressed with LZF.
+func (rr *rdbReader) string() ([]byte, error) {
+	n, special, err := rr.lengthOrEncoding()
+	if err != nil || !special {
+		if err != nil {
+			return nil, err
+		}
+		return rr.bytes(n)
+	}
+
+	switch n {
+	case rdbEncodingInt8:
+		b, err := rr.ReadByte()
+		return strconv.AppendInt(nil, int64(int8(b)), 10), err
+	case rdbEncodingInt16:
+		p, err := rr.bytes(2)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, int64(int16(binary.LittleEndian.Uint16(p))), 10), nil
+	case rdbEncodingInt32:
+		p, err := rr.bytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, int64(int32(binary.LittleEndian.Uint32(p))), 10), nil
+	case rdbEncodingLZF:
+		compressedLength, err := rr.length()
+		if err != nil {
+			return nil, err
+		}
+		length, err := rr.length()
+		if err != nil {
+			return nil, err
+		}
+		if length > maxSnapshotLength {
+			return nil, ErrInvalidRDB
+		}
+		compressed, err := rr.bytes(compressedLength)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, int(length))
+	}
+
+	return nil, ErrInvalidRDB
+}
+
+// float reads a score stored as a string, as in sorted sets of type RDB_TYPE_ZSET.
+func (rr *rdbReader) float() (float64, error) {
+	n, err := rr.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+
+	p, err := rr.bytes(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	return parseRDBScore(p)
+}
+
+func (rr *rdbReader) skipLengths(count int) error {
+	for i := 0; i < count; i++ {
+		if _, err := rr.length(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rr *rdbReader) skipStrings(count uint64) error {
+	for i := uint64(0); i < count; i++ {
+		if _, err := rr.string(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipValue reads past a value that is not a sorted set.
+func (rr *rdbReader) skipValue(valueType byte) error {
+	switch valueType {
+	case rdbTypeString, rdbTypeHashZipmap, rdbTypeListZiplist, rdbTypeSetIntset, rdbTypeHashZiplist,
+		rdbTypeHashListpack, rdbTypeSetListpack:
+		return rr.skipStrings(1)
+	case rdbTypeList, rdbTypeSet, rdbTypeListQuicklist, rdbTypeHash:
+		n, err := rr.length()
+		if err != nil {
+			return err
+		}
+		if valueType == rdbTypeHash {
+			n *= 2
+		}
+		return rr.skipStrings(n)
+	case rdbTypeListQuicklist2:
+		n, err := rr.length()
+		for i := uint64(0); i < n && err == nil; i++ {
+			if err = rr.skipLengths(1); err == nil {
+				err = rr.skipStrings(1)
+			}
+		}
+		return err
+	case rdbTypeHashListpackEx:
+		if _, err := rr.bytes(8); err != nil {
+			return err
+		}
+		return rr.skipStrings(1)
+	case rdbTypeHashMetadata:
+		if _, err := rr.bytes(8); err != nil {
+			return err
+		}
+		n, err := rr.length()
+		for i := uint64(0); i < n && err == nil; i++ {
+			if err = rr.skipLengths(1); err == nil {
+				err = rr.skipStrings(2)
+			}
+		}
+		return err
+	}
+
+	return ErrRDBUnsupportedType
+}
+
+// readRDBZSet reads a sorted set of the given type and returns its members sorted by score and member.
+func readRDBZSet[V any](rr *rdbReader, valueType byte) ([]Entry[V], error) {
+	var entries []Entry[V]
+
+	switch valueType {
+	case rdbTypeZSet, rdbTypeZSet2:
+		n, err := rr.length()
+		if err != nil {
+			return nil, err
+		}
+
+		entries = make([]Entry[V], 0, min(n, 1024))
+		for i := uint64(0); i < n; i++ {
+			member, err := rr.string()
+			if err != nil {
+				return nil, err
+			}
+
+			var score float64
+			if valueType == rdbTypeZSet2 {
+				p, err := rr.bytes(8)
+				if err != nil {
+					return nil, err
+				}
+				score = math.Float64frombits(binary.LittleEndian.Uint64(p))
+			} else if score, err = rr.float(); err != nil {
+				return nil, err
+			}
+
+			entries = append(entries, Entry[V]{Member: string(member), Score: score})
+		}
+	default:
+		blob, err := rr.string()
+		if err != nil {
+			return nil, err
+		}
+
+		var fields [][]byte
+		if valueType == rdbTypeZSetZiplist {
+			fields, err = ziplistEntries(blob)
+		} else {
+			fields, err = listpackEntries(blob)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(fields)%2 != 0 {
+			return nil, ErrInvalidRDB
+		}
+
+		entries = make([]Entry[V], 0, len(fields)/2)
+		for i := 0; i < len(fields); i += 2 {
+			score, err := parseRDBScore(fields[i+1])
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, Entry[V]{Member: string(fields[i]), Score: score})
+		}
+	}
+
+	return checkRDBMembers(entries)
+}
+
+// checkRDBMembers sorts the members of a sorted set, rejecting NaN scores and repeated members.
+func checkRDBMembers[V any](entries []Entry[V]) ([]Entry[V], error) {
+	seen := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		if _, exists := seen[e.Member]; exists || math.IsNaN(e.Score) {
+			return nil, ErrInvalidRDB
+		}
+		seen[e.Member] = struct{}{}
+	}
+
+	sortMembers(entries)
+	return entries, nil
+}
+
+// parseRDBScore parses a score stored as text, as Redis writes it with "inf" and "-inf" for infinities.
+func parseRDBScore(p []byte) (float64, error) {
+	score, err := strconv.ParseFloat(string(p), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, ErrInvalidRDB
+	}
+	return score, nil
+}
+
+// ziplistEntries returns the entries of a ziplist, with integers formatted as decimal strings.
+func ziplistEntries(zl []byte) ([][]byte, error) {
+	if len(zl) < 11 || binary.LittleEndian.Uint32(zl) != uint32(len(zl)) {
+		return nil, ErrInvalidRDB
+	}
+
+	var entries [][]byte
+	p := zl[10:]
+	for len(p) > 0 && p[0] != 0xff {
+		// Skip the length of the previous entry
+		if p[0] == 0xfe {
+			if len(p) < 5 {
+				return nil, ErrInvalidRDB
+			}
+			p = p[5:]
+		} else {
+			p = p[1:]
+		}
+		if len(p) == 0 {
+			return nil, ErrInvalidRDB
+		}
+
+		encoding := p[0]
+		var header, length int
+		switch encoding >> 6 {
+		case 0:
+			header, length = 1, int(encoding&0x3f)
+		case 1:
+			if len(p) < 2 {
+				return nil, ErrInvalidRDB
+			}
+			header, length = 2, int(encoding&0x3f)<<8|int(p[1])
+		case 2:
+			if len(p) < 5 {
+				return nil, ErrInvalidRDB
+			}
+			header, length = 5, int(binary.BigEndian.Uint32(p[1:]))
+		default:
+			value, size, err := ziplistInt(p)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, strconv.AppendInt(nil, value, 10))
+			p = p[size:]
+			continue
+		}
+
+		if length < 0 || len(p) < header+length {
+			return nil, ErrInvalidRDB
+		}
+		entries = append(entries, p[header:header+length])
+		p = p[header+length:]
+	}
+
+	if len(p) == 0 {
+		return nil, ErrInvalidRDB
+	}
+	return entries, nil
+}
+
+// ziplistInt decodes an integer entry of a ziplist, returning its value and the size of its encoding.
+func ziplistInt(p []byte) (int64, int, error) {
+	var size int
+	switch encoding := p[0]; encoding {
+	case 0xfe:
+		size = 1
+	case 0xc0:
+		size = 2
+	case 0xf0:
+		size = 3
+	case 0xd0:
+		size = 4
+	case 0xe0:
+		size = 8
+	default:
+		if encoding >= 0xf1 && encoding <= 0xfd {
+			// A 4-bit immediate value from 0 to 12, stored plus one
+			return int64(encoding&0x0f) - 1, 1, nil
+		}
+		return 0, 0, ErrInvalidRDB
+	}
+
+	if len(p) < 1+size {
+		return 0, 0, ErrInvalidRDB
+	}
+	return littleEndianInt(p[1 : 1+size]), 1 + size, nil
+}
+
+// listpackEntries returns the entries of a listpack, with integers formatted as decimal strings.
+func listpackEntries(lp []byte) ([][]byte, error) {
+	if len(lp) < 7 || binary.LittleEndian.Uint32(lp) != uint32(len(lp)) {
+		return nil, ErrInvalidRDB
+	}
+
+	var entries [][]byte
+	p := lp[6:]
+	for len(p) > 0 && p[0] != 0xff {
+		encoding := p[0]
+
+		var header, length int
+		var value int64
+		isInt := true
+		switch {
+		case encoding < 0x80:
+			header, value = 1, int64(encoding)
+		case encoding < 0xc0:
+			header, length, isInt = 1, int(encoding&0x3f), false
+		case encoding < 0xe0:
+			if len(p) < 2 {
+				return nil, ErrInvalidRDB
+			}
+			header, value = 2, int64(encoding&0x1f)<<8|int64(p[1])
+			if value >= 1<<12 {
+				value -= 1 << 13
+			}
+		case encoding < 0xf0:
+			if len(p) < 2 {
+				return nil, ErrInvalidRDB
+			}
+			header, length, isInt = 2, int(encoding&0x0f)<<8|int(p[1]), false
+		case encoding == 0xf0:
+			if len(p) < 5 {
+				return nil, ErrInvalidRDB
+			}
+			header, length, isInt = 5, int(binary.LittleEndian.Uint32(p[1:])), false
+		case encoding >= 0xf1 && encoding <= 0xf4:
+			size := []int{2, 3, 4, 8}[encoding-0xf1]
+			if len(p) < 1+size {
+				return nil, ErrInvalidRDB
+			}
+			header, value = 1+size, littleEndianInt(p[1:1+size])
+		default:
+			return nil, ErrInvalidRDB
+		}
+
+		if length < 0 || len(p) < header+length {
+			return nil, ErrInvalidRDB
+		}
+		if isInt {
+			entries = append(entries, strconv.AppendInt(nil, value, 10))
+		} else {
+			entries = append(entries, p[header:header+length])
+		}
+
+		// Skip the entry and its back length, which takes one byte per 7 bits of the entry length
+		size := header + length
+		backlen := 1
+		for n := size >> 7; n > 0; n >>= 7 {
+			backlen++
+		}
+		if len(p) < size+backlen {
+			return nil, ErrInvalidRDB
+		}
+		p = p[size+backlen:]
+	}
+
+	if len(p) == 0 {
+		return nil, ErrInvalidRDB
+	}
+	return entries, nil
+}
+
+// littleEndianInt decodes a signed little-endian integer of 1 to 8 bytes.
+func littleEndianInt(p []byte) int64 {
+	var value uint64
+	for i := len(p) - 1; i >= 0; i-- {
+		value = value<<8 | uint64(p[i])
+	}
+
+	shift := 64 - 8*uint(len(p))
+	return int64(value<<shift) >> shift
+}
+
+// lzfDecompress decompresses data compressed with LZF, as Redis compresses long strings, checking that
+// it decompresses to exactly length bytes.
+func lzfDecompress(in []byte, length int) ([]byte, error) {
+	out := make([]byte, 0, length)
+
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		if ctrl < 1<<5 {
+			// A run of ctrl + 1 literal bytes
+			if i+ctrl+1 > len(in) || len(out)+ctrl+1 > length {
+				return nil, ErrInvalidRDB
+			}
+			out = append(out, in[i:i+ctrl+1]...)
+			i += ctrl + 1
+			continue
+		}
+
+		// A back reference to n bytes starting offset bytes before the end of the output
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, ErrInvalidRDB
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, ErrInvalidRDB
+		}
+		offset := (ctrl&0x1f)<<8 | int(in[i])
+		i++
+
+		start := len(out) - offset - 1
+		if start < 0 || len(out)+n+2 > length {
+			return nil, ErrInvalidRDB
+		}
+		for j := 0; j < n+2; j++ {
+			out = append(out, out[start+j])
+		}
+	}
+
+	if len(out) != length {
+		return nil, ErrInvalidRDB
+	}
+	return out, nil
+}
+
+// rdbReadError reports the end of the input as ErrInvalidRDB and passes other read errors through.
+func rdbReadError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrInvalidRDB
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+package jellyzset
+
+import "sort"
+
+const (
+	scanBucketLoad    = 8  // Average number of names per bucket above which a scanIndex doubles its buckets
+	scanMaxEmptyVisit = 10 // Empty buckets a scan step may skip per name it is asked for, as in Redis
+)
+
+// scanIndex keeps names in the order of their scan hash, so that ZScan and Scan find the next batch of a
+// scan without visiting the other names.
+//
+// The names are spread over buckets by the top bits of their hashes, and each bucket holds its names sorted
+// by hash and name, so the buckets taken in order hold every name in hash order. The number of buckets
+// doubles and halves with the number of names, by splitting each bucket in two or merging neighbouring
+// buckets, which keeps that order. A step of a scan therefore costs a binary search in one bucket and a
+// visit of the names it returns, plus the empty buckets it skips. The zero value is an empty index.
+type scanIndex struct {
+	buckets [][]scanEntry
+	bits    uint // Number of hash bits selecting the bucket, len(buckets) being 1<<bits
+	length  int
+}
+
+// scanEntry is a name of a scanIndex with its hash.
+type scanEntry struct {
+	hash uint64
+	name string
+}
+
+// less reports whether the entry sorts before the given hash and name.
+func (e scanEntry) less(hash uint64, name string) bool {
+	return e.hash < hash || e.hash == hash && e.name < name
+}
+
+// bucket returns the index of the bucket holding the given hash.
+func (idx *scanIndex) bucket(hash uint64) int {
+	// Shifting a uint64 by 64 gives 0, so a single bucket holds every hash.
+	return int(hash >> (64 - idx.bits))
+}
+
+// add inserts a name, which must not be in the index already.
+func (idx *scanIndex) add(name string) {
+	if idx.buckets == nil {
+		idx.buckets = make([][]scanEntry, 1)
+	}
+
+	hash := scanHash(name)
+	b := idx.bucket(hash)
+	entries := idx.buckets[b]
+	i := sort.Search(len(entries), func(i int) bool { return !entries[i].less(hash, name) })
+	entries = append(entries, scanEntry{})
+	copy(entries[i+1:], entries[i:])
+	entries[i] = scanEntry{hash: hash, name: name}
+	idx.buckets[b] = entries
+
+	idx.length++
+	if idx.length > scanBucketLoad*len(idx.buckets) {
+		idx.grow()
+	}
+}
+
+// remove deletes a name, and reports whether it was in the index.
+func (idx *scanIndex) remove(name string) bool {
+	if idx.length == 0 {
+		return false
+	}
+
+	hash := scanHash(name)
+	b := idx.bucket(hash)
+	entries := idx.buckets[b]
+	i := sort.Search(len(entries), func(i int) bool { return !entries[i].less(hash, name) })
+	if i == len(entries) || entries[i].name != name {
+		return false
+	}
+
+	copy(entries[i:], entries[i+1:])
+	entries[len(entries)-1] = scanEntry{}
+	idx.buckets[b] = entries[:len(entries)-1]
+
+	idx.length--
+	if idx.bits > 0 && idx.length < scanBucketLoad/4*len(idx.buckets) {
+		idx.shrink()
+	}
+	return true
+}
+
+// grow doubles the buckets, splitting each one at the first hash with the next bit set.
+func (idx *scanIndex) grow() {
+	bit := uint64(1) << (63 - idx.bits)
+	buckets := make([][]scanEntry, 2*len(idx.buckets))
+	for b, entries := range idx.buckets {
+		i := sort.Search(len(entries), func(i int) bool { return entries[i].hash&bit != 0 })
+		// Capping the first half keeps an append to it from overwriting the second.
+		buckets[2*b] = entries[:i:i]
+		buckets[2*b+1] = entries[i:]
+	}
+
+	idx.buckets = buckets
+	idx.bits++
+}
+
+// shrink halves the buckets, merging each even bucket with the one after it.
+func (idx *scanIndex) shrink() {
+	buckets := make([][]scanEntry, len(idx.buckets)/2)
+	for b := range buckets {
+		low, high := idx.buckets[2*b], idx.buckets[2*b+1]
+		buckets[b] = append(append(make([]scanEntry, 0, len(low)+len(high)), low...), high...)
+	}
+
+	idx.buckets = buckets
+	idx.bits--
+}
+
+// next returns the next batch of a scan: the names with the count smallest hashes at or after cursor, along
+// with any other name sharing the last of those hashes, so a cursor never falls between two names. The names
+// are returned in hash order together with the cursor of the next batch, which is 0 when no name hashes past
+// the batch. A batch may hold fewer names when it skips too many empty buckets, as a Redis SCAN does.
+func (idx *scanIndex) next(cursor uint64, count int) ([]string, uint64) {
+	if count == 0 {
+		count = defaultScanCount
+	}
+	if idx.length == 0 {
+		return []string{}, 0
+	}
+
+	names := make([]string, 0, count)
+	b := idx.bucket(cursor)
+	entries := idx.buckets[b]
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].hash >= cursor })
+	last := uint64(0)
+	emptyVisits := count * scanMaxEmptyVisit
+	for {
+		for ; i < len(entries); i++ {
+			if len(names) >= count && entries[i].hash != last {
+				return names, last + 1
+			}
+			names = append(names, entries[i].name)
+			last = entries[i].hash
+		}
+
+		if b++; b == len(idx.buckets) {
+			return names, 0
+		}
+		// The hashes of the next buckets are all past the batch.
+		if len(names) >= count {
+			return names, last + 1
+		}
+		if entries, i = idx.buckets[b], 0; len(entries) == 0 {
+			if emptyVisits--; emptyVisits == 0 {
+				return names, uint64(b) << (64 - idx.bits)
+			}
+		}
+	}
+}
@@ -0,0 +1,582 @@
+package jellyzset
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// Snapshot layout, version 3. All lengths and counts are unsigned varints and every string is
+// prefixed with its length:
+//
+//	magic "JZSS" | version byte | key count
+//	for each key: key | deadline in Unix nanoseconds as a signed varint, 0 for none | member count
+//	    for each member, in skip list order: member | score as 8 big-endian bytes | value length | value
+//	    count of members with a deadline
+//	    for each member with a deadline: member | deadline in Unix nanoseconds as a signed varint
+//	CRC-32 (Castagnoli) of everything above, as 4 big-endian bytes
+//
+// Version 1 snapshots, which have no deadlines, and version 2 snapshots, which have no member deadlines,
+// are still read.
+const (
+	snapshotMagic     = "JZSS"
+	snapshotVersion   = 3
+	maxSnapshotLength = 512 << 20 // Largest key, member or encoded value accepted, as the Redis proto-max-bulk-len
+)
+
+var (
+	// ErrInvalidSnapshot is returned by ReadSnapshot when the input is truncated, malformed or not a snapshot.
+	ErrInvalidSnapshot = errors.New("invalid or truncated snapshot")
+
+	// ErrSnapshotVersion is returned by ReadSnapshot when the snapshot was written by an unsupported format version.
+	ErrSnapshotVersion = errors.New("unsupported snapshot version")
+
+	// ErrSnapshotChecksum is returned by ReadSnapshot when the snapshot does not match its checksum.
+	ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+)
+
+var snapshotTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ValueCodec encodes and decodes the values of a TypedZSet when it is written to or read from a snapshot.
+// An empty encoding is allowed and is passed back to DecodeValue as is.
+type ValueCodec[V any] interface {
+	EncodeValue(value V) ([]byte, error)
+	DecodeValue(data []byte) (V, error)
+}
+
+// GobCodec is the default ValueCodec, which encodes values with encoding/gob. A nil value is encoded as an
+// empty slice and decoded as the zero value of V. When V is an interface type, as for ZSet, every concrete
+// type stored in it other than the predeclared ones must be registered with gob.Register.
+type GobCodec[V any] struct{}
+
+// EncodeValue encodes the value with encoding/gob.
+func (GobCodec[V]) EncodeValue(value V) ([]byte, error) {
+	if any(value) == nil {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeValue decodes a value encoded by EncodeValue.
+func (GobCodec[V]) DecodeValue(data []byte) (V, error) {
+	var value V
+	if len(data) == 0 {
+		return value, nil
+	}
+
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return value, err
+}
+
+// SetValueCodec sets the codec used by WriteSnapshot and ReadSnapshot to encode and decode member values.
+//
+// A TypedZSet uses GobCodec until another codec is set. A custom codec is needed when values cannot be
+// handled by encoding/gob, or to keep the encoding stable across changes to the value types.
+//
+// Parameters:
+//   - codec: The codec to use for values, or nil to restore GobCodec.
+//
+// Example:
+//
+//	zset := jellyzset.NewTyped[string]()
+//	zset.SetValueCodec(stringCodec{})
+//
+// In this example, where stringCodec converts between a string and its bytes, snapshots of zset store the values as raw bytes instead of gob encodings.
+func (z *TypedZSet[V]) SetValueCodec(codec ValueCodec[V]) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	if codec == nil {
+		codec = GobCodec[V]{}
+	}
+	z.codec = codec
+}
+
+// WriteSnapshot writes every sorted set of the ZSet to w in a versioned, checksummed binary format.
+//
+// The snapshot is consistent: the sorted sets are copied while they are all read-locked, and the copy is
+// written once the locks are released, so a slow w does not hold up readers or writers. Members are written
+// in skip list order, which lets ReadSnapshot rebuild each skip list in linear time. The deadlines of keys
+// and members are kept, and the keys and members past their deadline are left out. Values are encoded with
+// the codec set by SetValueCodec. Output is buffered, and w is not closed.
+//
+// Parameters:
+//   - w: The writer to write the snapshot to.
+//
+// Returns:
+//   - An error from the codec or from w, if any.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("leaderboard", 3.5, "member1", "value1")
+//	file, _ := os.Create("zset.snapshot")
+//	err := zset.WriteSnapshot(file)
+//	file.Close()
+//
+// In this example, "leaderboard" and its member are written to "zset.snapshot", from which ReadSnapshot can restore them after a restart.
+func (z *TypedZSet[V]) WriteSnapshot(w io.Writer) error {
+	contents, codec := z.contents()
+
+	buffered := bufio.NewWriter(w)
+	sw := &snapshotWriter{w: buffered, crc: crc32.New(snapshotTable)}
+
+	sw.write([]byte(snapshotMagic))
+	sw.write([]byte{snapshotVersion})
+	sw.uvarint(uint64(len(contents)))
+
+	for _, c := range contents {
+		sw.string(c.key)
+		if c.deadline.IsZero() {
+			sw.varint(0)
+		} else {
+			sw.varint(c.deadline.UnixNano())
+		}
+		sw.uvarint(uint64(len(c.entries)))
+
+		for i := 0; i < len(c.entries) && sw.err == nil; i++ {
+			e := c.entries[i]
+			if err := snapshotEntry(sw, codec, e.Member, e.Score, e.Value); err != nil {
+				return err
+			}
+		}
+
+		sw.uvarint(uint64(len(c.expiries)))
+		for _, e := range c.expiries {
+			sw.string(e.member)
+			sw.varint(e.deadline.UnixNano())
+		}
+	}
+
+	if sw.err != nil {
+		return sw.err
+	}
+
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], sw.crc.Sum32())
+	if _, err := buffered.Write(sum[:]); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// contents copies the members and deadlines of every sorted set, in key order, leaving out the keys and
+// members past their deadline, and returns them with the codec of the values. The sorted sets are all
+// read-locked until the copy is complete, so it is a single point in time, as the one dump makes under the
+// exclusive keyspace lock.
+func (z *TypedZSet[V]) contents() ([]keyEntries[V], ValueCodec[V]) {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	now := z.clock.Now()
+	keys := make([]string, 0, len(z.records))
+	for key, set := range z.records {
+		if !set.expiredAt(now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	// Lock the sets in key order, as readKeys does
+	contents := make([]keyEntries[V], 0, len(keys))
+	for _, key := range keys {
+		set := z.records[key]
+		emptied := z.rlockSet(key, set)
+		defer set.mu.RUnlock()
+
+		// A set left empty by its expired members is removed with its key by the next access
+		if emptied {
+			continue
+		}
+		contents = append(contents, keyEntries[V]{
+			key:      key,
+			entries:  set.entries(),
+			deadline: set.deadline,
+			expiries: append([]memberDeadline(nil), set.expiries.deadlines...),
+		})
+	}
+
+	return contents, z.codec
+}
+
+// ReadSnapshot replaces the contents of the ZSet with a snapshot written by WriteSnapshot.
+//
+// The whole snapshot is read, checked against its checksum and decoded before the ZSet is touched, so on
+// error the ZSet is left as it was. Each skip list is bulk loaded from the members in stored order in linear
+// time. Keys and members get their deadline back, and those whose deadline has passed are dropped. Callers
+// blocked in BZPopMin or BZPopMax on a restored key are served once the snapshot is loaded. When an
+// append-only log is open, every restored key is recorded in it.
+//
+// Parameters:
+//   - r: The reader to read the snapshot from.
+//
+// Returns:
+//   - ErrInvalidSnapshot if the input is truncated or malformed, ErrSnapshotVersion if its format version is
+//     not supported, ErrSnapshotChecksum if it is corrupted, or an error from the codec or from r.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	file, _ := os.Open("zset.snapshot")
+//	err := zset.ReadSnapshot(file)
+//	file.Close()
+//
+// In this example, the sorted sets saved by WriteSnapshot are restored into zset, replacing anything it held.
+func (z *TypedZSet[V]) ReadSnapshot(r io.Reader) error {
+	z.mu.RLock()
+	codec, now := z.codec, z.clock.Now()
+	z.mu.RUnlock()
+
+	sr := &snapshotReader{r: bufio.NewReader(r), crc: crc32.New(snapshotTable)}
+
+	magic, err := sr.bytes(uint64(len(snapshotMagic)))
+	if err != nil {
+		return err
+	}
+	if string(magic) != snapshotMagic {
+		return ErrInvalidSnapshot
+	}
+
+	version, err := sr.ReadByte()
+	if err != nil {
+		return err
+	}
+	if version < 1 || version > snapshotVersion {
+		return ErrSnapshotVersion
+	}
+
+	keyCount, err := sr.uvarint()
+	if err != nil {
+		return err
+	}
+
+	records := make(map[string]*zset[V])
+	volatile := make(map[string]*zset[V])
+	expiring := make(map[string]*zset[V])
+	seen := make(map[string]bool)
+	for i := uint64(0); i < keyCount; i++ {
+		key, err := sr.string()
+		if err != nil {
+			return err
+		}
+		if seen[key] {
+			return ErrInvalidSnapshot
+		}
+		seen[key] = true
+
+		var deadline int64
+		if version > 1 {
+			if deadline, err = sr.varint(); err != nil {
+				return err
+			}
+		}
+
+		members, err := readSnapshotMembers(sr, codec, true)
+		if err != nil {
+			return err
+		}
+
+		var expiries []memberDeadline
+		if version > 2 {
+			if expiries, err = readSnapshotExpiries(sr, len(members)); err != nil {
+				return err
+			}
+			members, expiries = dropExpiredMembers(members, expiries, now)
+		}
+
+		set := &zset[V]{records: make(map[string]*zslNode[V], len(members)), zsl: newZSkipList[V]()}
+		set.frequency.Store(lfuInitValue)
+		if deadline != 0 {
+			set.deadline = time.Unix(0, deadline)
+			if set.expiredAt(now) {
+				continue
+			}
+			volatile[key] = set
+		}
+
+		for _, node := range set.zsl.build(members) {
+			set.remember(node)
+		}
+		for _, e := range expiries {
+			if set.records[e.member] == nil {
+				return ErrInvalidSnapshot
+			}
+			set.expiries.set(e.member, e.deadline)
+		}
+		if set.expiries.Len() > 0 {
+			expiring[key] = set
+		}
+		records[key] = set
+	}
+
+	expected := sr.crc.Sum32()
+	var sum [4]byte
+	if _, err := io.ReadFull(sr.r, sum[:]); err != nil {
+		return ErrInvalidSnapshot
+	}
+	if binary.BigEndian.Uint32(sum[:]) != expected {
+		return ErrSnapshotChecksum
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	z.setRecords(records)
+	z.volatile, z.expiring = volatile, expiring
+	z.log(logRecord[V]{op: aofFlush})
+	for key, set := range records {
+		set.mu.Lock()
+		z.log(logRecord[V]{op: aofStore, key: key, entries: set.entries()})
+		if !set.deadline.IsZero() {
+			z.log(logRecord[V]{op: aofExpire, key: key, deadline: set.deadline})
+		}
+		for _, e := range set.expiries.deadlines {
+			z.log(logRecord[V]{op: aofExpireMember, key: key, members: []string{e.member}, deadline: e.deadline})
+		}
+		z.serveWaiters(key, set)
+		set.mu.Unlock()
+	}
+	z.startSweeper()
+
+	return nil
+}
+
+// readSnapshotExpiries reads a count of members with a deadline, which cannot exceed the number of members
+// of the set, followed by each member and its deadline.
+func readSnapshotExpiries(sr *snapshotReader, members int) ([]memberDeadline, error) {
+	count, err := sr.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(members) {
+		return nil, ErrInvalidSnapshot
+	}
+
+	expiries := make([]memberDeadline, 0, count)
+	for i := uint64(0); i < count; i++ {
+		member, err := sr.string()
+		if err != nil {
+			return nil, err
+		}
+		deadline, err := sr.varint()
+		if err != nil {
+			return nil, err
+		}
+		expiries = append(expiries, memberDeadline{member: member, deadline: time.Unix(0, deadline)})
+	}
+
+	return expiries, nil
+}
+
+// dropExpiredMembers leaves out of members and their deadlines the members whose deadline is not after now.
+func dropExpiredMembers[V any](members []Entry[V], expiries []memberDeadline, now time.Time) ([]Entry[V], []memberDeadline) {
+	expired := make(map[string]bool)
+	kept := expiries[:0]
+	for _, e := range expiries {
+		if now.Before(e.deadline) {
+			kept = append(kept, e)
+		} else {
+			expired[e.member] = true
+		}
+	}
+
+	if len(expired) == 0 {
+		return members, kept
+	}
+
+	live := members[:0]
+	for _, m := range members {
+		if !expired[m.Member] {
+			live = append(live, m)
+		}
+	}
+	return live, kept
+}
+
+// readSnapshotMembers reads a count followed by that many members. When ordered is true, it checks that
+// the members are in skip list order, as they are in a sorted set.
+func readSnapshotMembers[V any](sr *snapshotReader, codec ValueCodec[V], ordered bool) ([]Entry[V], error) {
+	count, err := sr.uvarint()
+	if err != nil {
+		return nil, err
+	}
+
+	// The count is not trusted before the checksum is verified, so it does not size the slice up front
+	members := make([]Entry[V], 0, min(count, 1024))
+	for j := uint64(0); j < count; j++ {
+		member, err := sr.string()
+		if err != nil {
+			return nil, err
+		}
+
+		score, err := sr.float()
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(score) {
+			return nil, ErrInvalidSnapshot
+		}
+
+		if n := len(members); ordered && n > 0 {
+			last := members[n-1]
+			if score < last.Score || (score == last.Score && member <= last.Member) {
+				return nil, ErrInvalidSnapshot
+			}
+		}
+
+		data, err := sr.lengthPrefixed()
+		if err != nil {
+			return nil, err
+		}
+		value, err := codec.DecodeValue(data)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, Entry[V]{Member: member, Score: score, Value: value})
+	}
+
+	return members, nil
+}
+
+// snapshotWriter writes the parts of a snapshot while updating its checksum. The first error is kept
+// and every later write is skipped, so it only needs to be checked once.
+type snapshotWriter struct {
+	w   io.Writer
+	crc hash.Hash32
+	err error
+}
+
+func (sw *snapshotWriter) write(p []byte) {
+	if sw.err != nil {
+		return
+	}
+	if _, sw.err = sw.w.Write(p); sw.err == nil {
+		sw.crc.Write(p)
+	}
+}
+
+func (sw *snapshotWriter) uvarint(n uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	sw.write(buf[:binary.PutUvarint(buf[:], n)])
+}
+
+func (sw *snapshotWriter) varint(n int64) {
+	var buf [binary.MaxVarintLen64]byte
+	sw.write(buf[:binary.PutVarint(buf[:], n)])
+}
+
+func (sw *snapshotWriter) float(f float64) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(f))
+	sw.write(buf[:])
+}
+
+func (sw *snapshotWriter) string(s string) {
+	sw.uvarint(uint64(len(s)))
+	sw.write([]byte(s))
+}
+
+// snapshotEntry writes a member, its score and its value encoded with the codec.
+func snapshotEntry[V any](sw *snapshotWriter, codec ValueCodec[V], member string, score float64, value V) error {
+	data, err := codec.EncodeValue(value)
+	if err != nil {
+		return err
+	}
+
+	sw.string(member)
+	sw.float(score)
+	sw.uvarint(uint64(len(data)))
+	sw.write(data)
+	return nil
+}
+
+// snapshotReader reads the parts of a snapshot while updating its checksum. A truncated input is
+// reported as ErrInvalidSnapshot.
+type snapshotReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	err error // Last error from reading r
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err != nil {
+		sr.err = snapshotReadError(err)
+		return 0, sr.err
+	}
+	sr.crc.Write([]byte{b})
+	return b, nil
+}
+
+func (sr *snapshotReader) bytes(n uint64) ([]byte, error) {
+	if n > maxSnapshotLength {
+		return nil, ErrInvalidSnapshot
+	}
+
+	p := make([]byte, n)
+	if _, err := io.ReadFull(sr.r, p); err != nil {
+		return nil, snapshotReadError(err)
+	}
+	sr.crc.Write(p)
+	return p, nil
+}
+
+func (sr *snapshotReader) uvarint() (uint64, error) {
+	n, err := binary.ReadUvarint(sr)
+	if err != nil && sr.err == nil {
+		// The bytes were read, so the varint overflows 64 bits
+		return 0, ErrInvalidSnapshot
+	}
+	return n, err
+}
+
+func (sr *snapshotReader) varint() (int64, error) {
+	n, err := binary.ReadVarint(sr)
+	if err != nil && sr.err == nil {
+		return 0, ErrInvalidSnapshot
+	}
+	return n, err
+}
+
+func (sr *snapshotReader) float() (float64, error) {
+	p, err := sr.bytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.BigEndian.Uint64(p)), nil
+}
+
+func (sr *snapshotReader) lengthPrefixed() ([]byte, error) {
+	n, err := sr.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	return sr.bytes(n)
+}
+
+func (sr *snapshotReader) string() (string, error) {
+	p, err := sr.lengthPrefixed()
+	return string(p), err
+}
+
+// snapshotReadError reports the end of the input as ErrInvalidSnapshot and passes other read errors through.
+func snapshotReadError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrInvalidSnapshot
+	}
+	return err
+}
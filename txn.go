@@ -0,0 +1,323 @@
+package jellyzset
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrWatchedKeyChanged is returned by Watch.Txn when a watched key changed after it was watched, in which
+// case the transaction does not run, as a Redis EXEC after WATCH replies with a null.
+var ErrWatchedKeyChanged = errors.New("transaction aborted because a watched key changed")
+
+// Tx applies operations to a ZSet inside a transaction started by Txn. Every operation sees the changes
+// made by the previous ones, and no other caller sees the ZSet until the transaction ends. A Tx must not be
+// used once the function it was passed to has returned.
+type Tx[V any] struct {
+	z       *TypedZSet[V]
+	records []logRecord[V] // Mutations made by the transaction, written to the append-only log as one record
+}
+
+// Watch holds the versions of keys taken by TypedZSet.Watch, and runs a transaction only if none of them
+// changed since, like the Redis WATCH command.
+type Watch[V any] struct {
+	z        *TypedZSet[V]
+	versions map[string]uint64 // Version of each watched key, 0 if it was missing
+	since    uint64            // Last version given out when the keys were watched
+}
+
+// Txn runs fn as a transaction: the operations fn applies through tx act on several keys atomically, like
+// the commands queued between MULTI and EXEC in Redis.
+//
+// The keyspace is locked for as long as fn runs, so fn should be short, and must use tx rather than the
+// ZSet itself, which would wait for the transaction to end. As in Redis, there is no rollback: the changes
+// made before fn returns an error are kept, so fn should check its conditions before making changes. The
+// mutations of a transaction are written to the append-only log as a single record, so that they are
+// replayed all together or not at all. Use Watch to run a transaction only if keys read beforehand did not
+// change in between.
+//
+// Parameters:
+//   - fn: The function applying the operations of the transaction.
+//
+// Returns:
+//   - The error returned by fn, or ErrOOM if the memory limit is reached, in which case fn is not called.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("pending", 1.0, "job1", "payload1")
+//	err := zset.Txn(func(tx *jellyzset.Tx[interface{}]) error {
+//		job, err := tx.ZPopMin("pending")
+//		if err != nil {
+//			return err
+//		}
+//		tx.ZAdd("running", job.Score, job.Member, job.Value)
+//		return nil
+//	})
+//
+// In this example, "job1" moves from "pending" to "running", and no other caller can see it in both keys or in neither.
+func (z *TypedZSet[V]) Txn(fn func(tx *Tx[V]) error) error {
+	return z.Watch().Txn(fn)
+}
+
+// Watch takes the current versions of the given keys, so that a transaction started with Watch.Txn only
+// runs if none of them changed since, like the Redis WATCH command.
+//
+// Every change to a key gives it a new version: adding, rescoring, removing or expiring members, changing
+// a deadline, and removing the key, including when it expires or is evicted. The keys read between Watch and
+// Txn can therefore be relied upon inside the transaction, which is retried when it fails with
+// ErrWatchedKeyChanged. A missing key is seen as changed once it is created, and also when any key is removed,
+// since a key created and removed again leaves no version behind.
+//
+// Parameters:
+//   - keys: The keys to watch.
+//
+// Returns:
+//   - The watch, whose Txn method runs a transaction.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("leaderboard", 10, "alice", nil)
+//	for {
+//		watch := zset.Watch("leaderboard")
+//		_, score := zset.ZScore("leaderboard", "alice")
+//		err := watch.Txn(func(tx *jellyzset.Tx[interface{}]) error {
+//			if score < 100 {
+//				tx.ZAdd("leaderboard", score*2, "alice", nil)
+//			}
+//			return nil
+//		})
+//		if err != jellyzset.ErrWatchedKeyChanged {
+//			break
+//		}
+//	}
+//
+// In this example, the score of "alice" is doubled while below 100, retrying if "leaderboard" changed between the read and the transaction.
+func (z *TypedZSet[V]) Watch(keys ...string) *Watch[V] {
+	z.mu.RLock()
+	w := &Watch[V]{z: z, versions: make(map[string]uint64, len(keys)), since: z.versions.Load()}
+	for _, key := range keys {
+		w.versions[key] = 0
+		if set := z.lookup(key); set != nil {
+			emptied := z.rlockSet(key, set)
+			w.versions[key] = set.version
+			set.mu.RUnlock()
+
+			// A key left empty by its expired members is removed first, and watched as missing
+			if emptied {
+				z.mu.RUnlock()
+				z.deleteIfEmpty(key, set)
+				return z.Watch(keys...)
+			}
+		}
+	}
+	z.mu.RUnlock()
+	return w
+}
+
+// Txn runs fn as a transaction like TypedZSet.Txn, unless a watched key changed since it was watched.
+//
+// Parameters:
+//   - fn: The function applying the operations of the transaction.
+//
+// Returns:
+//   - ErrWatchedKeyChanged if a watched key changed, in which case fn is not called, ErrOOM if the memory
+//     limit is reached, or the error returned by fn.
+//
+// Example:
+//
+//	watch := zset.Watch("queue")
+//	entries := zset.ZRange("queue", 0, 0)
+//	err := watch.Txn(func(tx *jellyzset.Tx[interface{}]) error {
+//		if len(entries) > 0 {
+//			tx.ZRem("queue", entries[0].Member)
+//		}
+//		return nil
+//	})
+//
+// In this example, the first member of "queue" is removed unless "queue" changed after it was read, in which case err is ErrWatchedKeyChanged.
+func (w *Watch[V]) Txn(fn func(tx *Tx[V]) error) error {
+	z := w.z
+	if err := z.reserve(); err != nil {
+		return err
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	for key, version := range w.versions {
+		current := uint64(0)
+		if set := z.lookup(key); set != nil {
+			current = set.version
+		}
+		if current != version || version == 0 && z.removed > w.since {
+			return ErrWatchedKeyChanged
+		}
+	}
+
+	tx := &Tx[V]{z: z}
+	z.txn = tx
+	defer func() {
+		z.txn = nil
+		switch len(tx.records) {
+		case 0:
+		case 1:
+			z.appendLog(tx.records[0])
+		default:
+			z.appendLog(logRecord[V]{op: aofMulti, batch: tx.records})
+		}
+	}()
+
+	return fn(tx)
+}
+
+// ZAdd adds a member or replaces its score and value, like TypedZSet.ZAdd.
+func (tx *Tx[V]) ZAdd(key string, score float64, member string, value V) int {
+	tx.z.zadd(key, tx.set(key, true), score, member, value)
+	return 1
+}
+
+// ZIncrBy increments the score of a member, adding it if needed, like TypedZSet.ZIncrBy.
+func (tx *Tx[V]) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	if math.IsNaN(increment) {
+		return 0, ErrNotANumber
+	}
+	return tx.z.zincrby(key, tx.set(key, true), increment, member)
+}
+
+// ZRem removes a member, like TypedZSet.ZRem.
+func (tx *Tx[V]) ZRem(key, member string) bool {
+	set := tx.set(key, false)
+	if set == nil {
+		return false
+	}
+	return tx.z.zrem(key, set, member)
+}
+
+// ZMove moves a member with its value and deadline to another key, like TypedZSet.ZMove.
+func (tx *Tx[V]) ZMove(src, dst, member string, newScore *float64) (bool, error) {
+	if newScore != nil && math.IsNaN(*newScore) {
+		return false, ErrNotANumber
+	}
+
+	z := tx.z
+	from := tx.set(src, false)
+	if from == nil {
+		return false, nil
+	}
+	node, exists := from.records[member]
+	if !exists {
+		return false, nil
+	}
+
+	score, value := node.score, node.value
+	if newScore != nil {
+		score = *newScore
+	}
+	if src == dst {
+		z.zadd(dst, from, score, member, value)
+		return true, nil
+	}
+
+	deadline := from.expiries.deadline(member)
+	z.zrem(src, from, member)
+	to := tx.set(dst, true)
+	z.zadd(dst, to, score, member, value)
+
+	// The moved member replaces the one in dst, including its deadline.
+	if !deadline.IsZero() {
+		z.expireMemberAt(dst, member, deadline)
+	} else if to.expiries.remove(member) {
+		z.log(logRecord[V]{op: aofPersistMember, key: dst, members: []string{member}})
+	}
+	return true, nil
+}
+
+// ZPopMin removes and returns the member with the lowest score, like TypedZSet.ZPopMin.
+func (tx *Tx[V]) ZPopMin(key string) (Entry[V], error) {
+	return tx.pop(key, false)
+}
+
+// ZPopMax removes and returns the member with the highest score, like TypedZSet.ZPopMax.
+func (tx *Tx[V]) ZPopMax(key string) (Entry[V], error) {
+	return tx.pop(key, true)
+}
+
+// ZClear removes a key and its sorted set, like TypedZSet.ZClear.
+func (tx *Tx[V]) ZClear(key string) {
+	tx.z.zclear(key)
+}
+
+// ZScore returns the score of a member, like TypedZSet.ZScore.
+func (tx *Tx[V]) ZScore(key, member string) (bool, float64) {
+	set := tx.set(key, false)
+	if set == nil {
+		return false, 0
+	}
+	score, exists := set.scoreOf(member)
+	return exists, score
+}
+
+// ZCard returns the number of members in a sorted set, like TypedZSet.ZCard.
+func (tx *Tx[V]) ZCard(key string) int {
+	set := tx.set(key, false)
+	if set == nil {
+		return 0
+	}
+	return len(set.records)
+}
+
+// ZRangeQuery returns the entries of a sorted set selected by a query, like TypedZSet.ZRangeQuery.
+func (tx *Tx[V]) ZRangeQuery(key string, query RangeQuery) ([]Entry[V], error) {
+	lex, err := query.lexRange()
+	if err != nil {
+		return nil, err
+	}
+
+	set := tx.set(key, false)
+	if set == nil {
+		return nil, nil
+	}
+	return set.query(query, lex), nil
+}
+
+// ZKeyExists reports whether a key exists, like TypedZSet.ZKeyExists.
+func (tx *Tx[V]) ZKeyExists(key string) bool {
+	return tx.z.keyExists(key)
+}
+
+func (tx *Tx[V]) pop(key string, max bool) (Entry[V], error) {
+	set := tx.set(key, false)
+	if set == nil {
+		return Entry[V]{}, ErrKeyNotFound
+	}
+	return tx.z.zpop(key, set, max)
+}
+
+// set returns the sorted set at the given key with its expired members removed, as writeKey does. A missing
+// key is created when create is true; otherwise the set is nil. The keyspace is locked by the transaction,
+// so the set needs no lock of its own.
+func (tx *Tx[V]) set(key string, create bool) *zset[V] {
+	z := tx.z
+	set := z.lookup(key)
+	if set != nil && !z.purgeKey(key, set) {
+		set = nil
+	}
+	if set == nil {
+		if !create {
+			return nil
+		}
+		set = z.getOrCreate(key)
+	}
+
+	z.touch(set)
+	return set
+}
+
+// changed gives the key a new version, so that the transactions watching it do not run. The caller must
+// hold z.mu and the write lock of the set, or z.mu exclusively.
+func (z *TypedZSet[V]) changed(key string) {
+	if set, exists := z.records[key]; exists {
+		set.version = z.versions.Add(1)
+	}
+}
@@ -0,0 +1,475 @@
+package jellyzset
+
+import "math"
+
+// ZSet represents a collection of sorted sets, each identified by a unique key, whose members carry
+// values of any type. It is a TypedZSet[interface{}] that keeps the original API, where range queries
+// return flattened slices of members and scores instead of entries.
+type ZSet struct {
+	*TypedZSet[interface{}]
+}
+
+// New creates a new instance of the ZSet data structure.
+func New() *ZSet {
+	return &ZSet{TypedZSet: NewTyped[interface{}]()}
+}
+
+// ZAddWithOptions adds members to the sorted set stored at the given key, honouring the Redis ZADD flags.
+//
+// NX only adds new members and XX only updates existing ones. GT and LT only update an existing member
+// when the new score is greater or less than its current score; they never prevent new members from
+// being added. With INCR, the single member's score is incremented by the given score instead of being
+// replaced, and the member's existing value is kept. Invalid flag combinations are rejected the same
+// way Redis rejects them, before anything is modified.
+//
+// Parameters:
+//   - key:     The key associated with the sorted set.
+//   - opts:    The ZADD flags to apply.
+//   - members: The members to add or update, with their scores and values.
+//
+// Returns:
+//   - The number of members added, or added and updated when CH is set. With INCR this is 1 if the
+//     increment was applied and 0 if a flag prevented it; use ZAddIncr to get the resulting score.
+//   - An error if the flags are incompatible, INCR is used with several members, or a score is NaN.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	added, err := zset.ZAddWithOptions("mySortedSet", jellyzset.ZAddOptions{GT: true, CH: true},
+//		jellyzset.ZMember{Score: 5.0, Member: "member1"},
+//		jellyzset.ZMember{Score: 1.0, Member: "member2"})
+//
+// In this example, "member1" is raised to 5.0 because the new score is greater, and "member2" is added. Since CH is set, added will be 2.
+func (z *ZSet) ZAddWithOptions(key string, opts ZAddOptions, members ...ZMember) (int, error) {
+	return z.TypedZSet.ZAddWithOptions(key, opts, toEntries(members)...)
+}
+
+// ZAddMany adds or updates many members of the sorted set stored at the given key in one call.
+//
+// The members are sorted by score and member and threaded into the skip list in a single pass, so
+// loading many members is considerably cheaper than calling ZAdd for each one. When the key does not
+// exist or its sorted set is empty, the skip list is built in linear time. If the same member appears
+// more than once, the last occurrence wins, as if the members had been added one by one.
+//
+// Parameters:
+//   - key:     The key associated with the sorted set.
+//   - members: The members to add or update, with their scores and values.
+//
+// Returns:
+//   - The number of members that were added; updated members are not counted.
+//   - ErrNotANumber if any score is NaN, in which case nothing is added.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	added, err := zset.ZAddMany("mySortedSet",
+//		jellyzset.ZMember{Score: 3.5, Member: "member1", Value: "value1"},
+//		jellyzset.ZMember{Score: 2.0, Member: "member2", Value: "value2"})
+//
+// In this example, we create a sorted set "mySortedSet" holding two members in a single call, and added will be 2.
+func (z *ZSet) ZAddMany(key string, members ...ZMember) (int, error) {
+	return z.TypedZSet.ZAddMany(key, toEntries(members)...)
+}
+
+// ZRangeQuery returns the members of the sorted set at the given key selected by a range query, like
+// TypedZSet.ZRangeQuery, flattened into a slice of interfaces.
+//
+// The slice holds the members in the format [member1, member2, ...], or [member1, score1, member2, score2, ...]
+// when the query is built with WithScores. It is empty if the key does not exist or no member is in range.
+//
+// Parameters:
+//   - key:   The key associated with the sorted set.
+//   - query: The range query, created with RangeByRank, RangeByScore or RangeByLex.
+//
+// Returns:
+//   - A slice of interfaces containing the selected members, and their scores with WithScores.
+//   - ErrInvalidLexRange if the query is lexicographic and one of its bounds is not valid.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 1.0, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	zset.ZAdd("mySortedSet", 3.0, "member3", "value3")
+//	result, err := zset.ZRangeQuery("mySortedSet", jellyzset.RangeByRank(0, 1).Rev().WithScores())
+//
+// In this example, the two members with the highest scores are selected, and result will be ["member3", 3.0, "member2", 2.0].
+func (z *ZSet) ZRangeQuery(key string, query RangeQuery) ([]interface{}, error) {
+	entries, err := z.TypedZSet.ZRangeQuery(key, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return flattenEntries(entries, query.withScores), nil
+}
+
+// ZScoreRange retrieves a range of elements with scores within the specified range from the sorted set stored at the given key.
+//
+// If the key does not exist or the provided minimum score is greater than the maximum score, it returns an empty slice.
+//
+// Parameters:
+//   - key:  The key associated with the sorted set.
+//   - min:  The minimum score of the range (inclusive).
+//   - max:  The maximum score of the range (inclusive).
+//
+// Returns:
+//   - A slice of interfaces containing elements with scores within the specified range.
+//   - The slice is empty if there are no elements within the range or if the key does not exist.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	zset.ZAdd("mySortedSet", 4.2, "member3", "value3")
+//	results := zset.ZScoreRange("mySortedSet", 2.5, 4.0)
+//
+// In this example, we create a sorted set "mySortedSet" and add three members. ZScoreRange is then used to retrieve elements within the score range of 2.5 to 4.0, and the results slice will contain the elements "member1" and "member2" with their respective scores.
+func (z *ZSet) ZScoreRange(key string, min, max float64) []interface{} {
+	result, _ := z.ZRangeQuery(key, RangeByScore(min, max).WithScores())
+	return result
+}
+
+// ZRevScoreRange returns all the elements in the sorted set at the given key with scores falling within the range [max, min].
+//
+// This function returns elements ordered from high to low scores within the specified range, including elements with scores equal to max or min.
+//
+// If the key does not exist or if the provided max score is less than the min score, the function returns an empty slice.
+//
+// Parameters:
+//   - key: The key associated with the sorted set.
+//   - max: The maximum score for the range.
+//   - min: The minimum score for the range.
+//
+// Returns:
+//   - A slice of interfaces containing elements with scores within the specified range, ordered from high to low scores.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	zset.ZAdd("mySortedSet", 4.0, "member3", "value3")
+//	result := zset.ZRevScoreRange("mySortedSet", 4.0, 2.0)
+//
+// In this example, we create a sorted set "mySortedSet" and add three members with different scores. ZRevScoreRange is used to retrieve elements within the score range [4.0, 2.0]. The result will be a slice containing the elements "member3" with a score of 4.0 and "member2" with a score of 2.0, ordered from high to low scores.
+func (z *ZSet) ZRevScoreRange(key string, max, min float64) []interface{} {
+	result, _ := z.ZRangeQuery(key, RangeByScore(max, min).Rev().WithScores())
+	return result
+}
+
+// ZUnion computes the union of the sorted sets at the given keys like ZUnionStore, without storing it.
+//
+// Returns:
+//   - A slice of interfaces in the format [member1, score1, member2, score2, ...], ordered by score.
+//   - An error if no keys are given or the number of weights does not match the number of keys.
+func (z *ZSet) ZUnion(keys []string, opts *ZStoreOptions) ([]interface{}, error) {
+	entries, err := z.TypedZSet.ZUnion(keys, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return flattenEntries(entries, true), nil
+}
+
+// ZInter computes the intersection of the sorted sets at the given keys like ZInterStore, without storing it.
+//
+// Returns:
+//   - A slice of interfaces in the format [member1, score1, member2, score2, ...], ordered by score.
+//   - An error if no keys are given or the number of weights does not match the number of keys.
+func (z *ZSet) ZInter(keys []string, opts *ZStoreOptions) ([]interface{}, error) {
+	entries, err := z.TypedZSet.ZInter(keys, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return flattenEntries(entries, true), nil
+}
+
+// ZDiff computes the difference between the first sorted set and all the following ones like ZDiffStore, without storing it.
+//
+// Returns:
+//   - A slice of interfaces in the format [member1, score1, member2, score2, ...], ordered by score.
+//   - ErrNoInputKeys if no keys are given.
+func (z *ZSet) ZDiff(keys []string) ([]interface{}, error) {
+	entries, err := z.TypedZSet.ZDiff(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return flattenEntries(entries, true), nil
+}
+
+// ZRange returns a range of elements from the sorted set at the given key.
+//
+// It starts at the 'start' index and goes up to the 'stop' index (inclusive).
+// If 'start' is greater than 'stop' or the key does not exist, an empty slice is returned.
+//
+// Parameters:
+//   - key:   The key associated with the sorted set.
+//   - start: The starting index of the range.
+//   - stop:  The ending index of the range.
+//
+// Returns:
+//   - A slice of interfaces containing the selected elements within the specified range.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	zset.ZAdd("mySortedSet", 4.0, "member3", "value3")
+//	result := zset.ZRange("mySortedSet", 0, 1)
+//
+// In this example, we create a sorted set "mySortedSet" and add three members. ZRange is used to retrieve elements within the range [0, 1]. The result will be a slice containing the elements "member2" and "member1".
+func (z *ZSet) ZRange(key string, start, stop int) []interface{} {
+	result, _ := z.ZRangeQuery(key, RangeByRank(start, stop))
+	return result
+}
+
+// ZRangeWithScore returns a range of elements with scores from the sorted set at the given key.
+//
+// It starts at the 'start' index and goes up to the 'stop' index (inclusive).
+// If 'start' is greater than 'stop' or the key does not exist, an empty slice is returned.
+// The results include scores along with members in the format [member1, score1, member2, score2, ...].
+//
+// Parameters:
+//   - key:   The key associated with the sorted set.
+//   - start: The starting index of the range.
+//   - stop:  The ending index of the range.
+//
+// Returns:
+//   - A slice of interfaces containing the selected elements with scores within the specified range.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	zset.ZAdd("mySortedSet", 4.0, "member3", "value3")
+//	result := zset.ZRangeWithScore("mySortedSet", 0, 1)
+//
+// In this example, we create a sorted set "mySortedSet" and add three members. ZRangeWithScores is used to retrieve elements with scores within the range [0, 1]. The result will be a slice containing the elements "member2," its score 2.0, "member1," and its score 3.5.
+func (z *ZSet) ZRangeWithScore(key string, start, stop int) []interface{} {
+	result, _ := z.ZRangeQuery(key, RangeByRank(start, stop).WithScores())
+	return result
+}
+
+// ZRevRange returns a range of elements in reverse order from the sorted set at the given key.
+//
+// It starts at the 'start' index and goes down to the 'stop' index (inclusive).
+// If 'start' is greater than 'stop' or the key does not exist, an empty slice is returned.
+//
+// Parameters:
+//   - key:   The key associated with the sorted set.
+//   - start: The starting index of the range.
+//   - stop:  The ending index of the range.
+//
+// Returns:
+//   - A slice of interfaces containing the selected elements within the specified range, in reverse order.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	zset.ZAdd("mySortedSet", 4.0, "member3", "value3")
+//	result := zset.ZRevRange("mySortedSet", 1, 0)
+//
+// In this example, we create a sorted set "mySortedSet" and add three members. ZRevRange is used to retrieve elements in reverse order within the range [1, 0]. The result will be a slice containing the elements "member1" and "member2" in reverse order.
+func (z *ZSet) ZRevRange(key string, start, stop int) []interface{} {
+	result, _ := z.ZRangeQuery(key, RangeByRank(start, stop).Rev())
+	return result
+}
+
+// ZRevRangeWithScore returns a range of elements with scores in reverse order from the sorted set at the given key.
+//
+// It starts at the 'start' index and goes down to the 'stop' index (inclusive).
+// If 'start' is greater than 'stop' or the key does not exist, an empty slice is returned.
+// The results include scores along with members in the format [member1, score1, member2, score2, ...], in reverse order.
+//
+// Parameters:
+//   - key:   The key associated with the sorted set.
+//   - start: The starting index of the range.
+//   - stop:  The ending index of the range.
+//
+// Returns:
+//   - A slice of interfaces containing the selected elements with scores within the specified range, in reverse order.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	zset.ZAdd("mySortedSet", 4.0, "member3", "value3")
+//	result := zset.ZRevRangeWithScore("mySortedSet", 1, 0)
+//
+// In this example, we create a sorted set "mySortedSet" and add three members. ZRevRangeWithScores is used to retrieve elements with scores in reverse order within the range [1, 0]. The result will be a slice containing the elements "member2" with its score 2.0 and "member1" with its score 3.5, in reverse order.
+func (z *ZSet) ZRevRangeWithScore(key string, start, stop int) []interface{} {
+	result, _ := z.ZRangeQuery(key, RangeByRank(start, stop).Rev().WithScores())
+	return result
+}
+
+// ZRangeByLex returns the members of the sorted set at the given key that fall between min and max lexicographically.
+//
+// It is meant for sorted sets where all members share the same score, so that they are ordered by
+// member name. Bounds use the Redis syntax: "[member" is inclusive, "(member" is exclusive, and "-"
+// and "+" stand for the lowest and highest possible members. The first 'offset' matching members are
+// skipped and at most 'count' members are returned; a negative count returns all remaining members.
+//
+// Parameters:
+//   - key:    The key associated with the sorted set.
+//   - min:    The lower bound of the range.
+//   - max:    The upper bound of the range.
+//   - offset: The number of matching members to skip.
+//   - count:  The maximum number of members to return, or a negative number for no limit.
+//
+// Returns:
+//   - A slice of interfaces containing the members within the range, in lexicographic order.
+//   - ErrInvalidLexRange if min or max is not a valid bound.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 0, "apple", nil)
+//	zset.ZAdd("mySortedSet", 0, "apricot", nil)
+//	zset.ZAdd("mySortedSet", 0, "banana", nil)
+//	result, err := zset.ZRangeByLex("mySortedSet", "[ap", "(b", 0, -1)
+//
+// In this example, we create a sorted set "mySortedSet" with three members of score 0. ZRangeByLex is used to retrieve the members starting with "ap", and the result will be a slice containing "apple" and "apricot".
+func (z *ZSet) ZRangeByLex(key, min, max string, offset, count int) ([]interface{}, error) {
+	return z.ZRangeQuery(key, RangeByLex(min, max).Limit(offset, count))
+}
+
+// ZRevRangeByLex returns the members of the sorted set at the given key that fall between max and min lexicographically,
+// ordered from the highest member to the lowest.
+//
+// Bounds, offset and count behave as in ZRangeByLex, except that max comes before min and the offset
+// is counted from the highest matching member.
+//
+// Parameters:
+//   - key:    The key associated with the sorted set.
+//   - max:    The upper bound of the range.
+//   - min:    The lower bound of the range.
+//   - offset: The number of matching members to skip.
+//   - count:  The maximum number of members to return, or a negative number for no limit.
+//
+// Returns:
+//   - A slice of interfaces containing the members within the range, in reverse lexicographic order.
+//   - ErrInvalidLexRange if max or min is not a valid bound.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 0, "apple", nil)
+//	zset.ZAdd("mySortedSet", 0, "apricot", nil)
+//	zset.ZAdd("mySortedSet", 0, "banana", nil)
+//	result, err := zset.ZRevRangeByLex("mySortedSet", "+", "[apricot", 0, -1)
+//
+// In this example, ZRevRangeByLex is used to retrieve the members from "apricot" upwards in reverse order, and the result will be a slice containing "banana" and "apricot".
+func (z *ZSet) ZRevRangeByLex(key, max, min string, offset, count int) ([]interface{}, error) {
+	return z.ZRangeQuery(key, RangeByLex(max, min).Rev().Limit(offset, count))
+}
+
+// ZRetrieveByRank retrieves the member and score at the specified rank from the sorted set stored at the given key.
+//
+// If the key does not exist or the provided rank is out of bounds, it returns an empty slice.
+//
+// Parameters:
+//   - key:   The key associated with the sorted set.
+//   - rank:  The rank of the member to retrieve (0-based).
+//
+// Returns:
+//   - A slice of interfaces containing the member and score at the specified rank.
+//   - The slice is empty if the key does not exist or if the rank is out of bounds.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	result := zset.ZRetrieveByRank("mySortedSet", 0)
+//
+// In this example, we create a sorted set "mySortedSet" and add two members. ZRetrieveByRank is then used to retrieve the member and score at rank 0, resulting in the slice ["member2", 2.0].
+func (z *ZSet) ZRetrieveByRank(key string, rank int) []interface{} {
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
+		return []interface{}{}
+	}
+
+	entry, ok := set.entryByRank(int64(rank), false)
+	if !ok {
+		return []interface{}{"", float64(math.MinInt64)}
+	}
+
+	return []interface{}{entry.Member, entry.Score}
+}
+
+// ZRevRetrieveByRank retrieves the member and score at the specified reverse rank from the sorted set stored at the given key.
+//
+// If the key does not exist or the provided rank is out of bounds, it returns an empty slice.
+//
+// Parameters:
+//   - key:   The key associated with the sorted set.
+//   - rank:  The reverse rank of the member to retrieve (0-based).
+//
+// Returns:
+//   - A slice of interfaces containing the member and score at the specified reverse rank.
+//   - The slice is empty if the key does not exist or if the rank is out of bounds.
+//
+// Example:
+//
+//	zset := jellyzset.New()
+//	zset.ZAdd("mySortedSet", 3.5, "member1", "value1")
+//	zset.ZAdd("mySortedSet", 2.0, "member2", "value2")
+//	result := zset.ZRevRetrieveByRank("mySortedSet", 0)
+//
+// In this example, we create a sorted set "mySortedSet" and add two members. ZRevRetrieveByRank is then used to retrieve the member and score at reverse rank 0, resulting in the slice ["member1", 3.5].
+func (z *ZSet) ZRevRetrieveByRank(key string, rank int) []interface{} {
+	set, unlock := z.readKey(key)
+	defer unlock()
+
+	if set == nil {
+		return []interface{}{}
+	}
+
+	entry, ok := set.entryByRank(int64(rank), true)
+	if !ok {
+		return []interface{}{"", float64(math.MinInt64)}
+	}
+
+	return []interface{}{entry.Member, entry.Score}
+}
+
+// toEntries converts ZMember tuples to the entries taken by the TypedZSet methods.
+func toEntries(members []ZMember) []Entry[interface{}] {
+	entries := make([]Entry[interface{}], len(members))
+	for i, m := range members {
+		entries[i] = Entry[interface{}]{Member: m.Member, Score: m.Score, Value: m.Value}
+	}
+
+	return entries
+}
+
+// flattenEntries returns entries in the format [member1, score1, member2, score2, ...],
+// or [member1, member2, ...] when withScores is false.
+func flattenEntries(entries []Entry[interface{}], withScores bool) []interface{} {
+	size := len(entries)
+	if withScores {
+		size *= 2
+	}
+
+	result := make([]interface{}, 0, size)
+	for _, e := range entries {
+		if withScores {
+			result = append(result, e.Member, e.Score)
+		} else {
+			result = append(result, e.Member)
+		}
+	}
+
+	return result
+}